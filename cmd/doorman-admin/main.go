@@ -4,15 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/airenas/api-doorman/internal/pkg/admin"
+	"github.com/airenas/api-doorman/internal/pkg/archive"
+	"github.com/airenas/api-doorman/internal/pkg/bruteforce"
 	"github.com/airenas/api-doorman/internal/pkg/handler"
 	"github.com/airenas/api-doorman/internal/pkg/integration/cms"
 	"github.com/airenas/api-doorman/internal/pkg/model"
 	"github.com/airenas/api-doorman/internal/pkg/model/permission"
 	"github.com/airenas/api-doorman/internal/pkg/postgres"
+	"github.com/airenas/api-doorman/internal/pkg/randkey"
 	"github.com/airenas/api-doorman/internal/pkg/reset"
+	"github.com/airenas/api-doorman/internal/pkg/trial"
 	"github.com/airenas/api-doorman/internal/pkg/utils"
 	"github.com/airenas/go-app/pkg/goapp"
 	"github.com/labstack/gommon/color"
@@ -42,7 +47,7 @@ func mainInt(ctx context.Context) error {
 	}
 	defer db.Close()
 
-	hasher, err := utils.NewHasher(goapp.Config.GetString("hashSalt"))
+	hasher, err := utils.NewConfigHasher(goapp.Config.GetString("hashSecrets"), goapp.Config.GetString("hashSalt"))
 	if err != nil {
 		return fmt.Errorf("init hasher: %w", err)
 	}
@@ -56,8 +61,21 @@ func mainInt(ctx context.Context) error {
 	data.Hasher = hasher
 	data.Port = goapp.Config.GetInt("port")
 	data.UsageRestorer = repo
-	data.OneKeyGetter, data.LogProvider = repo, repo
-	authmw, err := handler.NewAuthMiddleware(repo)
+	data.OneKeyGetter, data.KeyGetter, data.LogProvider = repo, repo, repo
+	data.AdminManager = repo
+	data.Purger = repo
+	data.PurgeMinRetention = goapp.Config.GetDuration("archive.minRetention")
+	data.HashReporter = repo
+	store, err := bruteforce.NewStoreFromConfig(goapp.Config)
+	if err != nil {
+		return fmt.Errorf("init counter store: %w", err)
+	}
+	guard, guards, err := initGuards(goapp.Config, store)
+	if err != nil {
+		return fmt.Errorf("init brute force guards: %w", err)
+	}
+	data.BlockManager = guards
+	authmw, err := handler.NewAuthMiddleware(repo, guard)
 	if err != nil {
 		return fmt.Errorf("init auth middleware: %w", err)
 	}
@@ -74,13 +92,29 @@ func mainInt(ctx context.Context) error {
 	data.CmsData = &cms.Data{}
 	data.CmsData.ProjectValidator = pv
 
-	cms, err := postgres.NewCMSRepository(ctx, db, goapp.Config.GetInt("keySize"), hasher)
+	dayLocation, err := time.LoadLocation(goapp.Config.GetString("usage.dayTimeZone"))
+	if err != nil {
+		return fmt.Errorf("init usage time zone: %w", err)
+	}
+	keyFormat, err := randkey.NewFormat(goapp.Config.GetString("keyPrefix"), goapp.Config.GetInt("keySize"))
+	if err != nil {
+		return fmt.Errorf("init key format: %w", err)
+	}
+	log.Info().Str("prefix", goapp.Config.GetString("keyPrefix")).Msg("Key format")
+	cms, err := postgres.NewCMSRepository(ctx, db, keyFormat, hasher, dayLocation)
 	if err != nil {
 		return fmt.Errorf("init integrator: %w", err)
 	}
 	data.CmsData.Integrator = cms
+	data.CmsData.UsageMaxRange = goapp.Config.GetDuration("usage.maxRange")
+	data.CmsData.UsageMaxLogs = goapp.Config.GetInt("usage.maxLogs")
+
+	data.TrialData, err = initTrial(goapp.Config, cms, repo, store)
+	if err != nil {
+		return fmt.Errorf("init trial: %w", err)
+	}
 
-	utils.DefaultIPExtractor, err = utils.NewIPExtractor(goapp.Config.GetString("ipExtractType"))
+	utils.DefaultIPExtractor, err = utils.NewIPExtractor(goapp.Config.GetString("ipExtractType"), goapp.Config.GetString("trustedProxies"))
 	if err != nil {
 		return fmt.Errorf("init IP extractor: %w", err)
 	}
@@ -101,6 +135,10 @@ func mainInt(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("start timer: %w", err)
 	}
+	archiveDoneCh, err := startArchiveTimer(ctxTimer, config, repo, pv.Projects())
+	if err != nil {
+		return fmt.Errorf("start archive timer: %w", err)
+	}
 
 	if err := tryAddInitialAdmin(ctx, config, repo, pv.Projects()); err != nil {
 		return err
@@ -111,15 +149,97 @@ func mainInt(ctx context.Context) error {
 		return fmt.Errorf("start web server: %w", err)
 	}
 	cancelFunc()
-	select {
-	case <-doneCh:
-		log.Info().Msg("All code returned. Now exit. Bye")
-	case <-time.After(time.Second * 15):
-		log.Warn().Msg("Timeout graceful shutdown")
+	timeout := time.After(time.Second * 15)
+	for _, ch := range []<-chan struct{}{doneCh, archiveDoneCh} {
+		select {
+		case <-ch:
+		case <-timeout:
+			log.Warn().Msg("Timeout graceful shutdown")
+			return nil
+		}
 	}
+	log.Info().Msg("All code returned. Now exit. Bye")
 	return nil
 }
 
+// startArchiveTimer starts archiving of expired keys if archive.expiredFor or archive.purgeAfter is configured
+func startArchiveTimer(ctx context.Context, config *viper.Viper, repo archive.Archiver, projects []string) (<-chan struct{}, error) {
+	aData := archive.TimerData{Archiver: repo, Projects: projects}
+	aData.ExpiredFor = config.GetDuration("archive.expiredFor")
+	aData.PurgeAfter = config.GetDuration("archive.purgeAfter")
+	aData.MinRetention = config.GetDuration("archive.minRetention")
+	aData.IPKeyIdleFor = config.GetDuration("archive.ipKeyIdleFor")
+	aData.Interval = config.GetDuration("archive.interval")
+	if aData.Interval == 0 {
+		aData.Interval = 24 * time.Hour
+	}
+	if aData.ExpiredFor == 0 && aData.PurgeAfter == 0 && aData.IPKeyIdleFor == 0 {
+		log.Info().Msg("Archive timer disabled")
+		res := make(chan struct{})
+		close(res)
+		return res, nil
+	}
+	return archive.StartTimer(ctx, &aData)
+}
+
+// initGuards returns the admin token guard, nil if it is not configured, and the guards for managing blocks.
+// Proxy blocks are managed only with the redis store shared with the proxy, a memory store can't see them
+func initGuards(cfg *viper.Viper, store bruteforce.Store) (handler.FailureGuard, bruteforce.Guards, error) {
+	adminGuard, err := bruteforce.NewGuardFromConfig("admin", cfg, store)
+	if err != nil {
+		return nil, nil, err
+	}
+	guards := bruteforce.Guards{adminGuard}
+	if cfg.GetString("bruteForce.url") != "" {
+		proxyGuard, err := bruteforce.NewGuardFromConfig("proxy", cfg, store)
+		if err != nil {
+			return nil, nil, err
+		}
+		guards = append(guards, proxyGuard)
+	} else {
+		log.Warn().Msg("No bruteForce.url, proxy blocks are not managed")
+	}
+	if !adminGuard.Enabled() {
+		log.Info().Msg("No brute force guard")
+		return nil, guards, nil
+	}
+	log.Info().Msg(adminGuard.Info("Brute force: "))
+	return adminGuard, guards, nil
+}
+
+// initTrial returns the trial keys data, nil if trial.adminID is not configured.
+// Issuance caps are shared between instances only if they use the same redis store
+func initTrial(cfg *viper.Viper, creator trial.KeyCreator, users trial.UserLoader, store bruteforce.Store) (*trial.Data, error) {
+	adminID := cfg.GetString("trial.adminID")
+	if adminID == "" {
+		log.Info().Msg("No trial keys")
+		return nil, nil
+	}
+	challenger, err := trial.NewChallenger(cfg.GetString("trial.secret"), cfg.GetInt("trial.difficulty"), cfg.GetDuration("trial.challengeTTL"))
+	if err != nil {
+		return nil, err
+	}
+	res := &trial.Data{Challenger: challenger, Creator: creator, Users: users, Counter: store, AdminID: adminID}
+	for _, p := range strings.Split(cfg.GetString("trial.projects"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			res.Projects = append(res.Projects, p)
+		}
+	}
+	res.Plan = trial.Plan{
+		Credits:     cfg.GetFloat64("trial.credits"),
+		ValidFor:    cfg.GetDuration("trial.validFor"),
+		PerIP:       cfg.GetInt64("trial.perIP"),
+		PerIPWindow: cfg.GetDuration("trial.perIPWindow"),
+		PerDay:      cfg.GetInt64("trial.perDay"),
+	}
+	if err := res.Validate(); err != nil {
+		return nil, err
+	}
+	log.Info().Strs("projects", res.Projects).Str("admin", adminID).Float64("credits", res.Plan.Credits).
+		Dur("validFor", res.Plan.ValidFor).Msg(challenger.Info("Trial keys: "))
+	return res, nil
+}
+
 func tryAddInitialAdmin(ctx context.Context, config *viper.Viper, repo *postgres.AdminRepository, projects []string) error {
 	key := config.GetString("mainAdmin.key")
 	if key == "" {
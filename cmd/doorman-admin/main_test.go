@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/airenas/api-doorman/internal/pkg/bruteforce"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
@@ -19,3 +20,15 @@ func Test_initProjectReset(t *testing.T) {
 	assert.Equal(t, 600.0, res["asr"])
 	assert.Equal(t, 2000.0, res["tts"])
 }
+
+func Test_initGuards(t *testing.T) {
+	v := viper.New()
+	_, guards, err := initGuards(v, bruteforce.NewMemoryStore())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(guards), "no proxy guard without a shared store")
+
+	v.Set("bruteForce.url", "localhost:6379")
+	_, guards, err = initGuards(v, bruteforce.NewMemoryStore())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(guards))
+}
@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/airenas/api-doorman/internal/pkg/bruteforce"
+	"github.com/airenas/api-doorman/internal/pkg/handler"
 	"github.com/airenas/api-doorman/internal/pkg/postgres"
+	"github.com/airenas/api-doorman/internal/pkg/randkey"
 	"github.com/airenas/api-doorman/internal/pkg/utils"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -21,6 +26,7 @@ import (
 	"github.com/airenas/go-app/pkg/goapp"
 	"github.com/labstack/gommon/color"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 )
 
@@ -58,11 +64,23 @@ func mainInt(ctx context.Context) error {
 	defer db.Close()
 
 	hd := &service.HandlerData{DB: db}
-	hd.Hasher, err = utils.NewHasher(goapp.Config.GetString("hashSalt"))
+	hd.Hasher, err = utils.NewConfigHasher(goapp.Config.GetString("hashSecrets"), goapp.Config.GetString("hashSalt"))
 	if err != nil {
 		return fmt.Errorf("init hasher: %w", err)
 	}
 
+	hd.KeyPrefixes, err = randkey.ParsePrefixes(goapp.Config.GetString("keyPrefixes"))
+	if err != nil {
+		return fmt.Errorf("init key prefixes: %w", err)
+	}
+	hd.Guard, err = initGuard(goapp.Config)
+	if err != nil {
+		return fmt.Errorf("init brute force guard: %w", err)
+	}
+	if err := startMetrics(goapp.Config.GetInt("metricsPort")); err != nil {
+		return fmt.Errorf("start metrics: %w", err)
+	}
+
 	data := service.Data{}
 	data.Handlers, err = initFromConfig(goapp.Sub(goapp.Config, "proxy"), hd)
 	if err != nil {
@@ -70,7 +88,7 @@ func mainInt(ctx context.Context) error {
 	}
 	data.Port = goapp.Config.GetInt("port")
 
-	utils.DefaultIPExtractor, err = utils.NewIPExtractor(goapp.Config.GetString("ipExtractType"))
+	utils.DefaultIPExtractor, err = utils.NewIPExtractor(goapp.Config.GetString("ipExtractType"), goapp.Config.GetString("trustedProxies"))
 	if err != nil {
 		return fmt.Errorf("init IP extractor: %w", err)
 	}
@@ -103,6 +121,45 @@ func initFromConfig(cfg *viper.Viper, hd *service.HandlerData) ([]service.Handle
 	return res, nil
 }
 
+// initGuard returns nil if the guard is not configured
+func initGuard(cfg *viper.Viper) (handler.FailureGuard, error) {
+	store, err := bruteforce.NewStoreFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bruteforce.NewGuardFromConfig("proxy", cfg, store)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Enabled() {
+		log.Info().Msg("No brute force guard")
+		return nil, nil
+	}
+	log.Info().Msg(res.Info("Brute force: "))
+	return res, nil
+}
+
+// startMetrics serves prometheus metrics on a separate port, so the proxied paths are not affected
+func startMetrics(port int) error {
+	if port == 0 {
+		log.Info().Msg("No metrics port")
+		return nil
+	}
+	if port < 0 {
+		return fmt.Errorf("wrong metrics port %d", port)
+	}
+	log.Info().Int("port", port).Msg("Starting metrics service")
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Addr: ":" + strconv.Itoa(port), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			log.Error().Err(err).Msg("metrics service stopped")
+		}
+	}()
+	return nil
+}
+
 var (
 	version string
 )
@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/airenas/api-doorman/internal/pkg/admin"
 	"github.com/airenas/api-doorman/internal/pkg/migration"
 	"github.com/airenas/api-doorman/internal/pkg/migration/api"
 	"github.com/airenas/api-doorman/internal/pkg/postgres"
+	"github.com/airenas/api-doorman/internal/pkg/randkey"
 	"github.com/airenas/api-doorman/internal/pkg/utils"
 	"github.com/airenas/go-app/pkg/goapp"
 	"github.com/labstack/gommon/color"
@@ -38,7 +40,7 @@ func mainInt(ctx context.Context) error {
 	}
 	defer db.Close()
 
-	hasher, err := utils.NewHasher(config.GetString("hashSalt"))
+	hasher, err := utils.NewConfigHasher(config.GetString("hashSecrets"), config.GetString("hashSalt"))
 	if err != nil {
 		return fmt.Errorf("init hasher: %w", err)
 	}
@@ -61,7 +63,11 @@ func mainInt(ctx context.Context) error {
 	mData.DryRun = !config.GetBool("commit")
 	log.Info().Str("project", mData.Project).Msg("Project")
 
-	mData.CmsRepo, err = postgres.NewCMSRepository(ctx, db, config.GetInt("keySize"), hasher)
+	keyFormat, err := randkey.NewFormat(config.GetString("keyPrefix"), config.GetInt("keySize"))
+	if err != nil {
+		return fmt.Errorf("init key format: %w", err)
+	}
+	mData.CmsRepo, err = postgres.NewCMSRepository(ctx, db, keyFormat, hasher, time.UTC)
 	if err != nil {
 		return fmt.Errorf("init integrator: %w", err)
 	}
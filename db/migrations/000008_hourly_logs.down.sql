@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_hourly_logs_key_id;
+DROP MATERIALIZED VIEW IF EXISTS hourly_logs;
+ALTER TABLE logs DROP COLUMN IF EXISTS route;
@@ -0,0 +1,32 @@
+-- route name of the proxy handler, used for stats breakdown
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS route TEXT;
+
+-- hourly_logs materialized view, buckets in UTC,
+-- any time zone buckets are calculated from it at query time
+CREATE MATERIALIZED VIEW hourly_logs
+WITH (timescaledb.continuous) AS
+SELECT 
+    time_bucket('1 hour', date) AS hour,
+    key_id,
+    route,
+    response_code,
+    COUNT(*) AS request_count,
+    COUNT(*) FILTER (WHERE fail) AS failed_requests,
+    SUM(quota_value) FILTER (WHERE fail) AS failed_quota,
+    SUM(quota_value) FILTER (WHERE NOT fail) AS used_quota
+FROM logs
+GROUP BY hour, key_id, route, response_code
+WITH NO DATA;
+
+-- add continuous aggregate policy, recalculate every 30 minutes
+-- start_offset covers logs retention, so the first run materializes the old logs
+-- and the dropped chunks are never refreshed
+SELECT add_continuous_aggregate_policy('hourly_logs',
+    start_offset => INTERVAL '190 day',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes');
+
+-- turn realtime select feature on
+ALTER MATERIALIZED VIEW hourly_logs set (timescaledb.materialized_only = false);
+
+CREATE INDEX idx_hourly_logs_key_id ON hourly_logs (key_id);
@@ -0,0 +1,17 @@
+-- administrator changes audit
+
+BEGIN;
+
+-- Keeps changes of administrators and who did them
+CREATE TABLE administrator_operations (
+    id TEXT NOT NULL PRIMARY KEY,
+    adm_id TEXT NOT NULL,
+    date TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    msg TEXT,
+    data JSONB
+);
+
+ALTER TABLE administrator_operations ADD CONSTRAINT fk_administrator_operations_adm_id FOREIGN KEY (adm_id) REFERENCES administrators (id);
+CREATE INDEX idx_administrator_operations_adm_id ON administrator_operations (adm_id);
+
+END;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_operations_data_adm_id;
+DROP TABLE IF EXISTS administrator_budgets;
+DROP INDEX IF EXISTS idx_administrators_parent_id;
+ALTER TABLE administrators DROP CONSTRAINT IF EXISTS fk_administrators_parent_id;
+ALTER TABLE administrators DROP COLUMN IF EXISTS parent_id;
+
+END;
@@ -0,0 +1,24 @@
+-- administrators hierarchy and budgets
+
+BEGIN;
+
+ALTER TABLE administrators ADD COLUMN parent_id TEXT;
+ALTER TABLE administrators ADD CONSTRAINT fk_administrators_parent_id FOREIGN KEY (parent_id) REFERENCES administrators (id);
+CREATE INDEX idx_administrators_parent_id ON administrators (parent_id);
+
+-- Keeps credits an administrator (with children) can assign to keys of the project per period
+CREATE TABLE administrator_budgets (
+    adm_id TEXT NOT NULL,
+    project TEXT NOT NULL,
+    budget DOUBLE PRECISION NOT NULL,
+    period TEXT NOT NULL,
+
+    PRIMARY KEY (adm_id, project)
+);
+
+ALTER TABLE administrator_budgets ADD CONSTRAINT fk_administrator_budgets_adm_id FOREIGN KEY (adm_id) REFERENCES administrators (id);
+
+-- budget usage is calculated from operations made by administrators
+CREATE INDEX idx_operations_data_adm_id ON operations ((data->>'adm_id'), date);
+
+END;
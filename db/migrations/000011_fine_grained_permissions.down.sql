@@ -0,0 +1,13 @@
+-- removes fine-grained permissions
+
+BEGIN;
+
+UPDATE administrators
+SET permissions = ARRAY(
+    SELECT p FROM unnest(permissions) AS p
+    WHERE p <> ALL(ARRAY['KeyRead', 'KeyCreate', 'KeyUpdate', 'KeyRotate', 'CreditsAdd', 'CreditsRemove',
+        'UsageRead', 'StatsRead', 'LogsRead', 'ReadOnly', 'KeyManager'])
+)
+WHERE permissions IS NOT NULL;
+
+END;
@@ -0,0 +1,12 @@
+-- fine-grained permissions, existing administrators keep their effective rights
+
+BEGIN;
+
+UPDATE administrators
+SET permissions = ARRAY(
+    SELECT DISTINCT unnest(COALESCE(permissions, '{}') || ARRAY['KeyRead', 'KeyCreate', 'KeyUpdate', 'KeyRotate',
+        'CreditsAdd', 'CreditsRemove', 'UsageRead', 'StatsRead', 'LogsRead'])
+)
+WHERE NOT ('Everything' = ANY(COALESCE(permissions, '{}')));
+
+END;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_keys_archived;
+ALTER TABLE keys DROP COLUMN IF EXISTS archived;
+
+END;
@@ -0,0 +1,8 @@
+-- archived keys, they are invalid and hidden from listings, but history is kept
+
+BEGIN;
+
+ALTER TABLE keys ADD COLUMN archived TIMESTAMPTZ;
+CREATE INDEX idx_keys_archived ON keys (archived) WHERE archived IS NOT NULL;
+
+END;
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE logs DROP COLUMN IF EXISTS old_key;
+DROP INDEX IF EXISTS uidx_keys_project_old_key_manual;
+ALTER TABLE keys DROP COLUMN IF EXISTS old_key_valid_to;
+ALTER TABLE keys DROP COLUMN IF EXISTS old_key_hash;
+
+END;
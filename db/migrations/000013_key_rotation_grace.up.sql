@@ -0,0 +1,12 @@
+-- key rotation with grace period, the old key stays valid until old_key_valid_to
+
+BEGIN;
+
+ALTER TABLE keys ADD COLUMN old_key_hash TEXT;
+ALTER TABLE keys ADD COLUMN old_key_valid_to TIMESTAMPTZ;
+CREATE UNIQUE INDEX uidx_keys_project_old_key_manual ON keys (project, old_key_hash, manual) WHERE old_key_hash IS NOT NULL;
+
+-- marks requests made with the old key
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS old_key BOOLEAN NOT NULL DEFAULT FALSE;
+
+END;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE administrators DROP COLUMN IF EXISTS hash_version;
+ALTER TABLE keys DROP COLUMN IF EXISTS hash_version;
+
+END;
@@ -0,0 +1,8 @@
+-- version of the secret used for key_hash, existing hashes are made with hashSalt - version 1
+
+BEGIN;
+
+ALTER TABLE keys ADD COLUMN hash_version INT NOT NULL DEFAULT 1;
+ALTER TABLE administrators ADD COLUMN hash_version INT NOT NULL DEFAULT 1;
+
+END;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS anonymous_usage;
+DROP INDEX IF EXISTS idx_keys_project_ip_net;
+ALTER TABLE keys DROP COLUMN IF EXISTS ip_net;
+
+END;
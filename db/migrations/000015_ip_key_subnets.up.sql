@@ -0,0 +1,29 @@
+-- anonymous keys by IP subnet: the network of an IP key and the daily usage of all anonymous keys of a project
+
+BEGIN;
+
+ALTER TABLE keys ADD COLUMN ip_net INET;
+
+-- existing IP keys, values not parsable as IP are left without the network
+CREATE FUNCTION tmp_try_inet(s TEXT) RETURNS INET AS $$
+BEGIN
+    RETURN s::INET;
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE keys SET ip_net = tmp_try_inet(key_hash) WHERE manual = FALSE;
+
+DROP FUNCTION tmp_try_inet(TEXT);
+
+CREATE INDEX idx_keys_project_ip_net ON keys USING GIST (ip_net inet_ops) WHERE manual = FALSE;
+
+CREATE TABLE anonymous_usage (
+    project TEXT NOT NULL,
+    day DATE NOT NULL,
+    quota_value DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (project, day)
+);
+
+END;
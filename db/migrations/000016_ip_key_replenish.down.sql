@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_keys_project_ip_last_used;
+ALTER TABLE keys DROP COLUMN IF EXISTS replenished_at;
+
+END;
@@ -0,0 +1,10 @@
+-- lazy replenishment of anonymous IP keys, the time up to which the key was replenished
+
+BEGIN;
+
+ALTER TABLE keys ADD COLUMN replenished_at TIMESTAMPTZ;
+
+-- for garbage collection of idle IP keys
+CREATE INDEX idx_keys_project_ip_last_used ON keys (project, COALESCE(last_used, created)) WHERE manual = FALSE;
+
+END;
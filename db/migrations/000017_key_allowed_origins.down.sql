@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE keys DROP COLUMN IF EXISTS allowed_origins;
+
+END;
@@ -0,0 +1,7 @@
+-- publishable keys: allowed Origin/Referer patterns of browser requests
+
+BEGIN;
+
+ALTER TABLE keys ADD COLUMN allowed_origins TEXT[];
+
+END;
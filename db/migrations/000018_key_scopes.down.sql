@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE administrators DROP COLUMN IF EXISTS allowed_scopes;
+ALTER TABLE keys DROP COLUMN IF EXISTS scopes;
+
+END;
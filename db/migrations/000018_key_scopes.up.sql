@@ -0,0 +1,8 @@
+-- keys restricted to routes, paths and methods, administrators may assign only allowed scopes
+
+BEGIN;
+
+ALTER TABLE keys ADD COLUMN scopes TEXT[];
+ALTER TABLE administrators ADD COLUMN allowed_scopes TEXT[];
+
+END;
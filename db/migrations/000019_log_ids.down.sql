@@ -0,0 +1,8 @@
+BEGIN;
+
+SELECT delete_job(job_id) FROM timescaledb_information.jobs WHERE proc_name = 'backfill_log_ids';
+DROP PROCEDURE IF EXISTS backfill_log_ids(INT, JSONB);
+ALTER TABLE logs DROP COLUMN IF EXISTS id;
+DROP SEQUENCE IF EXISTS logs_id_seq;
+
+END;
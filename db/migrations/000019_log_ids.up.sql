@@ -0,0 +1,36 @@
+-- unique log ids, a tiebreaker of the logs paging cursor.
+-- The column is added without a default, so the logs chunks are not rewritten:
+-- new logs get ids by the default set afterwards, the old ones are filled by the backfill_log_ids job
+
+BEGIN;
+
+CREATE SEQUENCE IF NOT EXISTS logs_id_seq AS BIGINT;
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS id BIGINT;
+ALTER SEQUENCE logs_id_seq OWNED BY logs.id;
+ALTER TABLE logs ALTER COLUMN id SET DEFAULT nextval('logs_id_seq');
+
+-- fills the ids by one hour batches from the oldest logs, so it goes chunk by chunk,
+-- every batch is committed. When all logs have ids, it sets NOT NULL and unschedules itself.
+-- A failed or interrupted run continues from the first batch with missing ids on the next schedule
+CREATE OR REPLACE PROCEDURE backfill_log_ids(job_id INT, config JSONB)
+LANGUAGE plpgsql AS $$
+DECLARE
+    step INTERVAL := COALESCE((config->>'step')::INTERVAL, INTERVAL '1 hour');
+    at TIMESTAMPTZ;
+    till TIMESTAMPTZ;
+BEGIN
+    SELECT date_trunc('hour', MIN(date)), MAX(date) INTO at, till FROM logs;
+    WHILE at <= till LOOP
+        UPDATE logs SET id = nextval('logs_id_seq')
+        WHERE date >= at AND date < at + step AND id IS NULL;
+        COMMIT;
+        at := at + step;
+    END LOOP;
+    ALTER TABLE logs ALTER COLUMN id SET NOT NULL;
+    PERFORM alter_job(job_id, scheduled => FALSE);
+END
+$$;
+
+SELECT add_job('backfill_log_ids', INTERVAL '1 hour', config => '{"step": "1 hour"}');
+
+END;
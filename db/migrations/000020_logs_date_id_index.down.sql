@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_logs_date_id;
@@ -0,0 +1,2 @@
+-- index of the logs paging cursor, built in a transaction per chunk, so logs inserts are not blocked for long
+CREATE INDEX IF NOT EXISTS idx_logs_date_id ON logs (date, id) WITH (timescaledb.transaction_per_chunk);
@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	adminapi "github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/airenas/api-doorman/internal/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// AdminManager manages administrators
+type AdminManager interface {
+	CreateAdmin(ctx context.Context, user *model.User, in *adminapi.AdministratorInput) (*adminapi.Administrator, error)
+	ListAdmins(ctx context.Context, user *model.User) ([]*adminapi.Administrator, error)
+	GetAdmin(ctx context.Context, user *model.User, id string) (*adminapi.Administrator, error)
+	UpdateAdmin(ctx context.Context, user *model.User, id string, in *adminapi.AdministratorUpdate) (*adminapi.Administrator, error)
+	RotateAdminKey(ctx context.Context, user *model.User, id string) (*adminapi.Administrator, error)
+}
+
+func initAdminRoutes(e *echo.Echo, data *Data) {
+	e.POST("/admins", adminCreate(data))
+	e.GET("/admins", adminList(data))
+	e.GET("/admins/:id", adminGet(data))
+	e.PATCH("/admins/:id", adminUpdate(data))
+	e.POST("/admins/:id/rotate", adminRotate(data))
+}
+
+// runWithAdminManager checks permission and runs f
+func runWithAdminManager(c echo.Context, f func(*model.User) error) error {
+	return utils.RunWithPermission(c, permission.AdminManage, func(ctx echo.Context, u *model.User) error {
+		return f(u)
+	})
+}
+
+func adminCreate(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return runWithAdminManager(c, func(u *model.User) error {
+			var input adminapi.AdministratorInput
+			if err := utils.TakeJSONInput(c, &input); err != nil {
+				log.Error().Err(err).Send()
+				return err
+			}
+			if err := validateProjects(input.Projects, data.ProjectValidator); err != nil {
+				return err
+			}
+			res, err := data.AdminManager.CreateAdmin(c.Request().Context(), u, &input)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusCreated, res)
+		})
+	}
+}
+
+func adminList(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return runWithAdminManager(c, func(u *model.User) error {
+			res, err := data.AdminManager.ListAdmins(c.Request().Context(), u)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+func adminGet(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return runWithAdminManager(c, func(u *model.User) error {
+			res, err := data.AdminManager.GetAdmin(c.Request().Context(), u, c.Param("id"))
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+func adminUpdate(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return runWithAdminManager(c, func(u *model.User) error {
+			var input adminapi.AdministratorUpdate
+			if err := utils.TakeJSONInput(c, &input); err != nil {
+				log.Error().Err(err).Send()
+				return err
+			}
+			if input.Projects != nil {
+				if err := validateProjects(*input.Projects, data.ProjectValidator); err != nil {
+					return err
+				}
+			}
+			res, err := data.AdminManager.UpdateAdmin(c.Request().Context(), u, c.Param("id"), &input)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+func adminRotate(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return runWithAdminManager(c, func(u *model.User) error {
+			res, err := data.AdminManager.RotateAdminKey(c.Request().Context(), u, c.Param("id"))
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+func validateProjects(projects []string, prV PrValidator) error {
+	for _, p := range projects {
+		if err := validateProject(p, prV); err != nil {
+			log.Error().Err(err).Send()
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	adminapi "github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/airenas/api-doorman/internal/pkg/test/mocks"
+	"github.com/labstack/echo/v4"
+	"github.com/petergtz/pegomock/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newJSONRequest(method, path string, body interface{}) *http.Request {
+	req := httptest.NewRequest(method, path, mocks.ToReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	return req
+}
+
+func TestAdminCreate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		prOK bool
+		err  error
+		want int
+	}{
+		{name: "OK", in: adminapi.AdministratorInput{Name: "a", Projects: []string{"test"}}, prOK: true, want: http.StatusCreated},
+		{name: "Fail project", in: adminapi.AdministratorInput{Name: "a", Projects: []string{"olia"}}, prOK: false,
+			want: http.StatusBadRequest},
+		{name: "Fail input", in: "olia", prOK: true, want: http.StatusBadRequest},
+		{name: "Fail field", in: adminapi.AdministratorInput{Name: "a", Projects: []string{"test"}}, prOK: true,
+			err: model.NewWrongFieldError("name", "missing"), want: http.StatusBadRequest},
+		{name: "Fail access", in: adminapi.AdministratorInput{Name: "a", Projects: []string{"test"}}, prOK: true,
+			err: model.NewNoAccessError("permissions", "Everything"), want: http.StatusForbidden},
+		{name: "Fail", in: adminapi.AdministratorInput{Name: "a", Projects: []string{"test"}}, prOK: true,
+			err: errors.New("olia"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			pegomock.When(prValidarorMock.Check(pegomock.Any[string]())).ThenReturn(tt.prOK)
+			pegomock.When(adminManagerMock.CreateAdmin(pegomock.Any[context.Context](), pegomock.Any[*model.User](),
+				pegomock.Any[*adminapi.AdministratorInput]())).ThenReturn(&adminapi.Administrator{ID: "1", Key: "kkk"}, tt.err)
+			resp := testCode(t, newJSONRequest(http.MethodPost, "/admins", tt.in), tt.want)
+			if tt.want == http.StatusCreated {
+				assert.Contains(t, resp.Body.String(), `"key":"kkk"`)
+			}
+		})
+	}
+}
+
+func TestAdminCreate_FailPermission(t *testing.T) {
+	initTest(t)
+	tData.Auth = newTestAuth(map[permission.Enum]bool{permission.ResetMonthlyUsage: true})
+	tEcho = initRoutes(tData)
+	testCode(t, newJSONRequest(http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "a", Projects: []string{"test"}}),
+		http.StatusForbidden)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/admins", nil), http.StatusForbidden)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/admins/1", nil), http.StatusForbidden)
+	testCode(t, httptest.NewRequest(http.MethodPost, "/admins/1/rotate", nil), http.StatusForbidden)
+}
+
+func TestAdminList(t *testing.T) {
+	initTest(t)
+	pegomock.When(adminManagerMock.ListAdmins(pegomock.Any[context.Context](), pegomock.Any[*model.User]())).
+		ThenReturn([]*adminapi.Administrator{{ID: "1"}, {ID: "2"}}, nil)
+	resp := testCode(t, httptest.NewRequest(http.MethodGet, "/admins", nil), http.StatusOK)
+	assert.Equal(t, `[{"id":"1"},{"id":"2"}]`, strings.TrimSpace(resp.Body.String()))
+}
+
+func TestAdminGet(t *testing.T) {
+	initTest(t)
+	pegomock.When(adminManagerMock.GetAdmin(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Eq("1"))).
+		ThenReturn(&adminapi.Administrator{ID: "1"}, nil)
+	pegomock.When(adminManagerMock.GetAdmin(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Eq("2"))).
+		ThenReturn(nil, model.ErrNoAccess)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/admins/1", nil), http.StatusOK)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/admins/2", nil), http.StatusForbidden)
+}
+
+func TestAdminUpdate(t *testing.T) {
+	initTest(t)
+	pegomock.When(adminManagerMock.UpdateAdmin(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Eq("1"),
+		pegomock.Any[*adminapi.AdministratorUpdate]())).ThenReturn(&adminapi.Administrator{ID: "1", Disabled: true}, nil)
+	resp := testCode(t, newJSONRequest(http.MethodPatch, "/admins/1", map[string]interface{}{"disabled": true, "permissions": []string{}}),
+		http.StatusOK)
+	assert.Contains(t, resp.Body.String(), `"disabled":true`)
+	_, _, _, cIn := adminManagerMock.VerifyWasCalledOnce().UpdateAdmin(pegomock.Any[context.Context](), pegomock.Any[*model.User](),
+		pegomock.Any[string](), pegomock.Any[*adminapi.AdministratorUpdate]()).GetCapturedArguments()
+	assert.True(t, *cIn.Disabled)
+	assert.NotNil(t, cIn.Permissions)
+	assert.Empty(t, *cIn.Permissions)
+	assert.Nil(t, cIn.Projects)
+}
+
+func TestAdminUpdate_FailProject(t *testing.T) {
+	initTest(t)
+	pegomock.When(prValidarorMock.Check(pegomock.Any[string]())).ThenReturn(false)
+	testCode(t, newJSONRequest(http.MethodPatch, "/admins/1", map[string]interface{}{"projects": []string{"olia"}}),
+		http.StatusBadRequest)
+}
+
+func TestAdminRotate(t *testing.T) {
+	initTest(t)
+	pegomock.When(adminManagerMock.RotateAdminKey(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Eq("1"))).
+		ThenReturn(&adminapi.Administrator{ID: "1", Key: "new"}, nil)
+	resp := testCode(t, httptest.NewRequest(http.MethodPost, "/admins/1/rotate", nil), http.StatusOK)
+	assert.Contains(t, resp.Body.String(), `"key":"new"`)
+}
+
+func newTestAuth(perms map[permission.Enum]bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			user := &model.User{Name: "olia",
+				Permissions: perms,
+				Projects:    []string{"test"},
+				MaxLimit:    1000,
+				MaxValidTo:  time.Now().AddDate(1, 0, 0),
+			}
+			c.SetRequest(r.WithContext(context.WithValue(r.Context(), model.CtxUser, user)))
+			return next(c)
+		}
+	}
+}
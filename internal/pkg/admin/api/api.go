@@ -21,12 +21,20 @@ type Key struct {
 	Disabled    bool       `json:"disabled,omitempty"`
 	Description string     `json:"description,omitempty"`
 	Tags        []string   `json:"tags,omitempty"`
+	ExternalID  string     `json:"externalID,omitempty"`
+	AdminID     string     `json:"adminID,omitempty"`
+	Archived    *time.Time `json:"archived,omitempty"`
+	// OldKeyValidTo is set while the previous key is valid after rotation
+	OldKeyValidTo *time.Time `json:"oldKeyValidTo,omitempty"`
+	// AllowedOrigins are set for publishable keys
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
 }
 
 // Log structure for log data
 type Log struct {
 	KeyID        string    `json:"keyID,omitempty"`
 	URL          string    `json:"url,omitempty"`
+	Route        string    `json:"route,omitempty"`
 	QuotaValue   float64   `json:"quotaValue,omitempty"`
 	Date         time.Time `json:"date,omitempty"`
 	IP           string    `json:"ip,omitempty"`
@@ -35,6 +43,8 @@ type Log struct {
 	ResponseCode int       `json:"response,omitempty"`
 	RequestID    string    `json:"requestID,omitempty"`
 	ErrorMsg     string    `json:"errorMsg,omitempty"`
+	// OldKey is set if the request was made with the previous key during the rotation grace period
+	OldKey bool `json:"oldKey,omitempty"`
 }
 
 // KeyInfoResp keep key and logs data
@@ -43,6 +53,165 @@ type KeyInfoResp struct {
 	Logs []*Log `json:"logs,omitempty"`
 }
 
+// LogFilter keeps log query parameters
+type LogFilter struct {
+	Project      string
+	KeyID        string
+	From         *time.Time
+	To           *time.Time
+	ResponseCode int
+	Fail         *bool
+	IP           string
+	RequestID    string
+	Limit        int
+	Cursor       string
+}
+
+// LogListResp keeps one page of logs
+type LogListResp struct {
+	Logs       []*Log `json:"logs"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// KeyFilter keeps key list query parameters
+type KeyFilter struct {
+	Project  string
+	AdminID  string
+	Disabled *bool
+	Expired  *bool
+	// Archived lists only archived keys if true, archived keys are hidden by default
+	Archived bool
+	// Tag is 'key:value' for an exact match or 'key' for any value
+	Tag          string
+	Description  string
+	ExternalID   string
+	LastUsedFrom *time.Time
+	LastUsedTo   *time.Time
+	RemainingMin *float64
+	RemainingMax *float64
+	// Sort is one of created, lastUsed, validTo, remaining, with '-' prefix for descending order
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// KeyListResp keeps one page of keys
+type KeyListResp struct {
+	Keys       []*Key `json:"keys"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// PurgeResult keeps counts of purged records of archived keys
+type PurgeResult struct {
+	Logs       int64 `json:"logs"`
+	Operations int64 `json:"operations"`
+	Keys       int64 `json:"keys"`
+}
+
+// HashReport keeps counts of stored hashes by the hash secret version
+type HashReport struct {
+	CurrentVersion int                `json:"currentVersion"`
+	Keys           []HashVersionCount `json:"keys"`
+	Administrators []HashVersionCount `json:"administrators"`
+	// Legacy is the count of hashes not on the current version
+	Legacy int64 `json:"legacy"`
+}
+
+// HashVersionCount keeps count of hashes of one version
+type HashVersionCount struct {
+	Version int   `json:"version"`
+	Count   int64 `json:"count"`
+}
+
+// Block is an IP blocked for too many failed authentication attempts
+type Block struct {
+	Guard    string    `json:"guard"`
+	IP       string    `json:"ip"`
+	Failures int64     `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+// UnblockResult keeps the count of guards the IP was unblocked in
+type UnblockResult struct {
+	Cleared int `json:"cleared"`
+}
+
 type KeyIn struct {
 	Key string `json:"key,omitempty"`
 }
+
+// Administrator keeps administrator data, Key is returned only after create or rotate
+type Administrator struct {
+	ID          string     `json:"id,omitempty"`
+	ParentID    string     `json:"parentID,omitempty"`
+	Key         string     `json:"key,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Projects    []string   `json:"projects,omitempty"`
+	Permissions []string   `json:"permissions,omitempty"`
+	MaxLimit    float64    `json:"maxLimit,omitempty"`
+	MaxValidTo  *time.Time `json:"maxValidTo,omitempty"`
+	IPWhiteList string     `json:"IPWhiteList,omitempty"`
+	AllowedTags []string   `json:"allowedTags,omitempty"`
+	// AllowedScopes the administrator can assign to keys, see CreateInput.Scopes
+	AllowedScopes []string   `json:"allowedScopes,omitempty"`
+	Budgets       []*Budget  `json:"budgets,omitempty"`
+	Disabled      bool       `json:"disabled,omitempty"`
+	Created       *time.Time `json:"created,omitempty"`
+	Updated       *time.Time `json:"updated,omitempty"`
+}
+
+// AdministratorInput for create administrator request
+type AdministratorInput struct {
+	Name          string     `json:"name,omitempty"`
+	Description   string     `json:"description,omitempty"`
+	Projects      []string   `json:"projects,omitempty"`
+	Permissions   []string   `json:"permissions,omitempty"`
+	MaxLimit      float64    `json:"maxLimit,omitempty"`
+	MaxValidTo    *time.Time `json:"maxValidTo,omitempty"`
+	IPWhiteList   string     `json:"IPWhiteList,omitempty"`
+	AllowedTags   []string   `json:"allowedTags,omitempty"`
+	AllowedScopes []string   `json:"allowedScopes,omitempty"`
+	Budgets       []*Budget  `json:"budgets,omitempty"`
+	Disabled      bool       `json:"disabled,omitempty"`
+}
+
+// AdministratorUpdate for update administrator request, nil fields are not changed
+type AdministratorUpdate struct {
+	Name          *string    `json:"name,omitempty"`
+	Description   *string    `json:"description,omitempty"`
+	Projects      *[]string  `json:"projects,omitempty"`
+	Permissions   *[]string  `json:"permissions,omitempty"`
+	MaxLimit      *float64   `json:"maxLimit,omitempty"`
+	MaxValidTo    *time.Time `json:"maxValidTo,omitempty"`
+	IPWhiteList   *string    `json:"IPWhiteList,omitempty"`
+	AllowedTags   *[]string  `json:"allowedTags,omitempty"`
+	AllowedScopes *[]string  `json:"allowedScopes,omitempty"`
+	Budgets       *[]*Budget `json:"budgets,omitempty"`
+	Disabled      *bool      `json:"disabled,omitempty"`
+}
+
+// Budget limits credits the administrator with all children can assign to the project keys per period
+type Budget struct {
+	Project string  `json:"project,omitempty"`
+	Limit   float64 `json:"limit"`
+	// Period is daily or monthly, the budget renews at the start of each period (UTC)
+	Period string `json:"period,omitempty"`
+	// Used is the amount assigned in the current period
+	Used float64 `json:"used,omitempty"`
+}
+
+// TrialChallenge is a proof-of-work challenge for a trial key. The caller must find a nonce
+// so that sha256(challenge + ":" + nonce) starts with at least Difficulty zero bits
+type TrialChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Algorithm  string    `json:"algorithm"`
+	Difficulty int       `json:"difficulty"`
+	Expires    time.Time `json:"expires"`
+}
+
+// TrialKeyInput is the solved challenge for a trial key request
+type TrialKeyInput struct {
+	Challenge string `json:"challenge,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+}
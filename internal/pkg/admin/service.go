@@ -1,7 +1,10 @@
 package admin
 
 import (
+	"encoding/json"
+	"fmt"
 	slog "log"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,6 +16,7 @@ import (
 	"github.com/airenas/api-doorman/internal/pkg/integration/cms"
 	"github.com/airenas/api-doorman/internal/pkg/model"
 	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/airenas/api-doorman/internal/pkg/trial"
 	"github.com/airenas/api-doorman/internal/pkg/utils"
 	"github.com/airenas/go-app/pkg/goapp"
 	"github.com/facebookgo/grace/gracehttp"
@@ -30,13 +34,31 @@ type (
 	OneKeyRetriever interface {
 		Get(ctx context.Context, user *model.User, id string) (*adminapi.Key, error)
 	}
-	// LogRetriever retrieves one list from db
+	// KeyRetriever lists keys
+	KeyRetriever interface {
+		List(ctx context.Context, user *model.User, filter *adminapi.KeyFilter) (*adminapi.KeyListResp, error)
+	}
+	// LogProvider retrieves logs from db
 	LogProvider interface {
 		GetLogs(ctx context.Context, user *model.User, keyID string) ([]*adminapi.Log, error)
-		ListLogs(ctx context.Context, project string, to time.Time) ([]*adminapi.Log, error)
+		ListLogs(ctx context.Context, user *model.User, filter *adminapi.LogFilter) (*adminapi.LogListResp, error)
+		StreamLogs(ctx context.Context, user *model.User, filter *adminapi.LogFilter, f func(*adminapi.Log) error) error
 		DeleteLogs(ctx context.Context, project string, to time.Time) (int /* count of deleted items*/, error)
 	}
 
+	// KeyPurger purges data of keys archived before the date
+	KeyPurger interface {
+		Purge(ctx context.Context, project string, before time.Time) (*adminapi.PurgeResult, error)
+	}
+	// HashReporter reports counts of stored hashes by the secret version
+	HashReporter interface {
+		HashReport(ctx context.Context) (*adminapi.HashReport, error)
+	}
+	// BlockManager lists and clears IPs blocked for failed authentication attempts
+	BlockManager interface {
+		Blocks(ctx context.Context) ([]*adminapi.Block, error)
+		Unblock(ctx context.Context, ip string) (int, error)
+	}
 	// UsageReseter resets montly usage
 	UsageReseter interface {
 		Reset(ctx context.Context, project string, since time.Time, limit float64) error
@@ -59,6 +81,7 @@ type (
 	Data struct {
 		Port         int
 		OneKeyGetter OneKeyRetriever
+		KeyGetter    KeyRetriever
 		LogProvider  LogProvider
 		// logProvider       LogProvider
 		UsageRestorer    UsageRestorer
@@ -66,8 +89,16 @@ type (
 		ProjectValidator PrValidator
 		Auth             echo.MiddlewareFunc
 		Hasher           Hasher
+		AdminManager     AdminManager
+		Purger           KeyPurger
+		// PurgeMinRetention is the minimum age of the purged data, a purge 'before' must be older
+		PurgeMinRetention time.Duration
+		HashReporter      HashReporter
+		BlockManager      BlockManager
 
 		CmsData *cms.Data
+		// TrialData enables self-service trial keys if set
+		TrialData *trial.Data
 	}
 )
 
@@ -85,9 +116,32 @@ func StartWebServer(data *Data) error {
 	if data.OneKeyGetter == nil {
 		return errors.New("no OneKeyGetter")
 	}
+	if data.KeyGetter == nil {
+		return errors.New("no KeyGetter")
+	}
 	if data.LogProvider == nil {
 		return errors.New("no LogProvider")
 	}
+	if data.AdminManager == nil {
+		return errors.New("no AdminManager")
+	}
+	if data.Purger == nil {
+		return errors.New("no Purger")
+	}
+	if data.PurgeMinRetention <= 0 {
+		return errors.New("no PurgeMinRetention")
+	}
+	if data.HashReporter == nil {
+		return errors.New("no HashReporter")
+	}
+	if data.BlockManager == nil {
+		return errors.New("no BlockManager")
+	}
+	if data.TrialData != nil {
+		if err := data.TrialData.Validate(); err != nil {
+			return errors.Wrap(err, "wrong trial data")
+		}
+	}
 
 	log.Info().Int("port", data.Port).Msg("Starting HTTP doorman admin service")
 
@@ -118,13 +172,22 @@ func initRoutes(data *Data) *echo.Echo {
 
 	e.GET("/live", live(data))
 	e.POST("/hash", makeHash(data))
+	e.GET("/hash/report", hashReport(data))
+	e.GET("/block", blockList(data))
+	e.DELETE("/block/:ip", unblock(data))
+	e.GET("/:project/key", keyList(data))
 	e.GET("/:project/key/:key", keyInfo(data))
 	e.POST("/:project/restore/:requestID", restore(data))
 	e.POST("/:project/reset", reset(data))
-	// e.GET("/:project/log", logList(data))
+	e.POST("/:project/purge", purge(data))
+	e.GET("/:project/log", logList(data))
 	// e.DELETE("/:project/log", logDelete(data))
+	initAdminRoutes(e, data)
 
 	cms.InitRoutes(e, data.CmsData)
+	if data.TrialData != nil {
+		trial.InitRoutes(e, data.TrialData)
+	}
 
 	log.Info().Msg("Routes:")
 	for _, r := range e.Routes() {
@@ -133,30 +196,197 @@ func initRoutes(data *Data) *echo.Echo {
 	return e
 }
 
-// func logList(data *Data) func(echo.Context) error {
-// 	return func(c echo.Context) error {
-// 		defer goapp.Estimate("Service method: " + c.Path())()
-// 		project := c.Param("project")
-// 		if err := validateProject(project, data.ProjectValidator); err != nil {
-// 			log.Error().Err(err).Send()
-// 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-// 		}
-// 		to, err := utils.ParseDateParam(c.QueryParam("to"))
-// 		if err != nil {
-// 			return err
-// 		}
-// 		if to == nil {
-// 			return echo.NewHTTPError(http.StatusBadRequest, "no 'to' query param")
-// 		}
-// 		res, err := data.LogProvider.ListLogs(c.Request().Context(), project, *to)
+const (
+	_ndjsonMIME       = "application/x-ndjson"
+	_streamFlushEvery = 100
+)
 
-// 		if err != nil {
-// 			return utils.ProcessError(err)
-// 		}
+func logList(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.LogsRead, func(e echo.Context, user *model.User) error {
+			project := c.Param("project")
+			if err := validateProject(project, data.ProjectValidator); err != nil {
+				log.Error().Err(err).Send()
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			filter, err := parseLogFilter(c)
+			if err != nil {
+				return err
+			}
+			filter.Project = project
 
-// 		return c.JSON(http.StatusOK, res)
-// 	}
-// }
+			if c.QueryParam("format") == "ndjson" {
+				return streamLogs(c, data, user, filter)
+			}
+			res, err := data.LogProvider.ListLogs(c.Request().Context(), user, filter)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+// streamLogs writes logs as NDJSON, status is sent with the first record,
+// so errors before it are still reported with a proper code
+func streamLogs(c echo.Context, data *Data, user *model.User, filter *adminapi.LogFilter) error {
+	resp := c.Response()
+	enc := json.NewEncoder(resp)
+	started, count := false, 0
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		// exports may take longer than the server's write timeout
+		if err := http.NewResponseController(resp).SetWriteDeadline(time.Time{}); err != nil {
+			log.Warn().Err(err).Msg("can't reset write deadline")
+		}
+		resp.Header().Set(echo.HeaderContentType, _ndjsonMIME)
+		resp.WriteHeader(http.StatusOK)
+	}
+	err := data.LogProvider.StreamLogs(c.Request().Context(), user, filter, func(l *adminapi.Log) error {
+		start()
+		if err := enc.Encode(l); err != nil {
+			return fmt.Errorf("write log: %w", err)
+		}
+		count++
+		if count%_streamFlushEvery == 0 {
+			resp.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			return utils.ProcessError(err)
+		}
+		log.Error().Err(err).Int("sent", count).Msg("log streaming interrupted")
+		return nil
+	}
+	start()
+	resp.Flush()
+	return nil
+}
+
+func parseLogFilter(c echo.Context) (*adminapi.LogFilter, error) {
+	res := &adminapi.LogFilter{
+		KeyID:     c.QueryParam("keyID"),
+		IP:        c.QueryParam("ip"),
+		RequestID: c.QueryParam("requestID"),
+		Cursor:    c.QueryParam("cursor"),
+	}
+	var err error
+	if res.From, err = utils.ParseDateParam(c.QueryParam("from")); err != nil {
+		return nil, err
+	}
+	if res.To, err = utils.ParseDateParam(c.QueryParam("to")); err != nil {
+		return nil, err
+	}
+	if res.From != nil && res.To != nil && !res.From.Before(*res.To) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "'from' must be before 'to'")
+	}
+	if s := c.QueryParam("response"); s != "" {
+		if res.ResponseCode, err = strconv.Atoi(s); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong response '%s'", s))
+		}
+	}
+	if res.Fail, err = parseBoolParam(c, "fail"); err != nil {
+		return nil, err
+	}
+	if s := c.QueryParam("limit"); s != "" {
+		if res.Limit, err = strconv.Atoi(s); err != nil || res.Limit < 1 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong limit '%s'", s))
+		}
+	}
+	return res, nil
+}
+
+func keyList(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.KeyRead, func(e echo.Context, user *model.User) error {
+			project := c.Param("project")
+			if err := validateProject(project, data.ProjectValidator); err != nil {
+				log.Error().Err(err).Send()
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			filter, err := parseKeyFilter(c)
+			if err != nil {
+				return err
+			}
+			filter.Project = project
+			res, err := data.KeyGetter.List(c.Request().Context(), user, filter)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+func parseKeyFilter(c echo.Context) (*adminapi.KeyFilter, error) {
+	res := &adminapi.KeyFilter{
+		AdminID:     c.QueryParam("adminID"),
+		Tag:         c.QueryParam("tag"),
+		Description: c.QueryParam("q"),
+		ExternalID:  c.QueryParam("externalID"),
+		Sort:        c.QueryParam("sort"),
+		Cursor:      c.QueryParam("cursor"),
+	}
+	var err error
+	if res.Disabled, err = parseBoolParam(c, "disabled"); err != nil {
+		return nil, err
+	}
+	if res.Expired, err = parseBoolParam(c, "expired"); err != nil {
+		return nil, err
+	}
+	archived, err := parseBoolParam(c, "archived")
+	if err != nil {
+		return nil, err
+	}
+	res.Archived = archived != nil && *archived
+	if res.LastUsedFrom, err = utils.ParseDateParam(c.QueryParam("lastUsedFrom")); err != nil {
+		return nil, err
+	}
+	if res.LastUsedTo, err = utils.ParseDateParam(c.QueryParam("lastUsedTo")); err != nil {
+		return nil, err
+	}
+	if res.RemainingMin, err = parseFloatParam(c, "remainingMin"); err != nil {
+		return nil, err
+	}
+	if res.RemainingMax, err = parseFloatParam(c, "remainingMax"); err != nil {
+		return nil, err
+	}
+	if s := c.QueryParam("limit"); s != "" {
+		if res.Limit, err = strconv.Atoi(s); err != nil || res.Limit < 1 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong limit '%s'", s))
+		}
+	}
+	return res, nil
+}
+
+func parseBoolParam(c echo.Context, name string) (*bool, error) {
+	s := c.QueryParam(name)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong %s '%s'", name, s))
+	}
+	return &v, nil
+}
+
+func parseFloatParam(c echo.Context, name string) (*float64, error) {
+	s := c.QueryParam(name)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong %s '%s'", name, s))
+	}
+	return &v, nil
+}
 
 // func logDelete(data *Data) func(echo.Context) error {
 // 	return func(c echo.Context) error {
@@ -185,7 +415,7 @@ func initRoutes(data *Data) *echo.Echo {
 
 func keyInfo(data *Data) func(echo.Context) error {
 	return func(c echo.Context) error {
-		return utils.RunWithUser(c, func(e echo.Context, user *model.User) error {
+		return utils.RunWithPermission(c, permission.KeyRead, func(e echo.Context, user *model.User) error {
 			key := c.Param("key")
 			if key == "" {
 				log.Error().Msgf("no key")
@@ -205,6 +435,9 @@ func keyInfo(data *Data) func(echo.Context) error {
 			}
 
 			if c.QueryParam("full") == "1" {
+				if !user.HasPermission(permission.LogsRead) {
+					return echo.NewHTTPError(http.StatusForbidden)
+				}
 				res.Logs, err = data.LogProvider.GetLogs(c.Request().Context(), user, key)
 				if err != nil {
 					return utils.ProcessError(err)
@@ -338,3 +571,75 @@ func live(_data *Data) func(echo.Context) error {
 		return c.JSONBlob(http.StatusOK, []byte(`{"service":"OK"}`))
 	}
 }
+
+func hashReport(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.Everything, func(ctx echo.Context, u *model.User) error {
+			res, err := data.HashReporter.HashReport(c.Request().Context())
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+func blockList(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.Everything, func(ctx echo.Context, u *model.User) error {
+			res, err := data.BlockManager.Blocks(c.Request().Context())
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+func unblock(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.Everything, func(ctx echo.Context, u *model.User) error {
+			ip := c.Param("ip")
+			if net.ParseIP(ip) == nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "wrong ip")
+			}
+			res, err := data.BlockManager.Unblock(c.Request().Context(), ip)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, &adminapi.UnblockResult{Cleared: res})
+		})
+	}
+}
+
+func purge(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.Everything, func(ctx echo.Context, u *model.User) error {
+			project := c.Param("project")
+			if err := validateProject(project, data.ProjectValidator); err != nil {
+				log.Error().Err(err).Send()
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			before, err := utils.ParseDateParam(c.QueryParam("before"))
+			if err != nil {
+				return err
+			}
+			if before == nil {
+				log.Error().Msgf("no before")
+				return echo.NewHTTPError(http.StatusBadRequest, "no before")
+			}
+			if before.After(time.Now()) {
+				return echo.NewHTTPError(http.StatusBadRequest, "before is in the future")
+			}
+			if before.After(time.Now().Add(-data.PurgeMinRetention)) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("before must be older than the retention %v", data.PurgeMinRetention))
+			}
+
+			res, err := data.Purger.Purge(c.Request().Context(), project, *before)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package admin
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -23,9 +24,14 @@ import (
 
 var (
 	oneKeyRetrieverMock *mocks.MockOneKeyRetriever
+	keyRetrieverMock    *mocks.MockKeyRetriever
 	logRetrieverMock    *mocks.MockLogProvider
 	prValidarorMock     *mocks.MockPrValidator
 	uRestorer           *mocks.MockUsageRestorer
+	adminManagerMock    *mocks.MockAdminManager
+	purgerMock          *mocks.MockKeyPurger
+	hashReporterMock    *mocks.MockHashReporter
+	blockManagerMock    *mocks.MockBlockManager
 
 	tData *Data
 	tEcho *echo.Echo
@@ -35,9 +41,14 @@ var (
 func initTest(t *testing.T) {
 	mocks.AttachMockToTest(t)
 	oneKeyRetrieverMock = mocks.NewMockOneKeyRetriever()
+	keyRetrieverMock = mocks.NewMockKeyRetriever()
 	logRetrieverMock = mocks.NewMockLogProvider()
 	prValidarorMock = mocks.NewMockPrValidator()
 	uRestorer = mocks.NewMockUsageRestorer()
+	adminManagerMock = mocks.NewMockAdminManager()
+	purgerMock = mocks.NewMockKeyPurger()
+	hashReporterMock = mocks.NewMockHashReporter()
+	blockManagerMock = mocks.NewMockBlockManager()
 	pegomock.When(prValidarorMock.Check(pegomock.Any[string]())).ThenReturn(true)
 
 	tData = newTestData()
@@ -113,6 +124,104 @@ func TestKey_FailNoKey(t *testing.T) {
 	testCode(t, req, 400)
 }
 
+func TestKey_FailPermission(t *testing.T) {
+	initTest(t)
+	pegomock.When(oneKeyRetrieverMock.Get(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Eq("kkk"))).ThenReturn(&adminapi.Key{Key: "kkk"}, nil)
+	tData.Auth = newTestAuth(map[permission.Enum]bool{permission.UsageRead: true})
+	tEcho = initRoutes(tData)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/pr/key/kkk", nil), http.StatusForbidden)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/pr/log", nil), http.StatusForbidden)
+
+	tData.Auth = newTestAuth(map[permission.Enum]bool{permission.KeyRead: true})
+	tEcho = initRoutes(tData)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/pr/key/kkk", nil), http.StatusOK)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/pr/key/kkk?full=1", nil), http.StatusForbidden)
+}
+
+func TestPurge(t *testing.T) {
+	initTest(t)
+	pegomock.When(purgerMock.Purge(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[time.Time]())).
+		ThenReturn(&adminapi.PurgeResult{Logs: 10, Operations: 2, Keys: 1}, nil)
+	resp := testCode(t, httptest.NewRequest(http.MethodPost, "/pr/purge?before=2024-01-02T00:00:00Z", nil), http.StatusOK)
+	assert.Equal(t, `{"logs":10,"operations":2,"keys":1}`, strings.TrimSpace(resp.Body.String()))
+	_, cPr, cBefore := purgerMock.VerifyWasCalled(pegomock.Once()).
+		Purge(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[time.Time]()).GetCapturedArguments()
+	assert.Equal(t, "pr", cPr)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), cBefore.UTC())
+}
+
+func TestPurge_Fail(t *testing.T) {
+	initTest(t)
+	pegomock.When(purgerMock.Purge(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[time.Time]())).
+		ThenReturn(nil, errors.New("olia"))
+	testCode(t, httptest.NewRequest(http.MethodPost, "/pr/purge", nil), http.StatusBadRequest)
+	testCode(t, httptest.NewRequest(http.MethodPost, "/pr/purge?before=olia", nil), http.StatusBadRequest)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	testCode(t, httptest.NewRequest(http.MethodPost, "/pr/purge?before="+future, nil), http.StatusBadRequest)
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	testCode(t, httptest.NewRequest(http.MethodPost, "/pr/purge?before="+recent, nil), http.StatusBadRequest)
+	testCode(t, httptest.NewRequest(http.MethodPost, "/pr/purge?before=2024-01-02T00:00:00Z", nil), http.StatusInternalServerError)
+
+	tData.Auth = newTestAuth(map[permission.Enum]bool{permission.KeyUpdate: true})
+	tEcho = initRoutes(tData)
+	testCode(t, httptest.NewRequest(http.MethodPost, "/pr/purge?before=2024-01-02T00:00:00Z", nil), http.StatusForbidden)
+}
+
+func TestHashReport(t *testing.T) {
+	initTest(t)
+	pegomock.When(hashReporterMock.HashReport(pegomock.Any[context.Context]())).
+		ThenReturn(&adminapi.HashReport{CurrentVersion: 2,
+			Keys:           []adminapi.HashVersionCount{{Version: 2, Count: 5}, {Version: 1, Count: 3}},
+			Administrators: []adminapi.HashVersionCount{{Version: 1, Count: 1}}, Legacy: 4}, nil)
+	resp := testCode(t, httptest.NewRequest(http.MethodGet, "/hash/report", nil), http.StatusOK)
+	assert.Equal(t, `{"currentVersion":2,"keys":[{"version":2,"count":5},{"version":1,"count":3}],`+
+		`"administrators":[{"version":1,"count":1}],"legacy":4}`, strings.TrimSpace(resp.Body.String()))
+}
+
+func TestHashReport_Fail(t *testing.T) {
+	initTest(t)
+	pegomock.When(hashReporterMock.HashReport(pegomock.Any[context.Context]())).ThenReturn(nil, errors.New("olia"))
+	testCode(t, httptest.NewRequest(http.MethodGet, "/hash/report", nil), http.StatusInternalServerError)
+
+	tData.Auth = newTestAuth(map[permission.Enum]bool{permission.KeyRead: true})
+	tEcho = initRoutes(tData)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/hash/report", nil), http.StatusForbidden)
+}
+
+func TestBlockList(t *testing.T) {
+	initTest(t)
+	pegomock.When(blockManagerMock.Blocks(pegomock.Any[context.Context]())).
+		ThenReturn([]*adminapi.Block{{Guard: "proxy", IP: "1.2.3.4", Failures: 30,
+			Until: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)}}, nil)
+	resp := testCode(t, httptest.NewRequest(http.MethodGet, "/block", nil), http.StatusOK)
+	assert.Equal(t, `[{"guard":"proxy","ip":"1.2.3.4","failures":30,"until":"2024-01-02T10:00:00Z"}]`,
+		strings.TrimSpace(resp.Body.String()))
+
+	tData.Auth = newTestAuth(map[permission.Enum]bool{permission.KeyRead: true})
+	tEcho = initRoutes(tData)
+	testCode(t, httptest.NewRequest(http.MethodGet, "/block", nil), http.StatusForbidden)
+}
+
+func TestUnblock(t *testing.T) {
+	initTest(t)
+	pegomock.When(blockManagerMock.Unblock(pegomock.Any[context.Context](), pegomock.Any[string]())).ThenReturn(1, nil)
+	resp := testCode(t, httptest.NewRequest(http.MethodDelete, "/block/1.2.3.4", nil), http.StatusOK)
+	assert.Equal(t, `{"cleared":1}`, strings.TrimSpace(resp.Body.String()))
+	_, cIP := blockManagerMock.VerifyWasCalledOnce().Unblock(pegomock.Any[context.Context](), pegomock.Any[string]()).GetCapturedArguments()
+	assert.Equal(t, "1.2.3.4", cIP)
+}
+
+func TestUnblock_Fail(t *testing.T) {
+	initTest(t)
+	pegomock.When(blockManagerMock.Unblock(pegomock.Any[context.Context](), pegomock.Any[string]())).ThenReturn(0, errors.New("olia"))
+	testCode(t, httptest.NewRequest(http.MethodDelete, "/block/olia", nil), http.StatusBadRequest)
+	testCode(t, httptest.NewRequest(http.MethodDelete, "/block/1.2.3.4", nil), http.StatusInternalServerError)
+
+	tData.Auth = newTestAuth(map[permission.Enum]bool{permission.KeyRead: true})
+	tEcho = initRoutes(tData)
+	testCode(t, httptest.NewRequest(http.MethodDelete, "/block/1.2.3.4", nil), http.StatusForbidden)
+}
+
 func TestRestore(t *testing.T) {
 	initTest(t)
 	pegomock.When(uRestorer.RestoreUsage(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[bool](), pegomock.Any[string](), pegomock.Any[string]())).
@@ -161,38 +270,136 @@ func TestRestore_Fail(t *testing.T) {
 	testCode(t, req, http.StatusInternalServerError)
 }
 
-// func TestLogList(t *testing.T) {
-// 	initTest(t)
-// 	pegomock.When(logRetrieverMock.ListLogs(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[time.Time]())).
-// 		ThenReturn([]*adminapi.Log{{KeyID: "1", ResponseCode: 200}, {KeyID: "2", ResponseCode: 400}}, nil)
-// 	req := httptest.NewRequest(http.MethodGet, "/pr/log?to=2023-01-02T15:04:05Z", nil)
-// 	resp := testCode(t, req, http.StatusOK)
-// 	bytes, _ := io.ReadAll(resp.Body)
-// 	assert.Contains(t, string(bytes), `"keyID":"1"`)
-// 	assert.Contains(t, string(bytes), `"keyID":"2"`)
-// 	assert.Contains(t, string(bytes), `"response":400`)
-// 	_, cPr, cTime := logRetrieverMock.VerifyWasCalled(pegomock.Once()).
-// 		ListLogs(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[time.Time]()).
-// 		GetCapturedArguments()
-// 	assert.Equal(t, "pr", cPr)
-// 	assert.Equal(t, time.Date(2023, time.January, 2, 15, 04, 05, 0, time.UTC), cTime)
-// }
+func TestKeyList(t *testing.T) {
+	initTest(t)
+	pegomock.When(keyRetrieverMock.List(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*adminapi.KeyFilter]())).
+		ThenReturn(&adminapi.KeyListResp{Keys: []*adminapi.Key{{ID: "1"}, {ID: "2"}}, NextCursor: "cc"}, nil)
+	req := httptest.NewRequest(http.MethodGet, "/pr/key?adminID=a1&disabled=false&expired=1&archived=true&tag=plan:gold&q=olia&externalID=e1"+
+		"&lastUsedFrom=2023-01-01T15:04:05Z&lastUsedTo=2023-01-02T15:04:05Z&remainingMin=1.5&remainingMax=10&sort=-lastUsed&limit=10&cursor=xx", nil)
+	resp := testCode(t, req, http.StatusOK)
+	bytes, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(bytes), `"ID":"1"`)
+	assert.Contains(t, string(bytes), `"nextCursor":"cc"`)
+	_, _, cFilter := keyRetrieverMock.VerifyWasCalled(pegomock.Once()).
+		List(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*adminapi.KeyFilter]()).
+		GetCapturedArguments()
+	assert.Equal(t, "pr", cFilter.Project)
+	assert.Equal(t, "a1", cFilter.AdminID)
+	assert.False(t, *cFilter.Disabled)
+	assert.True(t, *cFilter.Expired)
+	assert.True(t, cFilter.Archived)
+	assert.Equal(t, "plan:gold", cFilter.Tag)
+	assert.Equal(t, "olia", cFilter.Description)
+	assert.Equal(t, "e1", cFilter.ExternalID)
+	assert.Equal(t, time.Date(2023, time.January, 1, 15, 04, 05, 0, time.UTC), *cFilter.LastUsedFrom)
+	assert.Equal(t, time.Date(2023, time.January, 2, 15, 04, 05, 0, time.UTC), *cFilter.LastUsedTo)
+	assert.Equal(t, 1.5, *cFilter.RemainingMin)
+	assert.Equal(t, 10.0, *cFilter.RemainingMax)
+	assert.Equal(t, "-lastUsed", cFilter.Sort)
+	assert.Equal(t, 10, cFilter.Limit)
+	assert.Equal(t, "xx", cFilter.Cursor)
+}
 
-// func TestLogList_FailDate(t *testing.T) {
-// 	initTest(t)
-// 	pegomock.When(logRetrieverMock.ListLogs(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[time.Time]())).
-// 		ThenReturn([]*adminapi.Log{{KeyID: "1", ResponseCode: 200}, {KeyID: "2", ResponseCode: 400}}, nil)
-// 	req := httptest.NewRequest(http.MethodGet, "/pr/log", nil)
-// 	testCode(t, req, http.StatusBadRequest)
-// }
+func TestKeyList_FailParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "disabled", query: "disabled=xx"},
+		{name: "expired", query: "expired=xx"},
+		{name: "lastUsedFrom", query: "lastUsedFrom=xx"},
+		{name: "lastUsedTo", query: "lastUsedTo=xx"},
+		{name: "remainingMin", query: "remainingMin=xx"},
+		{name: "remainingMax", query: "remainingMax=xx"},
+		{name: "limit", query: "limit=0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			req := httptest.NewRequest(http.MethodGet, "/pr/key?"+tt.query, nil)
+			testCode(t, req, http.StatusBadRequest)
+		})
+	}
+}
 
-// func TestLogList_FailDB(t *testing.T) {
-// 	initTest(t)
-// 	pegomock.When(logRetrieverMock.ListLogs(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[time.Time]())).
-// 		ThenReturn(nil, fmt.Errorf("err"))
-// 	req := httptest.NewRequest(http.MethodGet, "/pr/log?to=2023-01-02T15:04:05Z", nil)
-// 	testCode(t, req, http.StatusInternalServerError)
-// }
+func TestLogList(t *testing.T) {
+	initTest(t)
+	pegomock.When(logRetrieverMock.ListLogs(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*adminapi.LogFilter]())).
+		ThenReturn(&adminapi.LogListResp{Logs: []*adminapi.Log{{KeyID: "1", ResponseCode: 200}, {KeyID: "2", ResponseCode: 400}}, NextCursor: "cc"}, nil)
+	req := httptest.NewRequest(http.MethodGet, "/pr/log?keyID=k1&from=2023-01-01T15:04:05Z&to=2023-01-02T15:04:05Z&response=400&fail=true&ip=1.1.1.1&requestID=r1&limit=10&cursor=xx", nil)
+	resp := testCode(t, req, http.StatusOK)
+	bytes, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(bytes), `"keyID":"1"`)
+	assert.Contains(t, string(bytes), `"keyID":"2"`)
+	assert.Contains(t, string(bytes), `"response":400`)
+	assert.Contains(t, string(bytes), `"nextCursor":"cc"`)
+	_, _, cFilter := logRetrieverMock.VerifyWasCalled(pegomock.Once()).
+		ListLogs(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*adminapi.LogFilter]()).
+		GetCapturedArguments()
+	assert.Equal(t, "pr", cFilter.Project)
+	assert.Equal(t, "k1", cFilter.KeyID)
+	assert.Equal(t, time.Date(2023, time.January, 1, 15, 04, 05, 0, time.UTC), *cFilter.From)
+	assert.Equal(t, time.Date(2023, time.January, 2, 15, 04, 05, 0, time.UTC), *cFilter.To)
+	assert.Equal(t, 400, cFilter.ResponseCode)
+	assert.True(t, *cFilter.Fail)
+	assert.Equal(t, "1.1.1.1", cFilter.IP)
+	assert.Equal(t, "r1", cFilter.RequestID)
+	assert.Equal(t, 10, cFilter.Limit)
+	assert.Equal(t, "xx", cFilter.Cursor)
+}
+
+func TestLogList_FailParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "from", query: "from=xx"},
+		{name: "to", query: "to=xx"},
+		{name: "from after to", query: "from=2023-01-02T15:04:05Z&to=2023-01-01T15:04:05Z"},
+		{name: "response", query: "response=xx"},
+		{name: "fail", query: "fail=xx"},
+		{name: "limit", query: "limit=xx"},
+		{name: "limit negative", query: "limit=-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			req := httptest.NewRequest(http.MethodGet, "/pr/log?"+tt.query, nil)
+			testCode(t, req, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestLogList_FailDB(t *testing.T) {
+	initTest(t)
+	pegomock.When(logRetrieverMock.ListLogs(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*adminapi.LogFilter]())).
+		ThenReturn(nil, fmt.Errorf("err"))
+	req := httptest.NewRequest(http.MethodGet, "/pr/log", nil)
+	testCode(t, req, http.StatusInternalServerError)
+}
+
+func TestLogList_Stream(t *testing.T) {
+	initTest(t)
+	pegomock.When(logRetrieverMock.StreamLogs(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*adminapi.LogFilter](),
+		pegomock.Any[func(*adminapi.Log) error]())).Then(func(params []pegomock.Param) pegomock.ReturnValues {
+		f := params[3].(func(*adminapi.Log) error)
+		_ = f(&adminapi.Log{KeyID: "1"})
+		_ = f(&adminapi.Log{KeyID: "2"})
+		return []pegomock.ReturnValue{nil}
+	})
+	req := httptest.NewRequest(http.MethodGet, "/pr/log?format=ndjson", nil)
+	resp := testCode(t, req, http.StatusOK)
+	assert.Equal(t, _ndjsonMIME, resp.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "{\"keyID\":\"1\",\"date\":\"0001-01-01T00:00:00Z\"}\n{\"keyID\":\"2\",\"date\":\"0001-01-01T00:00:00Z\"}\n", resp.Body.String())
+}
+
+func TestLogList_StreamFail(t *testing.T) {
+	initTest(t)
+	pegomock.When(logRetrieverMock.StreamLogs(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*adminapi.LogFilter](),
+		pegomock.Any[func(*adminapi.Log) error]())).ThenReturn(model.NewNoAccessError("project", "pr"))
+	req := httptest.NewRequest(http.MethodGet, "/pr/log?format=ndjson", nil)
+	testCode(t, req, http.StatusForbidden)
+}
 
 // func TestLogDelete(t *testing.T) {
 // 	initTest(t)
@@ -228,26 +435,19 @@ func toReader(key interface{}) io.Reader {
 }
 
 func newTestData() *Data {
-	authMw := func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			r := c.Request()
-			ctx := r.Context()
-			user := &model.User{Name: "olia",
-				Permissions: map[permission.Enum]bool{permission.Everything: true},
-				Projects:    []string{"test"},
-				MaxLimit:    1000,
-				MaxValidTo:  time.Now().AddDate(1, 0, 0),
-			}
-			c.SetRequest(r.WithContext(context.WithValue(ctx, model.CtxUser, user)))
-			return next(c)
-		}
-	}
+	authMw := newTestAuth(map[permission.Enum]bool{permission.Everything: true})
 	res := &Data{
-		ProjectValidator: prValidarorMock,
-		UsageRestorer:    uRestorer,
-		Auth:             authMw,
-		OneKeyGetter:     oneKeyRetrieverMock,
-		LogProvider:      logRetrieverMock,
+		ProjectValidator:  prValidarorMock,
+		UsageRestorer:     uRestorer,
+		Auth:              authMw,
+		OneKeyGetter:      oneKeyRetrieverMock,
+		KeyGetter:         keyRetrieverMock,
+		LogProvider:       logRetrieverMock,
+		AdminManager:      adminManagerMock,
+		Purger:            purgerMock,
+		PurgeMinRetention: 720 * time.Hour,
+		HashReporter:      hashReporterMock,
+		BlockManager:      blockManagerMock,
 	}
 	return res
 }
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"context"
+	"time"
+
+	adminapi "github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Archiver archives expired keys, purges old data of archived keys and drops idle IP keys
+type Archiver interface {
+	ArchiveExpired(ctx context.Context, project string, expiredBefore time.Time) (int, error)
+	Purge(ctx context.Context, project string, before time.Time) (*adminapi.PurgeResult, error)
+	DeleteIdleIPKeys(ctx context.Context, project string, idleBefore time.Time) (int, error)
+}
+
+// TimerData keeps archive timer info
+type TimerData struct {
+	Archiver Archiver
+	Projects []string
+	// ExpiredFor archives keys expired for the duration, zero disables archiving
+	ExpiredFor time.Duration
+	// PurgeAfter purges data of keys archived for the duration, zero disables purging
+	PurgeAfter time.Duration
+	// MinRetention is the minimum of PurgeAfter
+	MinRetention time.Duration
+	// IPKeyIdleFor deletes IP keys not used for the duration and without logs, zero disables deleting
+	IPKeyIdleFor time.Duration
+	// Interval between runs
+	Interval time.Duration
+}
+
+// StartTimer starts timer in loop for doing archive tasks
+func StartTimer(ctx context.Context, data *TimerData) (<-chan struct{}, error) {
+	if data.Archiver == nil {
+		return nil, errors.Errorf("no Archiver")
+	}
+	if data.ExpiredFor < 0 || data.PurgeAfter < 0 || data.IPKeyIdleFor < 0 {
+		return nil, errors.Errorf("wrong durations")
+	}
+	if data.Interval <= 0 {
+		return nil, errors.Errorf("wrong interval")
+	}
+	if data.PurgeAfter > 0 && data.PurgeAfter < data.MinRetention {
+		return nil, errors.Errorf("purgeAfter %v is shorter than the min retention %v", data.PurgeAfter, data.MinRetention)
+	}
+	return startLoop(ctx, data), nil
+}
+
+func startLoop(ctx context.Context, data *TimerData) <-chan struct{} {
+	log.Info().Dur("expiredFor", data.ExpiredFor).Dur("purgeAfter", data.PurgeAfter).Dur("ipKeyIdleFor", data.IPKeyIdleFor).
+		Dur("interval", data.Interval).
+		Msgf("Starting archive timer")
+	res := make(chan struct{}, 2)
+	go func() {
+		defer close(res)
+		serviceLoop(ctx, data)
+	}()
+	return res
+}
+
+func serviceLoop(ctx context.Context, data *TimerData) {
+	for {
+		if err := doArchive(ctx, time.Now(), data); err != nil {
+			log.Error().Err(err).Send()
+		}
+		log.Info().Str("at", time.Now().Add(data.Interval).Format(time.RFC3339)).Msg("next archive run")
+		select {
+		case <-time.After(data.Interval):
+		case <-ctx.Done():
+			log.Info().Msg("Stopped archive service")
+			return
+		}
+	}
+}
+
+func doArchive(ctx context.Context, now time.Time, data *TimerData) error {
+	log.Info().Msg("Running archive")
+	for _, pr := range data.Projects {
+		if data.ExpiredFor > 0 {
+			if _, err := data.Archiver.ArchiveExpired(ctx, pr, now.Add(-data.ExpiredFor)); err != nil {
+				return err
+			}
+		}
+		if data.PurgeAfter > 0 {
+			if _, err := data.Archiver.Purge(ctx, pr, now.Add(-data.PurgeAfter)); err != nil {
+				return err
+			}
+		}
+		if data.IPKeyIdleFor > 0 {
+			if _, err := data.Archiver.DeleteIdleIPKeys(ctx, pr, now.Add(-data.IPKeyIdleFor)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package bruteforce
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	adminapi "github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	// max doublings of the delay, protects from overflow
+	_maxDelayShift = 16
+	_configSection = "bruteForce"
+)
+
+var (
+	failuresMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "doorman_bruteforce_failures_total",
+		Help: "Failed authentication attempts",
+	}, []string{"guard"})
+	blocksMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "doorman_bruteforce_blocks_total",
+		Help: "IPs blocked for too many failed authentication attempts",
+	}, []string{"guard"})
+	rejectedMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "doorman_bruteforce_rejected_total",
+		Help: "Requests rejected from blocked IPs",
+	}, []string{"guard"})
+)
+
+// Settings of the guard
+type Settings struct {
+	// Window for counting failures of an IP, zero disables the guard
+	Window time.Duration
+	// DelayAfter failures the answers are delayed, zero disables delays
+	DelayAfter int64
+	// Delay is the first delay, every next failure doubles it
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// BlockAfter failures the IP is blocked, zero disables blocking
+	BlockAfter int64
+	BlockFor   time.Duration
+}
+
+// Guard tracks failed authentication attempts by IP, delays and blocks guessing IPs
+type Guard struct {
+	name     string
+	store    Store
+	settings Settings
+}
+
+// NewGuard creates guard
+func NewGuard(name string, store Store, settings Settings) (*Guard, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no name")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("no store")
+	}
+	if settings.Window < 0 || settings.Delay < 0 || settings.MaxDelay < 0 || settings.BlockFor < 0 ||
+		settings.DelayAfter < 0 || settings.BlockAfter < 0 {
+		return nil, fmt.Errorf("wrong settings")
+	}
+	if settings.BlockAfter > 0 && settings.BlockFor == 0 {
+		return nil, fmt.Errorf("no blockFor")
+	}
+	if settings.MaxDelay == 0 {
+		settings.MaxDelay = settings.Delay
+	}
+	return &Guard{name: name, store: store, settings: settings}, nil
+}
+
+// NewGuardFromConfig creates guard from the config section bruteForce.<name>
+func NewGuardFromConfig(name string, cfg *viper.Viper, store Store) (*Guard, error) {
+	pr := _configSection + "." + name
+	return NewGuard(name, store, Settings{
+		Window:     cfg.GetDuration(pr + ".window"),
+		DelayAfter: cfg.GetInt64(pr + ".delayAfter"),
+		Delay:      cfg.GetDuration(pr + ".delay"),
+		MaxDelay:   cfg.GetDuration(pr + ".maxDelay"),
+		BlockAfter: cfg.GetInt64(pr + ".blockAfter"),
+		BlockFor:   cfg.GetDuration(pr + ".blockFor"),
+	})
+}
+
+// NewStoreFromConfig creates redis store if bruteForce.url is set, memory store otherwise
+func NewStoreFromConfig(cfg *viper.Viper) (Store, error) {
+	url := cfg.GetString(_configSection + ".url")
+	if url == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewRedisStore(url)
+}
+
+// Enabled returns true if the guard counts failures
+func (g *Guard) Enabled() bool {
+	return g.settings.Window > 0
+}
+
+// Blocked returns the remaining block time of the IP, zero if it is not blocked
+func (g *Guard) Blocked(ctx context.Context, ip string) (time.Duration, error) {
+	res, err := g.store.TTL(ctx, g.blockKey(ip))
+	if err != nil {
+		return 0, err
+	}
+	if res > 0 {
+		rejectedMetric.WithLabelValues(g.name).Inc()
+	}
+	return res, nil
+}
+
+// Fail records the failed attempt of the IP, returns the delay for the answer
+func (g *Guard) Fail(ctx context.Context, ip string) (time.Duration, error) {
+	if !g.Enabled() {
+		return 0, nil
+	}
+	failuresMetric.WithLabelValues(g.name).Inc()
+	count, err := g.store.Incr(ctx, g.failKey(ip), g.settings.Window)
+	if err != nil {
+		return 0, err
+	}
+	if g.settings.BlockAfter > 0 && count >= g.settings.BlockAfter {
+		log.Ctx(ctx).Warn().Str("guard", g.name).Str("ip", ip).Int64("failures", count).Dur("for", g.settings.BlockFor).Msg("Block IP")
+		if err := g.store.Set(ctx, g.blockKey(ip), count, g.settings.BlockFor); err != nil {
+			return 0, err
+		}
+		if _, err := g.store.Del(ctx, g.failKey(ip)); err != nil {
+			return 0, err
+		}
+		blocksMetric.WithLabelValues(g.name).Inc()
+	}
+	return g.delay(count), nil
+}
+
+func (g *Guard) delay(count int64) time.Duration {
+	if g.settings.DelayAfter == 0 || count <= g.settings.DelayAfter {
+		return 0
+	}
+	res := g.settings.Delay << min(count-g.settings.DelayAfter-1, _maxDelayShift)
+	return min(res, g.settings.MaxDelay)
+}
+
+// Blocks returns currently blocked IPs
+func (g *Guard) Blocks(ctx context.Context) ([]*adminapi.Block, error) {
+	prefix := g.blockKey("")
+	keys, err := g.store.Keys(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res := make([]*adminapi.Block, 0, len(keys))
+	for _, k := range keys {
+		ttl, err := g.store.TTL(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		if ttl <= 0 {
+			continue
+		}
+		failures, err := g.store.Get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &adminapi.Block{Guard: g.name, IP: strings.TrimPrefix(k, prefix), Failures: failures,
+			Until: now.Add(ttl).Truncate(time.Second)})
+	}
+	return res, nil
+}
+
+// Unblock drops the block and failures of the IP, returns false if there was nothing to drop
+func (g *Guard) Unblock(ctx context.Context, ip string) (bool, error) {
+	res, err := g.store.Del(ctx, g.blockKey(ip), g.failKey(ip))
+	if err != nil {
+		return false, err
+	}
+	if res > 0 {
+		log.Ctx(ctx).Info().Str("guard", g.name).Str("ip", ip).Msg("Unblocked IP")
+	}
+	return res > 0, nil
+}
+
+func (g *Guard) blockKey(ip string) string {
+	return fmt.Sprintf("bf:%s:block:%s", g.name, ip)
+}
+
+func (g *Guard) failKey(ip string) string {
+	return fmt.Sprintf("bf:%s:fail:%s", g.name, ip)
+}
+
+func (g *Guard) Info(pr string) string {
+	return pr + fmt.Sprintf("Guard(%s, %v, %d, %d, %s)", g.name, g.settings.Window, g.settings.DelayAfter, g.settings.BlockAfter, g.store.Info(""))
+}
+
+// Guards manages blocks of several guards
+type Guards []*Guard
+
+// Blocks returns blocked IPs of all guards
+func (gs Guards) Blocks(ctx context.Context) ([]*adminapi.Block, error) {
+	res := make([]*adminapi.Block, 0)
+	for _, g := range gs {
+		b, err := g.Blocks(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get %s blocks: %w", g.name, err)
+		}
+		res = append(res, b...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Guard != res[j].Guard {
+			return res[i].Guard < res[j].Guard
+		}
+		return res[i].IP < res[j].IP
+	})
+	return res, nil
+}
+
+// Unblock drops the IP's blocks in all guards, returns the count of guards the IP was dropped from
+func (gs Guards) Unblock(ctx context.Context, ip string) (int, error) {
+	res := 0
+	for _, g := range gs {
+		ok, err := g.Unblock(ctx, ip)
+		if err != nil {
+			return 0, fmt.Errorf("unblock %s: %w", g.name, err)
+		}
+		if ok {
+			res++
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,114 @@
+package bruteforce
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGuard(t *testing.T, s Settings) (*Guard, *MemoryStore) {
+	t.Helper()
+	st := NewMemoryStore()
+	res, err := NewGuard("test", st, s)
+	require.NoError(t, err)
+	return res, st
+}
+
+func TestNewGuard(t *testing.T) {
+	_, err := NewGuard("", NewMemoryStore(), Settings{})
+	assert.Error(t, err)
+	_, err = NewGuard("n", nil, Settings{})
+	assert.Error(t, err)
+	_, err = NewGuard("n", NewMemoryStore(), Settings{Window: -time.Second})
+	assert.Error(t, err)
+	_, err = NewGuard("n", NewMemoryStore(), Settings{Window: time.Second, BlockAfter: 2})
+	assert.Error(t, err)
+	g, err := NewGuard("n", NewMemoryStore(), Settings{})
+	require.NoError(t, err)
+	assert.False(t, g.Enabled())
+}
+
+func TestGuard_Delay(t *testing.T) {
+	g, _ := newTestGuard(t, Settings{Window: time.Minute, DelayAfter: 2, Delay: time.Second, MaxDelay: 3 * time.Second})
+	var got []time.Duration
+	for range 6 {
+		d, err := g.Fail(context.Background(), "1.1.1.1")
+		require.NoError(t, err)
+		got = append(got, d)
+	}
+	assert.Equal(t, []time.Duration{0, 0, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}, got)
+	d, err := g.Fail(context.Background(), "1.1.1.2")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+}
+
+func TestGuard_Block(t *testing.T) {
+	g, _ := newTestGuard(t, Settings{Window: time.Minute, BlockAfter: 3, BlockFor: time.Hour})
+	ctx := context.Background()
+	for range 2 {
+		_, err := g.Fail(ctx, "1.1.1.1")
+		require.NoError(t, err)
+	}
+	b, err := g.Blocked(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), b)
+
+	_, err = g.Fail(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	b, err = g.Blocked(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, b, float64(time.Second))
+
+	blocks, err := Guards{g}.Blocks(ctx)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, "test", blocks[0].Guard)
+	assert.Equal(t, "1.1.1.1", blocks[0].IP)
+	assert.Equal(t, int64(3), blocks[0].Failures)
+
+	c, err := Guards{g}.Unblock(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, c)
+	b, err = g.Blocked(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), b)
+	c, err = Guards{g}.Unblock(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, c)
+}
+
+func TestGuard_Disabled(t *testing.T) {
+	g, st := newTestGuard(t, Settings{})
+	d, err := g.Fail(context.Background(), "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+	keys, _ := st.Keys(context.Background(), "")
+	assert.Empty(t, keys)
+}
+
+func TestMemoryStore_Expire(t *testing.T) {
+	st := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st.now = func() time.Time { return now }
+	ctx := context.Background()
+	v, _ := st.Incr(ctx, "k", time.Minute)
+	assert.Equal(t, int64(1), v)
+	now = now.Add(30 * time.Second)
+	v, _ = st.Incr(ctx, "k", time.Minute)
+	assert.Equal(t, int64(2), v)
+	ttl, _ := st.TTL(ctx, "k")
+	assert.Equal(t, 30*time.Second, ttl)
+
+	now = now.Add(31 * time.Second)
+	v, _ = st.Get(ctx, "k")
+	assert.Equal(t, int64(0), v)
+	v, _ = st.Incr(ctx, "k", time.Minute)
+	assert.Equal(t, int64(1), v)
+
+	now = now.Add(2 * time.Minute)
+	_, _ = st.Incr(ctx, "other", time.Minute)
+	assert.Len(t, st.data, 1)
+}
@@ -0,0 +1,100 @@
+package bruteforce
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// incrScript increments the counter and sets ttl for a new one in a single step
+var incrScript = redis.NewScript(`
+local v = redis.call('INCR', KEYS[1])
+if v == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return v`)
+
+// RedisStore keeps counters in redis, so the data is shared between instances
+type RedisStore struct {
+	redisdb *redis.Client
+	url     string
+}
+
+// NewRedisStore creates redis store
+func NewRedisStore(url string) (*RedisStore, error) {
+	if url == "" {
+		return nil, fmt.Errorf("no redis url")
+	}
+	redisdb := redis.NewClient(&redis.Options{
+		Addr:               url,
+		MaxRetries:         3,
+		MinIdleConns:       2,
+		IdleTimeout:        5 * time.Minute,
+		IdleCheckFrequency: time.Minute,
+		PoolSize:           30,
+	})
+	return &RedisStore{redisdb: redisdb, url: url}, nil
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	res, err := incrScript.Run(s.redisdb.WithContext(ctx), []string{key}, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("can't incr: %w", err)
+	}
+	return res, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	res, err := s.redisdb.WithContext(ctx).Get(key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("can't get: %w", err)
+	}
+	return res, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value int64, ttl time.Duration) error {
+	if err := s.redisdb.WithContext(ctx).Set(key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("can't set: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	res, err := s.redisdb.WithContext(ctx).PTTL(key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("can't get ttl: %w", err)
+	}
+	if res < 0 { // no key or no expiration
+		return 0, nil
+	}
+	return res, nil
+}
+
+func (s *RedisStore) Del(ctx context.Context, keys ...string) (int64, error) {
+	res, err := s.redisdb.WithContext(ctx).Del(keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("can't del: %w", err)
+	}
+	return res, nil
+}
+
+func (s *RedisStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	var res []string
+	it := s.redisdb.WithContext(ctx).Scan(0, prefix+"*", 1000).Iterator()
+	for it.Next() {
+		res = append(res, it.Val())
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("can't scan: %w", err)
+	}
+	return res, nil
+}
+
+func (s *RedisStore) Info(pr string) string {
+	return pr + fmt.Sprintf("RedisStore(%s)", s.url)
+}
@@ -0,0 +1,139 @@
+package bruteforce
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store keeps expiring counters
+type Store interface {
+	// Incr increments the counter, ttl is set for a new counter only
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	Get(ctx context.Context, key string) (int64, error)
+	Set(ctx context.Context, key string, value int64, ttl time.Duration) error
+	// TTL returns zero if there is no key
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Del(ctx context.Context, keys ...string) (int64, error)
+	Keys(ctx context.Context, prefix string) ([]string, error)
+	Info(pr string) string
+}
+
+const _cleanEvery = time.Minute
+
+type memItem struct {
+	value   int64
+	expires time.Time
+}
+
+// MemoryStore keeps counters in memory of the process
+type MemoryStore struct {
+	lock      sync.Mutex
+	data      map[string]*memItem
+	lastClean time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore creates in memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: map[string]*memItem{}, now: time.Now}
+}
+
+func (s *MemoryStore) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	s.clean(now)
+	it := s.get(key, now)
+	if it == nil {
+		it = &memItem{expires: now.Add(ttl)}
+		s.data[key] = it
+	}
+	it.value++
+	return it.value, nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if it := s.get(key, s.now()); it != nil {
+		return it.value, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key string, value int64, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data[key] = &memItem{value: value, expires: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) TTL(_ context.Context, key string) (time.Duration, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	if it := s.get(key, now); it != nil {
+		return it.expires.Sub(now), nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) Del(_ context.Context, keys ...string) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	var res int64
+	for _, k := range keys {
+		if s.get(k, now) != nil {
+			res++
+		}
+		delete(s.data, k)
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) Keys(_ context.Context, prefix string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	var res []string
+	for k, it := range s.data {
+		if strings.HasPrefix(k, prefix) && it.expires.After(now) {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) get(key string, now time.Time) *memItem {
+	it, ok := s.data[key]
+	if !ok || !it.expires.After(now) {
+		return nil
+	}
+	return it
+}
+
+// clean drops expired items, so counters of random IPs do not pile up
+func (s *MemoryStore) clean(now time.Time) {
+	if now.Sub(s.lastClean) < _cleanEvery {
+		return
+	}
+	s.lastClean = now
+	for k, it := range s.data {
+		if !it.expires.After(now) {
+			delete(s.data, k)
+		}
+	}
+}
+
+func (s *MemoryStore) Info(pr string) string {
+	return pr + "MemoryStore"
+}
@@ -18,15 +18,17 @@ type (
 	}
 
 	AuthMiddleware struct {
-		auth Auth
+		auth  Auth
+		guard FailureGuard
 	}
 )
 
-func NewAuthMiddleware(auth Auth) (*AuthMiddleware, error) {
+// NewAuthMiddleware creates the middleware, guard may be nil
+func NewAuthMiddleware(auth Auth, guard FailureGuard) (*AuthMiddleware, error) {
 	if auth == nil {
 		return nil, fmt.Errorf("auth is nil")
 	}
-	return &AuthMiddleware{auth: auth}, nil
+	return &AuthMiddleware{auth: auth, guard: guard}, nil
 }
 
 // Handle is the method that implements the middleware logic
@@ -41,10 +43,17 @@ func (a *AuthMiddleware) Handle(next echo.HandlerFunc) echo.HandlerFunc {
 			return c.String(http.StatusUnauthorized, "Wrong auth header")
 		}
 		if key != "" {
-			user, err := a.auth.ValidateToken(ctx, key, utils.ExtractIP(r))
+			ip := utils.ExtractIP(r)
+			if retryAfter := checkBlocked(ctx, a.guard, ip); retryAfter > 0 {
+				log.Ctx(ctx).Warn().Str("ip", ip).Msg("IP is blocked")
+				c.Response().Header().Set("Retry-After", retryAfterStr(retryAfter))
+				return echo.NewHTTPError(http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+			}
+			user, err := a.auth.ValidateToken(ctx, key, ip)
 			if err != nil {
 				log.Ctx(ctx).Error().Err(err).Msg("can't validate token")
 				if errors.Is(err, model.ErrUnauthorized) {
+					fail(ctx, a.guard, ip)
 					return echo.NewHTTPError(http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 				}
 				return echo.NewHTTPError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
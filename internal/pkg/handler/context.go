@@ -10,17 +10,22 @@ import (
 )
 
 type customData struct {
-	ResponseCode   int
-	Key            string
-	KeyID          string
-	IP             string
-	Manual         bool
+	ResponseCode int
+	Key          string
+	KeyID        string
+	IP           string
+	Manual       bool
+	OldKey       bool
+	// Publishable is set for a key bound to the allowed browser origins
+	Publishable    bool
 	QuotaValue     float64
 	RateLimitValue int64
 	Value          string
 	Discount       *bool
 	Tags           []string
-	RequestID      string
+	// Scopes of the key, checked by ScopeValid
+	Scopes    []string
+	RequestID string
 }
 
 func customContext(r *http.Request) (*http.Request, *customData) {
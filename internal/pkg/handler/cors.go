@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/utils"
+)
+
+// DefaultExposedHeaders are the headers set by doorman, they are always exposed
+var DefaultExposedHeaders = []string{"X-Rate-Limit-Limit", "X-Rate-Limit-Remaining", "X-Rate-Limit-Short-Remaining", "Retry-After"}
+
+// AnyOrigin allows all origins
+const AnyOrigin = "*"
+
+// CORSSettings of a route
+type CORSSettings struct {
+	// AllowedOrigins are patterns of utils.MatchOrigin or AnyOrigin
+	AllowedOrigins []string
+	// AllowedMethods, empty allows the requested method
+	AllowedMethods []string
+	// AllowedHeaders, empty allows the requested headers
+	AllowedHeaders []string
+	// ExposedHeaders are added to DefaultExposedHeaders
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+type cors struct {
+	next      http.Handler
+	settings  CORSSettings
+	anyOrigin bool
+	exposed   string
+}
+
+// CORS creates handler answering CORS preflights of the allowed origins without a key
+// and adding CORS headers to their requests. Requests of other origins are passed as they are
+func CORS(next http.Handler, settings CORSSettings) (http.Handler, error) {
+	res := &cors{next: next, settings: settings}
+	var patterns []string
+	for _, o := range settings.AllowedOrigins {
+		if o == AnyOrigin {
+			res.anyOrigin = true
+		} else {
+			patterns = append(patterns, o)
+		}
+	}
+	if !res.anyOrigin && len(patterns) == 0 {
+		return nil, fmt.Errorf("no allowed origins")
+	}
+	if res.anyOrigin && settings.AllowCredentials {
+		return nil, fmt.Errorf("credentials can't be allowed for any origin")
+	}
+	if err := utils.ValidateOriginPatterns(patterns); err != nil {
+		return nil, err
+	}
+	if settings.MaxAge < 0 {
+		return nil, fmt.Errorf("wrong max age %v", settings.MaxAge)
+	}
+	exposed := slices.Clone(DefaultExposedHeaders)
+	for _, hs := range settings.ExposedHeaders {
+		if !slices.ContainsFunc(exposed, func(s string) bool { return strings.EqualFold(s, hs) }) {
+			exposed = append(exposed, hs)
+		}
+	}
+	res.exposed = strings.Join(exposed, ", ")
+	return res, nil
+}
+
+func (h *cors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !h.allowed(origin) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	h.setOrigin(w, origin)
+	if h.settings.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !isPreflight(r) {
+		w.Header().Set("Access-Control-Expose-Headers", h.exposed)
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	addVary(w, "Access-Control-Request-Method")
+	addVary(w, "Access-Control-Request-Headers")
+	w.Header().Set("Access-Control-Allow-Methods", joinOr(h.settings.AllowedMethods, r.Header.Get("Access-Control-Request-Method")))
+	if hs := joinOr(h.settings.AllowedHeaders, r.Header.Get("Access-Control-Request-Headers")); hs != "" {
+		w.Header().Set("Access-Control-Allow-Headers", hs)
+	}
+	if h.settings.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.FormatInt(int64(h.settings.MaxAge.Seconds()), 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *cors) allowed(origin string) bool {
+	return h.anyOrigin || utils.MatchOrigin(h.settings.AllowedOrigins, origin)
+}
+
+// setOrigin sets '*' for any origin, credentials are never allowed with it
+func (h *cors) setOrigin(w http.ResponseWriter, origin string) {
+	if h.anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", AnyOrigin)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	addVary(w, "Origin")
+}
+
+func (h *cors) Info(pr string) string {
+	return pr + fmt.Sprintf("CORS(%v, %v, %t)\n", h.settings.AllowedOrigins, h.settings.AllowedMethods, h.settings.AllowCredentials) +
+		GetInfo(LogShitf(pr), h.next)
+}
+
+func addVary(w http.ResponseWriter, value string) {
+	if !slices.Contains(w.Header().Values("Vary"), value) {
+		w.Header().Add("Vary", value)
+	}
+}
+
+func joinOr(values []string, def string) string {
+	if len(values) == 0 {
+		return def
+	}
+	return strings.Join(values, ", ")
+}
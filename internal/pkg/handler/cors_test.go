@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORS_Init(t *testing.T) {
+	_, err := CORS(newTestHandler(), CORSSettings{})
+	assert.Error(t, err)
+	_, err = CORS(newTestHandler(), CORSSettings{AllowedOrigins: []string{"example.com"}})
+	assert.Error(t, err)
+	_, err = CORS(newTestHandler(), CORSSettings{AllowedOrigins: []string{"*"}, MaxAge: -time.Second})
+	assert.Error(t, err)
+	_, err = CORS(newTestHandler(), CORSSettings{AllowedOrigins: []string{"*", "https://*.example.com"}, AllowCredentials: true})
+	assert.Error(t, err)
+	_, err = CORS(newTestHandler(), CORSSettings{AllowedOrigins: []string{"*", "https://*.example.com"}})
+	assert.NoError(t, err)
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	next := newTestHandler()
+	h, err := CORS(next, CORSSettings{AllowedOrigins: []string{"https://example.com"}, AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"}, AllowCredentials: true, MaxAge: 10 * time.Minute})
+	require.NoError(t, err)
+	req := httptest.NewRequest("OPTIONS", "/duration", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "authorization")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, 204, resp.Code)
+	assert.Nil(t, next.r)
+	assert.Equal(t, "https://example.com", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", resp.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, Content-Type", resp.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "true", resp.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "600", resp.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, resp.Header().Values("Vary"))
+}
+
+func TestCORS_PreflightRequested(t *testing.T) {
+	h, err := CORS(newTestHandler(), CORSSettings{AllowedOrigins: []string{"*"}})
+	require.NoError(t, err)
+	req := httptest.NewRequest("OPTIONS", "/duration", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "x-olia")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, 204, resp.Code)
+	assert.Equal(t, "*", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "PUT", resp.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "x-olia", resp.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "", resp.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "", resp.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORS_Request(t *testing.T) {
+	next := newTestHandler()
+	h, err := CORS(next, CORSSettings{AllowedOrigins: []string{"https://*.example.com"}, ExposedHeaders: []string{"X-Olia", "retry-after"}})
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/duration", nil)
+	req.Header.Set("Origin", "https://a.example.com")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+	assert.NotNil(t, next.r)
+	assert.Equal(t, "https://a.example.com", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Rate-Limit-Limit, X-Rate-Limit-Remaining, X-Rate-Limit-Short-Remaining, Retry-After, X-Olia",
+		resp.Header().Get("Access-Control-Expose-Headers"))
+}
+
+func TestCORS_Pass(t *testing.T) {
+	h, err := CORS(newTestHandler(), CORSSettings{AllowedOrigins: []string{"https://example.com"}})
+	require.NoError(t, err)
+	for _, origin := range []string{"", "https://other.com"} {
+		req := httptest.NewRequest("OPTIONS", "/duration", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		assert.Equal(t, testCode, resp.Code)
+		assert.Equal(t, "", resp.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
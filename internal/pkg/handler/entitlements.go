@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/airenas/api-doorman/internal/pkg/utils/tag"
+	"github.com/rs/zerolog/log"
+)
+
+// EntitlementRule checks the JSON body field against the condition in the key tag
+type EntitlementRule struct {
+	// Tag key, the tag value is a tag.Condition
+	Tag string
+	// Field of the JSON body
+	Field string
+	// Length checks the rune count of the field instead of the value
+	Length bool
+}
+
+type entitlements struct {
+	next  http.Handler
+	rules []EntitlementRule
+}
+
+// Entitlements creates handler checking the request JSON fields against the key tags.
+// A plain tag value is an exact value, or the max length for the length rule.
+// A key without the rule tag or a request without the field is not restricted
+func Entitlements(next http.Handler, rules []EntitlementRule) (http.Handler, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no entitlement rules")
+	}
+	res := &entitlements{next: next}
+	for _, r := range rules {
+		if r.Tag == "" || r.Field == "" {
+			return nil, fmt.Errorf("wrong entitlement rule %s=%s", r.Tag, r.Field)
+		}
+		res.rules = append(res.rules, EntitlementRule{Tag: strings.ToLower(r.Tag), Field: r.Field, Length: r.Length})
+	}
+	return res, nil
+}
+
+func (h *entitlements) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rn, ctx := customContext(r)
+	conditions, err := h.conditions(ctx.Tags)
+	if err != nil {
+		http.Error(w, "Service error", http.StatusInternalServerError)
+		log.Ctx(r.Context()).Error().Err(err).Msg("Can't parse entitlement tag")
+		return
+	}
+	if len(conditions) == 0 {
+		h.next.ServeHTTP(w, rn)
+		return
+	}
+
+	bodyBytes, ok := readJSONBody(w, r)
+	if !ok {
+		return
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &data); err != nil {
+		http.Error(w, "Wrong JSON body", http.StatusBadRequest)
+		log.Ctx(r.Context()).Info().Err(err).Msg("Can't read json body")
+		return
+	}
+	for i, rule := range h.rules {
+		if conditions[i] == nil {
+			continue
+		}
+		values, err := fieldValues(data[rule.Field], rule.Length)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Wrong field %s: %v", rule.Field, err), http.StatusBadRequest)
+			return
+		}
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			if err := conditions[i].Validate(v); err != nil {
+				log.Ctx(r.Context()).Info().Str("id", ctx.KeyID).Str("field", rule.Field).Err(err).Msg("Not entitled")
+				http.Error(w, fmt.Sprintf("Key does not allow %s: %v", rule.Field, err), http.StatusForbidden)
+				return
+			}
+		}
+	}
+	rn.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	h.next.ServeHTTP(w, rn)
+}
+
+// _maxJSONBodySize limits the JSON body read by doorman to check the request
+const _maxJSONBodySize = 10 << 20
+
+// readJSONBody reads the body up to _maxJSONBodySize, on failure it writes 413 or 400 and returns false
+func readJSONBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	res, err := io.ReadAll(http.MaxBytesReader(w, r.Body, _maxJSONBodySize))
+	if err != nil {
+		var mErr *http.MaxBytesError
+		if errors.As(err, &mErr) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Can't read request", http.StatusBadRequest)
+		}
+		log.Ctx(r.Context()).Info().Err(err).Msg("Can't read body")
+		return nil, false
+	}
+	return res, true
+}
+
+// conditions returns conditions by the rule index, nil for rules without a tag
+func (h *entitlements) conditions(tags []string) ([]tag.Condition, error) {
+	var res []tag.Condition
+	for _, t := range tags {
+		k, v, err := tag.Parse(t)
+		if err != nil {
+			return nil, err
+		}
+		for i, rule := range h.rules {
+			if rule.Tag != k || v == "" {
+				continue
+			}
+			if res == nil {
+				res = make([]tag.Condition, len(h.rules))
+			}
+			if res[i], err = tag.ParseCondition(toCondition(v, rule.Length)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+func toCondition(v string, length bool) string {
+	if strings.ContainsAny(v, "[(") {
+		return v
+	}
+	if length {
+		return "between[0," + v + "]"
+	}
+	return "in[" + v + "]"
+}
+
+// fieldValues returns values to check, an array is checked by each element
+func fieldValues(f interface{}, length bool) ([]string, error) {
+	switch v := f.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if length {
+			return []string{strconv.Itoa(utf8.RuneCountInString(v))}, nil
+		}
+		return []string{v}, nil
+	case float64:
+		if length {
+			return nil, fmt.Errorf("not a string")
+		}
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case bool:
+		if length {
+			return nil, fmt.Errorf("not a string")
+		}
+		return []string{strconv.FormatBool(v)}, nil
+	case []interface{}:
+		var res []string
+		for _, e := range v {
+			if _, ok := e.([]interface{}); ok {
+				return nil, fmt.Errorf("nested array")
+			}
+			ev, err := fieldValues(e, length)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, ev...)
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("unsupported type")
+}
+
+func (h *entitlements) Info(pr string) string {
+	var rs []string
+	for _, r := range h.rules {
+		if r.Length {
+			rs = append(rs, fmt.Sprintf("%s=len(%s)", r.Tag, r.Field))
+		} else {
+			rs = append(rs, fmt.Sprintf("%s=%s", r.Tag, r.Field))
+		}
+	}
+	return pr + fmt.Sprintf("Entitlements(%s)\n", strings.Join(rs, ", ")) + GetInfo(LogShitf(pr), h.next)
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRules = []EntitlementRule{{Tag: "voices", Field: "voice"}, {Tag: "maxChars", Field: "text", Length: true},
+	{Tag: "formats", Field: "outputFormat"}}
+
+func TestEntitlements(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		body string
+		want int
+	}{
+		{name: "no tags", body: `{"voice":"other"}`, want: testCode},
+		{name: "no tags, no json", body: `olia`, want: testCode},
+		{name: "other tags", tags: []string{"x-olia:1"}, body: `olia`, want: testCode},
+		{name: "in", tags: []string{"voices:in[astra,laura]"}, body: `{"voice":"laura"}`, want: testCode},
+		{name: "not in", tags: []string{"voices:in[astra,laura]"}, body: `{"voice":"other"}`, want: 403},
+		{name: "plain", tags: []string{"voices:astra"}, body: `{"voice":"astra"}`, want: testCode},
+		{name: "plain fail", tags: []string{"voices:astra"}, body: `{"voice":"laura"}`, want: 403},
+		{name: "no field", tags: []string{"voices:in[astra]"}, body: `{"text":"olia"}`, want: testCode},
+		{name: "max length", tags: []string{"maxChars:5"}, body: `{"text":"ąčęėį"}`, want: testCode},
+		{name: "max length fail", tags: []string{"maxChars:5"}, body: `{"text":"ąčęėįš"}`, want: 403},
+		{name: "length range fail", tags: []string{"maxChars:between[2,5]"}, body: `{"text":"a"}`, want: 403},
+		{name: "length not string", tags: []string{"maxChars:5"}, body: `{"text":10}`, want: 400},
+		{name: "array", tags: []string{"formats:in[mp3,wav]"}, body: `{"outputFormat":["mp3","wav"]}`, want: testCode},
+		{name: "array fail", tags: []string{"formats:in[mp3,wav]"}, body: `{"outputFormat":["mp3","flac"]}`, want: 403},
+		{name: "number", tags: []string{"formats:in[1,2]"}, body: `{"outputFormat":2}`, want: testCode},
+		{name: "object", tags: []string{"formats:in[1,2]"}, body: `{"outputFormat":{"a":1}}`, want: 400},
+		{name: "all", tags: []string{"voices:in[astra]", "maxChars:10", "formats:mp3"},
+			body: `{"voice":"astra","text":"olia","outputFormat":"mp3"}`, want: testCode},
+		{name: "all fail", tags: []string{"voices:in[astra]", "maxChars:10", "formats:mp3"},
+			body: `{"voice":"astra","text":"olia olia olia","outputFormat":"mp3"}`, want: 403},
+		{name: "wrong json", tags: []string{"voices:in[astra]"}, body: `{"voice":`, want: 400},
+		{name: "wrong tag", tags: []string{"voices"}, body: `{"voice":"astra"}`, want: 500},
+		{name: "wrong condition", tags: []string{"voices:in[astra"}, body: `{"voice":"astra"}`, want: 500},
+		{name: "composed", tags: []string{"voices:not in[laura] and prefix[a]"}, body: `{"voice":"astra"}`, want: testCode},
+		{name: "composed fail", tags: []string{"voices:not in[laura] and prefix[a]"}, body: `{"voice":"laura"}`, want: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(tt.body)))
+			ctx.Tags = tt.tags
+			resp := httptest.NewRecorder()
+			h, err := Entitlements(newTestHandler(), testRules)
+			require.Nil(t, err)
+			h.ServeHTTP(resp, req)
+			assert.Equal(t, tt.want, resp.Code)
+		})
+	}
+}
+
+func TestEntitlements_Body(t *testing.T) {
+	tests := []struct {
+		name string
+		body io.Reader
+		want int
+	}{
+		{name: "too large", body: strings.NewReader(`{"voice":"` + strings.Repeat("a", _maxJSONBodySize) + `"}`), want: 413},
+		{name: "read fail", body: iotest.ErrReader(errors.New("olia")), want: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, ctx := customContext(httptest.NewRequest("POST", "/duration", tt.body))
+			ctx.Tags = []string{"voices:in[astra]"}
+			resp := httptest.NewRecorder()
+			h, err := Entitlements(newTestHandler(), testRules)
+			require.Nil(t, err)
+			h.ServeHTTP(resp, req)
+			assert.Equal(t, tt.want, resp.Code)
+		})
+	}
+}
+
+func TestEntitlements_PassesBody(t *testing.T) {
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(`{"voice":"astra"}`)))
+	ctx.Tags = []string{"voices:in[astra]"}
+	resp := httptest.NewRecorder()
+	th := newTestHandler()
+	h, err := Entitlements(th, testRules)
+	require.Nil(t, err)
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+	b, _ := io.ReadAll(th.r.Body)
+	assert.Equal(t, `{"voice":"astra"}`, string(b))
+}
+
+func TestEntitlements_Reason(t *testing.T) {
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(`{"voice":"other"}`)))
+	ctx.Tags = []string{"voices:in[astra,laura]"}
+	resp := httptest.NewRecorder()
+	h, err := Entitlements(newTestHandler(), testRules)
+	require.Nil(t, err)
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, 403, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Key does not allow voice")
+}
+
+func TestEntitlements_Fail(t *testing.T) {
+	_, err := Entitlements(newTestHandler(), nil)
+	assert.NotNil(t, err)
+	_, err = Entitlements(newTestHandler(), []EntitlementRule{{Tag: "voices"}})
+	assert.NotNil(t, err)
+}
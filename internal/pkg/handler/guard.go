@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// FailureGuard tracks failed authentication attempts by IP
+type FailureGuard interface {
+	Blocked(ctx context.Context, ip string) (time.Duration, error)
+	Fail(ctx context.Context, ip string) (time.Duration /*delay*/, error)
+}
+
+// checkBlocked returns the remaining block time of the IP, guard errors do not block
+func checkBlocked(ctx context.Context, g FailureGuard, ip string) time.Duration {
+	if g == nil {
+		return 0
+	}
+	res, err := g.Blocked(ctx, ip)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("can't check IP block")
+		return 0
+	}
+	return res
+}
+
+// fail records the failed attempt and waits for the delay given by the guard
+func fail(ctx context.Context, g FailureGuard, ip string) {
+	if g == nil {
+		return
+	}
+	delay, err := g.Fail(ctx, ip)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("can't record failure")
+		return
+	}
+	if delay <= 0 {
+		return
+	}
+	log.Ctx(ctx).Debug().Str("ip", ip).Dur("delay", delay).Msg("Delay failed attempt")
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
+
+func writeBlocked(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", retryAfterStr(retryAfter))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+func retryAfterStr(d time.Duration) string {
+	return fmt.Sprintf("%d", int64(math.Ceil(d.Seconds())))
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/airenas/api-doorman/internal/pkg/utils"
@@ -16,20 +17,25 @@ type IPSaver interface {
 type ipAsKey struct {
 	next    http.Handler
 	ipSaver IPSaver
+	v4Bits  int
+	v6Bits  int
 }
 
-// IPAsKey creates handler
-func IPAsKey(next http.Handler, ipSaver IPSaver) http.Handler {
+// IPAsKey creates handler, the quota is shared by the IP network of v4Bits/v6Bits prefix length, zero means exact IP
+func IPAsKey(next http.Handler, ipSaver IPSaver, v4Bits, v6Bits int) http.Handler {
 	res := &ipAsKey{}
 	res.next = next
 	res.ipSaver = ipSaver
+	res.v4Bits = v4Bits
+	res.v6Bits = v6Bits
 	return res
 }
 
 func (h *ipAsKey) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	rn, ctx := customContext(r)
-	key := utils.ExtractIP(r)
-	log.Debug().Msgf("IP: %s, IP header: '%s'", key, utils.GetIPHeader(r))
+	ip := utils.ExtractIP(r)
+	key := utils.IPKey(ip, h.v4Bits, h.v6Bits)
+	log.Debug().Msgf("IP: %s, key: %s, IP header: '%s'", ip, key, utils.GetIPHeader(r))
 	ctx.Key = key
 	id, err := h.ipSaver.Save(rn.Context(), key)
 	if err != nil {
@@ -42,5 +48,5 @@ func (h *ipAsKey) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ipAsKey) Info(pr string) string {
-	return pr + "IPAsKey\n" + GetInfo(LogShitf(pr), h.next)
+	return pr + fmt.Sprintf("IPAsKey(/%d, /%d)\n", h.v4Bits, h.v6Bits) + GetInfo(LogShitf(pr), h.next)
 }
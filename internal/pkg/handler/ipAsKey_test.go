@@ -24,18 +24,29 @@ func TestIP(t *testing.T) {
 	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
 	resp := httptest.NewRecorder()
 
-	IPAsKey(newTestHandler(), ipSaverMock).ServeHTTP(resp, req)
+	IPAsKey(newTestHandler(), ipSaverMock, 0, 0).ServeHTTP(resp, req)
 	_, str := ipSaverMock.VerifyWasCalledOnce().Save(pegomock.Any[context.Context](), pegomock.Any[string]()).GetCapturedArguments()
 	assert.Equal(t, 555, resp.Code)
 	assert.Equal(t, "192.0.2.1", str)
 	assert.Equal(t, "192.0.2.1", ctx.Key)
 }
 
+func TestIP_Subnet(t *testing.T) {
+	initIPTest(t)
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+	resp := httptest.NewRecorder()
+
+	IPAsKey(newTestHandler(), ipSaverMock, 24, 64).ServeHTTP(resp, req)
+	_, str := ipSaverMock.VerifyWasCalledOnce().Save(pegomock.Any[context.Context](), pegomock.Any[string]()).GetCapturedArguments()
+	assert.Equal(t, "192.0.2.0/24", str)
+	assert.Equal(t, "192.0.2.0/24", ctx.Key)
+}
+
 func TestIP_Fail(t *testing.T) {
 	initIPTest(t)
 	pegomock.When(ipSaverMock.Save(pegomock.Any[context.Context](), pegomock.Any[string]())).ThenReturn("", errors.New("olia"))
 	req := httptest.NewRequest("POST", "/duration", nil)
 	resp := httptest.NewRecorder()
-	IPAsKey(newTestHandler(), ipSaverMock).ServeHTTP(resp, req)
+	IPAsKey(newTestHandler(), ipSaverMock, 0, 0).ServeHTTP(resp, req)
 	assert.Equal(t, 500, resp.Code)
 }
@@ -6,21 +6,50 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
+	"github.com/airenas/api-doorman/internal/pkg/utils/jsonpath"
 	"github.com/rs/zerolog/log"
 )
 
+// JSONFieldMode defines how the selected JSON values become the quota
+type JSONFieldMode string
+
+const (
+	// JSONFieldText takes the one selected string, the quota is its length
+	JSONFieldText JSONFieldMode = ""
+	// JSONFieldSum takes all selected strings, the quota is the sum of their lengths
+	JSONFieldSum JSONFieldMode = "sum"
+	// JSONFieldCount sets the quota to the count of the selected array items
+	JSONFieldCount JSONFieldMode = "count"
+)
+
 type jsonField struct {
 	next  http.Handler
-	field string
+	field *jsonpath.Path
+	mode  JSONFieldMode
 }
 
-// TakeJSON creates handler
-func TakeJSON(next http.Handler, field string) http.Handler {
+// TakeJSON creates handler, field is a jsonpath.Path selector.
+// Text and sum modes set the value of the selected text for JSONAsQuota, count mode sets the quota value
+func TakeJSON(next http.Handler, field string, mode JSONFieldMode) (http.Handler, error) {
+	p, err := jsonpath.Parse(field)
+	if err != nil {
+		return nil, err
+	}
+	switch mode {
+	case JSONFieldText, JSONFieldSum, JSONFieldCount:
+	default:
+		return nil, fmt.Errorf("wrong mode '%s', expected %s or %s", mode, JSONFieldSum, JSONFieldCount)
+	}
+	if mode == JSONFieldText && p.Wildcard() {
+		return nil, fmt.Errorf("path '%s' selects several values, use mode %s or %s", field, JSONFieldSum, JSONFieldCount)
+	}
 	res := &jsonField{}
 	res.next = next
-	res.field = field
-	return res
+	res.field = p
+	res.mode = mode
+	return res, nil
 }
 
 func (h *jsonField) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -28,31 +57,60 @@ func (h *jsonField) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// read all bytes from content body and create new stream using it.
 	bodyBytes, _ := io.ReadAll(r.Body)
-	var data map[string]interface{}
+	var data interface{}
 	err := json.Unmarshal(bodyBytes, &data)
 	if err != nil {
-		http.Error(w, "No field "+h.field, http.StatusBadRequest)
+		http.Error(w, "Can't parse JSON body", http.StatusBadRequest)
 		log.Error().Err(err).Msg("Can't extract json field")
 		return
 	}
-	f := data[h.field]
-	if f == nil {
-		http.Error(w, "No field "+h.field, http.StatusBadRequest)
-		log.Error().Msgf("No json field. ")
+	values, err := h.field.Find(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Wrong field %s: %v", h.field, err), http.StatusBadRequest)
+		log.Error().Err(err).Msg("No json field")
 		return
 	}
-	var ok bool
-	ctx.Value, ok = f.(string)
-	if !ok {
-		http.Error(w, "Field is not string type "+h.field, http.StatusBadRequest)
-		log.Error().Msgf("Field is not a string %v", f)
-		return
+	if h.mode == JSONFieldCount {
+		count, err := h.count(values)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Wrong field %s: %v", h.field, err), http.StatusBadRequest)
+			log.Error().Err(err).Msg("Can't count json field")
+			return
+		}
+		ctx.QuotaValue = float64(count)
+	} else {
+		texts := make([]string, 0, len(values))
+		for _, v := range values {
+			s, ok := v.(string)
+			if !ok {
+				http.Error(w, "Field is not string type "+h.field.String(), http.StatusBadRequest)
+				log.Error().Msgf("Field is not a string %v", v)
+				return
+			}
+			texts = append(texts, s)
+		}
+		ctx.Value = strings.Join(texts, "")
 	}
 	rn.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	h.next.ServeHTTP(w, rn)
 }
 
+// count returns the count of matches for a wildcard path, or the length of the selected array
+func (h *jsonField) count(values []interface{}) (int, error) {
+	if h.field.Wildcard() {
+		return len(values), nil
+	}
+	a, ok := values[0].([]interface{})
+	if !ok {
+		return 0, fmt.Errorf("not an array")
+	}
+	return len(a), nil
+}
+
 func (h *jsonField) Info(pr string) string {
+	if h.mode != JSONFieldText {
+		return pr + fmt.Sprintf("JSONField(%s, %s)\n", h.field, h.mode) + GetInfo(LogShitf(pr), h.next)
+	}
 	return pr + fmt.Sprintf("JSONField(%s)\n", h.field) + GetInfo(LogShitf(pr), h.next)
 }
@@ -1,18 +1,20 @@
 package handler
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestJSON(t *testing.T) {
 	req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(`{"body":"olia"}`)))
 	resp := httptest.NewRecorder()
 
-	TakeJSON(newTestHandler(), "body").ServeHTTP(resp, req)
+	newTestJSON(t, "body", JSONFieldText).ServeHTTP(resp, req)
 	assert.Equal(t, testCode, resp.Code)
 	assert.Equal(t, "olia", ctx.Value)
 }
@@ -21,7 +23,7 @@ func TestJSON_Nil(t *testing.T) {
 	req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(`{"body":"olia"}`)))
 	resp := httptest.NewRecorder()
 
-	TakeJSON(newTestHandler(), "body1").ServeHTTP(resp, req)
+	newTestJSON(t, "body1", JSONFieldText).ServeHTTP(resp, req)
 	assert.Equal(t, "", ctx.Value)
 	assert.Equal(t, 400, resp.Code)
 }
@@ -30,7 +32,7 @@ func TestJSON_Empty(t *testing.T) {
 	req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(`{"body":""}`)))
 	resp := httptest.NewRecorder()
 
-	TakeJSON(newTestHandler(), "body").ServeHTTP(resp, req)
+	newTestJSON(t, "body", JSONFieldText).ServeHTTP(resp, req)
 	assert.Equal(t, "", ctx.Value)
 	assert.Equal(t, testCode, resp.Code)
 }
@@ -39,7 +41,7 @@ func TestJSON_Fail(t *testing.T) {
 	req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(`{"body":"olia}`)))
 	resp := httptest.NewRecorder()
 
-	TakeJSON(newTestHandler(), "body1").ServeHTTP(resp, req)
+	newTestJSON(t, "body1", JSONFieldText).ServeHTTP(resp, req)
 	assert.Equal(t, "", ctx.Value)
 	assert.Equal(t, 400, resp.Code)
 }
@@ -48,7 +50,7 @@ func TestJSON_FailNotString(t *testing.T) {
 	req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(`{"body":10}`)))
 	resp := httptest.NewRecorder()
 
-	TakeJSON(newTestHandler(), "body").ServeHTTP(resp, req)
+	newTestJSON(t, "body", JSONFieldText).ServeHTTP(resp, req)
 	assert.Equal(t, "", ctx.Value)
 	assert.Equal(t, 400, resp.Code)
 }
@@ -57,7 +59,75 @@ func TestJSON_Parses(t *testing.T) {
 	req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(`{"body":"10", "opa": 20, "hi":true,"a":["aa"]}`)))
 	resp := httptest.NewRecorder()
 
-	TakeJSON(newTestHandler(), "body").ServeHTTP(resp, req)
+	newTestJSON(t, "body", JSONFieldText).ServeHTTP(resp, req)
 	assert.Equal(t, "10", ctx.Value)
 	assert.Equal(t, testCode, resp.Code)
 }
+
+func TestJSON_Path(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		mode      JSONFieldMode
+		body      string
+		want      int
+		wantValue string
+		wantQuota float64
+	}{
+		{name: "nested", path: "input.text", body: `{"input":{"text":"olia"}}`, want: testCode, wantValue: "olia"},
+		{name: "root", path: "$.input.text", body: `{"input":{"text":"olia"}}`, want: testCode, wantValue: "olia"},
+		{name: "index", path: "segments[1].text", body: `{"segments":[{"text":"a"},{"text":"bb"}]}`, want: testCode, wantValue: "bb"},
+		{name: "sum", path: "segments[*].text", mode: JSONFieldSum, body: `{"segments":[{"text":"a"},{"text":"bb"}]}`,
+			want: testCode, wantValue: "abb"},
+		{name: "sum one", path: "text", mode: JSONFieldSum, body: `{"text":"olia"}`, want: testCode, wantValue: "olia"},
+		{name: "sum empty", path: "segments[*].text", mode: JSONFieldSum, body: `{"segments":[]}`, want: testCode},
+		{name: "count array", path: "segments", mode: JSONFieldCount, body: `{"segments":["a","b","c"]}`, want: testCode, wantQuota: 3},
+		{name: "count wildcard", path: "segments[*]", mode: JSONFieldCount, body: `{"segments":[{},{}]}`, want: testCode, wantQuota: 2},
+		{name: "count empty", path: "segments", mode: JSONFieldCount, body: `{"segments":[]}`, want: testCode},
+		{name: "count not array", path: "segments", mode: JSONFieldCount, body: `{"segments":"a"}`, want: 400},
+		{name: "missing", path: "input.text", body: `{"input":{"txt":"olia"}}`, want: 400},
+		{name: "missing parent", path: "input.text", body: `{"text":"olia"}`, want: 400},
+		{name: "not object", path: "input.text", body: `{"input":"olia"}`, want: 400},
+		{name: "no index", path: "segments[2].text", body: `{"segments":[{"text":"a"}]}`, want: 400},
+		{name: "missing in item", path: "segments[*].text", mode: JSONFieldSum, body: `{"segments":[{"text":"a"},{}]}`, want: 400},
+		{name: "sum not string", path: "segments[*].text", mode: JSONFieldSum, body: `{"segments":[{"text":"a"},{"text":1}]}`, want: 400},
+		{name: "not array", path: "segments[*].text", mode: JSONFieldSum, body: `{"segments":{"text":"a"}}`, want: 400},
+		{name: "array body", path: "[*].text", mode: JSONFieldSum, body: `[{"text":"a"},{"text":"b"}]`, want: testCode, wantValue: "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, ctx := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(tt.body)))
+			resp := httptest.NewRecorder()
+			newTestJSON(t, tt.path, tt.mode).ServeHTTP(resp, req)
+			assert.Equal(t, tt.want, resp.Code)
+			assert.Equal(t, tt.wantValue, ctx.Value)
+			assert.Equal(t, tt.wantQuota, ctx.QuotaValue)
+		})
+	}
+}
+
+func TestJSON_PathReason(t *testing.T) {
+	req, _ := customContext(httptest.NewRequest("POST", "/duration", strings.NewReader(`{"input":{"txt":"olia"}}`)))
+	resp := httptest.NewRecorder()
+	newTestJSON(t, "input.text", JSONFieldText).ServeHTTP(resp, req)
+	assert.Equal(t, 400, resp.Code)
+	assert.Contains(t, resp.Body.String(), "no field $.input.text")
+}
+
+func TestTakeJSON_Fail(t *testing.T) {
+	_, err := TakeJSON(newTestHandler(), "", JSONFieldText)
+	assert.NotNil(t, err)
+	_, err = TakeJSON(newTestHandler(), "a[", JSONFieldText)
+	assert.NotNil(t, err)
+	_, err = TakeJSON(newTestHandler(), "a[*]", JSONFieldText)
+	assert.NotNil(t, err)
+	_, err = TakeJSON(newTestHandler(), "a", "olia")
+	assert.NotNil(t, err)
+}
+
+func newTestJSON(t *testing.T, path string, mode JSONFieldMode) http.Handler {
+	t.Helper()
+	res, err := TakeJSON(newTestHandler(), path, mode)
+	require.Nil(t, err)
+	return res
+}
@@ -2,46 +2,83 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/randkey"
+	"github.com/airenas/api-doorman/internal/pkg/utils"
 	"github.com/rs/zerolog/log"
 )
 
 // KeyValidator validator
 type KeyValidator interface {
-	IsValid(ctx context.Context, key string, ip string, manual bool) (bool /*valid*/, string /*id*/, []string /*tags*/, error)
+	IsValid(ctx context.Context, key string, ip string, manual bool) (bool /*valid*/, *model.KeyInfo, error)
 }
 
 type keyValid struct {
-	next http.Handler
-	kv   KeyValidator
+	next        http.Handler
+	kv          KeyValidator
+	guard       FailureGuard
+	keyPrefixes []string
 }
 
-// KeyValid creates handler
-func KeyValid(next http.Handler, kv KeyValidator) http.Handler {
+// KeyValid creates handler, guard may be nil.
+// The checksum of keys with keyPrefixes is checked before the lookup, a malformed key counts as a failure
+func KeyValid(next http.Handler, kv KeyValidator, guard FailureGuard, keyPrefixes []string) http.Handler {
 	res := &keyValid{}
 	res.kv = kv
 	res.next = next
+	res.guard = guard
+	res.keyPrefixes = keyPrefixes
 	return res
 }
 
 func (h *keyValid) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	rn, ctx := customContext(r)
-	ok, id, tags, err := h.kv.IsValid(r.Context(), ctx.Key, ctx.IP, ctx.Manual)
+	if ctx.Manual {
+		if retryAfter := checkBlocked(r.Context(), h.guard, ctx.IP); retryAfter > 0 {
+			log.Ctx(r.Context()).Warn().Str("ip", ctx.IP).Msg("IP is blocked")
+			writeBlocked(w, retryAfter)
+			return
+		}
+		if err := randkey.Validate(ctx.Key, h.keyPrefixes); err != nil {
+			log.Ctx(r.Context()).Info().Err(err).Msg("malformed key")
+			fail(r.Context(), h.guard, ctx.IP)
+			http.Error(w, "Key is not valid", http.StatusUnauthorized)
+			return
+		}
+	}
+	ok, info, err := h.kv.IsValid(r.Context(), ctx.Key, ctx.IP, ctx.Manual)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		log.Error().Err(err).Msg("can't check key")
 		return
 	}
 	if !ok {
+		if ctx.Manual {
+			fail(r.Context(), h.guard, ctx.IP)
+		}
 		http.Error(w, "Key is not valid", http.StatusUnauthorized)
 		return
 	}
-	ctx.Tags = tags
-	ctx.KeyID = id
-	if ctx.RateLimitValue, err = getLimitSetting(tags); err != nil {
+	ctx.Tags = info.Tags
+	ctx.KeyID = info.ID
+	ctx.OldKey = info.OldKey
+	ctx.Scopes = info.Scopes
+	if len(info.AllowedOrigins) > 0 {
+		origin := utils.RequestOrigin(r)
+		if !utils.MatchOrigin(info.AllowedOrigins, origin) {
+			log.Ctx(r.Context()).Info().Str("id", info.ID).Str("origin", origin).Msg("Origin is not allowed")
+			http.Error(w, "Origin is not allowed", http.StatusForbidden)
+			return
+		}
+		ctx.Publishable = true
+		setCORSOrigin(w, r)
+	}
+	if ctx.RateLimitValue, err = getLimitSetting(info.Tags); err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		log.Error().Err(err).Msg("can't check rate limit setting")
 		return
@@ -62,5 +99,9 @@ func getLimitSetting(tags []string) (int64, error) {
 }
 
 func (h *keyValid) Info(pr string) string {
-	return pr + "KeyValid\n" + GetInfo(LogShitf(pr), h.next)
+	gStr := "no guard"
+	if ip, ok := h.guard.(infoProvider); ok {
+		gStr = ip.Info("")
+	}
+	return pr + fmt.Sprintf("KeyValid(%s)\n", gStr) + GetInfo(LogShitf(pr), h.next)
 }
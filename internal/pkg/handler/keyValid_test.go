@@ -5,7 +5,9 @@ import (
 	"errors"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/airenas/api-doorman/internal/pkg/model"
 	"github.com/airenas/api-doorman/internal/pkg/test/mocks"
 	"github.com/petergtz/pegomock/v4"
 	"github.com/stretchr/testify/assert"
@@ -26,8 +28,8 @@ func TestKeyValid(t *testing.T) {
 	ctx.Manual = true
 	resp := httptest.NewRecorder()
 	pegomock.When(keyValidatorMock.IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())).
-		ThenReturn(true, "id1", []string{"olia"}, nil)
-	KeyValid(newTestHandler(), keyValidatorMock).ServeHTTP(resp, req)
+		ThenReturn(true, &model.KeyInfo{ID: "id1", Tags: []string{"olia"}, OldKey: true, Scopes: []string{"GET tts"}}, nil)
+	KeyValid(newTestHandler(), keyValidatorMock, nil, nil).ServeHTTP(resp, req)
 	assert.Equal(t, testCode, resp.Code)
 	assert.Equal(t, []string{"olia"}, ctx.Tags)
 	_, cKey, cIP, cM := keyValidatorMock.VerifyWasCalledOnce().IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]()).GetCapturedArguments()
@@ -36,6 +38,8 @@ func TestKeyValid(t *testing.T) {
 	assert.True(t, cM)
 
 	assert.Equal(t, "id1", ctx.KeyID)
+	assert.True(t, ctx.OldKey)
+	assert.Equal(t, []string{"GET tts"}, ctx.Scopes)
 }
 
 func TestKeyValid_Unauthorized(t *testing.T) {
@@ -45,8 +49,8 @@ func TestKeyValid_Unauthorized(t *testing.T) {
 	ctx.Manual = true
 	resp := httptest.NewRecorder()
 	pegomock.When(keyValidatorMock.IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())).
-		ThenReturn(false, "", nil, nil)
-	KeyValid(newTestHandler(), keyValidatorMock).ServeHTTP(resp, req)
+		ThenReturn(false, nil, nil)
+	KeyValid(newTestHandler(), keyValidatorMock, nil, nil).ServeHTTP(resp, req)
 	assert.Equal(t, 401, resp.Code)
 }
 
@@ -57,11 +61,104 @@ func TestKeyValid_Fail(t *testing.T) {
 	ctx.Manual = true
 	resp := httptest.NewRecorder()
 	pegomock.When(keyValidatorMock.IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())).
-		ThenReturn(false, "", nil, errors.New("olia"))
-	KeyValid(newTestHandler(), keyValidatorMock).ServeHTTP(resp, req)
+		ThenReturn(false, nil, errors.New("olia"))
+	KeyValid(newTestHandler(), keyValidatorMock, nil, nil).ServeHTTP(resp, req)
 	assert.Equal(t, 500, resp.Code)
 }
 
+func TestKeyValid_Blocked(t *testing.T) {
+	initKeyValidatorTest(t)
+	guard := mocks.NewMockFailureGuard()
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+	ctx.Key = "kkk"
+	ctx.IP = "1.2.3.4"
+	ctx.Manual = true
+	resp := httptest.NewRecorder()
+	pegomock.When(guard.Blocked(pegomock.Any[context.Context](), pegomock.Any[string]())).ThenReturn(1500*time.Millisecond, nil)
+	KeyValid(newTestHandler(), keyValidatorMock, guard, nil).ServeHTTP(resp, req)
+	assert.Equal(t, 429, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get("Retry-After"))
+	keyValidatorMock.VerifyWasCalled(pegomock.Never()).IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())
+}
+
+func TestKeyValid_GuardFail(t *testing.T) {
+	initKeyValidatorTest(t)
+	guard := mocks.NewMockFailureGuard()
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+	ctx.Key = "kkk"
+	ctx.IP = "1.2.3.4"
+	ctx.Manual = true
+	resp := httptest.NewRecorder()
+	pegomock.When(guard.Blocked(pegomock.Any[context.Context](), pegomock.Any[string]())).ThenReturn(time.Duration(0), errors.New("olia"))
+	pegomock.When(guard.Fail(pegomock.Any[context.Context](), pegomock.Any[string]())).ThenReturn(time.Duration(0), nil)
+	pegomock.When(keyValidatorMock.IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())).
+		ThenReturn(false, nil, nil)
+	KeyValid(newTestHandler(), keyValidatorMock, guard, nil).ServeHTTP(resp, req)
+	assert.Equal(t, 401, resp.Code)
+	_, cIP := guard.VerifyWasCalledOnce().Fail(pegomock.Any[context.Context](), pegomock.Any[string]()).GetCapturedArguments()
+	assert.Equal(t, "1.2.3.4", cIP)
+}
+
+func TestKeyValid_GuardSkipsIPKey(t *testing.T) {
+	initKeyValidatorTest(t)
+	guard := mocks.NewMockFailureGuard()
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+	ctx.Key = "1.2.3.4"
+	ctx.IP = "1.2.3.4"
+	resp := httptest.NewRecorder()
+	pegomock.When(keyValidatorMock.IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())).
+		ThenReturn(false, nil, nil)
+	KeyValid(newTestHandler(), keyValidatorMock, guard, nil).ServeHTTP(resp, req)
+	assert.Equal(t, 401, resp.Code)
+	guard.VerifyWasCalled(pegomock.Never()).Fail(pegomock.Any[context.Context](), pegomock.Any[string]())
+	guard.VerifyWasCalled(pegomock.Never()).Blocked(pegomock.Any[context.Context](), pegomock.Any[string]())
+}
+
+func TestKeyValid_FailChecksum(t *testing.T) {
+	initKeyValidatorTest(t)
+	guard := mocks.NewMockFailureGuard()
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+	ctx.Key = "dm_live_abcdefghij123456"
+	ctx.IP = "1.2.3.4"
+	ctx.Manual = true
+	resp := httptest.NewRecorder()
+	pegomock.When(guard.Blocked(pegomock.Any[context.Context](), pegomock.Any[string]())).ThenReturn(time.Duration(0), nil)
+	pegomock.When(guard.Fail(pegomock.Any[context.Context](), pegomock.Any[string]())).ThenReturn(time.Duration(0), nil)
+	KeyValid(newTestHandler(), keyValidatorMock, guard, []string{"dm_live_"}).ServeHTTP(resp, req)
+	assert.Equal(t, 401, resp.Code)
+	_, cIP := guard.VerifyWasCalledOnce().Fail(pegomock.Any[context.Context](), pegomock.Any[string]()).GetCapturedArguments()
+	assert.Equal(t, "1.2.3.4", cIP)
+	keyValidatorMock.VerifyWasCalled(pegomock.Never()).IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())
+}
+
+func TestKeyValid_FailChecksumBlocked(t *testing.T) {
+	initKeyValidatorTest(t)
+	guard := mocks.NewMockFailureGuard()
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+	ctx.Key = "dm_live_abcdefghij123456"
+	ctx.IP = "1.2.3.4"
+	ctx.Manual = true
+	resp := httptest.NewRecorder()
+	pegomock.When(guard.Blocked(pegomock.Any[context.Context](), pegomock.Any[string]())).ThenReturn(time.Second, nil)
+	KeyValid(newTestHandler(), keyValidatorMock, guard, []string{"dm_live_"}).ServeHTTP(resp, req)
+	assert.Equal(t, 429, resp.Code)
+	guard.VerifyWasCalled(pegomock.Never()).Fail(pegomock.Any[context.Context](), pegomock.Any[string]())
+}
+
+func TestKeyValid_LegacyKey(t *testing.T) {
+	initKeyValidatorTest(t)
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+	ctx.Key = "imported_key_1"
+	ctx.Manual = true
+	resp := httptest.NewRecorder()
+	pegomock.When(keyValidatorMock.IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())).
+		ThenReturn(true, &model.KeyInfo{ID: "id1"}, nil)
+	KeyValid(newTestHandler(), keyValidatorMock, nil, []string{"dm_live_"}).ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+	_, cKey, _, _ := keyValidatorMock.VerifyWasCalledOnce().IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]()).GetCapturedArguments()
+	assert.Equal(t, "imported_key_1", cKey)
+}
+
 func Test_getLimitSetting(t *testing.T) {
 	type args struct {
 		tags []string
@@ -90,3 +187,53 @@ func Test_getLimitSetting(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyValid_Publishable(t *testing.T) {
+	initKeyValidatorTest(t)
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+	req.Header.Set("Origin", "https://a.example.com")
+	ctx.Key = "kkk"
+	ctx.Manual = true
+	resp := httptest.NewRecorder()
+	pegomock.When(keyValidatorMock.IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())).
+		ThenReturn(true, &model.KeyInfo{ID: "id1", AllowedOrigins: []string{"https://*.example.com"}}, nil)
+	KeyValid(newTestHandler(), keyValidatorMock, nil, nil).ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+	assert.True(t, ctx.Publishable)
+	assert.Equal(t, "https://a.example.com", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", resp.Header().Get("Vary"))
+}
+
+func TestKeyValid_PublishableReferer(t *testing.T) {
+	initKeyValidatorTest(t)
+	req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+	req.Header.Set("Referer", "https://example.com/page")
+	ctx.Key = "kkk"
+	ctx.Manual = true
+	resp := httptest.NewRecorder()
+	pegomock.When(keyValidatorMock.IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())).
+		ThenReturn(true, &model.KeyInfo{ID: "id1", AllowedOrigins: []string{"https://example.com"}}, nil)
+	KeyValid(newTestHandler(), keyValidatorMock, nil, nil).ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+	assert.Equal(t, "", resp.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestKeyValid_OriginNotAllowed(t *testing.T) {
+	for _, origin := range []string{"", "https://evil.com"} {
+		t.Run(origin, func(t *testing.T) {
+			initKeyValidatorTest(t)
+			req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+			if origin != "" {
+				req.Header.Set("Origin", origin)
+			}
+			ctx.Key = "kkk"
+			ctx.Manual = true
+			resp := httptest.NewRecorder()
+			pegomock.When(keyValidatorMock.IsValid(pegomock.Any[context.Context](), pegomock.Any[string](), pegomock.Any[string](), pegomock.Any[bool]())).
+				ThenReturn(true, &model.KeyInfo{ID: "id1", AllowedOrigins: []string{"https://example.com"}}, nil)
+			KeyValid(newTestHandler(), keyValidatorMock, nil, nil).ServeHTTP(resp, req)
+			assert.Equal(t, 403, resp.Code)
+			assert.Equal(t, "", resp.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
@@ -17,16 +17,18 @@ type DBSaver interface {
 }
 
 type logDB struct {
-	next http.Handler
-	dbs  DBSaver
-	sync bool
+	next  http.Handler
+	dbs   DBSaver
+	route string
+	sync  bool
 }
 
-// LogDB creates handler
-func LogDB(next http.Handler, dbs DBSaver, syncLog bool) http.Handler {
+// LogDB creates handler, route is the proxy handler name saved with each log
+func LogDB(next http.Handler, dbs DBSaver, route string, syncLog bool) http.Handler {
 	res := &logDB{}
 	res.next = next
 	res.dbs = dbs
+	res.route = route
 	res.sync = syncLog
 	return res
 }
@@ -45,9 +47,11 @@ func (h *logDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	data.Date = time.Now()
 	data.QuotaValue = ctx.QuotaValue
 	data.KeyID = strings.TrimSpace(ctx.KeyID)
+	data.OldKey = ctx.OldKey
 	data.RequestID = ctx.RequestID
 	data.IP = utils.ExtractIP(r)
 	data.URL = rn.URL.String()
+	data.Route = h.route
 	data.ResponseCode = ctx.ResponseCode
 	data.Fail = responseCodeIsFail(data.ResponseCode)
 	sf := func() {
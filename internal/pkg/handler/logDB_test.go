@@ -28,8 +28,9 @@ func TestLogDB(t *testing.T) {
 	ctx.Manual = true
 	ctx.Value = "value"
 	ctx.RequestID = "reqID"
+	ctx.OldKey = true
 	resp := httptest.NewRecorder()
-	h := LogDB(newTestHandler(), dbSaverMock, true).(*logDB)
+	h := LogDB(newTestHandler(), dbSaverMock, "test", true).(*logDB)
 	h.sync = true
 
 	h.ServeHTTP(resp, req)
@@ -37,10 +38,12 @@ func TestLogDB(t *testing.T) {
 	assert.Equal(t, testCode, resp.Code)
 	_, cLog := dbSaverMock.VerifyWasCalledOnce().SaveLog(pegomock.Any[context.Context](), pegomock.Any[*api.Log]()).GetCapturedArguments()
 	assert.Equal(t, "kkk", cLog.KeyID)
+	assert.True(t, cLog.OldKey)
 	assert.Equal(t, 555, cLog.ResponseCode)
 	assert.Equal(t, true, cLog.Fail)
 	assert.Equal(t, "192.0.2.1", cLog.IP)
 	assert.Equal(t, "/duration", cLog.URL)
+	assert.Equal(t, "test", cLog.Route)
 	assert.Equal(t, "reqID", cLog.RequestID)
 }
 
@@ -48,7 +51,7 @@ func TestLogDB_NoFail(t *testing.T) {
 	initLogDBTest(t)
 	req, _ := customContext(httptest.NewRequest("POST", "/duration", nil))
 	resp := httptest.NewRecorder()
-	h := LogDB(newTestHandler(), dbSaverMock, true).(*logDB)
+	h := LogDB(newTestHandler(), dbSaverMock, "test", true).(*logDB)
 	h.sync = true
 	pegomock.When(dbSaverMock.SaveLog(pegomock.Any[context.Context](), pegomock.Any[*api.Log]())).ThenReturn(errors.New("olia"))
 
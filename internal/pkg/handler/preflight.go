@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// OriginProvider returns the allowed origin patterns of the project's publishable keys
+type OriginProvider interface {
+	AllowedOrigins(ctx context.Context) ([]string, error)
+}
+
+const (
+	_originsRefresh  = time.Minute
+	_preflightMaxAge = "600"
+)
+
+type preflight struct {
+	next http.Handler
+	op   OriginProvider
+
+	lock      sync.Mutex
+	origins   []string
+	refreshed time.Time
+}
+
+// Preflight creates handler answering CORS preflights for the origins of publishable keys.
+// A preflight has no key, so it is allowed for any publishable key origin, KeyValid checks the actual request.
+// Other preflights are passed to the next handler
+func Preflight(next http.Handler, op OriginProvider) http.Handler {
+	return &preflight{next: next, op: op}
+}
+
+func (h *preflight) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isPreflight(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	origin := r.Header.Get("Origin")
+	if !utils.MatchOrigin(h.getOrigins(r.Context()), origin) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	setCORSOrigin(w, r)
+	addVary(w, "Access-Control-Request-Method")
+	addVary(w, "Access-Control-Request-Headers")
+	w.Header().Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+	if hs := r.Header.Get("Access-Control-Request-Headers"); hs != "" {
+		w.Header().Set("Access-Control-Allow-Headers", hs)
+	}
+	w.Header().Set("Access-Control-Max-Age", _preflightMaxAge)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getOrigins returns cached origins, on failure the old ones are kept
+func (h *preflight) getOrigins(ctx context.Context) []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if time.Since(h.refreshed) < _originsRefresh {
+		return h.origins
+	}
+	h.refreshed = time.Now()
+	res, err := h.op.AllowedOrigins(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("can't load allowed origins")
+		return h.origins
+	}
+	h.origins = res
+	return h.origins
+}
+
+func (h *preflight) Info(pr string) string {
+	return pr + "Preflight\n" + GetInfo(LogShitf(pr), h.next)
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// setCORSOrigin allows the request origin, it is set for CORS requests only
+func setCORSOrigin(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	addVary(w, "Origin")
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testOrigins struct {
+	origins []string
+	err     error
+	calls   int
+}
+
+func (o *testOrigins) AllowedOrigins(context.Context) ([]string, error) {
+	o.calls++
+	return o.origins, o.err
+}
+
+func TestPreflight(t *testing.T) {
+	op := &testOrigins{origins: []string{"https://example.com"}}
+	h := Preflight(newTestHandler(), op)
+	req := httptest.NewRequest("OPTIONS", "/duration", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "authorization,content-type")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, 204, resp.Code)
+	assert.Equal(t, "https://example.com", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "POST", resp.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "authorization,content-type", resp.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", resp.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, resp.Header().Values("Vary"))
+
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, 1, op.calls)
+}
+
+func TestPreflight_Pass(t *testing.T) {
+	op := &testOrigins{origins: []string{"https://example.com"}}
+	h := Preflight(newTestHandler(), op)
+
+	req := httptest.NewRequest("OPTIONS", "/duration", nil)
+	req.Header.Set("Origin", "https://other.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+	assert.Equal(t, "", resp.Header().Get("Access-Control-Allow-Origin"))
+
+	req = httptest.NewRequest("OPTIONS", "/duration", nil)
+	req.Header.Set("Origin", "https://example.com")
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+
+	req = httptest.NewRequest("POST", "/duration", nil)
+	req.Header.Set("Origin", "https://example.com")
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+}
+
+func TestPreflight_Fail(t *testing.T) {
+	op := &testOrigins{err: errors.New("olia")}
+	h := Preflight(newTestHandler(), op)
+	req := httptest.NewRequest("OPTIONS", "/duration", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/airenas/api-doorman/internal/pkg/pricing"
+	"github.com/airenas/api-doorman/internal/pkg/utils/tag"
+	"github.com/rs/zerolog/log"
+)
+
+type pricingRule struct {
+	next http.Handler
+	rule *pricing.Rule
+}
+
+// Pricing creates handler calculating the quota value by the rule,
+// it must be after the quota extraction and after KeyValid
+func Pricing(next http.Handler, rule *pricing.Rule) http.Handler {
+	res := &pricingRule{}
+	res.next = next
+	res.rule = rule
+	return res
+}
+
+func (h *pricingRule) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rn, ctx := customContext(r)
+	in := &pricing.Input{Quota: ctx.QuotaValue, Method: r.Method, Path: r.URL.Path, Body: map[string]interface{}{},
+		Query: map[string]string{}, Headers: map[string]string{}, Tags: map[string]string{}}
+	if h.rule.UsesBody() && isJSON(r) {
+		bodyBytes, ok := readJSONBody(w, r)
+		if !ok {
+			return
+		}
+		if len(bytes.TrimSpace(bodyBytes)) > 0 {
+			var data interface{}
+			if err := json.Unmarshal(bodyBytes, &data); err != nil {
+				http.Error(w, "Can't parse JSON body", http.StatusBadRequest)
+				log.Ctx(r.Context()).Info().Err(err).Msg("Can't read json body")
+				return
+			}
+			in.Body = data
+		}
+		rn.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	}
+	for k, v := range r.URL.Query() {
+		in.Query[k] = v[0]
+	}
+	for k, v := range r.Header {
+		in.Headers[strings.ToLower(k)] = v[0]
+	}
+	for _, t := range ctx.Tags {
+		if k, v, err := tag.Parse(t); err == nil && k != "" {
+			in.Tags[k] = v
+		}
+	}
+	v, err := h.rule.Calculate(r.Context(), in)
+	if err != nil {
+		var re *pricing.ResultError
+		if errors.As(err, &re) {
+			http.Error(w, "Service error", http.StatusInternalServerError)
+			log.Ctx(r.Context()).Error().Err(err).Msg("Wrong pricing result")
+			return
+		}
+		http.Error(w, fmt.Sprintf("Can't calculate quota: %v", err), http.StatusBadRequest)
+		log.Ctx(r.Context()).Info().Err(err).Msg("Can't calculate quota")
+		return
+	}
+	log.Ctx(r.Context()).Debug().Float64("base", ctx.QuotaValue).Float64("quota", v).Msg("Priced")
+	ctx.QuotaValue = v
+	h.next.ServeHTTP(w, rn)
+}
+
+func isJSON(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		// json quota handlers do not require the content type
+		return r.Header.Get("Content-Type") == ""
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+func (h *pricingRule) Info(pr string) string {
+	return pr + fmt.Sprintf("Pricing(%s)\n", h.rule) + GetInfo(LogShitf(pr), h.next)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/airenas/api-doorman/internal/pkg/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPricing(t *testing.T, expr, path string) *pricing.Rule {
+	t.Helper()
+	res, err := pricing.NewRule(expr, path)
+	require.Nil(t, err)
+	return res
+}
+
+func TestPricing(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		ct    string
+		body  string
+		tags  []string
+		want  int
+		quota float64
+	}{
+		{name: "base", expr: "quota * 2.0", body: `{}`, want: testCode, quota: 20},
+		{name: "body", expr: `quota * (body.voice == "laura" ? 1.5 : 1.0)`, body: `{"voice":"laura"}`, want: testCode, quota: 15},
+		{name: "body json type", expr: `quota * (body.voice == "laura" ? 1.5 : 1.0)`, ct: "application/json; charset=utf-8",
+			body: `{"voice":"laura"}`, want: testCode, quota: 15},
+		{name: "not json body", expr: `has(body.voice) ? 1 : 2`, ct: "text/plain", body: `olia`, want: testCode, quota: 2},
+		{name: "empty body", expr: `has(body.voice) ? 1 : 2`, want: testCode, quota: 2},
+		{name: "wrong body", expr: `has(body.voice) ? 1 : 2`, body: `{"voice":`, want: 400},
+		{name: "array body", expr: `quota * double(size(body))`, body: `[{"a":1},{"a":2}]`, want: testCode, quota: 20},
+		{name: "value body", expr: `body == "olia" ? 1 : 2`, body: `"olia"`, want: testCode, quota: 1},
+		{name: "too large body", expr: `has(body.voice) ? 1 : 2`, body: `{"voice":"` + strings.Repeat("a", _maxJSONBodySize) + `"}`, want: 413},
+		{name: "no body use", expr: `quota`, body: `{"voice":`, want: testCode, quota: 10},
+		{name: "tags", expr: `tags.?plan.orValue("") == "enterprise" ? quota * 0.5 : quota`, tags: []string{"plan:enterprise", "x-a:1"},
+			body: `{}`, want: testCode, quota: 5},
+		{name: "query", expr: `quota * double(query.speed)`, body: `{}`, want: testCode, quota: 30},
+		{name: "header", expr: `headers["x-plan"] == "pro" ? 1 : 2`, body: `{}`, want: testCode, quota: 1},
+		{name: "missing field", expr: `body.voice == "a" ? 1 : 2`, body: `{}`, want: 400},
+		{name: "negative", expr: `-quota`, body: `{}`, want: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, ctx := customContext(httptest.NewRequest("POST", "/synth/laura?speed=3", strings.NewReader(tt.body)))
+			if tt.ct != "" {
+				req.Header.Set("Content-Type", tt.ct)
+			}
+			req.Header.Set("X-Plan", "pro")
+			ctx.QuotaValue = 10
+			ctx.Tags = tt.tags
+			resp := httptest.NewRecorder()
+			Pricing(newTestHandler(), newTestPricing(t, tt.expr, "")).ServeHTTP(resp, req)
+			assert.Equal(t, tt.want, resp.Code)
+			if tt.want == testCode {
+				assert.Equal(t, tt.quota, ctx.QuotaValue)
+			}
+		})
+	}
+}
+
+func TestPricing_Vars(t *testing.T) {
+	req, ctx := customContext(httptest.NewRequest("POST", "/synth/laura", nil))
+	ctx.QuotaValue = 10
+	resp := httptest.NewRecorder()
+	Pricing(newTestHandler(), newTestPricing(t, `vars.voice == "laura" ? quota * 2.0 : quota`, "/synth/{voice}")).ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+	assert.Equal(t, 20.0, ctx.QuotaValue)
+}
+
+func TestPricing_PassesBody(t *testing.T) {
+	req, _ := customContext(httptest.NewRequest("POST", "/synth", strings.NewReader(`{"voice":"laura"}`)))
+	resp := httptest.NewRecorder()
+	th := newTestHandler()
+	Pricing(th, newTestPricing(t, `body.voice == "laura" ? 1 : 2`, "")).ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+	b, _ := io.ReadAll(th.r.Body)
+	assert.Equal(t, `{"voice":"laura"}`, string(b))
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 
 	"github.com/airenas/api-doorman/internal/pkg/utils"
 	"github.com/rs/zerolog/log"
@@ -16,13 +17,16 @@ import (
 )
 
 type proxy struct {
-	url *url.URL
+	url     *url.URL
+	ownCORS bool
 }
 
-// Proxy creates handler
-func Proxy(url *url.URL) http.Handler {
+// Proxy creates handler, ownCORS drops the backend's Access-Control-* headers as doorman sets them for the route.
+// They are dropped also for a request doorman has already allowed the origin for, e.g. of a publishable key
+func Proxy(url *url.URL, ownCORS bool) http.Handler {
 	res := &proxy{}
 	res.url = url
+	res.ownCORS = ownCORS
 	return res
 }
 
@@ -41,6 +45,9 @@ func (h *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	proxy := httputil.NewSingleHostReverseProxy(h.url)
 	proxy.ModifyResponse = func(resp *http.Response) (err error) {
 		ctx.ResponseCode = resp.StatusCode
+		if h.ownCORS || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			dropCORSHeaders(resp.Header)
+		}
 		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 		return nil
 	}
@@ -54,6 +61,17 @@ func (h *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	proxy.ServeHTTP(w, rn)
 }
 
+func dropCORSHeaders(header http.Header) {
+	for k := range header {
+		if strings.HasPrefix(k, "Access-Control-") {
+			header.Del(k)
+		}
+	}
+}
+
 func (h *proxy) Info(pr string) string {
+	if h.ownCORS {
+		return pr + fmt.Sprintf("Proxy (%s, own CORS)\n", h.url.String())
+	}
 	return pr + fmt.Sprintf("Proxy (%s)\n", h.url.String())
 }
@@ -18,7 +18,7 @@ func TestProxy_Response(t *testing.T) {
 	resp := httptest.NewRecorder()
 
 	surl, _ := url.Parse(server.URL)
-	Proxy(surl).ServeHTTP(resp, req)
+	Proxy(surl, false).ServeHTTP(resp, req)
 	assert.Equal(t, 442, resp.Code)
 	assert.Equal(t, 442, ctx.ResponseCode)
 }
@@ -28,7 +28,43 @@ func TestProxy_ErrorHandler(t *testing.T) {
 	resp := httptest.NewRecorder()
 
 	surl, _ := url.Parse("http://a")
-	Proxy(surl).ServeHTTP(resp, req)
+	Proxy(surl, false).ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusBadGateway, resp.Code)
 	assert.Equal(t, http.StatusBadGateway, ctx.ResponseCode)
 }
+
+func TestProxy_CORS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Access-Control-Allow-Origin", "*")
+		rw.Header().Set("Access-Control-Expose-Headers", "X-Backend")
+		rw.Header().Set("X-Backend", "1")
+		rw.WriteHeader(200)
+	}))
+	defer server.Close()
+	surl, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name    string
+		ownCORS bool
+		origin  string
+		want    []string
+	}{
+		{name: "backend", want: []string{"*"}},
+		{name: "own CORS", ownCORS: true, want: nil},
+		{name: "own CORS origin", ownCORS: true, origin: "https://a.lt", want: []string{"https://a.lt"}},
+		{name: "origin set by doorman", origin: "https://a.lt", want: []string{"https://a.lt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := customContext(httptest.NewRequest("POST", "/duration", nil))
+			resp := httptest.NewRecorder()
+			if tt.origin != "" {
+				resp.Header().Set("Access-Control-Allow-Origin", tt.origin)
+			}
+			Proxy(surl, tt.ownCORS).ServeHTTP(resp, req)
+			assert.Equal(t, 200, resp.Code)
+			assert.Equal(t, tt.want, resp.Header().Values("Access-Control-Allow-Origin"))
+			assert.Equal(t, "1", resp.Header().Get("X-Backend"))
+		})
+	}
+}
@@ -17,14 +17,18 @@ type rateLimitValidate struct {
 	next  http.Handler
 	qv    RateLimitValidator
 	limit int64
+	// ipLimit limits a client IP of a publishable key in addition to the key limit
+	ipLimit int64
 }
 
-// QuotaValidate creates handler
-func RateLimitValidate(next http.Handler, qv RateLimitValidator, limit int64) http.Handler {
+// RateLimitValidate creates handler, ipLimit is the limit per client IP of a publishable key,
+// the key itself is limited as any other key. Zero ipLimit disables the per IP limit
+func RateLimitValidate(next http.Handler, qv RateLimitValidator, limit, ipLimit int64) http.Handler {
 	res := &rateLimitValidate{}
 	res.qv = qv
 	res.next = next
 	res.limit = limit
+	res.ipLimit = ipLimit
 	return res
 }
 
@@ -39,12 +43,28 @@ func (h *rateLimitValidate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if limit <= 0 {
 		limit = h.limit
 	}
-	ok, rem, retryAfter, err := h.qv.Validate(makeRateLimitKey(idOrHash(cData), cData.Manual), int64(limit), int64(quotaV))
-	if err != nil {
-		http.Error(w, "Service error", http.StatusInternalServerError)
-		log.Ctx(ctx).Error().Err(err).Msg("can't validate rate limit")
-		cData.ResponseCode = http.StatusInternalServerError
-		return
+	key := idOrHash(cData)
+	ok, rem, retryAfter := true, int64(-1), int64(0)
+	if cData.Publishable && h.ipLimit > 0 {
+		// the key is shared by all browsers of the site, so one client can't exhaust it.
+		// The IP is checked first, a blocked client does not take the key's limit
+		var err error
+		ok, rem, retryAfter, err = h.qv.Validate(makeRateLimitKey(key+":"+cData.IP, cData.Manual), min(h.ipLimit, limit), int64(quotaV))
+		if err != nil {
+			h.serviceError(w, r, cData, err)
+			return
+		}
+	}
+	if ok {
+		kOK, kRem, kRetryAfter, err := h.qv.Validate(makeRateLimitKey(key, cData.Manual), limit, int64(quotaV))
+		if err != nil {
+			h.serviceError(w, r, cData, err)
+			return
+		}
+		ok, retryAfter = kOK, max(retryAfter, kRetryAfter)
+		if rem < 0 || (kRem >= 0 && kRem < rem) {
+			rem = kRem
+		}
 	}
 	log.Ctx(ctx).Debug().Msgf("Quota value: %.2f, rem: %d, time: %d, rate limit: %d", quotaV, rem, retryAfter, limit)
 	if rem >= 0 {
@@ -61,6 +81,12 @@ func (h *rateLimitValidate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.next.ServeHTTP(w, rn)
 }
 
+func (h *rateLimitValidate) serviceError(w http.ResponseWriter, r *http.Request, cData *customData, err error) {
+	http.Error(w, "Service error", http.StatusInternalServerError)
+	log.Ctx(r.Context()).Error().Err(err).Msg("can't validate rate limit")
+	cData.ResponseCode = http.StatusInternalServerError
+}
+
 func idOrHash(ctx *customData) string {
 	if ctx.KeyID != "" {
 		return ctx.KeyID
@@ -77,5 +103,5 @@ func (h *rateLimitValidate) Info(pr string) string {
 	if ip, ok := h.qv.(infoProvider); ok {
 		rStr = ip.Info("")
 	}
-	return pr + fmt.Sprintf("RateLimitValidate(%d, %s)\n", h.limit, rStr) + GetInfo(LogShitf(pr), h.next)
+	return pr + fmt.Sprintf("RateLimitValidate(%d, %d, %s)\n", h.limit, h.ipLimit, rStr) + GetInfo(LogShitf(pr), h.next)
 }
@@ -1,6 +1,12 @@
 package handler
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func Test_idOrHash(t *testing.T) {
 	type args struct {
@@ -22,3 +28,59 @@ func Test_idOrHash(t *testing.T) {
 		})
 	}
 }
+
+type testRateLimiter struct {
+	keys   []string
+	limits []int64
+	// fail blocks the key
+	fail string
+}
+
+func (l *testRateLimiter) Validate(key string, limit int64, _ int64) (bool, int64, int64, error) {
+	l.keys, l.limits = append(l.keys, key), append(l.limits, limit)
+	if key == l.fail {
+		return false, 0, 10, nil
+	}
+	return true, limit, 0, nil
+}
+
+func TestRateLimitValidate_Publishable(t *testing.T) {
+	tests := []struct {
+		name        string
+		publishable bool
+		tagLimit    int64
+		ipLimit     int64
+		fail        string
+		wantKeys    []string
+		wantLimits  []int64
+		wantCode    int
+		wantRem     string
+	}{
+		{name: "default", ipLimit: 10, wantKeys: []string{"id1:true"}, wantLimits: []int64{100}, wantCode: testCode, wantRem: "100"},
+		{name: "publishable", publishable: true, ipLimit: 10, wantKeys: []string{"id1:1.2.3.4:true", "id1:true"},
+			wantLimits: []int64{10, 100}, wantCode: testCode, wantRem: "10"},
+		{name: "no IP limit", publishable: true, wantKeys: []string{"id1:true"}, wantLimits: []int64{100}, wantCode: testCode, wantRem: "100"},
+		{name: "tag", publishable: true, ipLimit: 10, tagLimit: 50, wantKeys: []string{"id1:1.2.3.4:true", "id1:true"},
+			wantLimits: []int64{10, 50}, wantCode: testCode, wantRem: "10"},
+		{name: "tag lower", publishable: true, ipLimit: 10, tagLimit: 5, wantKeys: []string{"id1:1.2.3.4:true", "id1:true"},
+			wantLimits: []int64{5, 5}, wantCode: testCode, wantRem: "5"},
+		{name: "IP blocked", publishable: true, ipLimit: 10, fail: "id1:1.2.3.4:true", wantKeys: []string{"id1:1.2.3.4:true"},
+			wantLimits: []int64{10}, wantCode: http.StatusTooManyRequests, wantRem: "0"},
+		{name: "key blocked", publishable: true, ipLimit: 10, fail: "id1:true", wantKeys: []string{"id1:1.2.3.4:true", "id1:true"},
+			wantLimits: []int64{10, 100}, wantCode: http.StatusTooManyRequests, wantRem: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := &testRateLimiter{fail: tt.fail}
+			req, ctx := customContext(httptest.NewRequest("POST", "/duration", nil))
+			ctx.KeyID, ctx.IP, ctx.Manual = "id1", "1.2.3.4", true
+			ctx.Publishable, ctx.RateLimitValue = tt.publishable, tt.tagLimit
+			resp := httptest.NewRecorder()
+			RateLimitValidate(newTestHandler(), rl, 100, tt.ipLimit).ServeHTTP(resp, req)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantKeys, rl.keys)
+			assert.Equal(t, tt.wantLimits, rl.limits)
+			assert.Equal(t, tt.wantRem, resp.Header().Get("X-Rate-Limit-Short-Remaining"))
+		})
+	}
+}
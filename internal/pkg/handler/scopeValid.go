@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/airenas/api-doorman/internal/pkg/utils/scope"
+	"github.com/rs/zerolog/log"
+)
+
+type scopeValid struct {
+	next  http.Handler
+	route string
+}
+
+// ScopeValid creates handler checking the key scopes against the route name, method and path,
+// it must be after KeyValid. The path of a scoped key is cleaned, others pass untouched
+func ScopeValid(next http.Handler, route string) http.Handler {
+	res := &scopeValid{}
+	res.next = next
+	res.route = route
+	return res
+}
+
+func (h *scopeValid) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rn, ctx := customContext(r)
+	if len(ctx.Scopes) == 0 {
+		h.next.ServeHTTP(w, rn)
+		return
+	}
+	if !cleanPath(rn) {
+		http.Error(w, "Wrong path", http.StatusBadRequest)
+		log.Ctx(r.Context()).Info().Str("path", r.URL.RawPath).Msg("Encoded slash in path")
+		return
+	}
+	ok, err := scope.Allowed(ctx.Scopes, h.route, r.Method, rn.URL.Path)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		log.Ctx(r.Context()).Error().Err(err).Str("id", ctx.KeyID).Msg("can't check key scopes")
+		return
+	}
+	if !ok {
+		log.Ctx(r.Context()).Info().Str("id", ctx.KeyID).Str("method", r.Method).Str("path", r.URL.Path).Msg("Key scope does not allow")
+		http.Error(w, fmt.Sprintf("Key scope does not allow %s %s", r.Method, r.URL.Path), http.StatusForbidden)
+		return
+	}
+	h.next.ServeHTTP(w, rn)
+}
+
+// cleanPath removes '.' and '..' segments, so the path checked by the scopes is the one sent to the backend,
+// paths with encoded slashes are rejected
+func cleanPath(r *http.Request) bool {
+	if strings.Contains(strings.ToLower(r.URL.RawPath), "%2f") {
+		return false
+	}
+	res := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") && res != "/" {
+		res += "/"
+	}
+	r.URL.Path, r.URL.RawPath = res, ""
+	return true
+}
+
+func (h *scopeValid) Info(pr string) string {
+	return pr + fmt.Sprintf("ScopeValid(%s)\n", h.route) + GetInfo(LogShitf(pr), h.next)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeValid(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		method string
+		path   string
+		want   int
+	}{
+		{name: "no scopes", method: "POST", path: "/tts", want: testCode},
+		{name: "route", scopes: []string{"tts"}, method: "POST", path: "/tts", want: testCode},
+		{name: "other route", scopes: []string{"asr"}, method: "POST", path: "/tts", want: 403},
+		{name: "method", scopes: []string{"GET tts"}, method: "GET", path: "/tts", want: testCode},
+		{name: "other method", scopes: []string{"GET tts"}, method: "POST", path: "/tts", want: 403},
+		{name: "path", scopes: []string{"POST /tts/**"}, method: "POST", path: "/tts/synth", want: testCode},
+		{name: "other path", scopes: []string{"POST /tts/**"}, method: "POST", path: "/asr/synth", want: 403},
+		{name: "any", scopes: []string{"asr", "/tts/*"}, method: "POST", path: "/tts/synth", want: testCode},
+		{name: "traversal", scopes: []string{"/tts/**"}, method: "POST", path: "/tts/../clone", want: 403},
+		{name: "traversal inside", scopes: []string{"/tts/**"}, method: "POST", path: "/tts/a/../b", want: testCode},
+		{name: "dot", scopes: []string{"/tts/*"}, method: "POST", path: "/tts/./a", want: testCode},
+		{name: "encoded slash", scopes: []string{"/tts/*"}, method: "POST", path: "/tts/a%2F..%2F..%2Fclone", want: 400},
+		{name: "encoded slash no scopes", method: "POST", path: "/tts/a%2fb", want: testCode},
+		{name: "wrong", scopes: []string{"GOT tts"}, method: "POST", path: "/tts", want: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, ctx := customContext(httptest.NewRequest(tt.method, tt.path, nil))
+			ctx.Scopes = tt.scopes
+			resp := httptest.NewRecorder()
+			ScopeValid(newTestHandler(), "tts").ServeHTTP(resp, req)
+			assert.Equal(t, tt.want, resp.Code)
+		})
+	}
+}
+
+func TestScopeValid_Reason(t *testing.T) {
+	req, ctx := customContext(httptest.NewRequest("DELETE", "/tts/1", nil))
+	ctx.Scopes = []string{"GET tts"}
+	resp := httptest.NewRecorder()
+	ScopeValid(newTestHandler(), "tts").ServeHTTP(resp, req)
+	assert.Equal(t, 403, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Key scope does not allow DELETE /tts/1")
+}
+
+func TestScopeValid_ForwardsCleanPath(t *testing.T) {
+	req, ctx := customContext(httptest.NewRequest("POST", "/tts/a/../b/", nil))
+	ctx.Scopes = []string{"/tts/**"}
+	resp := httptest.NewRecorder()
+	th := newTestHandler()
+	ScopeValid(th, "tts").ServeHTTP(resp, req)
+	assert.Equal(t, testCode, resp.Code)
+	assert.Equal(t, "/tts/b/", th.r.URL.Path)
+	assert.Equal(t, "/tts/b/", th.r.URL.EscapedPath())
+}
+
+func TestScopeValid_NoScopesKeepsPath(t *testing.T) {
+	for _, p := range []string{"/tts/a%2fb", "/tts/a/../b//c/./"} {
+		t.Run(p, func(t *testing.T) {
+			req, _ := customContext(httptest.NewRequest("POST", p, nil))
+			resp := httptest.NewRecorder()
+			th := newTestHandler()
+			ScopeValid(th, "tts").ServeHTTP(resp, req)
+			assert.Equal(t, testCode, resp.Code)
+			assert.Equal(t, p, th.r.URL.EscapedPath())
+		})
+	}
+}
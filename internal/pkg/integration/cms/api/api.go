@@ -17,6 +17,11 @@ type CreateInput struct {
 	Disabled    bool       `json:"disabled,omitempty"`
 	IPWhiteList string     `json:"IPWhiteList,omitempty"`
 	Tags        []string   `json:"tags,omitempty"`
+	// AllowedOrigins makes the key publishable: only browser requests with the matching Origin or Referer are allowed.
+	// Patterns are <scheme>://<host>[:<port>], the host may start with '*.', the port may be '*'
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+	// Scopes restrict the key to routes or paths and methods: '[<METHOD>[,<METHOD>] ]<route or /path pattern>'
+	Scopes []string `json:"scopes,omitempty"`
 }
 
 type UpdateInput struct {
@@ -25,6 +30,10 @@ type UpdateInput struct {
 	Description *string    `json:"description,omitempty"`
 	IPWhiteList *string    `json:"IPWhiteList,omitempty"`
 	Tags        []string   `json:"tags,omitempty"`
+	// AllowedOrigins replaces the patterns, an empty list makes the key not publishable
+	AllowedOrigins *[]string `json:"allowedOrigins,omitempty"`
+	// Scopes replaces the scopes, an empty list removes the restriction
+	Scopes *[]string `json:"scopes,omitempty"`
 }
 
 // CreditsInput for add credits
@@ -54,6 +63,14 @@ type Key struct {
 	Updated  *time.Time `json:"updated,omitempty"`
 	LastUsed *time.Time `json:"lastUsed,omitempty"`
 	LastIP   string     `json:"lastIP,omitempty"`
+	// Archived is set for archived keys, they are invalid and kept only for history
+	Archived *time.Time `json:"archived,omitempty"`
+	// OldKeyValidTo is set while the previous key is valid after rotation
+	OldKeyValidTo *time.Time `json:"oldKeyValidTo,omitempty"`
+	// Publishable keys may be embedded in web pages, they are valid only for the allowed origins
+	Publishable    bool     `json:"publishable,omitempty"`
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+	Scopes         []string `json:"scopes,omitempty"`
 }
 
 // KeyID provides key ID by key, response structure
@@ -84,6 +101,7 @@ type Log struct {
 	IP          string     `json:"ip,omitempty"`
 	Fail        bool       `json:"fail,omitempty"`
 	Response    int        `json:"response,omitempty"`
+	OldKey      bool       `json:"oldKey,omitempty"`
 }
 
 type StatParams struct {
@@ -91,6 +109,43 @@ type StatParams struct {
 	From *time.Time
 	To   *time.Time
 	Type usage.Enum
+	// TimeZone is IANA time zone name for daily and monthly buckets, default - server's day time zone.
+	// Zones with offsets not in whole hours are not supported
+	TimeZone string
+	// ByCode splits buckets by response code class
+	ByCode bool
+	// ByRoute splits buckets by proxy route
+	ByRoute bool
+}
+
+// ProjectStatParams input for aggregated stats of all keys available for the admin
+type ProjectStatParams struct {
+	// Service limits keys to one project, all available projects if empty
+	Service string
+	From    *time.Time
+	To      *time.Time
+	Type    usage.Enum
+}
+
+// TopKeysParams input for top keys by quota usage
+type TopKeysParams struct {
+	Service string
+	From    *time.Time
+	To      *time.Time
+	// ByFailed sorts by failed quota instead of used quota
+	ByFailed bool
+	Limit    int
+}
+
+// KeyStat aggregated key usage for a period
+type KeyStat struct {
+	ID             string  `json:"id,omitempty"`
+	Service        string  `json:"service,omitempty"`
+	Description    string  `json:"description,omitempty"`
+	RequestCount   int     `json:"requestCount,omitempty"`
+	FailedQuota    float64 `json:"failedQuota,omitempty"`
+	UsedQuota      float64 `json:"usedQuota,omitempty"`
+	FailedRequests int     `json:"failedRequests,omitempty"`
 }
 
 type Bucket struct {
@@ -99,4 +154,67 @@ type Bucket struct {
 	FailedQuota    float64   `json:"failedQuota,omitempty"`
 	UsedQuota      float64   `json:"usedQuota,omitempty"`
 	FailedRequests int       `json:"failedRequests,omitempty"`
+	// Route is set only for stats by route
+	Route string `json:"route,omitempty"`
+	// CodeClass is set only for stats by response code, e.g. 2xx, or unknown for logs without a code
+	CodeClass string `json:"codeClass,omitempty"`
+}
+
+// Bulk actions
+const (
+	BulkCreate  = "create"
+	BulkUpdate  = "update"
+	BulkDisable = "disable"
+	BulkCredits = "credits"
+)
+
+// Bulk item statuses
+const (
+	BulkStatusOK = "ok"
+	// BulkStatusExists means the operation was already done before
+	BulkStatusExists = "exists"
+	BulkStatusFailed = "failed"
+	// BulkStatusRolledBack means the item was fine, but the atomic request failed on another item
+	BulkStatusRolledBack = "rolledBack"
+	// BulkStatusSkipped means the item was not processed because the atomic request failed earlier
+	BulkStatusSkipped = "skipped"
+)
+
+// BulkItem is one item of a bulk request, used fields depend on the action
+type BulkItem struct {
+	ID          string     `json:"id,omitempty"`
+	OperationID string     `json:"operationID,omitempty"`
+	Service     string     `json:"service,omitempty"`
+	Credits     float64    `json:"credits,omitempty"`
+	ValidTo     *time.Time `json:"validTo,omitempty"`
+	Description *string    `json:"description,omitempty"`
+	Disabled    *bool      `json:"disabled,omitempty"`
+	IPWhiteList *string    `json:"IPWhiteList,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Msg         string     `json:"msg,omitempty"`
+}
+
+// BulkInput for bulk key operations
+type BulkInput struct {
+	Action string
+	// Atomic applies all items or nothing, otherwise each item is applied separately
+	Atomic bool
+	Items  []*BulkItem
+}
+
+// BulkItemResult is a result of one bulk item, Key is set only for created keys
+type BulkItemResult struct {
+	Index       int    `json:"index"`
+	ID          string `json:"id,omitempty"`
+	OperationID string `json:"operationID,omitempty"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	Key         *Key   `json:"key,omitempty"`
+}
+
+// BulkResult response of bulk operations
+type BulkResult struct {
+	OK     int               `json:"ok"`
+	Failed int               `json:"failed"`
+	Items  []*BulkItemResult `json:"items"`
 }
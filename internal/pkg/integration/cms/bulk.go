@@ -0,0 +1,216 @@
+package cms
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/airenas/api-doorman/internal/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	_csvMIME = "text/csv"
+	// _tagsSeparator separates tags in one CSV cell
+	_tagsSeparator = ";"
+)
+
+var bulkPermissions = map[string]permission.Enum{
+	api.BulkCreate:  permission.KeyCreate,
+	api.BulkUpdate:  permission.KeyUpdate,
+	api.BulkDisable: permission.KeyUpdate,
+	api.BulkCredits: permission.CreditsAdd,
+}
+
+func keysBulk(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithUser(c, func(ctx echo.Context, u *model.User) error {
+			action := c.Param("action")
+			perm, ok := bulkPermissions[action]
+			if !ok {
+				return echo.NewHTTPError(http.StatusNotFound)
+			}
+			if !u.HasPermission(perm) {
+				return echo.NewHTTPError(http.StatusForbidden)
+			}
+			atomic, err := parseBulkMode(c.QueryParam("mode"))
+			if err != nil {
+				return err
+			}
+			items, err := takeBulkItems(c)
+			if err != nil {
+				log.Error().Err(err).Send()
+				return err
+			}
+			for _, item := range items {
+				if item == nil {
+					return echo.NewHTTPError(http.StatusBadRequest, "empty item")
+				}
+				if action == api.BulkCredits && !u.HasPermission(creditsPermission(item.Credits)) {
+					return echo.NewHTTPError(http.StatusForbidden)
+				}
+				if action == api.BulkCreate {
+					if err := validateService(item.Service, data.ProjectValidator); err != nil {
+						log.Error().Err(err).Send()
+						return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+					}
+				}
+			}
+			res, err := data.Integrator.Bulk(c.Request().Context(), u, &api.BulkInput{Action: action, Atomic: atomic, Items: items})
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			code := http.StatusOK
+			if atomic && res.Failed > 0 {
+				code = http.StatusBadRequest
+			}
+			if c.QueryParam("format") == "csv" {
+				return writeBulkCSV(c, code, res)
+			}
+			return c.JSON(code, res)
+		})
+	}
+}
+
+// parseBulkMode returns true for the atomic mode, it is the default
+func parseBulkMode(s string) (bool, error) {
+	switch s {
+	case "", "atomic":
+		return true, nil
+	case "partial":
+		return false, nil
+	}
+	return false, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong mode '%s', expected atomic or partial", s))
+}
+
+// takeBulkItems reads items from JSON array or CSV with a header line
+func takeBulkItems(c echo.Context) ([]*api.BulkItem, error) {
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), _csvMIME) {
+		res, err := readBulkCSV(c.Request().Body)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return res, nil
+	}
+	var res []*api.BulkItem
+	if err := utils.TakeJSONInput(c, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func readBulkCSV(r io.Reader) ([]*api.BulkItem, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("no CSV header")
+		}
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+	for i, h := range header {
+		header[i] = strings.TrimSpace(h)
+		if _, ok := bulkCSVSetters[header[i]]; !ok {
+			return nil, fmt.Errorf("unknown CSV column '%s'", header[i])
+		}
+	}
+	var res []*api.BulkItem
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read CSV: %w", err)
+		}
+		item := &api.BulkItem{}
+		for i, v := range rec {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if err := bulkCSVSetters[header[i]](item, v); err != nil {
+				return nil, fmt.Errorf("line %d, column '%s': %w", line, header[i], err)
+			}
+		}
+		res = append(res, item)
+	}
+	return res, nil
+}
+
+var bulkCSVSetters = map[string]func(*api.BulkItem, string) error{
+	"id":          func(it *api.BulkItem, v string) error { it.ID = v; return nil },
+	"operationID": func(it *api.BulkItem, v string) error { it.OperationID = v; return nil },
+	"service":     func(it *api.BulkItem, v string) error { it.Service = v; return nil },
+	"description": func(it *api.BulkItem, v string) error { it.Description = &v; return nil },
+	"IPWhiteList": func(it *api.BulkItem, v string) error { it.IPWhiteList = &v; return nil },
+	"msg":         func(it *api.BulkItem, v string) error { it.Msg = v; return nil },
+	"tags": func(it *api.BulkItem, v string) error {
+		for _, t := range strings.Split(v, _tagsSeparator) {
+			if t = strings.TrimSpace(t); t != "" {
+				it.Tags = append(it.Tags, t)
+			}
+		}
+		return nil
+	},
+	"credits": func(it *api.BulkItem, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("wrong number '%s'", v)
+		}
+		it.Credits = f
+		return nil
+	},
+	"validTo": func(it *api.BulkItem, v string) error {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("wrong date '%s'", v)
+		}
+		it.ValidTo = &t
+		return nil
+	},
+	"disabled": func(it *api.BulkItem, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("wrong bool '%s'", v)
+		}
+		it.Disabled = &b
+		return nil
+	},
+}
+
+// writeBulkCSV writes results as a downloadable CSV, generated keys are not stored and can't be downloaded again
+func writeBulkCSV(c echo.Context, code int, res *api.BulkResult) error {
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, _csvMIME)
+	resp.Header().Set(echo.HeaderContentDisposition, `attachment; filename="keys.csv"`)
+	resp.WriteHeader(code)
+	w := csv.NewWriter(resp)
+	if err := w.Write([]string{"index", "id", "operationID", "status", "error", "key", "service", "validTo"}); err != nil {
+		return fmt.Errorf("write CSV: %w", err)
+	}
+	for _, ir := range res.Items {
+		var key, service, validTo string
+		if ir.Key != nil {
+			key, service = ir.Key.Key, ir.Key.Service
+			if ir.Key.ValidTo != nil {
+				validTo = ir.Key.ValidTo.Format(time.RFC3339)
+			}
+		}
+		if err := w.Write([]string{strconv.Itoa(ir.Index), ir.ID, ir.OperationID, ir.Status, ir.Error, key, service, validTo}); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,141 @@
+package cms
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/airenas/api-doorman/internal/pkg/test/mocks"
+	"github.com/labstack/echo/v4"
+	"github.com/petergtz/pegomock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeysBulk(t *testing.T) {
+	initTest(t)
+	pegomock.When(intMock.Bulk(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*api.BulkInput]())).
+		ThenReturn(&api.BulkResult{OK: 1, Items: []*api.BulkItemResult{{ID: "1", Status: api.BulkStatusOK}}}, nil)
+	req := httptest.NewRequest(http.MethodPost, "/keys/bulk/create?mode=partial",
+		mocks.ToReader([]*api.BulkItem{{OperationID: "o1", Service: "pr", Credits: 10}}))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	resp := testCode(t, req, http.StatusOK)
+	bytes, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(bytes), `"status":"ok"`)
+	_, _, cIn := intMock.VerifyWasCalled(pegomock.Once()).Bulk(pegomock.Any[context.Context](), pegomock.Any[*model.User](),
+		pegomock.Any[*api.BulkInput]()).GetCapturedArguments()
+	assert.Equal(t, api.BulkCreate, cIn.Action)
+	assert.False(t, cIn.Atomic)
+	require.Len(t, cIn.Items, 1)
+	assert.Equal(t, "o1", cIn.Items[0].OperationID)
+}
+
+func TestKeysBulk_CSV(t *testing.T) {
+	initTest(t)
+	validTo := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	pegomock.When(intMock.Bulk(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*api.BulkInput]())).
+		ThenReturn(&api.BulkResult{OK: 1, Items: []*api.BulkItemResult{{ID: "1", OperationID: "o1", Status: api.BulkStatusOK,
+			Key: &api.Key{Key: "secret", Service: "pr", ValidTo: &validTo}}}}, nil)
+	req := httptest.NewRequest(http.MethodPost, "/keys/bulk/create?format=csv",
+		strings.NewReader("operationID,service,credits,tags\no1,pr,10,a:1;b:2\n"))
+	req.Header.Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	resp := testCode(t, req, http.StatusOK)
+	assert.Equal(t, "text/csv", resp.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, resp.Header().Get(echo.HeaderContentDisposition), "attachment")
+	bytes, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "index,id,operationID,status,error,key,service,validTo\n0,1,o1,ok,,secret,pr,2030-01-02T00:00:00Z\n", string(bytes))
+	_, _, cIn := intMock.VerifyWasCalled(pegomock.Once()).Bulk(pegomock.Any[context.Context](), pegomock.Any[*model.User](),
+		pegomock.Any[*api.BulkInput]()).GetCapturedArguments()
+	assert.True(t, cIn.Atomic)
+	require.Len(t, cIn.Items, 1)
+	assert.Equal(t, 10.0, cIn.Items[0].Credits)
+	assert.Equal(t, []string{"a:1", "b:2"}, cIn.Items[0].Tags)
+}
+
+func TestKeysBulk_AtomicFail(t *testing.T) {
+	initTest(t)
+	pegomock.When(intMock.Bulk(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*api.BulkInput]())).
+		ThenReturn(&api.BulkResult{Failed: 1, Items: []*api.BulkItemResult{{ID: "1", Status: api.BulkStatusFailed}}}, nil)
+	req := httptest.NewRequest(http.MethodPost, "/keys/bulk/disable", mocks.ToReader([]*api.BulkItem{{ID: "1", OperationID: "o1"}}))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	testCode(t, req, http.StatusBadRequest)
+}
+
+func TestKeysBulk_Fail(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		ctype string
+		body  string
+		perms map[permission.Enum]bool
+		want  int
+	}{
+		{name: "action", path: "/keys/bulk/olia", body: `[]`, want: http.StatusNotFound},
+		{name: "mode", path: "/keys/bulk/update?mode=olia", body: `[]`, want: http.StatusBadRequest},
+		{name: "json", path: "/keys/bulk/update", body: `olia`, want: http.StatusBadRequest},
+		{name: "csv column", path: "/keys/bulk/update", ctype: "text/csv", body: "id,olia\n1,2\n", want: http.StatusBadRequest},
+		{name: "service", path: "/keys/bulk/create", body: `[{"operationID":"1"}]`, want: http.StatusBadRequest},
+		{name: "permission", path: "/keys/bulk/create", body: `[{"operationID":"1","service":"pr"}]`,
+			perms: map[permission.Enum]bool{permission.KeyUpdate: true}, want: http.StatusForbidden},
+		{name: "remove credits", path: "/keys/bulk/credits", body: `[{"id":"1","operationID":"1","credits":-10}]`,
+			perms: map[permission.Enum]bool{permission.CreditsAdd: true}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.perms != nil {
+				initTestWithPermissions(t, tt.perms)
+			} else {
+				initTest(t)
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			ctype := tt.ctype
+			if ctype == "" {
+				ctype = echo.MIMEApplicationJSON
+			}
+			req.Header.Set(echo.HeaderContentType, ctype)
+			testCode(t, req, tt.want)
+		})
+	}
+}
+
+func Test_readBulkCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []*api.BulkItem
+		wantErr bool
+	}{
+		{name: "Empty", in: "", wantErr: true},
+		{name: "Header only", in: "id,operationID\n", want: nil},
+		{name: "Update", in: "id, operationID ,disabled,validTo,description\n1,o1,true,2030-01-02T00:00:00Z,olia\n2,o2,,,\n",
+			want: []*api.BulkItem{{ID: "1", OperationID: "o1", Disabled: ptr(true), ValidTo: ptr(time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)),
+				Description: ptr("olia")}, {ID: "2", OperationID: "o2"}}},
+		{name: "Wrong column", in: "id,olia\n", wantErr: true},
+		{name: "Wrong credits", in: "id,credits\n1,x\n", wantErr: true},
+		{name: "Wrong date", in: "id,validTo\n1,x\n", wantErr: true},
+		{name: "Wrong bool", in: "id,disabled\n1,x\n", wantErr: true},
+		{name: "Wrong count", in: "id,disabled\n1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readBulkCSV(strings.NewReader(tt.in))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
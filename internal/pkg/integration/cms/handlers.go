@@ -2,12 +2,16 @@ package cms
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
 	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
 	"github.com/airenas/api-doorman/internal/pkg/model/usage"
 	"github.com/airenas/api-doorman/internal/pkg/utils"
 	"github.com/labstack/echo/v4"
@@ -22,10 +26,17 @@ type (
 		GetKey(ctx context.Context, user *model.User, id string) (*api.Key, error)
 		AddCredits(ctx context.Context, user *model.User, id string, in *api.CreditsInput) (*api.Key, error)
 		GetKeyID(ctx context.Context, user *model.User, id string) (*api.KeyID, error)
-		Usage(ctx context.Context, user *model.User, id string, from *time.Time, to *time.Time, full bool) (*api.Usage, error)
+		Usage(ctx context.Context, user *model.User, id string, from, to time.Time) (*api.Usage, error)
+		UsageLogs(ctx context.Context, user *model.User, id string, from, to time.Time, limit int, f func(*api.Log) error) error
 		Update(ctx context.Context, user *model.User, id string, in *api.UpdateInput) (*api.Key, error)
-		Change(ctx context.Context, user *model.User, id string) (*api.Key, error)
+		Change(ctx context.Context, user *model.User, id string, grace time.Duration) (*api.Key, error)
+		EndRotation(ctx context.Context, user *model.User, id string) (*api.Key, error)
 		Stats(ctx context.Context, user *model.User, in *api.StatParams) ([]*api.Bucket, error)
+		ProjectStats(ctx context.Context, user *model.User, in *api.ProjectStatParams) ([]*api.Bucket, error)
+		TopKeys(ctx context.Context, user *model.User, in *api.TopKeysParams) ([]*api.KeyStat, error)
+		ExhaustedKeys(ctx context.Context, user *model.User, service string, limit int) ([]*api.Key, error)
+		Bulk(ctx context.Context, user *model.User, in *api.BulkInput) (*api.BulkResult, error)
+		Archive(ctx context.Context, user *model.User, id string) (*api.Key, error)
 	}
 
 	// PrValidator validates if project is available
@@ -38,9 +49,25 @@ type (
 	Data struct {
 		ProjectValidator PrValidator
 		Integrator       Integrator
+		// UsageMaxRange limits the from-to range of a usage request
+		UsageMaxRange time.Duration
+		// UsageMaxLogs limits the count of logs returned by a usage request
+		UsageMaxLogs int
 	}
 )
 
+const (
+	_defaultUsageMaxRange = 366 * 24 * time.Hour
+	_defaultUsageMaxLogs  = 10000
+
+	_defaultTopKeys      = 10
+	_defaultExhausted    = 100
+	_maxStatsKeysInReply = 1000
+
+	// _maxRotationGrace limits how long the old key stays valid after rotation
+	_maxRotationGrace = 30 * 24 * time.Hour
+)
+
 // InitRoutes http routes for CMS integration
 func InitRoutes(e *echo.Echo, data *Data) {
 	e.POST("/key", keyCreate(data))
@@ -49,13 +76,19 @@ func InitRoutes(e *echo.Echo, data *Data) {
 	e.PATCH("/key/:keyID", keyUpdate(data))
 	e.PATCH("/key/:keyID/credits", keyAddCredits(data))
 	e.POST("/key/:keyID/change", keyChange(data))
+	e.POST("/key/:keyID/change/end", keyEndRotation(data))
+	e.POST("/key/:keyID/archive", keyArchive(data))
 	e.GET("/key/:keyID/usage", keyUsage(data))
 	e.GET("/key/:keyID/stats", keyStats(data))
+	e.GET("/stats", projectStats(data))
+	e.GET("/stats/top", topKeys(data))
+	e.GET("/stats/exhausted", exhaustedKeys(data))
+	e.POST("/keys/bulk/:action", keysBulk(data))
 }
 
 func keyCreate(data *Data) func(echo.Context) error {
 	return func(c echo.Context) error {
-		return utils.RunWithUser(c, func(ctx echo.Context, u *model.User) error {
+		return utils.RunWithPermission(c, permission.KeyCreate, func(ctx echo.Context, u *model.User) error {
 			var input api.CreateInput
 			if err := utils.TakeJSONInput(c, &input); err != nil {
 				log.Error().Err(err).Send()
@@ -81,7 +114,7 @@ func keyCreate(data *Data) func(echo.Context) error {
 
 func keyGet(data *Data) func(echo.Context) error {
 	return func(c echo.Context) error {
-		return utils.RunWithUser(c, func(ctx echo.Context, u *model.User) error {
+		return utils.RunWithPermission(c, permission.KeyRead, func(ctx echo.Context, u *model.User) error {
 			keyID := c.Param("keyID")
 			if keyID == "" {
 				log.Error().Msgf("no key ID")
@@ -101,7 +134,7 @@ func keyGet(data *Data) func(echo.Context) error {
 
 func keyUpdate(data *Data) func(echo.Context) error {
 	return func(c echo.Context) error {
-		return utils.RunWithUser(c, func(ctx echo.Context, u *model.User) error {
+		return utils.RunWithPermission(c, permission.KeyUpdate, func(ctx echo.Context, u *model.User) error {
 			keyID := c.Param("keyID")
 			if keyID == "" {
 				log.Error().Msgf("no key ID")
@@ -134,6 +167,9 @@ func keyAddCredits(data *Data) func(echo.Context) error {
 				log.Error().Err(err).Send()
 				return err
 			}
+			if !u.HasPermission(creditsPermission(input.Credits)) {
+				return echo.NewHTTPError(http.StatusForbidden)
+			}
 			keyResp, err := data.Integrator.AddCredits(c.Request().Context(), u, keyID, &input)
 			if err != nil {
 				return utils.ProcessError(err)
@@ -145,14 +181,69 @@ func keyAddCredits(data *Data) func(echo.Context) error {
 
 func keyChange(data *Data) func(echo.Context) error {
 	return func(c echo.Context) error {
-		return utils.RunWithUser(c, func(ctx echo.Context, u *model.User) error {
+		return utils.RunWithPermission(c, permission.KeyRotate, func(ctx echo.Context, u *model.User) error {
+			keyID := c.Param("keyID")
+			if keyID == "" {
+				log.Error().Msg("no key ID")
+				return echo.NewHTTPError(http.StatusBadRequest, "no key ID")
+			}
+
+			grace, err := parseGrace(c.QueryParam("grace"))
+			if err != nil {
+				return err
+			}
+
+			keyResp, err := data.Integrator.Change(c.Request().Context(), u, keyID, grace)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+
+			return c.JSON(http.StatusOK, keyResp)
+		})
+	}
+}
+
+func keyEndRotation(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.KeyRotate, func(ctx echo.Context, u *model.User) error {
+			keyID := c.Param("keyID")
+			if keyID == "" {
+				log.Error().Msg("no key ID")
+				return echo.NewHTTPError(http.StatusBadRequest, "no key ID")
+			}
+
+			keyResp, err := data.Integrator.EndRotation(c.Request().Context(), u, keyID)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+
+			return c.JSON(http.StatusOK, keyResp)
+		})
+	}
+}
+
+// parseGrace parses the rotation grace period as a duration, e.g. 24h
+func parseGrace(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	res, err := time.ParseDuration(s)
+	if err != nil || res < 0 || res > _maxRotationGrace {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong grace '%s', expected duration up to %s", s, _maxRotationGrace))
+	}
+	return res, nil
+}
+
+func keyArchive(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.KeyUpdate, func(ctx echo.Context, u *model.User) error {
 			keyID := c.Param("keyID")
 			if keyID == "" {
 				log.Error().Msg("no key ID")
 				return echo.NewHTTPError(http.StatusBadRequest, "no key ID")
 			}
 
-			keyResp, err := data.Integrator.Change(c.Request().Context(), u, keyID)
+			keyResp, err := data.Integrator.Archive(c.Request().Context(), u, keyID)
 			if err != nil {
 				return utils.ProcessError(err)
 			}
@@ -162,13 +253,20 @@ func keyChange(data *Data) func(echo.Context) error {
 	}
 }
 
+func creditsPermission(credits float64) permission.Enum {
+	if credits < 0 {
+		return permission.CreditsRemove
+	}
+	return permission.CreditsAdd
+}
+
 type keyByIDInput struct {
 	Key string `json:"key"`
 }
 
 func keyGetID(data *Data) func(echo.Context) error {
 	return func(c echo.Context) error {
-		return utils.RunWithUser(c, func(ctx echo.Context, u *model.User) error {
+		return utils.RunWithPermission(c, permission.KeyRead, func(ctx echo.Context, u *model.User) error {
 			var input keyByIDInput
 			if err := utils.TakeJSONInput(c, &input); err != nil {
 				log.Error().Err(err).Send()
@@ -190,33 +288,134 @@ func keyGetID(data *Data) func(echo.Context) error {
 
 func keyUsage(data *Data) func(echo.Context) error {
 	return func(c echo.Context) error {
-		return utils.RunWithUser(c, func(ctx echo.Context, u *model.User) error {
+		return utils.RunWithPermission(c, permission.UsageRead, func(ctx echo.Context, u *model.User) error {
 			keyID := c.Param("keyID")
 			if keyID == "" {
 				log.Error().Msgf("no key ID")
 				return echo.NewHTTPError(http.StatusBadRequest, "no key ID")
 			}
-			from, err := utils.ParseDateParam(c.QueryParam("from"))
+			from, to, err := parseUsageRange(c, data.usageMaxRange())
 			if err != nil {
 				return err
 			}
-			to, err := utils.ParseDateParam(c.QueryParam("to"))
+			full := c.QueryParam("full") == "1"
+			limit, err := parseLimit(c.QueryParam("limit"), data.usageMaxLogs(), data.usageMaxLogs())
 			if err != nil {
 				return err
 			}
-			usageResp, err := data.Integrator.Usage(c.Request().Context(), u, keyID, from, to, c.QueryParam("full") == "1")
+			usageResp, err := data.Integrator.Usage(c.Request().Context(), u, keyID, from, to)
 			if err != nil {
 				return utils.ProcessError(err)
 			}
-
-			return c.JSON(http.StatusOK, usageResp)
+			if !full {
+				return c.JSON(http.StatusOK, usageResp)
+			}
+			if usageResp.RequestCount > limit {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					fmt.Sprintf("too many logs %d, max %d, narrow the date range", usageResp.RequestCount, limit))
+			}
+			return streamUsage(c, data, u, keyID, from, to, limit, usageResp)
 		})
 	}
 }
 
+// streamUsage writes usage JSON with logs read one by one from the DB,
+// the output is the same as marshaled api.Usage with all logs
+func streamUsage(c echo.Context, data *Data, u *model.User, keyID string, from, to time.Time, limit int, usage *api.Usage) error {
+	usage.Logs = nil
+	head, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("marshal usage: %w", err)
+	}
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	resp.WriteHeader(http.StatusOK)
+	// drop the closing bracket and append logs array
+	if _, err := resp.Write(append(head[:len(head)-1], []byte(`,"logs":[`)...)); err != nil {
+		return fmt.Errorf("write usage: %w", err)
+	}
+	sep := []byte{}
+	err = data.Integrator.UsageLogs(c.Request().Context(), u, keyID, from, to, limit, func(l *api.Log) error {
+		b, err := json.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("marshal log: %w", err)
+		}
+		if _, err := resp.Write(append(sep, b...)); err != nil {
+			return fmt.Errorf("write log: %w", err)
+		}
+		sep = []byte{','}
+		return nil
+	})
+	if err != nil {
+		// status is already sent, the client gets an incomplete JSON
+		log.Error().Err(err).Msg("usage streaming interrupted")
+		return nil
+	}
+	if _, err := resp.Write([]byte(`]}`)); err != nil {
+		log.Error().Err(err).Msg("can't write usage end")
+	}
+	return nil
+}
+
+// parseUsageRange returns usage interval, 'to' defaults to now and 'from' to 'to' - maxRange
+func parseUsageRange(c echo.Context, maxRange time.Duration) (time.Time, time.Time, error) {
+	from, err := utils.ParseDateParam(c.QueryParam("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := utils.ParseDateParam(c.QueryParam("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to == nil {
+		now := time.Now()
+		to = &now
+	}
+	if from == nil {
+		f := to.Add(-maxRange)
+		from = &f
+	}
+	if !from.Before(*to) {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "'from' must be before 'to'")
+	}
+	if to.Sub(*from) > maxRange {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("range is too long, max %s", maxRange.String()))
+	}
+	return *from, *to, nil
+}
+
+func parseLimit(s string, def, max int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	res, err := strconv.Atoi(s)
+	if err != nil || res < 1 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong limit '%s'", s))
+	}
+	if res > max {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit is too big, max %d", max))
+	}
+	return res, nil
+}
+
+func (d *Data) usageMaxRange() time.Duration {
+	if d.UsageMaxRange > 0 {
+		return d.UsageMaxRange
+	}
+	return _defaultUsageMaxRange
+}
+
+func (d *Data) usageMaxLogs() int {
+	if d.UsageMaxLogs > 0 {
+		return d.UsageMaxLogs
+	}
+	return _defaultUsageMaxLogs
+}
+
 func keyStats(data *Data) func(echo.Context) error {
 	return func(c echo.Context) error {
-		return utils.RunWithUser(c, func(ctx echo.Context, u *model.User) error {
+		return utils.RunWithPermission(c, permission.StatsRead, func(ctx echo.Context, u *model.User) error {
 			keyID := c.Param("keyID")
 			if keyID == "" {
 				log.Error().Msgf("no key ID")
@@ -235,12 +434,23 @@ func keyStats(data *Data) func(echo.Context) error {
 			if err != nil {
 				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("can't parse type '%s'", uTypeStr))
 			}
-			usageResp, err := data.Integrator.Stats(c.Request().Context(), u, &api.StatParams{
-				ID:   keyID,
-				From: from,
-				To:   to,
-				Type: uType,
-			})
+			tz := c.QueryParam("tz")
+			if tz != "" {
+				if _, err := time.LoadLocation(tz); err != nil {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong tz '%s'", tz))
+				}
+			}
+			params := &api.StatParams{
+				ID:       keyID,
+				From:     from,
+				To:       to,
+				Type:     uType,
+				TimeZone: tz,
+			}
+			if err := parseStatsGroupBy(c.QueryParam("groupBy"), params); err != nil {
+				return err
+			}
+			usageResp, err := data.Integrator.Stats(c.Request().Context(), u, params)
 			if err != nil {
 				return utils.ProcessError(err)
 			}
@@ -250,6 +460,114 @@ func keyStats(data *Data) func(echo.Context) error {
 	}
 }
 
+func projectStats(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.StatsRead, func(ctx echo.Context, u *model.User) error {
+			service, err := parseServiceParam(c, data.ProjectValidator)
+			if err != nil {
+				return err
+			}
+			from, to, err := parseFromTo(c)
+			if err != nil {
+				return err
+			}
+			uTypeStr := c.QueryParam("type")
+			uType, err := usage.Parse(uTypeStr)
+			if err != nil || uType == usage.Hourly {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("can't parse type '%s'", uTypeStr))
+			}
+			res, err := data.Integrator.ProjectStats(c.Request().Context(), u, &api.ProjectStatParams{
+				Service: service,
+				From:    from,
+				To:      to,
+				Type:    uType,
+			})
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+func topKeys(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.StatsRead, func(ctx echo.Context, u *model.User) error {
+			service, err := parseServiceParam(c, data.ProjectValidator)
+			if err != nil {
+				return err
+			}
+			from, to, err := parseFromTo(c)
+			if err != nil {
+				return err
+			}
+			params := &api.TopKeysParams{Service: service, From: from, To: to}
+			switch by := c.QueryParam("by"); by {
+			case "", "used":
+			case "failed":
+				params.ByFailed = true
+			default:
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong by '%s'", by))
+			}
+			if params.Limit, err = parseLimit(c.QueryParam("limit"), _defaultTopKeys, _maxStatsKeysInReply); err != nil {
+				return err
+			}
+			res, err := data.Integrator.TopKeys(c.Request().Context(), u, params)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+func exhaustedKeys(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		return utils.RunWithPermission(c, permission.StatsRead, func(ctx echo.Context, u *model.User) error {
+			service, err := parseServiceParam(c, data.ProjectValidator)
+			if err != nil {
+				return err
+			}
+			limit, err := parseLimit(c.QueryParam("limit"), _defaultExhausted, _maxStatsKeysInReply)
+			if err != nil {
+				return err
+			}
+			res, err := data.Integrator.ExhaustedKeys(c.Request().Context(), u, service, limit)
+			if err != nil {
+				return utils.ProcessError(err)
+			}
+			return c.JSON(http.StatusOK, res)
+		})
+	}
+}
+
+// parseServiceParam returns optional service param, empty means all available projects
+func parseServiceParam(c echo.Context, prV PrValidator) (string, error) {
+	service := c.QueryParam("service")
+	if service == "" {
+		return "", nil
+	}
+	if err := validateService(service, prV); err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return service, nil
+}
+
+func parseFromTo(c echo.Context) (*time.Time, *time.Time, error) {
+	from, err := utils.ParseDateParam(c.QueryParam("from"))
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := utils.ParseDateParam(c.QueryParam("to"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "'from' must be before 'to'")
+	}
+	return from, to, nil
+}
+
 func validateService(project string, prV PrValidator) error {
 	if project == "" {
 		return errors.New("no service")
@@ -259,3 +577,19 @@ func validateService(project string, prV PrValidator) error {
 	}
 	return nil
 }
+
+// parseStatsGroupBy parses comma separated breakdown list, e.g. code,route
+func parseStatsGroupBy(s string, params *api.StatParams) error {
+	for _, g := range strings.Split(s, ",") {
+		switch strings.TrimSpace(g) {
+		case "":
+		case "code":
+			params.ByCode = true
+		case "route":
+			params.ByRoute = true
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong groupBy '%s'", g))
+		}
+	}
+	return nil
+}
@@ -13,12 +13,14 @@ import (
 	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
 	"github.com/airenas/api-doorman/internal/pkg/model"
 	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/airenas/api-doorman/internal/pkg/model/usage"
 	"github.com/airenas/api-doorman/internal/pkg/test/mocks"
 	"github.com/airenas/api-doorman/internal/pkg/test/mocks2"
 	"github.com/labstack/echo/v4"
 	"github.com/petergtz/pegomock/v4"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -30,6 +32,10 @@ var (
 )
 
 func initTest(t *testing.T) {
+	initTestWithPermissions(t, map[permission.Enum]bool{permission.Everything: true})
+}
+
+func initTestWithPermissions(t *testing.T, perms map[permission.Enum]bool) {
 	mocks.AttachMockToTest(t)
 	prValidarorMock = mocks.NewMockPrValidator()
 	intMock = mocks2.NewMockIntegrator()
@@ -43,7 +49,7 @@ func initTest(t *testing.T) {
 			r := c.Request()
 			ctx := r.Context()
 			user := &model.User{Name: "olia",
-				Permissions: map[permission.Enum]bool{permission.Everything: true},
+				Permissions: perms,
 				Projects:    []string{"test"},
 				MaxLimit:    1000,
 				MaxValidTo:  time.Now().AddDate(1, 0, 0),
@@ -160,7 +166,7 @@ func TestKeyUsage(t *testing.T) {
 		{name: "Fail", ret: ret{res: api.Usage{RequestCount: 1}, err: model.ErrNoRecord},
 			want: http.StatusBadRequest},
 		{name: "From", ret: ret{res: api.Usage{RequestCount: 1}, err: nil},
-			params: map[string]string{"from": "2020-01-20T14:50:30Z"},
+			params: map[string]string{"from": time.Now().AddDate(0, -1, 0).Format(time.RFC3339)},
 			want:   http.StatusOK},
 		{name: "To", ret: ret{res: api.Usage{RequestCount: 1}, err: nil},
 			params: map[string]string{"to": "2020-01-20T14:50:30Z"},
@@ -171,38 +177,238 @@ func TestKeyUsage(t *testing.T) {
 		{name: "To fail", ret: ret{res: api.Usage{RequestCount: 1}, err: nil},
 			params: map[string]string{"to": "xx2020-01-20T14:50:30Z"},
 			want:   http.StatusBadRequest},
+		{name: "From after to", ret: ret{res: api.Usage{RequestCount: 1}, err: nil},
+			params: map[string]string{"from": "2020-01-21T14:50:30Z", "to": "2020-01-20T14:50:30Z"},
+			want:   http.StatusBadRequest},
+		{name: "Range too long", ret: ret{res: api.Usage{RequestCount: 1}, err: nil},
+			params: map[string]string{"from": "2020-01-20T14:50:30Z", "to": "2021-02-20T14:50:30Z"},
+			want:   http.StatusBadRequest},
+		{name: "Limit fail", ret: ret{res: api.Usage{RequestCount: 1}, err: nil},
+			params: map[string]string{"limit": "xx"},
+			want:   http.StatusBadRequest},
+		{name: "Limit too big", ret: ret{res: api.Usage{RequestCount: 1}, err: nil},
+			params: map[string]string{"limit": "100000000"},
+			want:   http.StatusBadRequest},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			initTest(t)
-			pegomock.When(intMock.Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[*time.Time](),
-				pegomock.Any[*time.Time](), pegomock.Any[bool]())).
+			pegomock.When(intMock.Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+				pegomock.Any[time.Time]())).
 				ThenReturn(&tt.ret.res, tt.ret.err)
 			req := httptest.NewRequest(http.MethodGet, "/key/id1/usage", nil)
+			q := req.URL.Query()
 			for k, v := range tt.params {
-				q := req.URL.Query()
 				q.Add(k, v)
-				req.URL.RawQuery = q.Encode()
 			}
+			req.URL.RawQuery = q.Encode()
 			testCode(t, req, tt.want)
 		})
 	}
 }
 
-func TestKeyUsage_Full(t *testing.T) {
+func TestKeyStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		params map[string]string
+		want   int
+	}{
+		{name: "OK", params: map[string]string{"type": "daily"}, want: http.StatusOK},
+		{name: "Hourly", params: map[string]string{"type": "hourly"}, want: http.StatusOK},
+		{name: "TZ", params: map[string]string{"type": "daily", "tz": "Europe/Vilnius"}, want: http.StatusOK},
+		{name: "Group by", params: map[string]string{"type": "daily", "groupBy": "code,route"}, want: http.StatusOK},
+		{name: "Fail", params: map[string]string{"type": "daily"}, err: errors.New("olia"), want: http.StatusInternalServerError},
+		{name: "Fail type", params: map[string]string{"type": "weekly"}, want: http.StatusBadRequest},
+		{name: "Fail TZ", params: map[string]string{"type": "daily", "tz": "Europe/Olia"}, want: http.StatusBadRequest},
+		{name: "Fail group by", params: map[string]string{"type": "daily", "groupBy": "code,ip"}, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			pegomock.When(intMock.Stats(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*api.StatParams]())).
+				ThenReturn([]*api.Bucket{{RequestCount: 1}}, tt.err)
+			req := httptest.NewRequest(http.MethodGet, "/key/id1/stats", nil)
+			q := req.URL.Query()
+			for k, v := range tt.params {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			testCode(t, req, tt.want)
+		})
+	}
+}
+
+func TestKeyStats_Params(t *testing.T) {
 	initTest(t)
-	pegomock.When(intMock.Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[*time.Time](),
-		pegomock.Any[*time.Time](), pegomock.Any[bool]())).
-		ThenReturn(&api.Usage{RequestCount: 1}, nil)
-	req := httptest.NewRequest(http.MethodGet, "/key/id1/usage", nil)
+	pegomock.When(intMock.Stats(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*api.StatParams]())).
+		ThenReturn([]*api.Bucket{}, nil)
+	req := httptest.NewRequest(http.MethodGet, "/key/id1/stats?type=hourly&tz=Europe/Vilnius&groupBy=route", nil)
 	testCode(t, req, http.StatusOK)
-	intMock.VerifyWasCalledOnce().Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[*time.Time](),
-		pegomock.Any[*time.Time](), pegomock.Eq(false))
+	_, _, cParams := intMock.VerifyWasCalledOnce().Stats(pegomock.Any[context.Context](), pegomock.Any[*model.User](),
+		pegomock.Any[*api.StatParams]()).GetCapturedArguments()
+	assert.Equal(t, &api.StatParams{ID: "id1", Type: usage.Hourly, TimeZone: "Europe/Vilnius", ByRoute: true}, cParams)
+}
+
+func TestProjectStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		params map[string]string
+		want   int
+	}{
+		{name: "OK", params: map[string]string{"type": "daily"}, want: http.StatusOK},
+		{name: "Service", params: map[string]string{"type": "monthly", "service": "test"}, want: http.StatusOK},
+		{name: "Dates", params: map[string]string{"type": "daily", "from": "2020-01-20T14:50:30Z", "to": "2020-02-20T14:50:30Z"},
+			want: http.StatusOK},
+		{name: "Fail", params: map[string]string{"type": "daily"}, err: errors.New("olia"), want: http.StatusInternalServerError},
+		{name: "Fail access", params: map[string]string{"type": "daily"}, err: model.ErrNoAccess, want: http.StatusForbidden},
+		{name: "Fail type", params: map[string]string{"type": "hourly"}, want: http.StatusBadRequest},
+		{name: "Fail dates", params: map[string]string{"type": "daily", "from": "2020-02-20T14:50:30Z", "to": "2020-01-20T14:50:30Z"},
+			want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			pegomock.When(intMock.ProjectStats(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*api.ProjectStatParams]())).
+				ThenReturn([]*api.Bucket{{RequestCount: 1}}, tt.err)
+			testCode(t, newQueryRequest("/stats", tt.params), tt.want)
+		})
+	}
+}
 
-	req = httptest.NewRequest(http.MethodGet, "/key/id1/usage?full=1", nil)
+func TestProjectStats_FailService(t *testing.T) {
+	initTest(t)
+	pegomock.When(prValidarorMock.Check(pegomock.Any[string]())).ThenReturn(false)
+	testCode(t, newQueryRequest("/stats", map[string]string{"type": "daily", "service": "olia"}), http.StatusBadRequest)
+}
+
+func TestTopKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		params map[string]string
+		want   int
+	}{
+		{name: "OK", want: http.StatusOK},
+		{name: "Failed", params: map[string]string{"by": "failed", "limit": "100"}, want: http.StatusOK},
+		{name: "Fail", err: errors.New("olia"), want: http.StatusInternalServerError},
+		{name: "Fail by", params: map[string]string{"by": "olia"}, want: http.StatusBadRequest},
+		{name: "Fail limit", params: map[string]string{"limit": "10000"}, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			pegomock.When(intMock.TopKeys(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*api.TopKeysParams]())).
+				ThenReturn([]*api.KeyStat{{ID: "1"}}, tt.err)
+			testCode(t, newQueryRequest("/stats/top", tt.params), tt.want)
+		})
+	}
+}
+
+func TestTopKeys_Params(t *testing.T) {
+	initTest(t)
+	pegomock.When(intMock.TopKeys(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[*api.TopKeysParams]())).
+		ThenReturn([]*api.KeyStat{}, nil)
+	testCode(t, newQueryRequest("/stats/top", map[string]string{"by": "failed", "service": "test"}), http.StatusOK)
+	_, _, cParams := intMock.VerifyWasCalledOnce().TopKeys(pegomock.Any[context.Context](), pegomock.Any[*model.User](),
+		pegomock.Any[*api.TopKeysParams]()).GetCapturedArguments()
+	assert.Equal(t, &api.TopKeysParams{Service: "test", ByFailed: true, Limit: _defaultTopKeys}, cParams)
+}
+
+func TestExhaustedKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		params map[string]string
+		want   int
+	}{
+		{name: "OK", want: http.StatusOK},
+		{name: "Limit", params: map[string]string{"limit": "10"}, want: http.StatusOK},
+		{name: "Fail", err: errors.New("olia"), want: http.StatusInternalServerError},
+		{name: "Fail limit", params: map[string]string{"limit": "0"}, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			pegomock.When(intMock.ExhaustedKeys(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](),
+				pegomock.Any[int]())).ThenReturn([]*api.Key{{ID: "1"}}, tt.err)
+			testCode(t, newQueryRequest("/stats/exhausted", tt.params), tt.want)
+		})
+	}
+}
+
+func newQueryRequest(path string, params map[string]string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	q := req.URL.Query()
+	for k, v := range params {
+		q.Add(k, v)
+	}
+	req.URL.RawQuery = q.Encode()
+	return req
+}
+
+func TestKeyUsage_DefaultRange(t *testing.T) {
+	initTest(t)
+	pegomock.When(intMock.Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+		pegomock.Any[time.Time]())).ThenReturn(&api.Usage{RequestCount: 1}, nil)
+	req := httptest.NewRequest(http.MethodGet, "/key/id1/usage?to=2020-01-20T14:50:30Z", nil)
 	testCode(t, req, http.StatusOK)
-	intMock.VerifyWasCalledOnce().Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[*time.Time](),
-		pegomock.Any[*time.Time](), pegomock.Eq(true))
+	_, _, _, cFrom, cTo := intMock.VerifyWasCalledOnce().Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+		pegomock.Any[time.Time]()).GetCapturedArguments()
+	assert.Equal(t, time.Date(2020, 1, 20, 14, 50, 30, 0, time.UTC), cTo)
+	assert.Equal(t, _defaultUsageMaxRange, cTo.Sub(cFrom))
+}
+
+func TestKeyUsage_Full(t *testing.T) {
+	initTest(t)
+	pegomock.When(intMock.Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+		pegomock.Any[time.Time]())).
+		ThenReturn(&api.Usage{RequestCount: 2, UsedCredits: 10}, nil)
+	pegomock.When(intMock.UsageLogs(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+		pegomock.Any[time.Time](), pegomock.Any[int](), pegomock.Any[func(*api.Log) error]())).Then(func(params []pegomock.Param) pegomock.ReturnValues {
+		f := params[6].(func(*api.Log) error)
+		_ = f(&api.Log{IP: "1.1.1.1", UsedCredits: 4})
+		_ = f(&api.Log{IP: "1.1.1.2", UsedCredits: 6})
+		return []pegomock.ReturnValue{nil}
+	})
+	req := httptest.NewRequest(http.MethodGet, "/key/id1/usage", nil)
+	resp := testCode(t, req, http.StatusOK)
+	assert.NotContains(t, resp.Body.String(), "logs")
+	intMock.VerifyWasCalled(pegomock.Never()).UsageLogs(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+		pegomock.Any[time.Time](), pegomock.Any[int](), pegomock.Any[func(*api.Log) error]())
+
+	req = httptest.NewRequest(http.MethodGet, "/key/id1/usage?full=1&limit=5", nil)
+	resp = testCode(t, req, http.StatusOK)
+	var res api.Usage
+	require.Nil(t, json.Unmarshal(resp.Body.Bytes(), &res))
+	assert.Equal(t, 2, res.RequestCount)
+	assert.Equal(t, 10.0, res.UsedCredits)
+	require.Len(t, res.Logs, 2)
+	assert.Equal(t, "1.1.1.1", res.Logs[0].IP)
+	assert.Equal(t, "1.1.1.2", res.Logs[1].IP)
+	_, _, _, _, _, cLimit, _ := intMock.VerifyWasCalledOnce().UsageLogs(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+		pegomock.Any[time.Time](), pegomock.Any[int](), pegomock.Any[func(*api.Log) error]()).GetCapturedArguments()
+	assert.Equal(t, 5, cLimit)
+}
+
+func TestKeyUsage_FullEmpty(t *testing.T) {
+	initTest(t)
+	pegomock.When(intMock.Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+		pegomock.Any[time.Time]())).ThenReturn(&api.Usage{}, nil)
+	pegomock.When(intMock.UsageLogs(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+		pegomock.Any[time.Time](), pegomock.Any[int](), pegomock.Any[func(*api.Log) error]())).ThenReturn(nil)
+	req := httptest.NewRequest(http.MethodGet, "/key/id1/usage?full=1", nil)
+	resp := testCode(t, req, http.StatusOK)
+	assert.Equal(t, `{"requestCount":0,"logs":[]}`, resp.Body.String())
+}
+
+func TestKeyUsage_FailTooManyLogs(t *testing.T) {
+	initTest(t)
+	pegomock.When(intMock.Usage(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](), pegomock.Any[time.Time](),
+		pegomock.Any[time.Time]())).ThenReturn(&api.Usage{RequestCount: 11}, nil)
+	req := httptest.NewRequest(http.MethodGet, "/key/id1/usage?full=1&limit=10", nil)
+	testCode(t, req, http.StatusBadRequest)
 }
 
 func TestGetKey_ReturnKey(t *testing.T) {
@@ -358,13 +564,146 @@ func TestChange(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			initTest(t)
-			pegomock.When(intMock.Change(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string]())).ThenReturn(&tt.ret.res, tt.ret.err)
+			pegomock.When(intMock.Change(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](),
+				pegomock.Any[time.Duration]())).ThenReturn(&tt.ret.res, tt.ret.err)
 			req := httptest.NewRequest(http.MethodPost, "/key/id/change", nil)
 			testCode(t, req, tt.want)
 		})
 	}
 }
 
+func TestChange_Grace(t *testing.T) {
+	tests := []struct {
+		name  string
+		grace string
+		want  int
+		wantG time.Duration
+	}{
+		{name: "OK", grace: "24h", want: http.StatusOK, wantG: 24 * time.Hour},
+		{name: "Empty", grace: "", want: http.StatusOK, wantG: 0},
+		{name: "Wrong", grace: "olia", want: http.StatusBadRequest},
+		{name: "Negative", grace: "-1h", want: http.StatusBadRequest},
+		{name: "Too long", grace: "1000h", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			pegomock.When(intMock.Change(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](),
+				pegomock.Any[time.Duration]())).ThenReturn(&api.Key{Key: "kk"}, nil)
+			req := httptest.NewRequest(http.MethodPost, "/key/id/change?grace="+tt.grace, nil)
+			testCode(t, req, tt.want)
+			if tt.want == http.StatusOK {
+				_, _, _, cGrace := intMock.VerifyWasCalledOnce().Change(pegomock.Any[context.Context](), pegomock.Any[*model.User](),
+					pegomock.Any[string](), pegomock.Any[time.Duration]()).GetCapturedArguments()
+				assert.Equal(t, tt.wantG, cGrace)
+			}
+		})
+	}
+}
+
+func TestEndRotation(t *testing.T) {
+	type ret struct {
+		res api.Key
+		err error
+	}
+	tests := []struct {
+		name string
+		ret  ret
+		want int
+	}{
+		{name: "OK", ret: ret{res: api.Key{ID: "id"}, err: nil},
+			want: http.StatusOK},
+		{name: "No record", ret: ret{err: model.ErrNoRecord},
+			want: http.StatusBadRequest},
+		{name: "Fail", ret: ret{err: errors.New("olia")},
+			want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			pegomock.When(intMock.EndRotation(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string]())).ThenReturn(&tt.ret.res, tt.ret.err)
+			req := httptest.NewRequest(http.MethodPost, "/key/id/change/end", nil)
+			testCode(t, req, tt.want)
+		})
+	}
+}
+
+func TestArchive(t *testing.T) {
+	type ret struct {
+		res api.Key
+		err error
+	}
+	tests := []struct {
+		name string
+		ret  ret
+		want int
+	}{
+		{name: "OK", ret: ret{res: api.Key{ID: "id"}, err: nil},
+			want: http.StatusOK},
+		{name: "No record", ret: ret{err: model.ErrNoRecord},
+			want: http.StatusBadRequest},
+		{name: "No access", ret: ret{err: model.ErrNoAccess},
+			want: http.StatusForbidden},
+		{name: "Fail", ret: ret{err: errors.New("olia")},
+			want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTest(t)
+			pegomock.When(intMock.Archive(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string]())).ThenReturn(&tt.ret.res, tt.ret.err)
+			req := httptest.NewRequest(http.MethodPost, "/key/id/archive", nil)
+			testCode(t, req, tt.want)
+		})
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	readOnly := map[permission.Enum]bool{permission.KeyRead: true, permission.UsageRead: true,
+		permission.StatsRead: true, permission.LogsRead: true}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		perms  map[permission.Enum]bool
+		want   int
+	}{
+		{name: "Create", method: http.MethodPost, path: "/key", body: api.CreateInput{Service: "pr"}, perms: readOnly, want: http.StatusForbidden},
+		{name: "Update", method: http.MethodPatch, path: "/key/1", body: api.UpdateInput{}, perms: readOnly, want: http.StatusForbidden},
+		{name: "Change", method: http.MethodPost, path: "/key/1/change", perms: readOnly, want: http.StatusForbidden},
+		{name: "Archive", method: http.MethodPost, path: "/key/1/archive", perms: readOnly, want: http.StatusForbidden},
+		{name: "End rotation", method: http.MethodPost, path: "/key/1/change/end", perms: readOnly, want: http.StatusForbidden},
+		{name: "Add credits", method: http.MethodPatch, path: "/key/1/credits", body: api.CreditsInput{Credits: 10},
+			perms: readOnly, want: http.StatusForbidden},
+		{name: "Remove credits", method: http.MethodPatch, path: "/key/1/credits", body: api.CreditsInput{Credits: -10},
+			perms: map[permission.Enum]bool{permission.CreditsAdd: true}, want: http.StatusForbidden},
+		{name: "Add credits OK", method: http.MethodPatch, path: "/key/1/credits", body: api.CreditsInput{Credits: 10},
+			perms: map[permission.Enum]bool{permission.CreditsAdd: true}, want: http.StatusOK},
+		{name: "Get", method: http.MethodGet, path: "/key/1", perms: map[permission.Enum]bool{}, want: http.StatusForbidden},
+		{name: "Get OK", method: http.MethodGet, path: "/key/1", perms: readOnly, want: http.StatusOK},
+		{name: "Usage", method: http.MethodGet, path: "/key/1/usage", perms: map[permission.Enum]bool{permission.KeyRead: true},
+			want: http.StatusForbidden},
+		{name: "Stats", method: http.MethodGet, path: "/stats/top", perms: map[permission.Enum]bool{permission.KeyRead: true},
+			want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestWithPermissions(t, tt.perms)
+			pegomock.When(intMock.AddCredits(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string](),
+				pegomock.Any[*api.CreditsInput]())).ThenReturn(&api.Key{}, nil)
+			pegomock.When(intMock.GetKey(pegomock.Any[context.Context](), pegomock.Any[*model.User](), pegomock.Any[string]())).
+				ThenReturn(&api.Key{}, nil)
+			var body io.Reader
+			if tt.body != nil {
+				body = mocks.ToReader(tt.body)
+			}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			testCode(t, req, tt.want)
+		})
+	}
+}
+
 func TestKeyGetID(t *testing.T) {
 	type ret struct {
 		res api.KeyID
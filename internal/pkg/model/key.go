@@ -0,0 +1,13 @@
+package model
+
+// KeyInfo keeps data of a validated key
+type KeyInfo struct {
+	ID   string
+	Tags []string
+	// OldKey is true if the request was made with the previous key during the rotation grace period
+	OldKey bool
+	// AllowedOrigins are set for publishable keys, only browser requests from the origins are allowed
+	AllowedOrigins []string
+	// Scopes restrict the key to routes, paths and methods, empty means no restriction
+	Scopes []string
+}
@@ -12,11 +12,21 @@ func _() {
 	_ = x[Everything-1]
 	_ = x[RestoreUsage-2]
 	_ = x[ResetMonthlyUsage-3]
+	_ = x[AdminManage-4]
+	_ = x[KeyRead-5]
+	_ = x[KeyCreate-6]
+	_ = x[KeyUpdate-7]
+	_ = x[KeyRotate-8]
+	_ = x[CreditsAdd-9]
+	_ = x[CreditsRemove-10]
+	_ = x[UsageRead-11]
+	_ = x[StatsRead-12]
+	_ = x[LogsRead-13]
 }
 
-const _Enum_name = "UnknownEverythingRestoreUsageResetMonthlyUsage"
+const _Enum_name = "UnknownEverythingRestoreUsageResetMonthlyUsageAdminManageKeyReadKeyCreateKeyUpdateKeyRotateCreditsAddCreditsRemoveUsageReadStatsReadLogsRead"
 
-var _Enum_index = [...]uint8{0, 7, 17, 29, 46}
+var _Enum_index = [...]uint8{0, 7, 17, 29, 46, 57, 64, 73, 82, 91, 101, 114, 123, 132, 140}
 
 func (i Enum) String() string {
 	if i < 0 || i >= Enum(len(_Enum_index)-1) {
@@ -10,8 +10,30 @@ const (
 	Everything
 	RestoreUsage
 	ResetMonthlyUsage
+	AdminManage
+	KeyRead
+	KeyCreate
+	KeyUpdate
+	KeyRotate
+	CreditsAdd
+	CreditsRemove
+	UsageRead
+	StatsRead
+	LogsRead
 )
 
+const (
+	// ReadOnly role allows to see keys, usage, stats and logs
+	ReadOnly = "ReadOnly"
+	// KeyManager role allows all key operations
+	KeyManager = "KeyManager"
+)
+
+var roles = map[string][]Enum{
+	ReadOnly:   {KeyRead, UsageRead, StatsRead, LogsRead},
+	KeyManager: {KeyRead, KeyCreate, KeyUpdate, KeyRotate, CreditsAdd, CreditsRemove, UsageRead, StatsRead, LogsRead},
+}
+
 func Parse(s string) (Enum, error) {
 	switch s {
 	case "Everything":
@@ -20,7 +42,39 @@ func Parse(s string) (Enum, error) {
 		return RestoreUsage, nil
 	case "ResetMonthlyUsage":
 		return ResetMonthlyUsage, nil
+	case "AdminManage":
+		return AdminManage, nil
+	case "KeyRead":
+		return KeyRead, nil
+	case "KeyCreate":
+		return KeyCreate, nil
+	case "KeyUpdate":
+		return KeyUpdate, nil
+	case "KeyRotate":
+		return KeyRotate, nil
+	case "CreditsAdd":
+		return CreditsAdd, nil
+	case "CreditsRemove":
+		return CreditsRemove, nil
+	case "UsageRead":
+		return UsageRead, nil
+	case "StatsRead":
+		return StatsRead, nil
+	case "LogsRead":
+		return LogsRead, nil
 	default:
 		return Unknown, fmt.Errorf("invalid Permission: %s", s)
 	}
 }
+
+// Expand parses a permission or a role name into permissions
+func Expand(s string) ([]Enum, error) {
+	if res, ok := roles[s]; ok {
+		return res, nil
+	}
+	res, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return []Enum{res}, nil
+}
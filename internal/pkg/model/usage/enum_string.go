@@ -11,11 +11,12 @@ func _() {
 	_ = x[Unknown-0]
 	_ = x[Monthly-1]
 	_ = x[Daily-2]
+	_ = x[Hourly-3]
 }
 
-const _Enum_name = "UnknownMonthlyDaily"
+const _Enum_name = "UnknownMonthlyDailyHourly"
 
-var _Enum_index = [...]uint8{0, 7, 14, 19}
+var _Enum_index = [...]uint8{0, 7, 14, 19, 25}
 
 func (i Enum) String() string {
 	if i < 0 || i >= Enum(len(_Enum_index)-1) {
@@ -12,6 +12,7 @@ const (
 	Unknown Enum = iota
 	Monthly
 	Daily
+	Hourly
 )
 
 func Parse(s string) (Enum, error) {
@@ -20,6 +21,8 @@ func Parse(s string) (Enum, error) {
 		return Monthly, nil
 	case "daily":
 		return Daily, nil
+	case "hourly":
+		return Hourly, nil
 	default:
 		return Unknown, fmt.Errorf("invalid: %s", s)
 	}
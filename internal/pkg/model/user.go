@@ -2,14 +2,17 @@ package model
 
 import (
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/airenas/api-doorman/internal/pkg/model/usage"
 	"github.com/airenas/api-doorman/internal/pkg/utils/tag"
 )
 
 type User struct {
 	ID          string
+	ParentID    string
 	Name        string
 	Disabled    bool
 	MaxValidTo  time.Time
@@ -17,7 +20,19 @@ type User struct {
 	Projects    []string
 	Permissions map[permission.Enum]bool
 	AllowedTags map[string]string
-	CurrentIP   string
+	// AllowedScopes the user can assign to keys
+	AllowedScopes []string
+	CurrentIP     string
+	// Descendants keeps IDs of all child administrators, the user can manage their keys
+	Descendants []string
+	// Budgets by project
+	Budgets map[string]*Budget
+}
+
+// Budget limits credits assigned to project keys during the period
+type Budget struct {
+	Limit  float64
+	Period usage.Enum
 }
 
 func (u *User) ValidateDate(to *time.Time) (time.Time, error) {
@@ -46,12 +61,17 @@ func (u *User) ValidateID(id string) error {
 	if u.HasPermission(permission.Everything) {
 		return nil
 	}
-	if u.ID != id {
+	if u.ID != id && !slices.Contains(u.Descendants, id) {
 		return ErrNoAccess
 	}
 	return nil
 }
 
+// AdminIDs returns user's ID with descendants
+func (u *User) AdminIDs() []string {
+	return append([]string{u.ID}, u.Descendants...)
+}
+
 func (u *User) ValidateTags(tags []string) error {
 	for _, t := range tags {
 		k, v, err := tag.Parse(t)
@@ -69,6 +89,23 @@ func (u *User) ValidateTags(tags []string) error {
 	return nil
 }
 
+// ValidateScopes checks if the user can assign the scopes,
+// a user with allowed scopes can't assign no scopes as it means no restriction
+func (u *User) ValidateScopes(scopes []string) error {
+	if u.HasPermission(permission.Everything) {
+		return nil
+	}
+	if len(u.AllowedScopes) > 0 && len(scopes) == 0 {
+		return NewNoAccessError("scopes", "unrestricted")
+	}
+	for _, s := range scopes {
+		if !slices.Contains(u.AllowedScopes, s) {
+			return NewNoAccessError("scopes", s)
+		}
+	}
+	return nil
+}
+
 func (u *User) HasPermission(perm permission.Enum) bool {
 	return u.Permissions != nil && (u.Permissions[perm] || u.Permissions[permission.Everything])
 }
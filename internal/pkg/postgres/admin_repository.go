@@ -3,8 +3,11 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/airenas/api-doorman/internal/pkg/admin/api"
@@ -29,14 +32,331 @@ func (a *AdminRepository) DeleteLogs(ctx context.Context, project string, to tim
 	panic("unimplemented")
 }
 
-// ListLogs implements admin.LogProvider.
-func (a *AdminRepository) ListLogs(ctx context.Context, project string, to time.Time) ([]*api.Log, error) {
-	panic("unimplemented")
+const (
+	_logsDefaultLimit = 100
+	_logsMaxLimit     = 1000
+
+	_logFields = `COALESCE(l.id, 0) AS id, l.key_id, l.url, l.route, l.quota_value, l.date, l.ip, l.value, l.fail, 
+	l.response_code, l.request_id, l.error_msg, l.old_key`
+)
+
+// ListLogs returns one page of logs sorted by date
+func (r *AdminRepository) ListLogs(ctx context.Context, user *model.User, in *api.LogFilter) (*api.LogListResp, error) {
+	log.Ctx(ctx).Debug().Any("filter", in).Msg("List logs")
+	limit := in.Limit
+	if limit == 0 {
+		limit = _logsDefaultLimit
+	}
+	if limit < 0 || limit > _logsMaxLimit {
+		return nil, model.NewWrongFieldError("limit", fmt.Sprintf("must be in [1, %d]", _logsMaxLimit))
+	}
+	query, values, err := prepareLogsQuery(user, in, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	var res []*logRecord
+	if err := r.db.SelectContext(ctx, &res, query, values...); err != nil {
+		return nil, mapErr(err)
+	}
+	log.Ctx(ctx).Debug().Int("count", len(res)).Msg("Got logs")
+	apiRes := &api.LogListResp{Logs: make([]*api.Log, 0, len(res))}
+	if len(res) > limit {
+		res = res[:limit]
+		apiRes.NextCursor = encodeLogCursor(res[limit-1])
+	}
+	for _, r := range res {
+		apiRes.Logs = append(apiRes.Logs, mapToLog(r))
+	}
+	return apiRes, nil
 }
 
-// List implements admin.KeyRetriever.
-func (a *AdminRepository) List(ctx context.Context, project string) ([]*api.Key, error) {
-	panic("unimplemented")
+// StreamLogs passes all logs matching the filter to the callback one by one
+func (r *AdminRepository) StreamLogs(ctx context.Context, user *model.User, in *api.LogFilter, f func(*api.Log) error) error {
+	log.Ctx(ctx).Debug().Any("filter", in).Msg("Stream logs")
+	if in.Limit < 0 {
+		return model.NewWrongFieldError("limit", "negative")
+	}
+	query, values, err := prepareLogsQuery(user, in, in.Limit)
+	if err != nil {
+		return err
+	}
+	rows, err := r.db.QueryxContext(ctx, query, values...)
+	if err != nil {
+		return mapErr(err)
+	}
+	defer rows.Close()
+	c := 0
+	for rows.Next() {
+		var rec logRecord
+		if err := rows.StructScan(&rec); err != nil {
+			return fmt.Errorf("scan log: %w", err)
+		}
+		if err := f(mapToLog(&rec)); err != nil {
+			return err
+		}
+		c++
+	}
+	log.Ctx(ctx).Debug().Int("count", c).Msg("Streamed logs")
+	return rows.Err()
+}
+
+func prepareLogsQuery(user *model.User, in *api.LogFilter, limit int) (string, []interface{}, error) {
+	if err := user.ValidateProject(in.Project); err != nil {
+		return "", nil, err
+	}
+	f := &queryFilter{}
+	f.add("k.project = $%d", in.Project)
+	if !user.HasPermission(permission.Everything) {
+		f.add("k.adm_id = ANY($%d)", pq.StringArray(user.AdminIDs()))
+	}
+	if in.KeyID != "" {
+		f.add("l.key_id = $%d", in.KeyID)
+	}
+	if in.From != nil {
+		f.add("l.date >= $%d", *in.From)
+	}
+	if in.To != nil {
+		f.add("l.date < $%d", *in.To)
+	}
+	if in.ResponseCode != 0 {
+		f.add("l.response_code = $%d", in.ResponseCode)
+	}
+	if in.Fail != nil {
+		f.add("l.fail = $%d", *in.Fail)
+	}
+	if in.IP != "" {
+		f.add("l.ip = $%d", in.IP)
+	}
+	if in.RequestID != "" {
+		f.add("l.request_id = $%d", in.RequestID)
+	}
+	if in.Cursor != "" {
+		date, id, err := decodeLogCursor(in.Cursor)
+		if err != nil {
+			return "", nil, model.NewWrongFieldError("cursor", "wrong format")
+		}
+		// the plain date bound lets the chunks before the cursor be skipped
+		dArg := f.addValue(date)
+		f.conditions = append(f.conditions, fmt.Sprintf("l.date >= %s", dArg),
+			fmt.Sprintf("(l.date, l.id) > (%s, %s)", dArg, f.addValue(id)))
+	}
+	limitStr := ""
+	if limit > 0 {
+		limitStr = "LIMIT " + f.addValue(limit)
+	}
+	return `
+		SELECT ` + _logFields + `
+		FROM logs l
+		JOIN keys k ON k.id = l.key_id
+		WHERE ` + f.where() + `
+		ORDER BY l.date, l.id
+		` + limitStr, f.values, nil
+}
+
+// encodeLogCursor encodes the date and the unique log id of the last returned log
+func encodeLogCursor(r *logRecord) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d|%d", r.Date.UnixNano(), r.ID)))
+}
+
+func decodeLogCursor(s string) (time.Time, int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("decode cursor: %w", err)
+	}
+	dStr, idStr, ok := strings.Cut(string(b), "|")
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("wrong cursor '%s'", string(b))
+	}
+	nanos, err := strconv.ParseInt(dStr, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("wrong cursor date: %w", err)
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("wrong cursor id: %w", err)
+	}
+	return time.Unix(0, nanos), id, nil
+}
+
+const (
+	_keysDefaultLimit = 100
+	_keysMaxLimit     = 1000
+)
+
+// keySortFields maps API sort names to SQL expressions, all expressions are not null
+var keySortFields = map[string]string{
+	"created":   "k.created",
+	"lastUsed":  "COALESCE(k.last_used, 'epoch'::TIMESTAMPTZ)",
+	"validTo":   "k.valid_to",
+	"remaining": "(k.quota_limit - k.quota_value)",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// List returns one page of keys matching the filter, key secrets are never returned
+func (r *AdminRepository) List(ctx context.Context, user *model.User, in *api.KeyFilter) (*api.KeyListResp, error) {
+	log.Ctx(ctx).Debug().Any("filter", in).Msg("List keys")
+	limit := in.Limit
+	if limit == 0 {
+		limit = _keysDefaultLimit
+	}
+	if limit < 0 || limit > _keysMaxLimit {
+		return nil, model.NewWrongFieldError("limit", fmt.Sprintf("must be in [1, %d]", _keysMaxLimit))
+	}
+	query, values, err := prepareKeysQuery(user, in, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	var res []*keyRecord
+	if err := r.db.SelectContext(ctx, &res, query, values...); err != nil {
+		return nil, mapErr(err)
+	}
+	log.Ctx(ctx).Debug().Int("count", len(res)).Msg("Got keys")
+	apiRes := &api.KeyListResp{Keys: make([]*api.Key, 0, len(res))}
+	if len(res) > limit {
+		res = res[:limit]
+		apiRes.NextCursor = encodeKeyCursor(in.Sort, res[limit-1])
+	}
+	for _, r := range res {
+		apiRes.Keys = append(apiRes.Keys, mapToAdminKey(r, ""))
+	}
+	return apiRes, nil
+}
+
+func prepareKeysQuery(user *model.User, in *api.KeyFilter, limit int) (string, []interface{}, error) {
+	if err := user.ValidateProject(in.Project); err != nil {
+		return "", nil, err
+	}
+	sortName, desc := parseKeySort(in.Sort)
+	sortExpr, ok := keySortFields[sortName]
+	if !ok {
+		return "", nil, model.NewWrongFieldError("sort", fmt.Sprintf("unknown '%s'", in.Sort))
+	}
+	f := &queryFilter{}
+	f.add("k.project = $%d", in.Project)
+	if !user.HasPermission(permission.Everything) {
+		f.add("k.adm_id = ANY($%d)", pq.StringArray(user.AdminIDs()))
+	}
+	if in.AdminID != "" {
+		f.add("k.adm_id = $%d", in.AdminID)
+	}
+	if in.Archived {
+		f.conditions = append(f.conditions, "k.archived IS NOT NULL")
+	} else {
+		f.conditions = append(f.conditions, "k.archived IS NULL")
+	}
+	if in.Disabled != nil {
+		f.add("k.disabled = $%d", *in.Disabled)
+	}
+	if in.Expired != nil {
+		if *in.Expired {
+			f.conditions = append(f.conditions, "k.valid_to <= now()")
+		} else {
+			f.conditions = append(f.conditions, "k.valid_to > now()")
+		}
+	}
+	if in.Tag != "" {
+		if strings.Contains(in.Tag, ":") {
+			f.add("$%d = ANY(k.tags)", in.Tag)
+		} else {
+			f.add("EXISTS (SELECT 1 FROM unnest(k.tags) t WHERE t LIKE $%d)", likeEscaper.Replace(in.Tag)+":%")
+		}
+	}
+	if in.Description != "" {
+		f.add("k.description ILIKE $%d", "%"+likeEscaper.Replace(in.Description)+"%")
+	}
+	if in.ExternalID != "" {
+		f.add("k.external_id = $%d", in.ExternalID)
+	}
+	if in.LastUsedFrom != nil {
+		f.add("k.last_used >= $%d", *in.LastUsedFrom)
+	}
+	if in.LastUsedTo != nil {
+		f.add("k.last_used < $%d", *in.LastUsedTo)
+	}
+	if in.RemainingMin != nil {
+		f.add("(k.quota_limit - k.quota_value) >= $%d", *in.RemainingMin)
+	}
+	if in.RemainingMax != nil {
+		f.add("(k.quota_limit - k.quota_value) <= $%d", *in.RemainingMax)
+	}
+	if in.Cursor != "" {
+		value, id, err := decodeKeyCursor(sortName, in.Cursor)
+		if err != nil {
+			return "", nil, model.NewWrongFieldError("cursor", "wrong format")
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		f.conditions = append(f.conditions, fmt.Sprintf("(%s, k.id) %s (%s, %s)", sortExpr, op, f.addValue(value), f.addValue(id)))
+	}
+	order := "ASC"
+	if desc {
+		order = "DESC"
+	}
+	return `
+		SELECT ` + _keyFields + `
+		FROM keys k
+		WHERE ` + f.where() + `
+		ORDER BY ` + sortExpr + ` ` + order + `, k.id ` + order + `
+		LIMIT ` + strconv.Itoa(limit), f.values, nil
+}
+
+// parseKeySort returns sort field name and descending flag, created is the default
+func parseKeySort(s string) (string, bool) {
+	desc := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		s = "created"
+	}
+	return s, desc
+}
+
+func encodeKeyCursor(sort string, r *keyRecord) string {
+	sortName, _ := parseKeySort(sort)
+	var v string
+	switch sortName {
+	case "lastUsed":
+		v = "0"
+		if r.LastUsed != nil {
+			v = strconv.FormatInt(r.LastUsed.UnixNano(), 10)
+		}
+	case "validTo":
+		v = strconv.FormatInt(r.ValidTo.UnixNano(), 10)
+	case "remaining":
+		v = strconv.FormatFloat(r.Limit-r.QuotaValue, 'g', -1, 64)
+	default:
+		v = strconv.FormatInt(r.Created.UnixNano(), 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%s|%s", sortName, v, r.ID)))
+}
+
+// decodeKeyCursor returns the sort value and key ID, the cursor must be made for the same sort field
+func decodeKeyCursor(sortName, s string) (interface{}, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode cursor: %w", err)
+	}
+	strs := strings.SplitN(string(b), "|", 3)
+	if len(strs) != 3 {
+		return nil, "", fmt.Errorf("wrong cursor '%s'", string(b))
+	}
+	if strs[0] != sortName {
+		return nil, "", fmt.Errorf("cursor for '%s', sort by '%s'", strs[0], sortName)
+	}
+	if sortName == "remaining" {
+		v, err := strconv.ParseFloat(strs[1], 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("wrong cursor value: %w", err)
+		}
+		return v, strs[2], nil
+	}
+	nanos, err := strconv.ParseInt(strs[1], 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("wrong cursor date: %w", err)
+	}
+	return time.Unix(0, nanos), strs[2], nil
 }
 
 func NewAdmimRepository(ctx context.Context, db *sqlx.DB, hasher Hasher) (*AdminRepository, error) {
@@ -140,12 +460,15 @@ func (r *AdminRepository) RestoreUsage(ctx context.Context, project string, manu
 
 func (r *AdminRepository) ValidateToken(ctx context.Context, token string, ip string) (*model.User, error) {
 	log.Ctx(ctx).Trace().Msg("Validating token")
-	hash := r.hasher.HashKey(token)
+	hashes := r.hasher.HashKeys(token)
 	var res administratorRecord
 	err := r.db.GetContext(ctx, &res, `
-		SELECT id, disabled, max_valid_to, max_limit, projects, name, permissions, ip_white_list, allowed_tags
+		SELECT id, parent_id, key_hash, disabled, max_valid_to, max_limit, projects, name, permissions, ip_white_list, allowed_tags,
+			allowed_scopes
 		FROM administrators
-		WHERE key_hash = $1`, hash)
+		WHERE key_hash = ANY($1)
+		ORDER BY key_hash = $2 DESC
+		LIMIT 1`, pq.StringArray(hashes), hashes[0])
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, model.ErrUnauthorized
@@ -162,28 +485,92 @@ func (r *AdminRepository) ValidateToken(ctx context.Context, token string, ip st
 	if !ok {
 		return nil, fmt.Errorf("%w: ip %s is not allowed: %s", model.ErrUnauthorized, ip, res.IPWhiteList.String)
 	}
+	if res.ParentID.Valid {
+		disabled, err := isAnyAncestorDisabled(ctx, r.db, res.ParentID.String)
+		if err != nil {
+			return nil, err
+		}
+		if disabled {
+			return nil, fmt.Errorf("parent disabled: %w", model.ErrUnauthorized)
+		}
+	}
+	if res.KeyHash != hashes[0] {
+		r.rehashAdmin(ctx, res.ID, res.KeyHash, hashes[0])
+	}
+	return r.toUser(ctx, &res, ip)
+}
+
+// LoadUser loads the enabled administrator by ID, used by the services acting on behalf of an administrator
+func (r *AdminRepository) LoadUser(ctx context.Context, id string) (*model.User, error) {
+	res, err := loadAdminRecord(ctx, r.db, id)
+	if err != nil {
+		return nil, fmt.Errorf("load administrator %s: %w", id, err)
+	}
+	if res.Disabled {
+		return nil, fmt.Errorf("disabled: %w", model.ErrUnauthorized)
+	}
+	if res.ParentID.Valid {
+		disabled, err := isAnyAncestorDisabled(ctx, r.db, res.ParentID.String)
+		if err != nil {
+			return nil, err
+		}
+		if disabled {
+			return nil, fmt.Errorf("parent disabled: %w", model.ErrUnauthorized)
+		}
+	}
+	return r.toUser(ctx, res, "")
+}
+
+func (r *AdminRepository) toUser(ctx context.Context, res *administratorRecord, ip string) (*model.User, error) {
+	descendants, err := loadDescendants(ctx, r.db, res.ID)
+	if err != nil {
+		return nil, err
+	}
+	budgets, err := loadBudgets(ctx, r.db, res.ID)
+	if err != nil {
+		return nil, err
+	}
 
 	return &model.User{
-		ID:          res.ID,
-		Projects:    res.Projects,
-		MaxValidTo:  res.MaxValidTo,
-		MaxLimit:    res.MaxLimit,
-		Name:        res.Name,
-		Permissions: loadPermissions(res.Permissions),
-		AllowedTags: loadAllowedTags(res.AllowedTags),
-		CurrentIP:   ip,
+		ID:            res.ID,
+		ParentID:      res.ParentID.String,
+		Projects:      res.Projects,
+		MaxValidTo:    res.MaxValidTo,
+		MaxLimit:      res.MaxLimit,
+		Name:          res.Name,
+		Permissions:   loadPermissions(res.Permissions),
+		AllowedTags:   loadAllowedTags(res.AllowedTags),
+		AllowedScopes: res.AllowedScopes,
+		CurrentIP:     ip,
+		Descendants:   descendants,
+		Budgets:       toModelBudgets(budgets),
 	}, nil
 }
 
+// rehashAdmin replaces the admin's legacy hash with the current version hash, failure does not break the authentication
+func (r *AdminRepository) rehashAdmin(ctx context.Context, id, oldHash, hash string) {
+	log.Ctx(ctx).Info().Str("id", id).Int("version", r.hasher.Version()).Msg("Rehash admin key")
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE administrators
+		SET key_hash = $3,
+			hash_version = $4
+		WHERE id = $1 AND key_hash = $2`, id, oldHash, hash, r.hasher.Version())
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("id", id).Msg("can't rehash admin key")
+	}
+}
+
 func loadPermissions(stringArray pq.StringArray) map[permission.Enum]bool {
 	res := make(map[permission.Enum]bool)
 	for _, pStr := range stringArray {
-		perm, err := permission.Parse(pStr)
+		perms, err := permission.Expand(pStr)
 		if err != nil {
 			log.Warn().Str("permission", pStr).Err(err).Msg("Can't parse permission")
 			continue
 		}
-		res[perm] = true
+		for _, perm := range perms {
+			res[perm] = true
+		}
 	}
 	return res
 }
@@ -207,10 +594,11 @@ func (r *AdminRepository) AddAdmin(ctx context.Context, key string, user *model.
 	hash := r.hasher.HashKey(key)
 	_, err := r.db.ExecContext(ctx, `
 		INSERT INTO administrators
-			(id, key_hash, projects, max_valid_to, max_limit, name, created, updated, permissions)
+			(id, key_hash, projects, max_valid_to, max_limit, name, created, updated, permissions, hash_version)
 		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $7, $8)
-		`, ulid.Make().String(), hash, pq.Array(user.Projects), user.MaxValidTo, user.MaxLimit, user.Name, now, pq.Array(mapToStr(user.Permissions)))
+			($1, $2, $3, $4, $5, $6, $7, $7, $8, $9)
+		`, ulid.Make().String(), hash, pq.Array(user.Projects), user.MaxValidTo, user.MaxLimit, user.Name, now, pq.Array(mapToStr(user.Permissions)),
+		r.hasher.Version())
 	if err != nil {
 		return fmt.Errorf("insert admin: %w", mapErr(err))
 	}
@@ -379,34 +767,45 @@ func resetSettingKey(project string) string {
 
 func mapToLog(v *logRecord) *api.Log {
 	res := &api.Log{
+		KeyID:        v.KeyID,
 		Date:         v.Date,
 		Fail:         v.Fail,
 		IP:           v.IP,
 		URL:          v.URL,
+		Route:        v.Route.String,
 		QuotaValue:   v.QuotaValue,
 		Value:        v.Value,
 		ResponseCode: v.ResponseCode,
 		RequestID:    v.RequestID,
 		ErrorMsg:     v.ErrorMsg,
+		OldKey:       v.OldKey,
 	}
 	return res
 }
 
 func mapToAdminKey(keyR *keyRecord, key string) *api.Key {
 	res := &api.Key{
-		ID:          keyR.ID,
-		ValidTo:     toTimePtr(&keyR.ValidTo),
-		LastUsed:    toTimePtr(keyR.LastUsed),
-		LastIP:      keyR.LastIP.String,
-		Limit:       keyR.Limit,
-		QuotaValue:  keyR.QuotaValue,
-		QuotaFailed: keyR.QuotaValueFailed,
-		Disabled:    keyR.Disabled,
-		Created:     toTimePtr(&keyR.Created),
-		Updated:     toTimePtr(&keyR.Updated),
-		IPWhiteList: keyR.IPWhiteList.String,
-		Tags:        keyR.Tags,
-		Key:         key,
+		ID:            keyR.ID,
+		ValidTo:       toTimePtr(&keyR.ValidTo),
+		LastUsed:      toTimePtr(keyR.LastUsed),
+		LastIP:        keyR.LastIP.String,
+		Limit:         keyR.Limit,
+		QuotaValue:    keyR.QuotaValue,
+		QuotaFailed:   keyR.QuotaValueFailed,
+		Disabled:      keyR.Disabled,
+		Created:       toTimePtr(&keyR.Created),
+		Updated:       toTimePtr(&keyR.Updated),
+		IPWhiteList:   keyR.IPWhiteList.String,
+		Tags:          keyR.Tags,
+		Manual:        keyR.Manual,
+		Description:   keyR.Description.String,
+		ExternalID:    keyR.ExternalID.String,
+		AdminID:       keyR.AdminID.String,
+		Archived:      toTimePtr(keyR.Archived),
+		OldKeyValidTo: oldKeyValidTo(keyR, time.Now()),
+		Key:           key,
+
+		AllowedOrigins: keyR.AllowedOrigins,
 	}
 	return res
 }
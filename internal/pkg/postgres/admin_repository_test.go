@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_keyCursor(t *testing.T) {
+	created := time.Date(2024, 3, 15, 10, 0, 0, 123, time.UTC)
+	rec := &keyRecord{ID: "k1", Created: created, ValidTo: created.AddDate(1, 0, 0), Limit: 100, QuotaValue: 12.5}
+	tests := []struct {
+		sort string
+		want interface{}
+	}{
+		{sort: "", want: created},
+		{sort: "-created", want: created},
+		{sort: "validTo", want: created.AddDate(1, 0, 0)},
+		{sort: "lastUsed", want: time.Unix(0, 0)},
+		{sort: "-remaining", want: 87.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			c := encodeKeyCursor(tt.sort, rec)
+			name, _ := parseKeySort(tt.sort)
+			v, id, err := decodeKeyCursor(name, c)
+			require.NoError(t, err)
+			assert.Equal(t, "k1", id)
+			if tm, ok := tt.want.(time.Time); ok {
+				assert.True(t, tm.Equal(v.(time.Time)))
+			} else {
+				assert.Equal(t, tt.want, v)
+			}
+		})
+	}
+	_, _, err := decodeKeyCursor("validTo", encodeKeyCursor("created", rec))
+	assert.Error(t, err)
+	_, _, err = decodeKeyCursor("created", "olia")
+	assert.Error(t, err)
+}
+
+func Test_prepareKeysQuery(t *testing.T) {
+	user := &model.User{ID: "a1", Projects: []string{"p1"}, Permissions: map[permission.Enum]bool{permission.KeyRead: true}}
+	disabled, remaining := true, 10.0
+	query, values, err := prepareKeysQuery(user, &api.KeyFilter{Project: "p1", Disabled: &disabled, Tag: "plan",
+		Description: "50%_off", RemainingMin: &remaining, Sort: "-remaining"}, 11)
+	require.NoError(t, err)
+	assert.Contains(t, query, "k.adm_id = ANY($2)")
+	assert.Contains(t, query, "k.disabled = $3")
+	assert.Contains(t, query, "t LIKE $4")
+	assert.Contains(t, query, "k.description ILIKE $5")
+	assert.Contains(t, query, "(k.quota_limit - k.quota_value) >= $6")
+	assert.Contains(t, query, "ORDER BY (k.quota_limit - k.quota_value) DESC, k.id DESC")
+	assert.Contains(t, query, "k.archived IS NULL")
+	assert.Contains(t, query, "LIMIT 11")
+	require.Len(t, values, 6)
+	assert.Equal(t, "plan:%", values[3])
+	assert.Equal(t, `%50\%\_off%`, values[4])
+
+	query, _, err = prepareKeysQuery(user, &api.KeyFilter{Project: "p1", Archived: true}, 11)
+	require.NoError(t, err)
+	assert.Contains(t, query, "k.archived IS NOT NULL")
+
+	_, _, err = prepareKeysQuery(user, &api.KeyFilter{Project: "p2"}, 11)
+	assert.Error(t, err)
+	_, _, err = prepareKeysQuery(user, &api.KeyFilter{Project: "p1", Sort: "olia"}, 11)
+	assert.IsType(t, &model.WrongFieldError{}, err)
+	_, _, err = prepareKeysQuery(user, &api.KeyFilter{Project: "p1", Cursor: "olia"}, 11)
+	assert.IsType(t, &model.WrongFieldError{}, err)
+}
+
+func Test_prepareLogsQuery(t *testing.T) {
+	user := &model.User{ID: "a1", Projects: []string{"p1"}, Permissions: map[permission.Enum]bool{permission.Everything: true}}
+	date := time.Date(2024, 3, 15, 10, 0, 0, 123, time.UTC)
+	cursor := encodeLogCursor(&logRecord{ID: 12, Date: date})
+	query, values, err := prepareLogsQuery(user, &api.LogFilter{Project: "p1", Cursor: cursor}, 11)
+	require.NoError(t, err)
+	assert.Contains(t, query, "l.date >= $2 AND (l.date, l.id) > ($2, $3)")
+	assert.Contains(t, query, "ORDER BY l.date, l.id")
+	require.Len(t, values, 4)
+	assert.True(t, date.Equal(values[1].(time.Time)))
+	assert.Equal(t, int64(12), values[2])
+
+	_, _, err = prepareLogsQuery(user, &api.LogFilter{Project: "p1", Cursor: "olia"}, 11)
+	assert.IsType(t, &model.WrongFieldError{}, err)
+}
@@ -0,0 +1,677 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/airenas/api-doorman/internal/pkg/model/usage"
+	"github.com/airenas/api-doorman/internal/pkg/randkey"
+	"github.com/airenas/api-doorman/internal/pkg/utils"
+	"github.com/airenas/api-doorman/internal/pkg/utils/scope"
+	"github.com/airenas/api-doorman/internal/pkg/utils/tag"
+	"github.com/lib/pq"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	_adminKeySize = 40
+
+	_adminFields = `id, parent_id, name, description, projects, permissions, max_valid_to, max_limit,
+	ip_white_list, allowed_tags, allowed_scopes, disabled, created, updated`
+)
+
+// CreateAdmin creates a new child administrator of the user,
+// the returned key is not stored and can't be retrieved later
+func (r *AdminRepository) CreateAdmin(ctx context.Context, user *model.User, in *api.AdministratorInput) (*api.Administrator, error) {
+	log.Ctx(ctx).Trace().Any("data", in).Msg("Create admin")
+	if err := validateAdminInput(in); err != nil {
+		return nil, err
+	}
+	maxValidTo, err := user.ValidateDate(in.MaxValidTo)
+	if err != nil {
+		return nil, err
+	}
+	rec := &administratorRecord{
+		ID:            ulid.Make().String(),
+		ParentID:      toNullStr(user.ID),
+		Name:          strings.TrimSpace(in.Name),
+		Description:   toNullStr(in.Description),
+		Projects:      in.Projects,
+		Permissions:   in.Permissions,
+		MaxValidTo:    maxValidTo,
+		MaxLimit:      in.MaxLimit,
+		IPWhiteList:   toNullStr(in.IPWhiteList),
+		AllowedTags:   in.AllowedTags,
+		AllowedScopes: in.AllowedScopes,
+		Disabled:      in.Disabled,
+	}
+	budgets := toBudgetRecords(rec.ID, in.Budgets)
+	if err := validateAdminGrant(user, rec, budgets); err != nil {
+		return nil, err
+	}
+	key, err := randkey.Generate(_adminKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	now := time.Now()
+	rec.Created, rec.Updated = now, now
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO administrators
+			(id, parent_id, key_hash, name, description, projects, permissions, max_valid_to, max_limit,
+			ip_white_list, allowed_tags, allowed_scopes, disabled, created, updated, hash_version)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $14, $15)
+		`, rec.ID, rec.ParentID, r.hasher.HashKey(key), rec.Name, rec.Description, rec.Projects, rec.Permissions, rec.MaxValidTo, rec.MaxLimit,
+		rec.IPWhiteList, rec.AllowedTags, rec.AllowedScopes, rec.Disabled, now, r.hasher.Version())
+	if err != nil {
+		return nil, fmt.Errorf("insert admin: %w", mapErr(err))
+	}
+	if err := saveBudgets(ctx, tx, rec.ID, budgets); err != nil {
+		return nil, err
+	}
+	if err := addAdminOperation(ctx, tx, rec.ID, now, "Create", newAdminOpData(user, nil)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return mapToAdministrator(rec, budgets, key), nil
+}
+
+// ListAdmins returns administrators the user can manage
+func (r *AdminRepository) ListAdmins(ctx context.Context, user *model.User) ([]*api.Administrator, error) {
+	log.Ctx(ctx).Trace().Str("user", user.ID).Msg("List admins")
+	f := &queryFilter{}
+	if !user.HasPermission(permission.Everything) {
+		f.add("id = ANY($%d)", pq.StringArray(user.Descendants))
+	}
+	var res []*administratorRecord
+	err := r.db.SelectContext(ctx, &res, `
+		SELECT `+_adminFields+`
+		FROM administrators
+		WHERE `+f.where()+`
+		ORDER BY created, id`, f.values...)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	apiRes := make([]*api.Administrator, 0, len(res))
+	for _, rec := range res {
+		apiRes = append(apiRes, mapToAdministrator(rec, nil, ""))
+	}
+	return apiRes, nil
+}
+
+// GetAdmin returns one administrator with budgets usage
+func (r *AdminRepository) GetAdmin(ctx context.Context, user *model.User, id string) (*api.Administrator, error) {
+	log.Ctx(ctx).Trace().Str("id", id).Msg("Get admin")
+	rec, err := loadAdminRecord(ctx, r.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAdminAccess(user, rec); err != nil {
+		return nil, err
+	}
+	budgets, err := loadBudgets(ctx, r.db, id)
+	if err != nil {
+		return nil, err
+	}
+	res := mapToAdministrator(rec, budgets, "")
+	now := time.Now()
+	for _, b := range res.Budgets {
+		period, _ := usage.Parse(b.Period)
+		if b.Used, err = budgetUsed(ctx, r.db, id, b.Project, budgetPeriodStart(period, now), ""); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// UpdateAdmin updates administrator's settings, disabling is also an update
+func (r *AdminRepository) UpdateAdmin(ctx context.Context, user *model.User, id string, in *api.AdministratorUpdate) (*api.Administrator, error) {
+	log.Ctx(ctx).Trace().Str("id", id).Any("data", in).Msg("Update admin")
+	if err := validateAdminUpdate(in); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	rec, err := loadAdminRecord(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAdminAccess(user, rec); err != nil {
+		return nil, err
+	}
+	budgets, err := loadBudgets(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	updates, values, err := applyAdminUpdate(in, rec)
+	if err != nil {
+		return nil, err
+	}
+	if in.Budgets != nil {
+		budgets = toBudgetRecords(id, *in.Budgets)
+	}
+	if err := validateAdminGrant(user, rec, budgets); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rec.Updated = now
+	setSQL := "updated = $2"
+	if len(updates) > 0 {
+		setSQL += ", " + makeUpdateSQL(updates)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE administrators
+		SET `+setSQL+`
+		WHERE id = $1`, append([]interface{}{id, now}, values...)...)
+	if err != nil {
+		return nil, fmt.Errorf("update admin: %w", mapErr(err))
+	}
+	if in.Budgets != nil {
+		updates = append(updates, "budgets")
+		if err := saveBudgets(ctx, tx, id, budgets); err != nil {
+			return nil, err
+		}
+	}
+	if err := addAdminOperation(ctx, tx, id, now, "Update", newAdminOpData(user, updates)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return mapToAdministrator(rec, budgets, ""), nil
+}
+
+// RotateAdminKey generates a new key for the administrator, the old one stops working immediately
+func (r *AdminRepository) RotateAdminKey(ctx context.Context, user *model.User, id string) (*api.Administrator, error) {
+	log.Ctx(ctx).Trace().Str("id", id).Msg("Rotate admin key")
+	key, err := randkey.Generate(_adminKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	rec, err := loadAdminRecord(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec.ID != user.ID {
+		if err := validateAdminAccess(user, rec); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	rec.Updated = now
+	_, err = tx.ExecContext(ctx, `
+		UPDATE administrators
+		SET key_hash = $2, updated = $3, hash_version = $4
+		WHERE id = $1`, id, r.hasher.HashKey(key), now, r.hasher.Version())
+	if err != nil {
+		return nil, fmt.Errorf("update admin: %w", mapErr(err))
+	}
+	if err := addAdminOperation(ctx, tx, id, now, "Rotate Key", newAdminOpData(user, nil)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return mapToAdministrator(rec, nil, key), nil
+}
+
+func loadAdminRecord(ctx context.Context, db dbTx, id string) (*administratorRecord, error) {
+	var res administratorRecord
+	err := db.GetContext(ctx, &res, `
+		SELECT `+_adminFields+`
+		FROM administrators
+		WHERE id = $1`, id)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	return &res, nil
+}
+
+// loadDescendants returns IDs of all children administrators recursively
+func loadDescendants(ctx context.Context, db dbTx, id string) ([]string, error) {
+	var res []string
+	err := db.SelectContext(ctx, &res, `
+		WITH RECURSIVE t AS (
+			SELECT id FROM administrators WHERE parent_id = $1
+			UNION
+			SELECT a.id FROM administrators a JOIN t ON a.parent_id = t.id
+		)
+		SELECT id FROM t`, id)
+	if err != nil {
+		return nil, fmt.Errorf("load descendants: %w", mapErr(err))
+	}
+	return res, nil
+}
+
+// isAnyAncestorDisabled checks the administrator with id and its parents
+func isAnyAncestorDisabled(ctx context.Context, db dbTx, id string) (bool, error) {
+	var res bool
+	err := db.GetContext(ctx, &res, `
+		WITH RECURSIVE t AS (
+			SELECT id, parent_id, disabled FROM administrators WHERE id = $1
+			UNION
+			SELECT a.id, a.parent_id, a.disabled FROM administrators a JOIN t ON a.id = t.parent_id
+		)
+		SELECT COALESCE(BOOL_OR(disabled), FALSE) FROM t`, id)
+	if err != nil {
+		return false, fmt.Errorf("load ancestors: %w", mapErr(err))
+	}
+	return res, nil
+}
+
+func loadBudgets(ctx context.Context, db dbTx, id string) ([]*budgetRecord, error) {
+	var res []*budgetRecord
+	err := db.SelectContext(ctx, &res, `
+		SELECT adm_id, project, budget, period
+		FROM administrator_budgets
+		WHERE adm_id = $1
+		ORDER BY project`, id)
+	if err != nil {
+		return nil, fmt.Errorf("load budgets: %w", mapErr(err))
+	}
+	return res, nil
+}
+
+// loadAncestorBudgets returns project budgets of the administrator and all its parents and locks them
+// until the end of the transaction, so concurrent credit grants are validated one after another
+func loadAncestorBudgets(ctx context.Context, db dbTx, id, project string) ([]*budgetRecord, error) {
+	var res []*budgetRecord
+	err := db.SelectContext(ctx, &res, `
+		WITH RECURSIVE t AS (
+			SELECT id, parent_id FROM administrators WHERE id = $1
+			UNION
+			SELECT a.id, a.parent_id FROM administrators a JOIN t ON a.id = t.parent_id
+		)
+		SELECT b.adm_id, b.project, b.budget, b.period
+		FROM administrator_budgets b
+		JOIN t ON t.id = b.adm_id
+		WHERE b.project = $2
+		ORDER BY b.adm_id
+		FOR UPDATE OF b`, id, project)
+	if err != nil {
+		return nil, fmt.Errorf("load budgets: %w", mapErr(err))
+	}
+	return res, nil
+}
+
+func saveBudgets(ctx context.Context, tx dbTx, id string, budgets []*budgetRecord) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM administrator_budgets WHERE adm_id = $1`, id); err != nil {
+		return fmt.Errorf("delete budgets: %w", mapErr(err))
+	}
+	for _, b := range budgets {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO administrator_budgets (adm_id, project, budget, period)
+			VALUES ($1, $2, $3, $4)`, id, b.Project, b.Budget, b.Period)
+		if err != nil {
+			return fmt.Errorf("insert budget: %w", mapErr(err))
+		}
+	}
+	return nil
+}
+
+// budgetUsed sums credits assigned to the project keys by the administrator and its descendants since the time
+func budgetUsed(ctx context.Context, db dbTx, id, project string, since time.Time, skipOperationID string) (float64, error) {
+	var res float64
+	err := db.GetContext(ctx, &res, `
+		WITH RECURSIVE t AS (
+			SELECT $1::TEXT AS id
+			UNION
+			SELECT a.id FROM administrators a JOIN t ON a.parent_id = t.id
+		)
+		SELECT COALESCE(SUM(o.quota_value), 0)
+		FROM operations o
+		JOIN keys k ON k.id = o.key_id
+		WHERE o.data->>'adm_id' IN (SELECT id FROM t) AND k.project = $2 AND o.date >= $3 AND o.id <> $4`,
+		id, project, since, skipOperationID)
+	if err != nil {
+		return 0, fmt.Errorf("get budget usage: %w", mapErr(err))
+	}
+	return res, nil
+}
+
+// validateBudgets checks that credits fit into the project budgets of the user and all its parents
+func validateBudgets(ctx context.Context, db dbTx, user *model.User, project string, credits float64, operationID string) error {
+	budgets, err := loadAncestorBudgets(ctx, db, user.ID, project)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, b := range budgets {
+		period, err := usage.Parse(b.Period)
+		if err != nil {
+			return fmt.Errorf("wrong budget period '%s': %w", b.Period, err)
+		}
+		used, err := budgetUsed(ctx, db, b.AdminID, project, budgetPeriodStart(period, now), operationID)
+		if err != nil {
+			return err
+		}
+		if used+credits > b.Budget {
+			return model.NewWrongFieldError("credits", fmt.Sprintf("over %s budget for %s, budget %f, used %f", b.Period, project, b.Budget, used))
+		}
+	}
+	return nil
+}
+
+// budgetPeriodStart returns the start of the current budget period in UTC
+func budgetPeriodStart(period usage.Enum, now time.Time) time.Time {
+	now = now.UTC()
+	if period == usage.Daily {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return utils.StartOfMonth(now, 0)
+}
+
+func addAdminOperation(ctx context.Context, tx dbTx, id string, date time.Time, msg string, data *operationData) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO administrator_operations (id, adm_id, date, msg, data)
+		VALUES ($1, $2, $3, $4, $5)`, ulid.Make().String(), id, date, msg, data)
+	if err != nil {
+		return fmt.Errorf("insert admin operation: %w", mapErr(err))
+	}
+	return nil
+}
+
+func newAdminOpData(user *model.User, fields []string) *operationData {
+	res := newOpData(user)
+	res.Fields = fields
+	return res
+}
+
+// validateAdminAccess checks if the user can see and manage the administrator:
+// not Everything users can manage only their descendants
+func validateAdminAccess(user *model.User, rec *administratorRecord) error {
+	if user.HasPermission(permission.Everything) {
+		return nil
+	}
+	if !slices.Contains(user.Descendants, rec.ID) {
+		return model.ErrNoAccess
+	}
+	return nil
+}
+
+// validateAdminGrant checks that the user does not grant more than has
+func validateAdminGrant(user *model.User, rec *administratorRecord, budgets []*budgetRecord) error {
+	for _, p := range rec.Permissions {
+		perms, err := permission.Expand(p)
+		if err != nil {
+			return model.NewWrongFieldError("permissions", fmt.Sprintf("wrong permission: %s", p))
+		}
+		for _, perm := range perms {
+			if !user.HasPermission(perm) {
+				return model.NewNoAccessError("permissions", p)
+			}
+		}
+	}
+	for _, b := range budgets {
+		if !slices.Contains(rec.Projects, b.Project) {
+			return model.NewWrongFieldError("budgets", fmt.Sprintf("no project %s", b.Project))
+		}
+	}
+	if user.HasPermission(permission.Everything) {
+		return nil
+	}
+	for _, p := range rec.Projects {
+		if err := user.ValidateProject(p); err != nil {
+			return err
+		}
+	}
+	if rec.MaxLimit > user.MaxLimit {
+		return model.NewWrongFieldError("maxLimit", fmt.Sprintf("over limit, max %f", user.MaxLimit))
+	}
+	if rec.MaxValidTo.After(user.MaxValidTo) {
+		return model.NewWrongFieldError("maxValidTo", fmt.Sprintf("must be before %s", user.MaxValidTo.Format(time.RFC3339)))
+	}
+	for _, t := range rec.AllowedTags {
+		k, v, _ := tag.Parse(t)
+		if av, ok := user.AllowedTags[k]; !ok || !tag.Narrows(v, av) {
+			return model.NewNoAccessError("allowedTags", t)
+		}
+	}
+	if len(user.AllowedScopes) > 0 && len(rec.AllowedScopes) == 0 {
+		return model.NewNoAccessError("allowedScopes", "unrestricted")
+	}
+	for _, s := range rec.AllowedScopes {
+		if !slices.Contains(user.AllowedScopes, s) {
+			return model.NewNoAccessError("allowedScopes", s)
+		}
+	}
+	for _, p := range rec.Projects {
+		ub, ok := user.Budgets[p]
+		if !ok {
+			continue
+		}
+		i := slices.IndexFunc(budgets, func(b *budgetRecord) bool { return b.Project == p })
+		if i < 0 {
+			return model.NewWrongFieldError("budgets", fmt.Sprintf("missing for %s", p))
+		}
+		if budgets[i].Period != strings.ToLower(ub.Period.String()) {
+			return model.NewWrongFieldError("budgets", fmt.Sprintf("period for %s must be %s", p, strings.ToLower(ub.Period.String())))
+		}
+		if budgets[i].Budget > ub.Limit {
+			return model.NewWrongFieldError("budgets", fmt.Sprintf("over limit for %s, max %f", p, ub.Limit))
+		}
+	}
+	return nil
+}
+
+func validateAdminInput(in *api.AdministratorInput) error {
+	if strings.TrimSpace(in.Name) == "" {
+		return model.NewWrongFieldError("name", "missing")
+	}
+	if len(in.Projects) == 0 {
+		return model.NewWrongFieldError("projects", "missing")
+	}
+	if in.MaxLimit < 0 {
+		return model.NewWrongFieldError("maxLimit", "negative")
+	}
+	if in.MaxValidTo != nil && in.MaxValidTo.Before(time.Now()) {
+		return model.NewWrongFieldError("maxValidTo", "past date")
+	}
+	if in.IPWhiteList != "" {
+		if err := utils.ValidateIPsCIDR(in.IPWhiteList); err != nil {
+			return model.NewWrongFieldError("IPWhiteList", "wrong IP CIDR format")
+		}
+	}
+	if err := validateBudgetsInput(in.Budgets); err != nil {
+		return err
+	}
+	if err := scope.Validate(in.AllowedScopes); err != nil {
+		return model.NewWrongFieldError("allowedScopes", err.Error())
+	}
+	return validateAllowedTags(in.AllowedTags)
+}
+
+func validateAdminUpdate(in *api.AdministratorUpdate) error {
+	if in.Name != nil && strings.TrimSpace(*in.Name) == "" {
+		return model.NewWrongFieldError("name", "empty")
+	}
+	if in.Projects != nil && len(*in.Projects) == 0 {
+		return model.NewWrongFieldError("projects", "empty")
+	}
+	if in.MaxLimit != nil && *in.MaxLimit < 0 {
+		return model.NewWrongFieldError("maxLimit", "negative")
+	}
+	if in.MaxValidTo != nil && in.MaxValidTo.Before(time.Now()) {
+		return model.NewWrongFieldError("maxValidTo", "past date")
+	}
+	if in.IPWhiteList != nil {
+		if err := utils.ValidateIPsCIDR(*in.IPWhiteList); err != nil {
+			return model.NewWrongFieldError("IPWhiteList", "wrong IP CIDR format")
+		}
+	}
+	if in.Budgets != nil {
+		if err := validateBudgetsInput(*in.Budgets); err != nil {
+			return err
+		}
+	}
+	if in.AllowedScopes != nil {
+		if err := scope.Validate(*in.AllowedScopes); err != nil {
+			return model.NewWrongFieldError("allowedScopes", err.Error())
+		}
+	}
+	if in.AllowedTags != nil {
+		return validateAllowedTags(*in.AllowedTags)
+	}
+	return nil
+}
+
+func validateAllowedTags(tags []string) error {
+	for _, t := range tags {
+		_, v, err := tag.Parse(t)
+		if err != nil {
+			return model.NewWrongFieldError("allowedTags", fmt.Sprintf("wrong tag: %s", t))
+		}
+		if err := tag.ValidateCondition(v); err != nil {
+			return model.NewWrongFieldError("allowedTags", err.Error())
+		}
+	}
+	return nil
+}
+
+func validateBudgetsInput(budgets []*api.Budget) error {
+	projects := map[string]bool{}
+	for _, b := range budgets {
+		if b == nil || b.Project == "" {
+			return model.NewWrongFieldError("budgets", "no project")
+		}
+		if projects[b.Project] {
+			return model.NewWrongFieldError("budgets", fmt.Sprintf("duplicate project %s", b.Project))
+		}
+		projects[b.Project] = true
+		if b.Limit < 0 {
+			return model.NewWrongFieldError("budgets", "negative limit")
+		}
+		if p, err := usage.Parse(b.Period); err != nil || (p != usage.Daily && p != usage.Monthly) {
+			return model.NewWrongFieldError("budgets", fmt.Sprintf("wrong period '%s', expected daily or monthly", b.Period))
+		}
+	}
+	return nil
+}
+
+// applyAdminUpdate changes rec and returns updated columns with values
+func applyAdminUpdate(in *api.AdministratorUpdate, rec *administratorRecord) ([]string, []interface{}, error) {
+	var values []interface{}
+	var updates []string
+	add := func(field string, value interface{}) {
+		updates = append(updates, field)
+		values = append(values, value)
+	}
+	if in.Name != nil {
+		rec.Name = strings.TrimSpace(*in.Name)
+		add("name", rec.Name)
+	}
+	if in.Description != nil {
+		rec.Description = toNullStr(*in.Description)
+		add("description", rec.Description)
+	}
+	if in.Projects != nil {
+		rec.Projects = *in.Projects
+		add("projects", rec.Projects)
+	}
+	if in.Permissions != nil {
+		rec.Permissions = *in.Permissions
+		add("permissions", rec.Permissions)
+	}
+	if in.MaxLimit != nil {
+		rec.MaxLimit = *in.MaxLimit
+		add("max_limit", rec.MaxLimit)
+	}
+	if in.MaxValidTo != nil {
+		rec.MaxValidTo = *in.MaxValidTo
+		add("max_valid_to", rec.MaxValidTo)
+	}
+	if in.IPWhiteList != nil {
+		rec.IPWhiteList = toNullStr(*in.IPWhiteList)
+		add("ip_white_list", rec.IPWhiteList)
+	}
+	if in.AllowedTags != nil {
+		rec.AllowedTags = *in.AllowedTags
+		add("allowed_tags", rec.AllowedTags)
+	}
+	if in.AllowedScopes != nil {
+		rec.AllowedScopes = *in.AllowedScopes
+		add("allowed_scopes", rec.AllowedScopes)
+	}
+	if in.Disabled != nil {
+		rec.Disabled = *in.Disabled
+		add("disabled", rec.Disabled)
+	}
+	if len(updates) == 0 && in.Budgets == nil {
+		return nil, nil, model.NewWrongFieldError("", "no updates")
+	}
+	return updates, values, nil
+}
+
+func toBudgetRecords(id string, in []*api.Budget) []*budgetRecord {
+	res := make([]*budgetRecord, 0, len(in))
+	for _, b := range in {
+		res = append(res, &budgetRecord{AdminID: id, Project: b.Project, Budget: b.Limit, Period: strings.ToLower(b.Period)})
+	}
+	return res
+}
+
+func toModelBudgets(in []*budgetRecord) map[string]*model.Budget {
+	res := make(map[string]*model.Budget, len(in))
+	for _, b := range in {
+		period, err := usage.Parse(b.Period)
+		if err != nil {
+			log.Warn().Str("period", b.Period).Err(err).Msg("Can't parse budget period")
+			continue
+		}
+		res[b.Project] = &model.Budget{Limit: b.Budget, Period: period}
+	}
+	return res
+}
+
+func mapToAdministrator(rec *administratorRecord, budgets []*budgetRecord, key string) *api.Administrator {
+	res := &api.Administrator{
+		ID:            rec.ID,
+		ParentID:      rec.ParentID.String,
+		Key:           key,
+		Name:          rec.Name,
+		Description:   rec.Description.String,
+		Projects:      rec.Projects,
+		Permissions:   rec.Permissions,
+		MaxLimit:      rec.MaxLimit,
+		MaxValidTo:    toTimePtr(&rec.MaxValidTo),
+		IPWhiteList:   rec.IPWhiteList.String,
+		AllowedTags:   rec.AllowedTags,
+		AllowedScopes: rec.AllowedScopes,
+		Disabled:      rec.Disabled,
+		Created:       toTimePtr(&rec.Created),
+		Updated:       toTimePtr(&rec.Updated),
+	}
+	for _, b := range budgets {
+		res.Budgets = append(res.Budgets, &api.Budget{Project: b.Project, Limit: b.Budget, Period: b.Period})
+	}
+	return res
+}
@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
+	"github.com/airenas/api-doorman/internal/pkg/model/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validateAdminGrant(t *testing.T) {
+	now := time.Now()
+	manager := &model.User{
+		ID:            "m",
+		Projects:      []string{"p1", "p2"},
+		Permissions:   map[permission.Enum]bool{permission.AdminManage: true, permission.RestoreUsage: true},
+		MaxLimit:      100,
+		MaxValidTo:    now.AddDate(1, 0, 0),
+		AllowedTags:   map[string]string{"voices": "in[a,b]"},
+		AllowedScopes: []string{"GET tts", "asr"},
+		Budgets:       map[string]*model.Budget{"p1": {Limit: 100, Period: usage.Monthly}},
+	}
+	super := &model.User{ID: "s", Permissions: map[permission.Enum]bool{permission.Everything: true}, MaxValidTo: now}
+	newRec := func(f func(*administratorRecord)) *administratorRecord {
+		res := &administratorRecord{Projects: []string{"p1"}, Permissions: []string{"RestoreUsage"}, MaxLimit: 50,
+			MaxValidTo: now.AddDate(0, 1, 0), AllowedTags: []string{"voices:in[a,b]"}, AllowedScopes: []string{"asr"}}
+		if f != nil {
+			f(res)
+		}
+		return res
+	}
+	budgets := []*budgetRecord{{Project: "p1", Budget: 50, Period: "monthly"}}
+	tests := []struct {
+		name    string
+		user    *model.User
+		rec     *administratorRecord
+		budgets []*budgetRecord
+		wantErr error
+	}{
+		{name: "OK", user: manager, rec: newRec(nil), budgets: budgets},
+		{name: "Everything", user: super, rec: newRec(func(r *administratorRecord) {
+			r.Projects, r.MaxLimit, r.Permissions = []string{"p3"}, 1000, []string{"Everything"}
+		})},
+		{name: "Permission", user: manager, rec: newRec(func(r *administratorRecord) { r.Permissions = []string{"Everything"} }),
+			wantErr: &model.NoAccessError{}},
+		{name: "Wrong permission", user: manager, rec: newRec(func(r *administratorRecord) { r.Permissions = []string{"Olia"} }),
+			wantErr: &model.WrongFieldError{}},
+		{name: "Project", user: manager, rec: newRec(func(r *administratorRecord) { r.Projects = []string{"p3"} }),
+			wantErr: &model.NoAccessError{}},
+		{name: "Limit", user: manager, rec: newRec(func(r *administratorRecord) { r.MaxLimit = 101 }),
+			wantErr: &model.WrongFieldError{}},
+		{name: "Valid to", user: manager, rec: newRec(func(r *administratorRecord) { r.MaxValidTo = now.AddDate(2, 0, 0) }),
+			wantErr: &model.WrongFieldError{}},
+		{name: "Tag", user: manager, rec: newRec(func(r *administratorRecord) { r.AllowedTags = []string{"voices:in[a,b,c]"} }),
+			wantErr: &model.NoAccessError{}},
+		{name: "Tag narrowed", user: manager, rec: newRec(func(r *administratorRecord) { r.AllowedTags = []string{"voices:in[b]"} }), budgets: budgets},
+		{name: "Tag unrestricted", user: manager, rec: newRec(func(r *administratorRecord) { r.AllowedTags = []string{"voices:"} }),
+			wantErr: &model.NoAccessError{}},
+		{name: "Tag other", user: manager, rec: newRec(func(r *administratorRecord) { r.AllowedTags = []string{"formats:in[mp3]"} }),
+			wantErr: &model.NoAccessError{}},
+		{name: "Scope", user: manager, rec: newRec(func(r *administratorRecord) { r.AllowedScopes = []string{"tts"} }),
+			wantErr: &model.NoAccessError{}},
+		{name: "Scope unrestricted", user: manager, rec: newRec(func(r *administratorRecord) { r.AllowedScopes = nil }),
+			wantErr: &model.NoAccessError{}},
+		{name: "Scope unrestricted Everything", user: super, rec: newRec(func(r *administratorRecord) { r.AllowedScopes = nil })},
+		{name: "Budget missing", user: manager, rec: newRec(nil), wantErr: &model.WrongFieldError{}},
+		{name: "Budget limit", user: manager, rec: newRec(nil),
+			budgets: []*budgetRecord{{Project: "p1", Budget: 101, Period: "monthly"}}, wantErr: &model.WrongFieldError{}},
+		{name: "Budget period", user: manager, rec: newRec(nil),
+			budgets: []*budgetRecord{{Project: "p1", Budget: 10, Period: "daily"}}, wantErr: &model.WrongFieldError{}},
+		{name: "Budget project", user: super, rec: newRec(nil),
+			budgets: []*budgetRecord{{Project: "p2", Budget: 10, Period: "daily"}}, wantErr: &model.WrongFieldError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAdminGrant(tt.user, tt.rec, tt.budgets)
+			if tt.wantErr != nil {
+				assert.IsType(t, tt.wantErr, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_applyAdminUpdate(t *testing.T) {
+	rec := &administratorRecord{Name: "a", Projects: []string{"p1"}, Permissions: []string{"RestoreUsage"}}
+	name, disabled := " b ", true
+	updates, values, err := applyAdminUpdate(&api.AdministratorUpdate{Name: &name, Permissions: &[]string{}, Disabled: &disabled}, rec)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "permissions", "disabled"}, updates)
+	assert.Len(t, values, 3)
+	assert.Equal(t, "b", rec.Name)
+	assert.Empty(t, rec.Permissions)
+	assert.Equal(t, []string{"p1"}, []string(rec.Projects))
+	assert.True(t, rec.Disabled)
+
+	_, _, err = applyAdminUpdate(&api.AdministratorUpdate{}, rec)
+	assert.IsType(t, &model.WrongFieldError{}, err)
+
+	updates, _, err = applyAdminUpdate(&api.AdministratorUpdate{Budgets: &[]*api.Budget{}}, rec)
+	require.NoError(t, err)
+	assert.Empty(t, updates)
+}
+
+func Test_validateBudgetsInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []*api.Budget
+		wantErr bool
+	}{
+		{name: "Empty"},
+		{name: "OK", in: []*api.Budget{{Project: "p1", Limit: 10, Period: "daily"}, {Project: "p2", Period: "monthly"}}},
+		{name: "No project", in: []*api.Budget{{Limit: 10, Period: "daily"}}, wantErr: true},
+		{name: "Duplicate", in: []*api.Budget{{Project: "p1", Period: "daily"}, {Project: "p1", Period: "daily"}}, wantErr: true},
+		{name: "Negative", in: []*api.Budget{{Project: "p1", Limit: -1, Period: "daily"}}, wantErr: true},
+		{name: "Hourly", in: []*api.Budget{{Project: "p1", Period: "hourly"}}, wantErr: true},
+		{name: "Wrong period", in: []*api.Budget{{Project: "p1", Period: "weekly"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBudgetsInput(tt.in)
+			if tt.wantErr {
+				assert.IsType(t, &model.WrongFieldError{}, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_budgetPeriodStart(t *testing.T) {
+	now := time.Date(2024, 3, 15, 23, 30, 0, 0, time.FixedZone("x", -2*3600))
+	assert.Equal(t, time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC), budgetPeriodStart(usage.Daily, now))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), budgetPeriodStart(usage.Monthly, now))
+}
@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// AnonymousSettings keeps quota settings of IP keys
+type AnonymousSettings struct {
+	// DailyCap limits the daily usage of all IP keys of the project, zero - no limit
+	DailyCap float64
+	// Limit is the default quota of an IP key, replenishment does not raise the remaining quota above it
+	Limit float64
+	// Replenish quota is given back every ReplenishEvery, zero disables replenishment
+	Replenish      float64
+	ReplenishEvery time.Duration
+}
+
+// SetAnonymous sets quota settings of IP keys
+func (r *Repository) SetAnonymous(s AnonymousSettings) error {
+	if s.DailyCap < 0 {
+		return fmt.Errorf("wrong anonymous daily cap %f", s.DailyCap)
+	}
+	if s.Replenish < 0 {
+		return fmt.Errorf("wrong replenish value %f", s.Replenish)
+	}
+	if s.Replenish > 0 && s.ReplenishEvery <= 0 {
+		return fmt.Errorf("no replenish period")
+	}
+	if s.Replenish > 0 && s.Limit <= 0 {
+		return fmt.Errorf("no default limit for replenishment")
+	}
+	r.anonymous = s
+	return nil
+}
+
+// replenish gives back the quota for the passed replenish periods of the IP key.
+// Like the monthly reset it raises quota_limit, so quota_value stays the total usage
+func (r *Repository) replenish(ctx context.Context, db dbTx, key *keyRecord, now time.Time) error {
+	if r.anonymous.Replenish <= 0 {
+		return nil
+	}
+	from := key.Created
+	if key.ReplenishedAt != nil {
+		from = *key.ReplenishedAt
+	}
+	inc, to := replenishInc(key.Limit-key.QuotaValue, r.anonymous, from, now)
+	if !to.After(from) {
+		return nil
+	}
+	log.Ctx(ctx).Debug().Str("id", key.ID).Float64("inc", inc).Time("to", to).Msg("Replenish IP key")
+	var limit float64
+	err := db.QueryRowContext(ctx, `
+		UPDATE keys
+		SET quota_limit = quota_limit + $2,
+			replenished_at = $3
+		WHERE id = $1 AND replenished_at IS NOT DISTINCT FROM $4
+		RETURNING quota_limit`, key.ID, inc, to, key.ReplenishedAt).Scan(&limit)
+	if err != nil {
+		if err == sql.ErrNoRows { // replenished by a parallel call
+			return nil
+		}
+		return fmt.Errorf("replenish: %w", mapErr(err))
+	}
+	key.Limit = limit
+	return nil
+}
+
+// replenishInc returns the quota to add for the periods passed since from and the new replenish time
+func replenishInc(remaining float64, s AnonymousSettings, from, now time.Time) (float64, time.Time) {
+	periods := now.Sub(from) / s.ReplenishEvery
+	if periods < 1 {
+		return 0, from
+	}
+	to := from.Add(periods * s.ReplenishEvery)
+	inc := min(float64(periods)*s.Replenish, s.Limit-remaining)
+	return max(inc, 0), to
+}
+
+// addAnonymousUsage adds the quota to the project's daily anonymous usage, returns false if the cap is reached
+func (r *Repository) addAnonymousUsage(ctx context.Context, db dbTx, qv float64) (bool, error) {
+	if r.anonymous.DailyCap <= 0 {
+		return true, nil
+	}
+	if qv > r.anonymous.DailyCap {
+		return false, nil
+	}
+	var used float64
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO anonymous_usage (project, day, quota_value)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (project, day) DO UPDATE
+		SET quota_value = anonymous_usage.quota_value + EXCLUDED.quota_value
+		WHERE anonymous_usage.quota_value + EXCLUDED.quota_value <= $4
+		RETURNING quota_value`, r.project, anonymousDay(time.Now()), qv, r.anonymous.DailyCap).Scan(&used)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("add anonymous usage: %w", mapErr(err))
+	}
+	return true, nil
+}
+
+// restoreAnonymousUsage returns the quota of the failed call to the daily anonymous usage, failure is only logged
+func (r *Repository) restoreAnonymousUsage(ctx context.Context, qv float64) {
+	if r.anonymous.DailyCap <= 0 {
+		return
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE anonymous_usage
+		SET quota_value = GREATEST(quota_value - $3, 0)
+		WHERE project = $1 AND day = $2`, r.project, anonymousDay(time.Now()), qv)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("can't restore anonymous usage")
+	}
+}
+
+// anonymousDay is the UTC day of the anonymous usage
+func anonymousDay(now time.Time) string {
+	return now.UTC().Format(time.DateOnly)
+}
+
+// ipNet returns the network of the IP key, nil if the key is not an IP or a network
+func ipNet(key string) *string {
+	if p, err := netip.ParsePrefix(key); err == nil {
+		res := p.Masked().String()
+		return &res
+	}
+	if addr, ok := utils.ParseHostIP(key); ok {
+		res := netip.PrefixFrom(addr, addr.BitLen()).String()
+		return &res
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ipNet(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		key  string
+		want *string
+	}{
+		{key: "1.2.3.4", want: str("1.2.3.4/32")},
+		{key: "1.2.3.0/24", want: str("1.2.3.0/24")},
+		{key: "2001:db8::/64", want: str("2001:db8::/64")},
+		{key: "2001:db8::1", want: str("2001:db8::1/128")},
+		{key: "olia", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, ipNet(tt.key))
+		})
+	}
+}
+
+func Test_anonymousDay(t *testing.T) {
+	loc := time.FixedZone("x", 3*3600)
+	assert.Equal(t, "2024-01-01", anonymousDay(time.Date(2024, 1, 2, 1, 0, 0, 0, loc)))
+}
+
+func TestRepository_SetAnonymous(t *testing.T) {
+	r := &Repository{}
+	assert.NotNil(t, r.SetAnonymous(AnonymousSettings{DailyCap: -1}))
+	assert.NotNil(t, r.SetAnonymous(AnonymousSettings{Replenish: -1}))
+	assert.NotNil(t, r.SetAnonymous(AnonymousSettings{Replenish: 10, Limit: 100}))
+	assert.NotNil(t, r.SetAnonymous(AnonymousSettings{Replenish: 10, ReplenishEvery: time.Hour}))
+	assert.Nil(t, r.SetAnonymous(AnonymousSettings{DailyCap: 100, Limit: 100, Replenish: 10, ReplenishEvery: time.Hour}))
+	assert.Equal(t, 100.0, r.anonymous.DailyCap)
+}
+
+func Test_replenishInc(t *testing.T) {
+	s := AnonymousSettings{Limit: 100, Replenish: 30, ReplenishEvery: 24 * time.Hour}
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		remaining float64
+		now       time.Time
+		wantInc   float64
+		wantTo    time.Time
+	}{
+		{name: "not passed", remaining: 0, now: from.Add(23 * time.Hour), wantInc: 0, wantTo: from},
+		{name: "one period", remaining: 10, now: from.Add(25 * time.Hour), wantInc: 30, wantTo: from.Add(24 * time.Hour)},
+		{name: "several periods", remaining: 0, now: from.Add(50 * time.Hour), wantInc: 60, wantTo: from.Add(48 * time.Hour)},
+		{name: "capped", remaining: 90, now: from.Add(50 * time.Hour), wantInc: 10, wantTo: from.Add(48 * time.Hour)},
+		{name: "full", remaining: 100, now: from.Add(50 * time.Hour), wantInc: 0, wantTo: from.Add(48 * time.Hour)},
+		{name: "above limit", remaining: 150, now: from.Add(50 * time.Hour), wantInc: 0, wantTo: from.Add(48 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inc, to := replenishInc(tt.remaining, s, from, tt.now)
+			assert.Equal(t, tt.wantInc, inc)
+			assert.Equal(t, tt.wantTo, to)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	adminapi "github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const _archiveMsg = "Archive Key"
+
+// Archive makes the key invalid and hides it from listings, the key and its history are kept.
+// Archiving of an archived key does nothing
+func (r *CMSRepository) Archive(ctx context.Context, user *model.User, id string) (*api.Key, error) {
+	log.Ctx(ctx).Trace().Str("id", id).Msg("Archive")
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	key, err := loadKeyRecord(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateKeyAccess(user, key); err != nil {
+		return nil, err
+	}
+	if key.Archived != nil {
+		return mapToKey(key, ""), nil
+	}
+	if _, err := archiveKey(ctx, tx, id, time.Now(), newOpData(user)); err != nil {
+		return nil, err
+	}
+	res, err := loadKeyRecord(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return mapToKey(res, ""), nil
+}
+
+// ArchiveExpired archives manual keys of the project expired before the date, returns the count of archived keys
+func (r *AdminRepository) ArchiveExpired(ctx context.Context, project string, expiredBefore time.Time) (int, error) {
+	log.Ctx(ctx).Debug().Str("project", project).Time("expiredBefore", expiredBefore).Msg("Archive expired keys")
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	var ids []string
+	err = tx.SelectContext(ctx, &ids, `
+		SELECT id
+		FROM keys
+		WHERE project = $1 AND manual AND archived IS NULL AND valid_to < $2
+		FOR UPDATE`, project, expiredBefore)
+	if err != nil {
+		return 0, fmt.Errorf("get expired keys: %w", mapErr(err))
+	}
+	now := time.Now()
+	res := 0
+	for _, id := range ids {
+		ok, err := archiveKey(ctx, tx, id, now, nil)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			res++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+	log.Ctx(ctx).Info().Str("project", project).Int("count", res).Msg("Archived expired keys")
+	return res, nil
+}
+
+// Purge removes logs of the project's keys archived before the date and
+// drops IPs from their operations and key records, the archiving date is the only criterion
+func (r *AdminRepository) Purge(ctx context.Context, project string, before time.Time) (*adminapi.PurgeResult, error) {
+	log.Ctx(ctx).Debug().Str("project", project).Time("before", before).Msg("Purge archived keys data")
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	res := &adminapi.PurgeResult{}
+	sRes, err := tx.ExecContext(ctx, `
+		DELETE FROM logs l
+		USING keys k
+		WHERE l.key_id = k.id AND k.project = $1 AND k.archived < $2`, project, before)
+	if err != nil {
+		return nil, fmt.Errorf("delete logs: %w", mapErr(err))
+	}
+	res.Logs, _ = sRes.RowsAffected()
+
+	sRes, err = tx.ExecContext(ctx, `
+		UPDATE operations o
+		SET data = o.data - 'ip'
+		FROM keys k
+		WHERE o.key_id = k.id AND k.project = $1 AND k.archived < $2 AND o.data->>'ip' IS NOT NULL`, project, before)
+	if err != nil {
+		return nil, fmt.Errorf("anonymise operations: %w", mapErr(err))
+	}
+	res.Operations, _ = sRes.RowsAffected()
+
+	sRes, err = tx.ExecContext(ctx, `
+		UPDATE keys
+		SET last_ip = NULL
+		WHERE project = $1 AND archived < $2 AND last_ip IS NOT NULL`, project, before)
+	if err != nil {
+		return nil, fmt.Errorf("anonymise keys: %w", mapErr(err))
+	}
+	res.Keys, _ = sRes.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	log.Ctx(ctx).Info().Str("project", project).Any("result", res).Msg("Purged archived keys data")
+	return res, nil
+}
+
+// DeleteIdleIPKeys deletes the project's IP keys not used since the date, returns the count of deleted keys.
+// Logs and operations are never deleted here, a key is deleted only when the logs retention
+// has removed its logs and it has no operations
+func (r *AdminRepository) DeleteIdleIPKeys(ctx context.Context, project string, idleBefore time.Time) (int, error) {
+	log.Ctx(ctx).Debug().Str("project", project).Time("idleBefore", idleBefore).Msg("Delete idle IP keys")
+	sRes, err := r.db.ExecContext(ctx, `
+		DELETE FROM keys k
+		WHERE k.project = $1 AND k.manual = FALSE AND COALESCE(k.last_used, k.created) < $2 AND
+			NOT EXISTS (SELECT 1 FROM logs l WHERE l.key_id = k.id) AND
+			NOT EXISTS (SELECT 1 FROM operations o WHERE o.key_id = k.id)`, project, idleBefore)
+	if err != nil {
+		return 0, fmt.Errorf("delete keys: %w", mapErr(err))
+	}
+	res, _ := sRes.RowsAffected()
+	log.Ctx(ctx).Info().Str("project", project).Int64("count", res).Msg("Deleted idle IP keys")
+	return int(res), nil
+}
+
+// archiveKey marks the key as archived and records the operation, returns false if the key was already archived
+func archiveKey(ctx context.Context, db dbTx, id string, now time.Time, opData *operationData) (bool, error) {
+	sRes, err := db.ExecContext(ctx, `
+		UPDATE keys
+		SET archived = $2,
+			updated = $2
+		WHERE id = $1 AND archived IS NULL`, id, now)
+	if err != nil {
+		return false, fmt.Errorf("archive key: %w", mapErr(err))
+	}
+	if rows, _ := sRes.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+	_, err = newOperation(ctx, db, &createOperationInput{opID: ulid.Make().String(), keyID: id, date: now, msg: _archiveMsg, opData: opData})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// validateNotArchived rejects changes of archived keys
+func validateNotArchived(key *keyRecord) error {
+	if key.Archived != nil {
+		return model.NewWrongFieldError("id", "key is archived")
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const _bulkMaxItems = 1000
+
+// Bulk applies the action to many keys, in atomic mode all items are applied in one transaction,
+// otherwise each item separately. Errors of items are reported in the result
+func (r *CMSRepository) Bulk(ctx context.Context, user *model.User, in *api.BulkInput) (*api.BulkResult, error) {
+	log.Ctx(ctx).Debug().Str("action", in.Action).Bool("atomic", in.Atomic).Int("count", len(in.Items)).Msg("Bulk")
+	if err := validateBulkInput(in); err != nil {
+		return nil, err
+	}
+	res := &api.BulkResult{Items: make([]*api.BulkItemResult, 0, len(in.Items))}
+	if in.Atomic {
+		if err := r.bulkAtomic(ctx, user, in, res); err != nil {
+			return nil, err
+		}
+	} else {
+		for i, item := range in.Items {
+			res.Items = append(res.Items, r.bulkOne(ctx, user, in.Action, i, item))
+		}
+	}
+	for _, ir := range res.Items {
+		if ir.Status == api.BulkStatusOK || ir.Status == api.BulkStatusExists {
+			res.OK++
+		} else {
+			res.Failed++
+		}
+	}
+	return res, nil
+}
+
+func (r *CMSRepository) bulkAtomic(ctx context.Context, user *model.User, in *api.BulkInput, res *api.BulkResult) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	failed := false
+	for i, item := range in.Items {
+		if failed {
+			res.Items = append(res.Items, newBulkItemResult(i, item, api.BulkStatusSkipped))
+			continue
+		}
+		ir := r.bulkItem(ctx, tx, user, in.Action, i, item)
+		failed = ir.Status == api.BulkStatusFailed
+		res.Items = append(res.Items, ir)
+	}
+	if failed {
+		for _, ir := range res.Items {
+			if ir.Status == api.BulkStatusOK || ir.Status == api.BulkStatusExists {
+				ir.Status, ir.Key = api.BulkStatusRolledBack, nil
+			}
+		}
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (r *CMSRepository) bulkOne(ctx context.Context, user *model.User, action string, i int, item *api.BulkItem) *api.BulkItemResult {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return newBulkItemError(i, item, fmt.Errorf("begin transaction: %w", err))
+	}
+	defer rollback(tx)
+
+	res := r.bulkItem(ctx, tx, user, action, i, item)
+	if res.Status != api.BulkStatusOK {
+		return res
+	}
+	if err := tx.Commit(); err != nil {
+		return newBulkItemError(i, item, fmt.Errorf("commit transaction: %w", err))
+	}
+	return res
+}
+
+func (r *CMSRepository) bulkItem(ctx context.Context, tx dbTx, user *model.User, action string, i int, item *api.BulkItem) *api.BulkItemResult {
+	var rec *keyRecord
+	var key string
+	var err error
+	switch action {
+	case api.BulkCreate:
+		in := &api.CreateInput{ID: item.ID, OperationID: item.OperationID, Service: item.Service, Credits: item.Credits,
+			ValidTo: item.ValidTo, Description: valueOrEmpty(item.Description), Disabled: item.Disabled != nil && *item.Disabled,
+			IPWhiteList: valueOrEmpty(item.IPWhiteList), Tags: item.Tags}
+		if err = validateInput(in); err == nil {
+			rec, key, err = r.create(ctx, tx, user, in)
+		}
+	case api.BulkUpdate:
+		rec, err = r.bulkUpdate(ctx, tx, user, item, &api.UpdateInput{ValidTo: item.ValidTo, Disabled: item.Disabled,
+			Description: item.Description, IPWhiteList: item.IPWhiteList, Tags: item.Tags}, "Update Key")
+	case api.BulkDisable:
+		disabled := true
+		rec, err = r.bulkUpdate(ctx, tx, user, item, &api.UpdateInput{Disabled: &disabled}, "Disable Key")
+	case api.BulkCredits:
+		in := &api.CreditsInput{OperationID: item.OperationID, Credits: item.Credits, Msg: item.Msg}
+		if err = validateCreditsInput(in); err == nil {
+			rec, err = r.addQuota(ctx, tx, user, item.ID, in)
+		}
+	}
+	if errors.Is(err, model.ErrOperationExists) {
+		return newBulkItemResult(i, item, api.BulkStatusExists)
+	}
+	if err != nil {
+		return newBulkItemError(i, item, err)
+	}
+	res := newBulkItemResult(i, item, api.BulkStatusOK)
+	res.ID = rec.ID
+	if key != "" {
+		res.Key = mapToKey(rec, key)
+	}
+	return res
+}
+
+// bulkUpdate updates the key and records the operation, so the same item is not applied twice
+func (r *CMSRepository) bulkUpdate(ctx context.Context, tx dbTx, user *model.User, item *api.BulkItem, in *api.UpdateInput, msg string) (*keyRecord, error) {
+	if err := validateUserUpdate(user, in); err != nil {
+		return nil, err
+	}
+	op := &createOperationInput{opID: item.OperationID, keyID: item.ID, date: time.Now(), msg: msg, opData: newOpData(user)}
+	has, err := validateOperation(ctx, tx, op)
+	if err != nil {
+		return nil, err
+	}
+	if has {
+		return nil, model.ErrOperationExists
+	}
+	rec, err := r.update(ctx, tx, user, item.ID, in)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := newOperation(ctx, tx, op); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func validateBulkInput(in *api.BulkInput) error {
+	switch in.Action {
+	case api.BulkCreate, api.BulkUpdate, api.BulkDisable, api.BulkCredits:
+	default:
+		return model.NewWrongFieldError("action", fmt.Sprintf("unknown '%s'", in.Action))
+	}
+	if len(in.Items) == 0 {
+		return model.NewWrongFieldError("items", "empty")
+	}
+	if len(in.Items) > _bulkMaxItems {
+		return model.NewWrongFieldError("items", fmt.Sprintf("too many, max %d", _bulkMaxItems))
+	}
+	ops := make(map[string]bool, len(in.Items))
+	for i, item := range in.Items {
+		if item == nil {
+			return model.NewWrongFieldError("items", fmt.Sprintf("empty item %d", i))
+		}
+		if strings.TrimSpace(item.OperationID) == "" {
+			return model.NewWrongFieldError("operationID", fmt.Sprintf("missing for item %d", i))
+		}
+		if ops[item.OperationID] {
+			return model.NewWrongFieldError("operationID", fmt.Sprintf("duplicate '%s'", item.OperationID))
+		}
+		ops[item.OperationID] = true
+		if in.Action != api.BulkCreate && item.ID == "" {
+			return model.NewWrongFieldError("id", fmt.Sprintf("missing for item %d", i))
+		}
+	}
+	return nil
+}
+
+func newBulkItemResult(i int, item *api.BulkItem, status string) *api.BulkItemResult {
+	return &api.BulkItemResult{Index: i, ID: item.ID, OperationID: item.OperationID, Status: status}
+}
+
+func newBulkItemError(i int, item *api.BulkItem, err error) *api.BulkItemResult {
+	res := newBulkItemResult(i, item, api.BulkStatusFailed)
+	res.Error = bulkErrorMsg(err)
+	return res
+}
+
+// bulkErrorMsg hides internal errors from the response
+func bulkErrorMsg(err error) string {
+	var errF *model.WrongFieldError
+	var errA *model.NoAccessError
+	switch {
+	case errors.As(err, &errF):
+		return errF.Error()
+	case errors.As(err, &errA):
+		return errA.Error()
+	case errors.Is(err, model.ErrNoRecord), errors.Is(err, model.ErrNoAccess), errors.Is(err, model.ErrOperationDiffers),
+		errors.Is(err, model.ErrDuplicate):
+		return err.Error()
+	}
+	log.Error().Err(err).Msg("bulk item failed")
+	return "internal error"
+}
+
+func valueOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
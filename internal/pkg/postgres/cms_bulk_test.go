@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateBulkInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      *api.BulkInput
+		wantErr bool
+	}{
+		{name: "Create", in: &api.BulkInput{Action: api.BulkCreate, Items: []*api.BulkItem{{OperationID: "1"}, {OperationID: "2"}}}},
+		{name: "Credits", in: &api.BulkInput{Action: api.BulkCredits, Items: []*api.BulkItem{{ID: "k1", OperationID: "1"}}}},
+		{name: "Action", in: &api.BulkInput{Action: "olia", Items: []*api.BulkItem{{OperationID: "1"}}}, wantErr: true},
+		{name: "Empty", in: &api.BulkInput{Action: api.BulkCreate}, wantErr: true},
+		{name: "Too many", in: &api.BulkInput{Action: api.BulkCreate, Items: make([]*api.BulkItem, _bulkMaxItems+1)}, wantErr: true},
+		{name: "Nil item", in: &api.BulkInput{Action: api.BulkCreate, Items: []*api.BulkItem{nil}}, wantErr: true},
+		{name: "No operation", in: &api.BulkInput{Action: api.BulkCreate, Items: []*api.BulkItem{{ID: "k1"}}}, wantErr: true},
+		{name: "Duplicate operation", in: &api.BulkInput{Action: api.BulkCreate, Items: []*api.BulkItem{{OperationID: "1"},
+			{OperationID: "1"}}}, wantErr: true},
+		{name: "No ID", in: &api.BulkInput{Action: api.BulkDisable, Items: []*api.BulkItem{{OperationID: "1"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBulkInput(tt.in)
+			if tt.wantErr {
+				assert.IsType(t, &model.WrongFieldError{}, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_bulkErrorMsg(t *testing.T) {
+	assert.Equal(t, "wrong credits: over", bulkErrorMsg(fmt.Errorf("x: %w", model.NewWrongFieldError("credits", "over"))))
+	assert.Equal(t, "load key: no record found", bulkErrorMsg(fmt.Errorf("load key: %w", model.ErrNoRecord)))
+	assert.Equal(t, "internal error", bulkErrorMsg(errors.New("db down")))
+}
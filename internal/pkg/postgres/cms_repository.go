@@ -12,38 +12,46 @@ import (
 	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
 	mapi "github.com/airenas/api-doorman/internal/pkg/migration/api"
 	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
 	"github.com/airenas/api-doorman/internal/pkg/model/usage"
 	"github.com/airenas/api-doorman/internal/pkg/randkey"
 	"github.com/airenas/api-doorman/internal/pkg/utils"
+	"github.com/airenas/api-doorman/internal/pkg/utils/scope"
 	"github.com/airenas/api-doorman/internal/pkg/utils/tag"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog/log"
 )
 
 type CMSRepository struct {
-	db         *sqlx.DB
-	newKeySize int
-	hasher     Hasher
+	db        *sqlx.DB
+	keyFormat *randkey.Format
+	hasher    Hasher
+	// dayLocation is the time zone used by daily_logs buckets
+	dayLocation *time.Location
 }
 
 const (
 	_keyFields = `id, project, manual, quota_limit, 
 	quota_value, valid_to, disabled, ip_white_list, tags, created, updated, 
-	last_used, last_ip, quota_value_failed, description, external_id, adm_id`
+	last_used, last_ip, quota_value_failed, description, external_id, adm_id, archived, old_key_valid_to, allowed_origins, scopes`
 )
 
-func NewCMSRepository(ctx context.Context, db *sqlx.DB, keySize int, hasher Hasher) (*CMSRepository, error) {
+func NewCMSRepository(ctx context.Context, db *sqlx.DB, keyFormat *randkey.Format, hasher Hasher, dayLocation *time.Location) (*CMSRepository, error) {
 	if db == nil {
 		return nil, fmt.Errorf("db is nil")
 	}
-	if keySize < 10 || keySize > 100 {
-		return nil, fmt.Errorf("wrong keySize")
+	if keyFormat == nil {
+		return nil, fmt.Errorf("keyFormat is nil")
 	}
 	if hasher == nil {
 		return nil, fmt.Errorf("hasher is nil")
 	}
-	f := CMSRepository{db: db, newKeySize: keySize, hasher: hasher}
+	if dayLocation == nil {
+		return nil, fmt.Errorf("dayLocation is nil")
+	}
+	f := CMSRepository{db: db, keyFormat: keyFormat, hasher: hasher, dayLocation: dayLocation}
 	return &f, nil
 }
 
@@ -58,36 +66,51 @@ func (r *CMSRepository) Create(ctx context.Context, user *model.User, in *api.Cr
 	}
 	defer rollback(tx)
 
-	if err := user.ValidateProject(in.Service); err != nil {
+	res, key, err := r.create(ctx, tx, user, in)
+	if err != nil {
 		return nil, false, err
 	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("commit transaction: %w", err)
+	}
+	return mapToKey(res, key), true, nil
+}
+
+// create validates user's rights and creates the key, returns the record and generated key
+func (r *CMSRepository) create(ctx context.Context, tx dbTx, user *model.User, in *api.CreateInput) (*keyRecord, string, error) {
+	if err := user.ValidateProject(in.Service); err != nil {
+		return nil, "", err
+	}
 	if err := user.ValidateTags(in.Tags); err != nil {
-		return nil, false, err
+		return nil, "", err
+	}
+	if err := user.ValidateScopes(in.Scopes); err != nil {
+		return nil, "", err
 	}
 	validTo, err := user.ValidateDate(in.ValidTo)
 	if err != nil {
-		return nil, false, err
+		return nil, "", err
 	}
 	if err := r.validateQuota(ctx, tx, user, in.Credits); err != nil {
-		return nil, false, err
+		return nil, "", err
+	}
+	if err := validateBudgets(ctx, tx, user, in.Service, in.Credits, in.OperationID); err != nil {
+		return nil, "", err
 	}
 
 	if in.ID == "" {
 		in.ID = ulid.Make().String()
 	}
-	key, err := randkey.Generate(r.newKeySize)
+	key, err := r.keyFormat.Generate()
 	if err != nil {
-		return nil, false, fmt.Errorf("generate key: %w", err)
+		return nil, "", fmt.Errorf("generate key: %w", err)
 	}
 
 	res, err := r.createKeyWithQuota(ctx, tx, user, in, key, validTo)
 	if err != nil {
-		return nil, false, err
-	}
-	if err := tx.Commit(); err != nil {
-		return nil, false, fmt.Errorf("commit transaction: %w", err)
+		return nil, "", err
 	}
-	return mapToKey(res, key), true, nil
+	return res, key, nil
 }
 
 func (r *CMSRepository) GetKey(ctx context.Context, user *model.User, id string) (*api.Key, error) {
@@ -102,8 +125,7 @@ func (r *CMSRepository) GetKey(ctx context.Context, user *model.User, id string)
 }
 
 func (r *CMSRepository) GetKeyID(ctx context.Context, user *model.User, id string) (*api.KeyID, error) {
-	hash := r.hasher.HashKey(id)
-	res, err := loadKeyRecordByHash(ctx, r.db, hash)
+	res, err := loadKeyRecordByHash(ctx, r.db, r.hasher.HashKeys(id))
 	if err != nil {
 		return nil, mapErr(err)
 	}
@@ -138,13 +160,7 @@ func (r *CMSRepository) AddCredits(ctx context.Context, user *model.User, id str
 }
 
 func (r *CMSRepository) Update(ctx context.Context, user *model.User, id string, in *api.UpdateInput) (*api.Key, error) {
-	if err := validateUpdate(in); err != nil {
-		return nil, err
-	}
-	if _, err := user.ValidateDate(in.ValidTo); err != nil {
-		return nil, err
-	}
-	if err := user.ValidateTags(in.Tags); err != nil {
+	if err := validateUserUpdate(user, in); err != nil {
 		return nil, err
 	}
 	tx, err := r.db.Beginx()
@@ -163,19 +179,20 @@ func (r *CMSRepository) Update(ctx context.Context, user *model.User, id string,
 	return mapToKey(res, ""), nil
 }
 
-func (r *CMSRepository) Change(ctx context.Context, user *model.User, id string) (*api.Key, error) {
+// Change generates a new key, the old one stays valid for the grace period
+func (r *CMSRepository) Change(ctx context.Context, user *model.User, id string, grace time.Duration) (*api.Key, error) {
 	tx, err := r.db.Beginx()
 	if err != nil {
 		return nil, fmt.Errorf("begin transaction: %w", err)
 	}
 	defer rollback(tx)
 
-	key, err := randkey.Generate(r.newKeySize)
+	key, err := r.keyFormat.Generate()
 	if err != nil {
 		return nil, fmt.Errorf("generate key: %w", err)
 	}
 
-	res, err := r.changeKey(ctx, tx, user, id, key)
+	res, err := r.changeKey(ctx, tx, user, id, key, grace)
 	if err != nil {
 		return nil, err
 	}
@@ -197,13 +214,9 @@ func validateKeyAccess(user *model.User, res *keyRecord) error {
 	return user.ValidateProject(res.Project)
 }
 
-func (r *CMSRepository) Usage(ctx context.Context, user *model.User, id string, from *time.Time, to *time.Time, full bool) (*api.Usage, error) {
-	log.Ctx(ctx).Debug().Str("id", id).Msg("Get logs")
-
-	where, values := makeDatesFilter("date", 2 /*start id*/, from, to)
-	sValues := make([]interface{}, 0, len(values)+1)
-	sValues = append(sValues, id)
-	sValues = append(sValues, values...)
+// Usage calculates key usage totals: full days are taken from daily_logs, the edges of the interval from raw logs
+func (r *CMSRepository) Usage(ctx context.Context, user *model.User, id string, from, to time.Time) (*api.Usage, error) {
+	log.Ctx(ctx).Debug().Str("id", id).Time("from", from).Time("to", to).Msg("Get usage")
 
 	key, err := loadKeyRecord(ctx, r.db, id)
 	if err != nil {
@@ -213,32 +226,92 @@ func (r *CMSRepository) Usage(ctx context.Context, user *model.User, id string,
 		return nil, err
 	}
 
-	var res []*logRecord
-	err = r.db.SelectContext(ctx, &res, `
-		SELECT * 
-		FROM logs 
-		WHERE 
-			key_id = $1 `+where+`			
-		`, sValues...)
+	f := &queryFilter{}
+	idP := f.addValue(id)
+	var query string
+	if dayFrom, dayTo, ok := fullDays(from, to, r.dayLocation); ok {
+		fromP, dayFromP, dayToP, toP := f.addValue(from), f.addValue(dayFrom), f.addValue(dayTo), f.addValue(to)
+		query = `
+		SELECT request_count, used_quota, failed_quota
+		FROM daily_logs
+		WHERE key_id = ` + idP + ` AND day >= ` + dayFromP + ` AND day < ` + dayToP + `
+		UNION ALL
+		SELECT COUNT(*), SUM(quota_value) FILTER (WHERE NOT fail), SUM(quota_value) FILTER (WHERE fail)
+		FROM logs
+		WHERE key_id = ` + idP + ` AND 
+			((date >= ` + fromP + ` AND date < ` + dayFromP + `) OR (date >= ` + dayToP + ` AND date < ` + toP + `))`
+	} else {
+		fromP, toP := f.addValue(from), f.addValue(to)
+		query = `
+		SELECT COUNT(*) AS request_count, SUM(quota_value) FILTER (WHERE NOT fail) AS used_quota, 
+			SUM(quota_value) FILTER (WHERE fail) AS failed_quota
+		FROM logs
+		WHERE key_id = ` + idP + ` AND date >= ` + fromP + ` AND date < ` + toP
+	}
+
+	var res bucketRecord
+	err = r.db.GetContext(ctx, &res, `
+		SELECT COALESCE(SUM(request_count), 0)::BIGINT AS request_count, 
+			COALESCE(SUM(used_quota), 0)::DOUBLE PRECISION AS used_quota, 
+			COALESCE(SUM(failed_quota), 0)::DOUBLE PRECISION AS failed_quota
+		FROM (`+query+`) t`, f.values...)
 	if err != nil {
 		return nil, mapErr(err)
 	}
-	log.Ctx(ctx).Debug().Int("count", len(res)).Msg("Got logs")
-	apiRes := &api.Usage{
-		Logs: make([]*api.Log, 0, len(res)),
+	return &api.Usage{
+		RequestCount:  res.RequestCount.V,
+		UsedCredits:   res.UsedQuota.V,
+		FailedCredits: res.FailedQuota.V,
+	}, nil
+}
+
+// UsageLogs passes key logs to the callback one by one
+func (r *CMSRepository) UsageLogs(ctx context.Context, user *model.User, id string, from, to time.Time, limit int, f func(*api.Log) error) error {
+	log.Ctx(ctx).Debug().Str("id", id).Msg("Get logs")
+
+	key, err := loadKeyRecord(ctx, r.db, id)
+	if err != nil {
+		return mapErr(err)
+	}
+	if err := validateKeyAccess(user, key); err != nil {
+		return err
 	}
-	for _, r := range res {
-		if r.Fail {
-			apiRes.FailedCredits += r.QuotaValue
-		} else {
-			apiRes.UsedCredits += r.QuotaValue
+
+	rows, err := r.db.QueryxContext(ctx, `
+		SELECT date, fail, response_code, ip, quota_value, old_key
+		FROM logs 
+		WHERE key_id = $1 AND date >= $2 AND date < $3
+		ORDER BY date
+		LIMIT $4`, id, from, to, limit)
+	if err != nil {
+		return mapErr(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rec logRecord
+		if err := rows.StructScan(&rec); err != nil {
+			return fmt.Errorf("scan log: %w", err)
 		}
-		apiRes.RequestCount++
-		if full {
-			apiRes.Logs = append(apiRes.Logs, mapLog(r))
+		if err := f(mapLog(&rec)); err != nil {
+			return err
 		}
 	}
-	return apiRes, nil
+	return rows.Err()
+}
+
+// fullDays returns the interval of whole days inside [from, to)
+func fullDays(from, to time.Time, loc *time.Location) (time.Time, time.Time, bool) {
+	fl := from.In(loc)
+	dayFrom := time.Date(fl.Year(), fl.Month(), fl.Day(), 0, 0, 0, 0, loc)
+	if dayFrom.Before(from) {
+		dayFrom = time.Date(fl.Year(), fl.Month(), fl.Day()+1, 0, 0, 0, 0, loc)
+	}
+	tl := to.In(loc)
+	dayTo := time.Date(tl.Year(), tl.Month(), tl.Day(), 0, 0, 0, 0, loc)
+	if !dayFrom.Before(dayTo) {
+		return time.Time{}, time.Time{}, false
+	}
+	return dayFrom, dayTo, true
 }
 
 // func (r *CMSRepository) Changes(ctx context.Context, user *model.User, from *time.Time, projects []string) (*api.Changes, error) {
@@ -282,6 +355,9 @@ func (r *CMSRepository) Stats(ctx context.Context, user *model.User, in *api.Sta
 	if err := validateKeyAccess(user, key); err != nil {
 		return nil, err
 	}
+	if r.needsHourlyStats(in) {
+		return r.hourlyStats(ctx, in)
+	}
 	tbl, dField, err := getStatsTableField(in.Type)
 	if err != nil {
 		return nil, err
@@ -312,6 +388,234 @@ func (r *CMSRepository) Stats(ctx context.Context, user *model.User, in *api.Sta
 	return apiRes, nil
 }
 
+// ProjectStats returns buckets summed over all keys available for the user
+func (r *CMSRepository) ProjectStats(ctx context.Context, user *model.User, in *api.ProjectStatParams) ([]*api.Bucket, error) {
+	log.Ctx(ctx).Trace().Any("data", in).Msg("Get project stats")
+	tbl, dField, err := getStatsTableField(in.Type)
+	if err != nil {
+		return nil, err
+	}
+	f := &queryFilter{}
+	if err := addKeyAccessFilter(f, user, in.Service); err != nil {
+		return nil, err
+	}
+	if in.From != nil {
+		f.add("d."+dField+" >= $%d", *in.From)
+	}
+	if in.To != nil {
+		f.add("d."+dField+" < $%d", *in.To)
+	}
+
+	var res []*bucketRecord
+	err = r.db.SelectContext(ctx, &res, `
+		SELECT d.`+dField+` AS at,
+			SUM(d.request_count)::BIGINT AS request_count, 
+			SUM(d.failed_quota)::DOUBLE PRECISION AS failed_quota, 
+			SUM(d.used_quota)::DOUBLE PRECISION AS used_quota, 
+			SUM(d.failed_requests)::BIGINT AS failed_requests
+		FROM `+tbl+` d
+		JOIN keys k ON k.id = d.key_id
+		WHERE `+f.where()+`
+		GROUP BY at
+		ORDER BY at`, f.values...)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	log.Ctx(ctx).Debug().Int("count", len(res)).Msg("Got buckets")
+	apiRes := make([]*api.Bucket, 0, len(res))
+	for _, r := range res {
+		apiRes = append(apiRes, mapToBucket(r))
+	}
+	return apiRes, nil
+}
+
+// TopKeys returns keys with the biggest used or failed quota for the period
+func (r *CMSRepository) TopKeys(ctx context.Context, user *model.User, in *api.TopKeysParams) ([]*api.KeyStat, error) {
+	log.Ctx(ctx).Trace().Any("data", in).Msg("Get top keys")
+	f := &queryFilter{}
+	if err := addKeyAccessFilter(f, user, in.Service); err != nil {
+		return nil, err
+	}
+	if in.From != nil {
+		f.add("d.day >= $%d", *in.From)
+	}
+	if in.To != nil {
+		f.add("d.day < $%d", *in.To)
+	}
+	order := "used_quota"
+	if in.ByFailed {
+		order = "failed_quota"
+	}
+
+	var res []*keyStatRecord
+	err := r.db.SelectContext(ctx, &res, `
+		SELECT k.id, k.project, k.description,
+			SUM(d.request_count)::BIGINT AS request_count, 
+			SUM(d.failed_quota)::DOUBLE PRECISION AS failed_quota, 
+			SUM(d.used_quota)::DOUBLE PRECISION AS used_quota, 
+			SUM(d.failed_requests)::BIGINT AS failed_requests
+		FROM daily_logs d
+		JOIN keys k ON k.id = d.key_id
+		WHERE `+f.where()+` AND k.archived IS NULL
+		GROUP BY k.id
+		ORDER BY `+order+` DESC NULLS LAST, k.id
+		LIMIT `+f.addValue(in.Limit), f.values...)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	log.Ctx(ctx).Debug().Int("count", len(res)).Msg("Got top keys")
+	apiRes := make([]*api.KeyStat, 0, len(res))
+	for _, r := range res {
+		apiRes = append(apiRes, mapToKeyStat(r))
+	}
+	return apiRes, nil
+}
+
+// ExhaustedKeys returns active keys without quota left, recently used first
+func (r *CMSRepository) ExhaustedKeys(ctx context.Context, user *model.User, service string, limit int) ([]*api.Key, error) {
+	log.Ctx(ctx).Trace().Str("service", service).Msg("Get exhausted keys")
+	f := &queryFilter{}
+	if err := addKeyAccessFilter(f, user, service); err != nil {
+		return nil, err
+	}
+	f.add("k.valid_to > $%d", time.Now())
+
+	var res []*keyRecord
+	err := r.db.SelectContext(ctx, &res, `
+		SELECT `+_keyFields+`
+		FROM keys k
+		WHERE `+f.where()+` AND k.manual AND NOT k.disabled AND k.archived IS NULL AND k.quota_value >= k.quota_limit
+		ORDER BY k.last_used DESC NULLS LAST, k.id
+		LIMIT `+f.addValue(limit), f.values...)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	log.Ctx(ctx).Debug().Int("count", len(res)).Msg("Got exhausted keys")
+	apiRes := make([]*api.Key, 0, len(res))
+	for _, r := range res {
+		apiRes = append(apiRes, mapToKey(r, ""))
+	}
+	return apiRes, nil
+}
+
+// addKeyAccessFilter limits keys (alias k) by the same rules as validateKeyAccess
+func addKeyAccessFilter(f *queryFilter, user *model.User, project string) error {
+	if project != "" {
+		if err := user.ValidateProject(project); err != nil {
+			return err
+		}
+		f.add("k.project = $%d", project)
+	}
+	if !user.HasPermission(permission.Everything) {
+		f.add("k.adm_id = ANY($%d)", pq.StringArray(user.AdminIDs()))
+		f.add("k.project = ANY($%d)", pq.StringArray(user.Projects))
+	}
+	return nil
+}
+
+// needsHourlyStats returns true if stats can't be taken from daily_logs or monthly_logs
+func (r *CMSRepository) needsHourlyStats(in *api.StatParams) bool {
+	return in.Type == usage.Hourly || in.ByCode || in.ByRoute ||
+		(in.TimeZone != "" && in.TimeZone != r.dayLocation.String())
+}
+
+func (r *CMSRepository) hourlyStats(ctx context.Context, in *api.StatParams) ([]*api.Bucket, error) {
+	tz := in.TimeZone
+	if tz == "" {
+		tz = r.dayLocation.String()
+	}
+	if in.Type == usage.Daily || in.Type == usage.Monthly {
+		if err := validateHourAligned(tz, in.From, in.To); err != nil {
+			return nil, err
+		}
+	}
+	f := &queryFilter{}
+	f.add("key_id = $%d", in.ID)
+	var at string
+	switch in.Type {
+	case usage.Hourly:
+		at = "hour"
+	case usage.Daily:
+		at = "time_bucket('1 day', hour, " + f.addValue(tz) + "::TEXT)"
+	case usage.Monthly:
+		at = "time_bucket('1 month', hour, " + f.addValue(tz) + "::TEXT)"
+	default:
+		return nil, model.NewWrongFieldError("type", "wrong type")
+	}
+	if in.From != nil {
+		f.add("hour >= $%d", *in.From)
+	}
+	if in.To != nil {
+		f.add("hour < $%d", *in.To)
+	}
+	fields, group := "", "at"
+	if in.ByRoute {
+		fields += ", route"
+		group += ", route"
+	}
+	if in.ByCode {
+		fields += ", response_code / 100 AS code_class"
+		group += ", code_class"
+	}
+
+	var res []*bucketRecord
+	err := r.db.SelectContext(ctx, &res, `
+		SELECT `+at+` AS at`+fields+`,
+			SUM(request_count)::BIGINT AS request_count, 
+			SUM(failed_quota)::DOUBLE PRECISION AS failed_quota, 
+			SUM(used_quota)::DOUBLE PRECISION AS used_quota, 
+			SUM(failed_requests)::BIGINT AS failed_requests
+		FROM hourly_logs
+		WHERE `+f.where()+`
+		GROUP BY `+group+`
+		ORDER BY `+group, f.values...)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	log.Ctx(ctx).Debug().Int("count", len(res)).Msg("Got hourly buckets")
+	apiRes := make([]*api.Bucket, 0, len(res))
+	for _, r := range res {
+		b := mapToBucket(r)
+		if in.ByCode && !r.CodeClass.Valid {
+			b.CodeClass = _unknownCodeClass
+		}
+		apiRes = append(apiRes, b)
+	}
+	return apiRes, nil
+}
+
+// _unknownCodeClass is the class of logs without a response code
+const _unknownCodeClass = "unknown"
+
+// validateHourAligned rejects time zones with offsets not in whole hours, e.g. +05:30,
+// as day and month buckets in them can't be built from hourly_logs.
+// The offsets are checked at the period bounds (or now) and in the winter and summer of their years
+func validateHourAligned(tz string, from, to *time.Time) error {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return model.NewWrongFieldError("tz", fmt.Sprintf("wrong time zone '%s'", tz))
+	}
+	var times []time.Time
+	for _, t := range []*time.Time{from, to} {
+		if t != nil {
+			times = append(times, *t)
+		}
+	}
+	if len(times) == 0 {
+		times = append(times, time.Now())
+	}
+	for _, t := range times {
+		for _, at := range []time.Time{t, time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(t.Year(), time.July, 1, 0, 0, 0, 0, time.UTC)} {
+			if _, offset := at.In(loc).Zone(); offset%3600 != 0 {
+				return model.NewWrongFieldError("tz", fmt.Sprintf("time zone '%s' has an offset not in whole hours, "+
+					"daily and monthly stats are not supported for it", tz))
+			}
+		}
+	}
+	return nil
+}
+
 func (r *CMSRepository) CreatePlain(ctx context.Context, user *model.User, in []*mapi.Key, project string, dryRun bool) error {
 	tx, err := r.db.Beginx()
 	if err != nil {
@@ -328,6 +632,7 @@ func (r *CMSRepository) CreatePlain(ctx context.Context, user *model.User, in []
 		keyRecord := &keyRecord{
 			ID:               ulid.Make().String(),
 			KeyHash:          r.hasher.HashKey(d.Key),
+			HashVersion:      r.hasher.Version(),
 			Project:          project,
 			Manual:           d.Manual,
 			Limit:            d.Limit,
@@ -363,6 +668,18 @@ func (r *CMSRepository) CreatePlain(ctx context.Context, user *model.User, in []
 	return nil
 }
 
+// toOrigins returns NULL for no origins, so the key is not publishable
+func toOrigins(in []string) pq.StringArray {
+	return toNullArray(in)
+}
+
+func toNullArray(in []string) pq.StringArray {
+	if len(in) == 0 {
+		return nil
+	}
+	return pq.StringArray(in)
+}
+
 func toNullStr(s string) sql.NullString {
 	if s == "" {
 		return sql.NullString{}
@@ -387,7 +704,28 @@ func mapToBucket(r *bucketRecord) *api.Bucket {
 		UsedQuota:      r.UsedQuota.V,
 		FailedQuota:    r.FailedQuota.V,
 		FailedRequests: r.FailedRequests.V,
+		Route:          r.Route.String,
+		CodeClass:      toCodeClass(r.CodeClass),
+	}
+}
+
+func mapToKeyStat(r *keyStatRecord) *api.KeyStat {
+	return &api.KeyStat{
+		ID:             r.ID,
+		Service:        r.Project,
+		Description:    r.Description.String,
+		RequestCount:   r.RequestCount.V,
+		UsedQuota:      r.UsedQuota.V,
+		FailedQuota:    r.FailedQuota.V,
+		FailedRequests: r.FailedRequests.V,
+	}
+}
+
+func toCodeClass(v sql.Null[int]) string {
+	if !v.Valid {
+		return ""
 	}
+	return fmt.Sprintf("%dxx", v.V)
 }
 
 func (r *CMSRepository) validateQuota(ctx context.Context, tx dbTx, user *model.User, credits float64) error {
@@ -441,14 +779,16 @@ func loadKeyRecord(ctx context.Context, db dbTx, id string) (*keyRecord, error)
 	return &res, nil
 }
 
-func loadKeyRecordByHash(ctx context.Context, db dbTx, hash string) (*keyRecord, error) {
+// loadKeyRecordByHash finds the key by hashes of all secret versions, the current key is preferred to the old one
+func loadKeyRecordByHash(ctx context.Context, db dbTx, hashes []string) (*keyRecord, error) {
 	var res keyRecord
 	err := db.GetContext(ctx, &res, `
 		SELECT `+_keyFields+` 
 		FROM keys 
-		WHERE key_hash = $1 AND
-			manual = TRUE		
-		LIMIT 1`, hash)
+		WHERE (key_hash = ANY($1) OR (old_key_hash = ANY($1) AND old_key_valid_to > now())) AND
+			manual = TRUE
+		ORDER BY key_hash = ANY($1) DESC
+		LIMIT 1`, pq.StringArray(hashes))
 	if err != nil {
 		return nil, mapErr(err)
 	}
@@ -475,6 +815,14 @@ func prepareKeyUpdates(in *api.UpdateInput, key *keyRecord) (string, []interface
 		updates = append(updates, "valid_to")
 		values = append(values, *in.ValidTo)
 	}
+	if in.AllowedOrigins != nil {
+		updates = append(updates, "allowed_origins")
+		values = append(values, toOrigins(*in.AllowedOrigins))
+	}
+	if in.Scopes != nil {
+		updates = append(updates, "scopes")
+		values = append(values, toNullArray(*in.Scopes))
+	}
 	if len(in.Tags) > 0 {
 		tags, err := mergeTags(key.Tags, in.Tags)
 		if err != nil {
@@ -535,6 +883,9 @@ func (r *CMSRepository) addQuota(ctx context.Context, db dbTx, user *model.User,
 	if err := validateKeyAccess(user, key); err != nil {
 		return nil, err
 	}
+	if err := validateNotArchived(key); err != nil {
+		return nil, err
+	}
 
 	now := time.Now()
 
@@ -550,6 +901,9 @@ func (r *CMSRepository) addQuota(ctx context.Context, db dbTx, user *model.User,
 		if err := r.validateQuota(ctx, db, user, in.Credits); err != nil {
 			return nil, err
 		}
+		if err := validateBudgets(ctx, db, user, key.Project, in.Credits, in.OperationID); err != nil {
+			return nil, err
+		}
 	}
 
 	if in.Credits < 0 && key.Limit+in.Credits < key.QuotaValue {
@@ -585,6 +939,9 @@ func (r *CMSRepository) update(ctx context.Context, db dbTx, user *model.User, i
 	if err := validateKeyAccess(user, key); err != nil {
 		return nil, err
 	}
+	if err := validateNotArchived(key); err != nil {
+		return nil, err
+	}
 
 	updates, values, err := prepareKeyUpdates(in, key)
 	if err != nil {
@@ -628,6 +985,12 @@ func mapToKey(keyR *keyRecord, key string) *api.Key {
 		Description:   keyR.Description.String,
 		Manual:        keyR.Manual,
 		Tags:          keyR.Tags,
+		Archived:      toTimePtr(keyR.Archived),
+		OldKeyValidTo: oldKeyValidTo(keyR, time.Now()),
+
+		AllowedOrigins: keyR.AllowedOrigins,
+		Publishable:    len(keyR.AllowedOrigins) > 0,
+		Scopes:         keyR.Scopes,
 
 		Key: key,
 	}
@@ -641,6 +1004,7 @@ func mapLog(log *logRecord) *api.Log {
 	res.Response = log.ResponseCode
 	res.IP = log.IP
 	res.UsedCredits = log.QuotaValue
+	res.OldKey = log.OldKey
 	return res
 }
 
@@ -670,9 +1034,11 @@ func (r *CMSRepository) createKeyWithQuota(ctx context.Context, tx dbTx, user *m
 	hash := r.hasher.HashKey(key)
 	log.Ctx(ctx).Trace().Str("id", in.ID).Str("key", key).Msg("Create key record")
 	_, err := tx.ExecContext(ctx, `
-	INSERT INTO keys (id, project, key_hash, manual, quota_limit, valid_to, created, updated, disabled, tags, description, adm_id, ip_white_list)
-	VALUES ($1, $2, $3, TRUE, $4, $5, $6, $6, $7, $8, $9, $10, $11)
-	`, in.ID, in.Service, hash, in.Credits, validTo, now, in.Disabled, in.Tags, in.Description, user.ID, in.IPWhiteList)
+	INSERT INTO keys (id, project, key_hash, manual, quota_limit, valid_to, created, updated, disabled, tags, description, adm_id, ip_white_list, hash_version,
+		allowed_origins, scopes)
+	VALUES ($1, $2, $3, TRUE, $4, $5, $6, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`, in.ID, in.Service, hash, in.Credits, validTo, now, in.Disabled, in.Tags, in.Description, user.ID, in.IPWhiteList, r.hasher.Version(),
+		toOrigins(in.AllowedOrigins), toNullArray(in.Scopes))
 	if err != nil {
 		return nil, fmt.Errorf("create key: %w", mapErr(err))
 	}
@@ -688,8 +1054,8 @@ func (r *CMSRepository) createKeyWithQuota(ctx context.Context, tx dbTx, user *m
 	return loadKeyRecord(ctx, tx, in.ID)
 }
 
-func (r *CMSRepository) changeKey(ctx context.Context, tx dbTx, user *model.User, id string, key string) (*keyRecord, error) {
-	log.Ctx(ctx).Trace().Str("id", id).Msg("Change key")
+func (r *CMSRepository) changeKey(ctx context.Context, tx dbTx, user *model.User, id string, key string, grace time.Duration) (*keyRecord, error) {
+	log.Ctx(ctx).Trace().Str("id", id).Dur("grace", grace).Msg("Change key")
 
 	keyRec, err := loadKeyRecord(ctx, tx, id)
 	if err != nil {
@@ -698,15 +1064,26 @@ func (r *CMSRepository) changeKey(ctx context.Context, tx dbTx, user *model.User
 	if !keyRec.Manual {
 		return nil, model.NewWrongFieldError("manual", "not manual key")
 	}
+	if err := validateNotArchived(keyRec); err != nil {
+		return nil, err
+	}
 
 	now := time.Now()
 	hash := r.hasher.HashKey(key)
+	var oldValidTo *time.Time
+	if grace > 0 {
+		t := now.Add(grace)
+		oldValidTo = &t
+	}
 	sRes, err := tx.ExecContext(ctx, `
 	UPDATE keys 
 	SET key_hash = $1, 
-		updated = $2
+		updated = $2,
+		old_key_hash = CASE WHEN $4::TIMESTAMPTZ IS NULL THEN NULL ELSE key_hash END,
+		old_key_valid_to = $4,
+		hash_version = $5
 	WHERE id = $3
-	`, hash, now, id)
+	`, hash, now, id, oldValidTo, r.hasher.Version())
 	if err != nil {
 		return nil, fmt.Errorf("create key: %w", mapErr(err))
 	}
@@ -719,6 +1096,7 @@ func (r *CMSRepository) changeKey(ctx context.Context, tx dbTx, user *model.User
 		return nil, err
 	}
 
+	keyRec.OldKeyValidTo = oldValidTo
 	return keyRec, nil
 }
 
@@ -731,14 +1109,14 @@ func (r *CMSRepository) createPlainKey(ctx context.Context, tx dbTx, user *model
 		created, updated, disabled, 
 		tags, description, adm_id, 
 		ip_white_list, quota_value, quota_value_failed, 
-		last_used, last_ip)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		last_used, last_ip, hash_version)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 	`, in.ID, in.Project, in.KeyHash,
 		in.Manual, in.Limit, in.ValidTo,
 		in.Created, in.Updated, in.Disabled,
 		in.Tags, in.Description, in.AdminID,
 		in.IPWhiteList, in.QuotaValue, in.QuotaValueFailed,
-		in.LastUsed, in.LastIP)
+		in.LastUsed, in.LastIP, in.HashVersion)
 	if err != nil {
 		return fmt.Errorf("create key: %w", mapErr(err))
 	}
@@ -823,6 +1201,12 @@ func validateInput(input *api.CreateInput) error {
 			return model.NewWrongFieldError("IPWhiteList", "wrong IP CIDR format")
 		}
 	}
+	if err := utils.ValidateOriginPatterns(input.AllowedOrigins); err != nil {
+		return model.NewWrongFieldError("allowedOrigins", err.Error())
+	}
+	if err := scope.Validate(input.Scopes); err != nil {
+		return model.NewWrongFieldError("scopes", err.Error())
+	}
 	return validateTags(input.Tags)
 }
 
@@ -845,9 +1229,34 @@ func validateUpdate(input *api.UpdateInput) error {
 			return model.NewWrongFieldError("IPWhiteList", "wrong IP CIDR format")
 		}
 	}
+	if input.AllowedOrigins != nil {
+		if err := utils.ValidateOriginPatterns(*input.AllowedOrigins); err != nil {
+			return model.NewWrongFieldError("allowedOrigins", err.Error())
+		}
+	}
+	if input.Scopes != nil {
+		if err := scope.Validate(*input.Scopes); err != nil {
+			return model.NewWrongFieldError("scopes", err.Error())
+		}
+	}
 	return validateTags(input.Tags)
 }
 
+func validateUserUpdate(user *model.User, in *api.UpdateInput) error {
+	if err := validateUpdate(in); err != nil {
+		return err
+	}
+	if _, err := user.ValidateDate(in.ValidTo); err != nil {
+		return err
+	}
+	if in.Scopes != nil {
+		if err := user.ValidateScopes(*in.Scopes); err != nil {
+			return err
+		}
+	}
+	return user.ValidateTags(in.Tags)
+}
+
 func validateCreditsInput(input *api.CreditsInput) error {
 	if input == nil {
 		return model.NewWrongFieldError("operationID", "missing")
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_fullDays(t *testing.T) {
+	vilnius, err := time.LoadLocation("Europe/Vilnius")
+	assert.Nil(t, err)
+	tests := []struct {
+		name     string
+		from, to time.Time
+		loc      *time.Location
+		wantFrom time.Time
+		wantTo   time.Time
+		wantOK   bool
+	}{
+		{name: "Same day", from: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), to: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			loc: time.UTC, wantOK: false},
+		{name: "Next day", from: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), to: time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC),
+			loc: time.UTC, wantOK: false},
+		{name: "One day", from: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), to: time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC),
+			loc: time.UTC, wantFrom: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), wantTo: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), wantOK: true},
+		{name: "Exact days", from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			loc: time.UTC, wantFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), wantTo: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), wantOK: true},
+		{name: "Location", from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+			loc: vilnius, wantFrom: time.Date(2024, 1, 2, 0, 0, 0, 0, vilnius), wantTo: time.Date(2024, 1, 3, 0, 0, 0, 0, vilnius), wantOK: true},
+		{name: "DST", from: time.Date(2024, 3, 30, 12, 0, 0, 0, vilnius), to: time.Date(2024, 4, 1, 12, 0, 0, 0, vilnius),
+			loc: vilnius, wantFrom: time.Date(2024, 3, 31, 0, 0, 0, 0, vilnius), wantTo: time.Date(2024, 4, 1, 0, 0, 0, 0, vilnius), wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotFrom, gotTo, gotOK := fullDays(tt.from, tt.to, tt.loc)
+			assert.Equal(t, tt.wantOK, gotOK)
+			if tt.wantOK {
+				assert.True(t, tt.wantFrom.Equal(gotFrom), "from %v, want %v", gotFrom, tt.wantFrom)
+				assert.True(t, tt.wantTo.Equal(gotTo), "to %v, want %v", gotTo, tt.wantTo)
+			}
+		})
+	}
+}
+
+func Test_validateHourAligned(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		tz      string
+		from    *time.Time
+		wantErr bool
+	}{
+		{name: "UTC", tz: "UTC", wantErr: false},
+		{name: "DST", tz: "Europe/Vilnius", from: &from, wantErr: false},
+		{name: "Half hour", tz: "Asia/Kolkata", wantErr: true},
+		{name: "45 minutes", tz: "Asia/Kathmandu", from: &from, wantErr: true},
+		{name: "Half hour DST", tz: "Australia/Lord_Howe", from: &from, wantErr: true},
+		{name: "Wrong", tz: "Olia/Olia", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHourAligned(tt.tz, tt.from, nil)
+			assert.Equal(t, tt.wantErr, err != nil, "error %v", err)
+		})
+	}
+}
@@ -15,6 +15,7 @@ type keyRecord struct {
 	Project          string
 	AdminID          sql.NullString `db:"adm_id"`
 	KeyHash          string         `db:"key_hash"` // or IP
+	HashVersion      int            `db:"hash_version"`
 	Manual           bool
 	ValidTo          time.Time `db:"valid_to"`
 	Limit            float64   `db:"quota_limit"`
@@ -24,17 +25,27 @@ type keyRecord struct {
 	Updated          time.Time
 	LastUsed         *time.Time     `db:"last_used"`
 	ResetAt          *time.Time     `db:"reset_at"`
+	ReplenishedAt    *time.Time     `db:"replenished_at"`
 	LastIP           sql.NullString `db:"last_ip"`
 	Disabled         bool
 	IPWhiteList      sql.NullString `db:"ip_white_list"`
 	Description      sql.NullString
 	Tags             pq.StringArray `db:"tags,omitempty"`
+	AllowedOrigins   pq.StringArray `db:"allowed_origins"`
+	Scopes           pq.StringArray `db:"scopes"`
 	ExternalID       sql.NullString `db:"external_id"`
+	Archived         *time.Time
+	OldKeyHash       sql.NullString `db:"old_key_hash"`
+	OldKeyValidTo    *time.Time     `db:"old_key_valid_to"`
+	// OldKey is set if the record was found by the old key hash
+	OldKey bool `db:"old_key"`
 }
 
 type logRecord struct {
+	ID           int64
 	KeyID        string `db:"key_id"`
 	URL          string
+	Route        sql.NullString
 	QuotaValue   float64 `db:"quota_value"`
 	Date         time.Time
 	IP           string
@@ -44,6 +55,7 @@ type logRecord struct {
 
 	RequestID string `db:"request_id"`
 	ErrorMsg  string `db:"error_msg"`
+	OldKey    bool   `db:"old_key"`
 }
 
 type operationRecord struct {
@@ -58,6 +70,8 @@ type operationRecord struct {
 type operationData struct {
 	IP      string `json:"ip,omitempty"`
 	AdminID string `json:"adm_id,omitempty"`
+	// Fields lists changed fields
+	Fields []string `json:"fields,omitempty"`
 }
 
 type ProjectSettings struct {
@@ -69,6 +83,7 @@ type ProjectSettings struct {
 
 type administratorRecord struct {
 	ID          string
+	ParentID    sql.NullString `db:"parent_id"`
 	Projects    pq.StringArray
 	Permissions pq.StringArray
 	KeyHash     string         `db:"key_hash"`
@@ -76,11 +91,20 @@ type administratorRecord struct {
 	MaxLimit    float64        `db:"max_limit"`
 	IPWhiteList sql.NullString `db:"ip_white_list"`
 	AllowedTags pq.StringArray `db:"allowed_tags"`
-	Name        string
-	Disabled    bool
-	Description sql.NullString
-	Created     time.Time
-	Updated     time.Time
+	// AllowedScopes the administrator can assign to keys
+	AllowedScopes pq.StringArray `db:"allowed_scopes"`
+	Name          string
+	Disabled      bool
+	Description   sql.NullString
+	Created       time.Time
+	Updated       time.Time
+}
+
+type budgetRecord struct {
+	AdminID string `db:"adm_id"`
+	Project string
+	Budget  float64
+	Period  string
 }
 
 type bucketRecord struct {
@@ -89,6 +113,18 @@ type bucketRecord struct {
 	FailedQuota    sql.Null[float64] `db:"failed_quota"`
 	UsedQuota      sql.Null[float64] `db:"used_quota"`
 	FailedRequests sql.Null[int]     `db:"failed_requests"`
+	Route          sql.NullString    `db:"route"`
+	CodeClass      sql.Null[int]     `db:"code_class"`
+}
+
+type keyStatRecord struct {
+	ID             string
+	Project        string
+	Description    sql.NullString
+	RequestCount   sql.Null[int]     `db:"request_count"`
+	FailedQuota    sql.Null[float64] `db:"failed_quota"`
+	UsedQuota      sql.Null[float64] `db:"used_quota"`
+	FailedRequests sql.Null[int]     `db:"failed_requests"`
 }
 
 // //////////////////////////
@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+)
+
+// queryFilter collects SQL conditions with positional parameters
+type queryFilter struct {
+	conditions []string
+	values     []interface{}
+}
+
+// add appends condition, cond must contain one %d placeholder for the parameter index
+func (f *queryFilter) add(cond string, value interface{}) {
+	f.values = append(f.values, value)
+	f.conditions = append(f.conditions, fmt.Sprintf(cond, len(f.values)))
+}
+
+// addValue appends value and returns its placeholder, e.g. $3
+func (f *queryFilter) addValue(value interface{}) string {
+	f.values = append(f.values, value)
+	return fmt.Sprintf("$%d", len(f.values))
+}
+
+func (f *queryFilter) where() string {
+	if len(f.conditions) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(f.conditions, " AND ")
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	adminapi "github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/rs/zerolog/log"
+)
+
+// HashReport returns counts of manual keys' and administrators' hashes by the secret version.
+// Legacy hashes are rehashed on the successful authentication, so the report shows what is still left
+func (r *AdminRepository) HashReport(ctx context.Context) (*adminapi.HashReport, error) {
+	log.Ctx(ctx).Trace().Msg("Hash report")
+	res := &adminapi.HashReport{CurrentVersion: r.hasher.Version()}
+	var err error
+	res.Keys, err = r.hashVersionCounts(ctx, `
+		SELECT hash_version AS version, COUNT(*) AS count
+		FROM keys
+		WHERE manual
+		GROUP BY hash_version
+		ORDER BY hash_version DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("count keys: %w", err)
+	}
+	res.Administrators, err = r.hashVersionCounts(ctx, `
+		SELECT hash_version AS version, COUNT(*) AS count
+		FROM administrators
+		GROUP BY hash_version
+		ORDER BY hash_version DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("count administrators: %w", err)
+	}
+	for _, c := range append(res.Keys, res.Administrators...) {
+		if c.Version != res.CurrentVersion {
+			res.Legacy += c.Count
+		}
+	}
+	return res, nil
+}
+
+func (r *AdminRepository) hashVersionCounts(ctx context.Context, query string) ([]adminapi.HashVersionCount, error) {
+	var recs []struct {
+		Version int
+		Count   int64
+	}
+	if err := r.db.SelectContext(ctx, &recs, query); err != nil {
+		return nil, mapErr(err)
+	}
+	res := make([]adminapi.HashVersionCount, 0, len(recs))
+	for _, rec := range recs {
+		res = append(res, adminapi.HashVersionCount{Version: rec.Version, Count: rec.Count})
+	}
+	return res, nil
+}
@@ -8,14 +8,21 @@ import (
 	"time"
 
 	"github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
 	"github.com/airenas/api-doorman/internal/pkg/utils"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog/log"
 )
 
 type Hasher interface {
+	// HashKey hashes with the current secret
 	HashKey(key string) string
+	// Version returns the current secret version
+	Version() int
+	// HashKeys returns hashes by all secrets, the current one is first
+	HashKeys(key string) []string
 }
 
 // Repository communicates with postgres
@@ -23,6 +30,8 @@ type Repository struct {
 	db      *sqlx.DB
 	project string
 	hasher  Hasher
+	// anonymous keeps settings of IP keys
+	anonymous AnonymousSettings
 }
 
 func NewRepository(ctx context.Context, db *sqlx.DB, project string, hasher Hasher) (*Repository, error) {
@@ -41,41 +50,64 @@ func NewRepository(ctx context.Context, db *sqlx.DB, project string, hasher Hash
 	return &f, nil
 }
 
-func (r *Repository) hash(key string, manual bool) string {
+// hashes returns key hashes by all secret versions, the current one is first, IP keys are not hashed
+func (r *Repository) hashes(key string, manual bool) pq.StringArray {
 	if manual {
-		return r.hasher.HashKey(key)
+		return r.hasher.HashKeys(key)
 	}
-	return key
+	return pq.StringArray{key}
+}
+
+// keyByHashSQL selects the key by the hash of any secret version or by the old hash during the rotation grace period,
+// the current key is preferred by the priority. Params: $1 - project, $2 - hashes, $3 - manual
+func keyByHashSQL(fields string) string {
+	return `
+		SELECT ` + fields + `, old_key
+		FROM (
+			(SELECT ` + fields + `, FALSE AS old_key, 0 AS priority
+			FROM keys
+			WHERE project = $1 AND key_hash = ANY($2) AND manual = $3
+			LIMIT 1)
+			UNION ALL
+			(SELECT ` + fields + `, TRUE AS old_key, 1 AS priority
+			FROM keys
+			WHERE project = $1 AND old_key_hash = ANY($2) AND manual = $3 AND old_key_valid_to > now()
+			LIMIT 1)
+		) k
+		ORDER BY priority
+		LIMIT 1`
 }
 
 // IsValid validates key
-func (r *Repository) IsValid(ctx context.Context, key string, IP string, manual bool) (bool, string, []string, error) {
+func (r *Repository) IsValid(ctx context.Context, key string, IP string, manual bool) (bool, *model.KeyInfo, error) {
 	ctx, span := utils.StartSpan(ctx, "postgres.IsValid")
 	defer span.End()
 
-	hash := r.hash(key, manual)
-	log.Ctx(ctx).Trace().Str("project", r.project).Str("key_hash", hash).Bool("manual", manual).Msg("Validating key")
+	hashes := r.hashes(key, manual)
+	log.Ctx(ctx).Trace().Str("project", r.project).Str("key_hash", hashes[0]).Bool("manual", manual).Msg("Validating key")
 
 	var res keyRecord
-	err := r.db.GetContext(ctx, &res, `
-		SELECT id, disabled, valid_to, ip_white_list, tags 
-		FROM keys 
-		WHERE project = $1 AND 
-			key_hash = $2 AND 
-			manual = $3
-		LIMIT 1`, r.project, hash, manual)
+	err := r.db.GetContext(ctx, &res, keyByHashSQL("id, key_hash, disabled, valid_to, ip_white_list, tags, archived, allowed_origins, scopes"),
+		r.project, hashes, manual)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Ctx(ctx).Debug().Msg("No key")
-			return false, "", nil, nil
+			return false, nil, nil
 		}
-		return false, "", nil, fmt.Errorf("can't get key: %w", mapErr(err))
+		return false, nil, fmt.Errorf("can't get key: %w", mapErr(err))
+	}
+	if res.OldKey {
+		log.Ctx(ctx).Info().Str("id", res.ID).Msg("Old key used")
 	}
 	ok, err := validateKey(&res, IP)
-	if err != nil {
-		return ok, "", nil, err
+	if err != nil || !ok {
+		return false, nil, err
+	}
+	if manual && !res.OldKey && res.KeyHash != hashes[0] {
+		r.rehash(ctx, res.ID, res.KeyHash, hashes[0])
 	}
-	return ok, res.ID, res.Tags, nil
+	return true, &model.KeyInfo{ID: res.ID, Tags: res.Tags, OldKey: res.OldKey, AllowedOrigins: res.AllowedOrigins,
+		Scopes: res.Scopes}, nil
 }
 
 func validateKey(key *keyRecord, IP string) (bool, error) {
@@ -83,6 +115,10 @@ func validateKey(key *keyRecord, IP string) (bool, error) {
 		log.Info().Msg("Key disabled")
 		return false, nil
 	}
+	if key.Archived != nil {
+		log.Info().Msg("Key archived")
+		return false, nil
+	}
 	if !key.ValidTo.After(time.Now()) {
 		log.Info().Msg("Key expired")
 		return false, nil
@@ -97,13 +133,40 @@ func validateKey(key *keyRecord, IP string) (bool, error) {
 	return res, err
 }
 
+// AllowedOrigins returns the distinct origin patterns of the project's active publishable keys
+func (r *Repository) AllowedOrigins(ctx context.Context) ([]string, error) {
+	var res []string
+	err := r.db.SelectContext(ctx, &res, `
+		SELECT DISTINCT unnest(allowed_origins)
+		FROM keys
+		WHERE project = $1 AND manual = TRUE AND allowed_origins IS NOT NULL AND
+			disabled = FALSE AND archived IS NULL AND valid_to > now()`, r.project)
+	if err != nil {
+		return nil, fmt.Errorf("can't get allowed origins: %w", mapErr(err))
+	}
+	return res, nil
+}
+
+// rehash replaces the legacy hash with the current version hash, failure does not break the request
+func (r *Repository) rehash(ctx context.Context, id, oldHash, hash string) {
+	log.Ctx(ctx).Info().Str("id", id).Int("version", r.hasher.Version()).Msg("Rehash key")
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE keys
+		SET key_hash = $3,
+			hash_version = $4
+		WHERE id = $1 AND key_hash = $2`, id, oldHash, hash, r.hasher.Version())
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("id", id).Msg("can't rehash key")
+	}
+}
+
 // SaveValidate add qv to quota and validates with quota limit
 func (r *Repository) SaveValidate(ctx context.Context, key string, ip string, manual bool, qv float64) (bool, float64, float64, error) {
 	ctx, span := utils.StartSpan(ctx, "postgres.SaveValidate")
 	defer span.End()
 
-	hash := r.hash(key, manual)
-	log.Ctx(ctx).Trace().Str("project", r.project).Str("key_hash", hash).Bool("manual", manual).Msg("Validating key")
+	hashes := r.hashes(key, manual)
+	log.Ctx(ctx).Trace().Str("project", r.project).Str("key_hash", hashes[0]).Bool("manual", manual).Msg("Validating key")
 
 	tx, err := r.db.Beginx()
 	if err != nil {
@@ -112,18 +175,27 @@ func (r *Repository) SaveValidate(ctx context.Context, key string, ip string, ma
 	defer rollback(tx)
 
 	var res keyRecord
-	err = tx.GetContext(ctx, &res, `
-		SELECT id, project, manual, quota_limit, quota_value 
-		FROM keys 
-		WHERE project = $1 AND 
-			key_hash = $2 AND 
-			manual = $3 
-		LIMIT 1`, r.project, hash, manual)
+	err = tx.GetContext(ctx, &res, keyByHashSQL("id, project, manual, quota_limit, quota_value, created, replenished_at"), r.project, hashes, manual)
 	if err != nil {
 		return false, 0, 0, err
 	}
+	if !manual {
+		if err := r.replenish(ctx, tx, &res, time.Now()); err != nil {
+			return false, 0, 0, err
+		}
+	}
 
 	remRequired := res.Limit - res.QuotaValue - qv
+	if remRequired >= 0 && !manual {
+		ok, err := r.addAnonymousUsage(ctx, tx, qv)
+		if err != nil {
+			return false, 0, 0, err
+		}
+		if !ok {
+			log.Ctx(ctx).Warn().Str("project", r.project).Float64("cap", r.anonymous.DailyCap).Msg("Anonymous daily cap reached")
+			remRequired = -1
+		}
+	}
 	if remRequired < 0 {
 		err := r.updateFailed(ctx, tx, res.ID, ip, qv)
 		if err != nil {
@@ -174,20 +246,21 @@ func (r *Repository) Restore(ctx context.Context, key string, manual bool, qv fl
 
 	updateQuery := `
 		UPDATE keys
-		SET updated = $1, 
-			quota_value_failed = quota_value_failed + $2, 
-			quota_value = quota_value - $2
+		SET updated = $4, 
+			quota_value_failed = quota_value_failed + $5, 
+			quota_value = quota_value - $5
 		WHERE 
-			project = $3 AND
-			key_hash = $4 AND 
-			manual = $5
+			id = (SELECT id FROM (` + keyByHashSQL("id") + `) k)
 		RETURNING quota_limit, quota_value
 	`
 	var limit, quotaValue float64
-	err := r.db.QueryRowContext(ctx, updateQuery, now, qv, r.project, r.hash(key, manual), manual).Scan(&limit, &quotaValue)
+	err := r.db.QueryRowContext(ctx, updateQuery, r.project, r.hashes(key, manual), manual, now, qv).Scan(&limit, &quotaValue)
 	if err != nil {
 		return 0, 0, fmt.Errorf("update quota: %w", err)
 	}
+	if !manual {
+		r.restoreAnonymousUsage(ctx, qv)
+	}
 
 	remainingQuota := limit - quotaValue
 	return remainingQuota, limit, nil
@@ -209,11 +282,19 @@ func (r *Repository) CheckCreateIPKey(ctx context.Context, ip string, limit floa
 
 	id := ulid.Make().String()
 	log.Ctx(ctx).Debug().Str("ip", ip).Msg("insert new key for IP")
+	// a network key takes over the usage of the IP keys it covers, nested keys are counted once
 	sRes, err := r.db.ExecContext(ctx, `
-	INSERT INTO keys (id, project, key_hash, manual, quota_limit, valid_to, created, updated)
-	VALUES ($1, $2, $3, FALSE, $4, $5, $6, $6)
+	INSERT INTO keys (id, project, key_hash, manual, quota_limit, valid_to, created, updated, ip_net, quota_value)
+	SELECT $1, $2, $3, FALSE, $4, $5, $6, $6, $7::INET,
+		COALESCE((
+			SELECT SUM(k.quota_value)
+			FROM keys k
+			WHERE k.project = $2 AND k.manual = FALSE AND k.ip_net << $7::INET AND
+				NOT EXISTS (SELECT 1 FROM keys p 
+					WHERE p.project = $2 AND p.manual = FALSE AND p.ip_net << $7::INET AND k.ip_net << p.ip_net)
+		), 0)
 	ON CONFLICT DO NOTHING
-	`, id, r.project, ip, limit, time.Date(2100, time.Month(1), 1, 01, 0, 0, 0, time.UTC), time.Now())
+	`, id, r.project, ip, limit, time.Date(2100, time.Month(1), 1, 01, 0, 0, 0, time.UTC), time.Now(), ipNet(ip))
 	if err != nil {
 		return "", fmt.Errorf("create key: %w", err)
 	}
@@ -248,9 +329,9 @@ func (r *Repository) SaveLog(ctx context.Context, data *api.Log) error {
 	log.Ctx(ctx).Trace().Any("data", data).Msg("Insert log")
 
 	_, err := r.db.ExecContext(ctx, `
-	INSERT INTO logs (key_id, url, quota_value, date, ip, value, fail, response_code, request_id, error_msg)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-	`, data.KeyID, data.URL, data.QuotaValue, data.Date, data.IP, data.Value, data.Fail, data.ResponseCode, data.RequestID, data.ErrorMsg)
+	INSERT INTO logs (key_id, url, route, quota_value, date, ip, value, fail, response_code, request_id, error_msg, old_key)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, data.KeyID, data.URL, toNullStr(data.Route), data.QuotaValue, data.Date, data.IP, data.Value, data.Fail, data.ResponseCode, data.RequestID, data.ErrorMsg, data.OldKey)
 	if err != nil {
 		return fmt.Errorf("insert log: %w", err)
 	}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// EndRotation ends the rotation grace period early, the old key becomes invalid immediately
+func (r *CMSRepository) EndRotation(ctx context.Context, user *model.User, id string) (*api.Key, error) {
+	log.Ctx(ctx).Trace().Str("id", id).Msg("End rotation")
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	key, err := loadKeyRecord(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateKeyAccess(user, key); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if oldKeyValidTo(key, now) == nil {
+		return mapToKey(key, ""), nil
+	}
+	_, err = tx.ExecContext(ctx, `
+	UPDATE keys
+	SET old_key_hash = NULL,
+		old_key_valid_to = NULL,
+		updated = $2
+	WHERE id = $1
+	`, id, now)
+	if err != nil {
+		return nil, fmt.Errorf("end rotation: %w", mapErr(err))
+	}
+	_, err = newOperation(ctx, tx, &createOperationInput{opID: ulid.Make().String(), keyID: id, date: now, msg: "End Key Rotation", opData: newOpData(user)})
+	if err != nil {
+		return nil, err
+	}
+	res, err := loadKeyRecord(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return mapToKey(res, ""), nil
+}
+
+// oldKeyValidTo returns the end of the rotation grace period if the old key is still valid
+func oldKeyValidTo(key *keyRecord, now time.Time) *time.Time {
+	if key.OldKeyValidTo == nil || !key.OldKeyValidTo.After(now) {
+		return nil
+	}
+	return key.OldKeyValidTo
+}
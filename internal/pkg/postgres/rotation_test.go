@@ -0,0 +1,28 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_oldKeyValidTo(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	future, past := now.Add(time.Hour), now.Add(-time.Hour)
+	tests := []struct {
+		name string
+		to   *time.Time
+		want *time.Time
+	}{
+		{name: "No rotation", to: nil, want: nil},
+		{name: "Active", to: &future, want: &future},
+		{name: "Ended", to: &past, want: nil},
+		{name: "Now", to: &now, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, oldKeyValidTo(&keyRecord{OldKeyValidTo: tt.to}, now))
+		})
+	}
+}
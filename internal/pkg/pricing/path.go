@@ -0,0 +1,70 @@
+package pricing
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pathPattern matches the path segments, a '{name}' segment is a variable
+type pathPattern struct {
+	str      string
+	segments []string
+}
+
+func parsePathPattern(s string) (*pathPattern, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("wrong path pattern '%s', must start with '/'", s)
+	}
+	res := &pathPattern{str: s, segments: strings.Split(s, "/")}
+	names := map[string]bool{}
+	for _, seg := range res.segments {
+		name, ok := varName(seg)
+		if !ok {
+			if strings.ContainsAny(seg, "{}") {
+				return nil, fmt.Errorf("wrong path pattern '%s', segment '%s'", s, seg)
+			}
+			continue
+		}
+		if name == "" || names[name] {
+			return nil, fmt.Errorf("wrong path pattern '%s', variable '%s'", s, seg)
+		}
+		names[name] = true
+	}
+	return res, nil
+}
+
+// match returns the variables of the path, empty if the path does not match
+func (p *pathPattern) match(path string) map[string]string {
+	res := map[string]string{}
+	if p == nil {
+		return res
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != len(p.segments) {
+		return res
+	}
+	vars := map[string]string{}
+	for i, seg := range p.segments {
+		if name, ok := varName(seg); ok {
+			vars[name] = parts[i]
+		} else if seg != parts[i] {
+			return res
+		}
+	}
+	return vars
+}
+
+func (p *pathPattern) String() string {
+	return p.str
+}
+
+func varName(seg string) (string, bool) {
+	if len(seg) >= 2 && seg[0] == '{' && seg[len(seg)-1] == '}' {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
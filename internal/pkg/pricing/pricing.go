@@ -0,0 +1,139 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/ext"
+)
+
+// _costLimit stops expressions iterating over big request bodies
+const _costLimit = 100000
+
+// Input of the pricing expression, the maps and the body are never nil
+type Input struct {
+	// Quota is the base quota extracted from the request
+	Quota  float64
+	Method string
+	Path   string
+	// Body is the decoded JSON of the request: an object, an array or a value, an empty object if there is no body
+	Body interface{}
+	// Query keeps the first value of the query parameters
+	Query map[string]string
+	// Headers keeps the first value of the headers by lower case name
+	Headers map[string]string
+	// Vars are the path variables of the pattern
+	Vars map[string]string
+	// Tags of the key by lower case tag key
+	Tags map[string]string
+}
+
+// Rule calculates the quota of a request by the CEL expression.
+// Variables: quota (double), method, path (string), body (dyn, the decoded JSON), query, headers, vars, tags (map of strings).
+// The math and strings CEL extensions and optional values are available, e.g.
+// 'math.greatest(quota * (body.?voice.orValue("") == "laura" ? 1.5 : 1.0), 10.0)'
+type Rule struct {
+	expr     string
+	pattern  *pathPattern
+	prg      cel.Program
+	usesBody bool
+}
+
+// NewRule compiles the expression, the path pattern of the variables is like '/synth/{voice}', it may be empty
+func NewRule(expr, pathPattern string) (*Rule, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("quota", cel.DoubleType),
+		cel.Variable("method", cel.StringType),
+		cel.Variable("path", cel.StringType),
+		cel.Variable("body", cel.DynType),
+		cel.Variable("query", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("vars", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("tags", cel.MapType(cel.StringType, cel.StringType)),
+		cel.OptionalTypes(),
+		ext.Math(),
+		ext.Strings(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("init CEL env: %w", err)
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("compile '%s': %w", expr, iss.Err())
+	}
+	switch ast.OutputType() {
+	case cel.DoubleType, cel.IntType, cel.UintType, cel.DynType:
+	default:
+		return nil, fmt.Errorf("expression '%s' returns %s, expected a number", expr, ast.OutputType())
+	}
+	prg, err := env.Program(ast, cel.CostLimit(_costLimit), cel.InterruptCheckFrequency(100))
+	if err != nil {
+		return nil, fmt.Errorf("init program: %w", err)
+	}
+	pattern, err := parsePathPattern(pathPattern)
+	if err != nil {
+		return nil, err
+	}
+	res := &Rule{expr: expr, pattern: pattern, prg: prg}
+	for _, ref := range ast.NativeRep().ReferenceMap() {
+		res.usesBody = res.usesBody || ref.Name == "body"
+	}
+	return res, nil
+}
+
+// UsesBody returns true if the expression refers the body variable, the body is not read otherwise
+func (r *Rule) UsesBody() bool {
+	return r.usesBody
+}
+
+// Calculate evaluates the expression, in.Vars are filled from the path
+func (r *Rule) Calculate(ctx context.Context, in *Input) (float64, error) {
+	in.Vars = r.pattern.match(in.Path)
+	out, _, err := r.prg.ContextEval(ctx, map[string]interface{}{
+		"quota":   in.Quota,
+		"method":  in.Method,
+		"path":    in.Path,
+		"body":    in.Body,
+		"query":   in.Query,
+		"headers": in.Headers,
+		"vars":    in.Vars,
+		"tags":    in.Tags,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("evaluate: %w", err)
+	}
+	var res float64
+	switch v := out.(type) {
+	case types.Double:
+		res = float64(v)
+	case types.Int:
+		res = float64(v)
+	case types.Uint:
+		res = float64(v)
+	default:
+		return 0, &ResultError{msg: fmt.Sprintf("result %v is not a number", out.Value())}
+	}
+	if res < 0 || math.IsNaN(res) || math.IsInf(res, 0) {
+		return 0, &ResultError{msg: fmt.Sprintf("wrong result %v", res)}
+	}
+	return res, nil
+}
+
+func (r *Rule) String() string {
+	if r.pattern != nil {
+		return fmt.Sprintf("%s, %s", r.expr, r.pattern)
+	}
+	return r.expr
+}
+
+// ResultError indicates a wrong result of the expression, it is a configuration error, not a request one
+type ResultError struct {
+	msg string
+}
+
+func (e *ResultError) Error() string {
+	return e.msg
+}
@@ -0,0 +1,137 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestInput() *Input {
+	return &Input{Quota: 100, Method: "POST", Path: "/synth/laura",
+		Body:    map[string]interface{}{"voice": "laura", "format": "mp3", "segments": []interface{}{"a", "b"}},
+		Query:   map[string]string{"speed": "2"},
+		Headers: map[string]string{"x-plan": "pro"},
+		Tags:    map[string]string{"plan": "enterprise"},
+	}
+}
+
+func TestRule_Calculate(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		path    string
+		want    float64
+		wantErr bool
+	}{
+		{name: "quota", expr: "quota", want: 100},
+		{name: "int", expr: "10", want: 10},
+		{name: "uint", expr: "10u", want: 10},
+		{name: "voice", expr: `quota * (body.voice == "laura" ? 1.5 : 1.0)`, want: 150},
+		{name: "voice map", expr: `quota * {"laura": 1.5, "astra": 2.0}[body.voice]`, want: 150},
+		{name: "min charge", expr: "math.greatest(quota * 0.01, 10.0)", want: 10},
+		{name: "format", expr: `quota + (body.format == "wav" ? 50.0 : 0.0)`, want: 100},
+		{name: "optional", expr: `quota * (body.?speed.orValue("1") == "1" ? 1.0 : 2.0)`, want: 100},
+		{name: "tag", expr: `tags.?plan.orValue("") == "enterprise" ? quota * 0.8 : quota`, want: 80},
+		{name: "has", expr: `has(tags.discount) ? 0.0 : quota`, want: 100},
+		{name: "query", expr: `quota * double(query.speed)`, want: 200},
+		{name: "header", expr: `headers["x-plan"] == "pro" ? quota / 2.0 : quota`, want: 50},
+		{name: "path", expr: `path.startsWith("/synth") ? quota + 1.0 : quota`, want: 101},
+		{name: "method", expr: `method == "POST" ? 1 : 2`, want: 1},
+		{name: "vars", expr: `vars.voice == "laura" ? 3 : 4`, path: "/synth/{voice}", want: 3},
+		{name: "vars not matched", expr: `has(vars.voice) ? 3 : 4`, path: "/tts/{voice}", want: 4},
+		{name: "list", expr: `double(size(body.segments))`, want: 2},
+		{name: "strings ext", expr: `body.voice.upperAscii() == "LAURA" ? 1 : 0`, want: 1},
+		{name: "missing key", expr: `body.speed == "1" ? 1 : 0`, wantErr: true},
+		{name: "negative", expr: `-1.0`, wantErr: true},
+		{name: "dyn not number", expr: `body.voice`, wantErr: true},
+		{name: "division", expr: `quota / 0.0`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRule(tt.expr, tt.path)
+			require.Nil(t, err)
+			got, err := r.Calculate(context.Background(), newTestInput())
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assert.InDelta(t, tt.want, got, 0.000001)
+		})
+	}
+}
+
+func TestRule_ArrayBody(t *testing.T) {
+	r, err := NewRule(`quota * double(size(body)) + (body[0].voice == "laura" ? 1.0 : 0.0)`, "")
+	require.Nil(t, err)
+	in := newTestInput()
+	in.Body = []interface{}{map[string]interface{}{"voice": "laura"}, map[string]interface{}{"voice": "astra"}}
+	got, err := r.Calculate(context.Background(), in)
+	require.Nil(t, err)
+	assert.InDelta(t, 201.0, got, 0.000001)
+}
+
+func TestRule_ResultError(t *testing.T) {
+	r, err := NewRule("-1.0", "")
+	require.Nil(t, err)
+	_, err = r.Calculate(context.Background(), newTestInput())
+	var re *ResultError
+	assert.True(t, errors.As(err, &re))
+
+	r, err = NewRule("body.speed", "")
+	require.Nil(t, err)
+	_, err = r.Calculate(context.Background(), newTestInput())
+	require.NotNil(t, err)
+	assert.False(t, errors.As(err, &re))
+}
+
+func TestRule_CostLimit(t *testing.T) {
+	r, err := NewRule(`double([1,2,3,4,5,6,7,8,9,10].map(a, [1,2,3,4,5,6,7,8,9,10].map(b,
+		[1,2,3,4,5,6,7,8,9,10].map(c, [1,2,3,4,5,6,7,8,9,10].map(d, [1,2,3,4,5,6,7,8,9,10].map(e, a+b+c+d+e))))).size())`, "")
+	require.Nil(t, err)
+	_, err = r.Calculate(context.Background(), newTestInput())
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cost limit")
+}
+
+func TestNewRule_Fail(t *testing.T) {
+	for _, tt := range []struct{ expr, path string }{
+		{expr: ""},
+		{expr: "quota *"},
+		{expr: `"str"`},
+		{expr: "quota > 1.0"},
+		{expr: "unknown"},
+		{expr: "quota + 1"},
+		{expr: "quota", path: "synth/{voice}"},
+		{expr: "quota", path: "/synth/{}"},
+		{expr: "quota", path: "/synth/{a}/{a}"},
+		{expr: "quota", path: "/synth/a{b}"},
+	} {
+		_, err := NewRule(tt.expr, tt.path)
+		assert.NotNil(t, err, tt.expr+" "+tt.path)
+	}
+}
+
+func TestRule_UsesBody(t *testing.T) {
+	r, err := NewRule(`quota * (body.voice == "a" ? 1.0 : 2.0)`, "")
+	require.Nil(t, err)
+	assert.True(t, r.UsesBody())
+	r, err = NewRule(`tags.?body.orValue("") == "a" ? 1.0 : quota`, "")
+	require.Nil(t, err)
+	assert.False(t, r.UsesBody())
+}
+
+func TestPathPattern(t *testing.T) {
+	p, err := parsePathPattern("/synth/{voice}/{format}")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"voice": "laura", "format": "mp3"}, p.match("/synth/laura/mp3"))
+	assert.Equal(t, map[string]string{}, p.match("/synth/laura"))
+	assert.Equal(t, map[string]string{}, p.match("/tts/laura/mp3"))
+	assert.Equal(t, map[string]string{}, p.match("/synth/laura/mp3/1"))
+	p, err = parsePathPattern("")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{}, p.match("/synth"))
+}
@@ -0,0 +1,125 @@
+package randkey
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+const (
+	_symbols = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// _checksumLen is the length of base62 encoded CRC32
+	_checksumLen = 6
+	// _separator ends the prefix
+	_separator    = '_'
+	_maxPrefixLen = 20
+)
+
+// Format generates keys as <prefix><random body><checksum>, e.g. dm_live_XXXXCCCCCC.
+// The prefix lets secret scanners detect leaked keys, the checksum lets reject mistyped keys without db lookup
+type Format struct {
+	prefix string
+	size   int
+}
+
+// NewFormat creates key format, size is the length of the random body.
+// Empty prefix means plain keys without the checksum
+func NewFormat(prefix string, size int) (*Format, error) {
+	if size < 10 || size > 100 {
+		return nil, fmt.Errorf("wrong key size %d", size)
+	}
+	if err := validatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	return &Format{prefix: prefix, size: size}, nil
+}
+
+// Generate generates new random key
+func (f *Format) Generate() (string, error) {
+	body, err := Generate(f.size)
+	if err != nil {
+		return "", err
+	}
+	if f.prefix == "" {
+		return body, nil
+	}
+	return f.prefix + body + checksum(f.prefix+body), nil
+}
+
+// Validate checks the checksum of a key having one of the prefixes, other keys are not checked,
+// as older or imported plain keys may contain any symbols
+func Validate(key string, prefixes []string) error {
+	prefix, ok := findPrefix(key, prefixes)
+	if !ok {
+		return nil
+	}
+	body := key[len(prefix):]
+	if len(body) <= _checksumLen {
+		return errors.New("key too short")
+	}
+	for _, c := range body {
+		if !strings.ContainsRune(_symbols, c) {
+			return errors.New("wrong key symbol")
+		}
+	}
+	l := len(key) - _checksumLen
+	if checksum(key[:l]) != key[l:] {
+		return errors.New("wrong key checksum")
+	}
+	return nil
+}
+
+// ParsePrefixes parses the comma separated key prefixes, e.g. 'dm_live_,dm_test_'
+func ParsePrefixes(s string) ([]string, error) {
+	var res []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if err := validatePrefix(p); err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+func findPrefix(key string, prefixes []string) (string, bool) {
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func validatePrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if len(prefix) > _maxPrefixLen {
+		return fmt.Errorf("prefix '%s' too long, max %d", prefix, _maxPrefixLen)
+	}
+	if prefix[len(prefix)-1] != _separator || prefix[0] == _separator {
+		return fmt.Errorf("wrong prefix '%s', expected e.g. dm_live_", prefix)
+	}
+	for _, c := range prefix {
+		if c != _separator && !strings.ContainsRune(_symbols, c) {
+			return fmt.Errorf("wrong prefix symbol '%c'", c)
+		}
+	}
+	return nil
+}
+
+// checksum returns CRC32 of s as fixed length base62 string
+func checksum(s string) string {
+	v := crc32.ChecksumIEEE([]byte(s))
+	res := make([]byte, _checksumLen)
+	for i := _checksumLen - 1; i >= 0; i-- {
+		res[i] = _symbols[v%uint32(len(_symbols))]
+		v /= uint32(len(_symbols))
+	}
+	return string(res)
+}
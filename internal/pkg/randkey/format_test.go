@@ -0,0 +1,82 @@
+package randkey
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat_Generate(t *testing.T) {
+	f, err := NewFormat("dm_live_", 30)
+	require.NoError(t, err)
+	got, err := f.Generate()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(got, "dm_live_"))
+	assert.Len(t, got, 8+30+_checksumLen)
+	assert.NoError(t, Validate(got, []string{"dm_live_"}))
+
+	f, err = NewFormat("", 30)
+	require.NoError(t, err)
+	got, err = f.Generate()
+	require.NoError(t, err)
+	assert.Len(t, got, 30)
+	assert.NoError(t, Validate(got, []string{"dm_live_"}))
+}
+
+func TestNewFormat_Fail(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		size   int
+	}{
+		{name: "Short", prefix: "dm_", size: 9},
+		{name: "Long", prefix: "dm_", size: 101},
+		{name: "No separator", prefix: "dm", size: 30},
+		{name: "Starts with separator", prefix: "_dm_", size: 30},
+		{name: "Wrong symbol", prefix: "dm-live_", size: 30},
+		{name: "Long prefix", prefix: strings.Repeat("a", 20) + "_", size: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFormat(tt.prefix, tt.size)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	key := "dm_live_abcdefghij" + checksum("dm_live_abcdefghij")
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "OK", key: key, wantErr: false},
+		{name: "Plain", key: "abcdefghij", wantErr: false},
+		{name: "Legacy with separator", key: "old_key_abc", wantErr: false},
+		{name: "Other prefix", key: "dm_test_abcdefghij", wantErr: false},
+		{name: "Typo", key: strings.Replace(key, "c", "C", 1), wantErr: true},
+		{name: "Wrong checksum", key: key[:len(key)-1] + "x", wantErr: true},
+		{name: "Short", key: "dm_live_abc", wantErr: true},
+		{name: "Wrong symbol", key: "dm_live_abc-defghij" + checksum("dm_live_abc-defghij"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.key, []string{"dm_live_", "dm_prod_"})
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := ParsePrefixes(" dm_live_, dm_test_,")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dm_live_", "dm_test_"}, got)
+	got, err = ParsePrefixes("")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	_, err = ParsePrefixes("dm_live_,dm")
+	assert.Error(t, err)
+}
@@ -7,7 +7,7 @@ import (
 
 // Generate genetares new random key
 func Generate(n int) (string, error) {
-	var syms = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+	var syms = []byte(_symbols)
 	l := big.NewInt(int64(len(syms)))
 
 	b := make([]byte, n)
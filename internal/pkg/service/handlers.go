@@ -11,6 +11,7 @@ import (
 	"github.com/airenas/api-doorman/internal/pkg/handler"
 	"github.com/airenas/api-doorman/internal/pkg/integration/tts"
 	"github.com/airenas/api-doorman/internal/pkg/postgres"
+	"github.com/airenas/api-doorman/internal/pkg/pricing"
 	"github.com/airenas/api-doorman/internal/pkg/ratelimit"
 	"github.com/airenas/api-doorman/internal/pkg/text"
 	"github.com/airenas/api-doorman/internal/pkg/utils"
@@ -23,6 +24,10 @@ import (
 type HandlerData struct {
 	DB     *sqlx.DB
 	Hasher *utils.Hasher
+	// Guard tracks failed key attempts, nil disables the tracking
+	Guard handler.FailureGuard
+	// KeyPrefixes of the generated keys, their checksum is checked before the key lookup
+	KeyPrefixes []string
 }
 
 // NewHandler creates handler based on config
@@ -58,7 +63,10 @@ func newDefaultHandler(name string, cfg *viper.Viper) (HandlerWrap, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Wrong backendURL")
 	}
-	res.h = handler.Proxy(url)
+	res.h, err = addCORS(name, cfg, handler.Proxy(url, hasCORS(name, cfg)))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't init CORS")
+	}
 	return res, nil
 }
 
@@ -83,11 +91,13 @@ func (h *defaultHandler) Priority() int {
 }
 
 type prefixHandler struct {
-	prefix   string
-	methods  map[string]bool
-	proxyURL string
-	name     string
-	h        http.Handler
+	prefix  string
+	methods map[string]bool
+	// preflight accepts OPTIONS preflights regardless of methods, they are answered by doorman
+	preflight bool
+	proxyURL  string
+	name      string
+	h         http.Handler
 }
 
 func newPrQuotaHandler(name string, cfg *viper.Viper, hd *HandlerData) (HandlerWrap, error) {
@@ -111,6 +121,7 @@ func initPrefixes(name string, cfg *viper.Viper, res *prefixHandler) error {
 	}
 	res.proxyURL = cfg.GetString(name + ".backend")
 	res.methods = initMethods(cfg.GetString(name + ".method"))
+	res.preflight = cfg.GetBool(name+".publishable") || hasCORS(name, cfg)
 	log.Info().Msgf("PrefixURL: %s", res.prefix)
 	return nil
 }
@@ -132,7 +143,7 @@ func newQuotaHandler(name string, cfg *viper.Viper, hd *HandlerData) (http.Handl
 		return nil, fmt.Errorf("can't init validator: %w", err)
 	}
 
-	h := handler.FillOutHeader(handler.Proxy(url))
+	h := handler.FillOutHeader(handler.Proxy(url, hasCORS(name, cfg)))
 	h = handler.FillHeader(handler.FillKeyHeader(handler.FillRequestIDHeader(h, cfg.GetString(name+".db"))))
 	h, err = addCleanHeader(h, cfg.GetString(name+".cleanHeaders"))
 	if err != nil {
@@ -163,13 +174,22 @@ func newQuotaHandler(name string, cfg *viper.Viper, hd *HandlerData) (http.Handl
 			}
 			h = handler.SkipFirstQuota(h, counter)
 		}
+		if h, err = addPricing(name, cfg, h); err != nil {
+			return nil, errors.Wrap(err, "can't init pricing")
+		}
 		qf := strings.TrimSpace(cfg.GetString(name + ".quota.field"))
 		if qt == "json" {
 			if qf == "" {
 				return nil, errors.New("No field")
 			}
-			log.Info().Msgf("Quota extract: %s(%s)", qt, qf)
-			h = handler.TakeJSON(handler.JSONAsQuota(h), qf)
+			mode := handler.JSONFieldMode(strings.TrimSpace(cfg.GetString(name + ".quota.fieldMode")))
+			log.Info().Msgf("Quota extract: %s(%s, %s)", qt, qf, mode)
+			if mode != handler.JSONFieldCount {
+				h = handler.JSONAsQuota(h)
+			}
+			if h, err = handler.TakeJSON(h, qf, mode); err != nil {
+				return nil, errors.Wrap(err, "can't init json field")
+			}
 		} else if qt == "jsonTTS" {
 			log.Info().Msgf("Quota extract: %s(text)", qt)
 			h, err = handler.JSONTTSAsQuota(h, cfg.GetFloat64(name+".quota.discount"))
@@ -211,18 +231,35 @@ func newQuotaHandler(name string, cfg *viper.Viper, hd *HandlerData) (http.Handl
 		log.Info().Msgf("No quota validation")
 	}
 
-	h = handler.LogDB(h, repo, cfg.GetBool(name+".syncLog"))
+	h = handler.LogDB(h, repo, name, cfg.GetBool(name+".syncLog"))
+	if h, err = addEntitlements(name, cfg, h); err != nil {
+		return nil, errors.Wrap(err, "can't init entitlements")
+	}
 
-	hKey := handler.KeyValid(h, repo)
+	hKey := handler.KeyValid(handler.ScopeValid(h, name), repo, hd.Guard, hd.KeyPrefixes)
 	dl := cfg.GetFloat64(name + ".quota.default")
 	if dl > 0 {
 		log.Info().Msgf("Default IP quota: %.f", dl)
-		hIP := handler.IPAsKey(hKey, newIPSaver(repo, dl))
+		v4Bits, v6Bits := cfg.GetInt(name+".quota.ipv4Prefix"), cfg.GetInt(name+".quota.ipv6Prefix")
+		if err := utils.ValidateIPKeyPrefixes(v4Bits, v6Bits); err != nil {
+			return nil, errors.Wrap(err, "wrong IP key prefixes")
+		}
+		as := postgres.AnonymousSettings{Limit: dl,
+			DailyCap:       cfg.GetFloat64(name + ".quota.anonymousDailyCap"),
+			Replenish:      cfg.GetFloat64(name + ".quota.replenish"),
+			ReplenishEvery: cfg.GetDuration(name + ".quota.replenishEvery"),
+		}
+		if err := repo.SetAnonymous(as); err != nil {
+			return nil, errors.Wrap(err, "can't init anonymous settings")
+		}
+		log.Info().Msgf("IP key prefixes: /%d, /%d, anonymous daily cap: %.f, replenish: %.f every %v",
+			v4Bits, v6Bits, as.DailyCap, as.Replenish, as.ReplenishEvery)
+		hIP := handler.IPAsKey(hKey, newIPSaver(repo, dl), v4Bits, v6Bits)
 		hKey = handler.KeyValidOrIP(hKey, hIP)
 	}
 	h = handler.KeyExtract(hKey)
 
-	return h, nil
+	return addCORS(name, cfg, addPreflight(name, cfg, h, repo))
 }
 
 func newRateLimiter(name string, cfg *viper.Viper, next http.Handler) (http.Handler, error) {
@@ -239,7 +276,15 @@ func newRateLimiter(name string, cfg *viper.Viper, next http.Handler) (http.Hand
 	if err != nil {
 		return nil, fmt.Errorf("can't init redis limiter: %w", err)
 	}
-	return handler.RateLimitValidate(next, rl, defaultLimit), nil
+	return handler.RateLimitValidate(next, rl, defaultLimit, publishableLimit(name, cfg, defaultLimit)), nil
+}
+
+// publishableLimit returns the limit per client IP of a publishable key, a tenth of the default limit if not set
+func publishableLimit(name string, cfg *viper.Viper, defaultLimit int64) int64 {
+	if cfg.IsSet(name + ".rateLimit.publishable") {
+		return cfg.GetInt64(name + ".rateLimit.publishable")
+	}
+	return max(defaultLimit/10, 1)
 }
 
 func (h *prefixHandler) Handler() http.Handler {
@@ -273,7 +318,7 @@ func (h *prefixHandler) Valid(r *http.Request) bool {
 }
 
 func (h *prefixHandler) methodOK(m string) bool {
-	if len(h.methods) == 0 {
+	if len(h.methods) == 0 || (h.preflight && m == http.MethodOptions) {
 		return true
 	}
 	_, f := h.methods[m]
@@ -314,7 +359,7 @@ func newKeyHandler(name string, cfg *viper.Viper, hd *HandlerData) (http.Handler
 		return nil, fmt.Errorf("can't init validator: %w", err)
 	}
 
-	h := handler.FillOutHeader(handler.Proxy(url))
+	h := handler.FillOutHeader(handler.Proxy(url, hasCORS(name, cfg)))
 	h = handler.FillHeader(handler.FillKeyHeader(handler.FillRequestIDHeader(h, cfg.GetString(name+".db"))))
 	h, err = addCleanHeader(h, cfg.GetString(name+".cleanHeaders"))
 	if err != nil {
@@ -326,11 +371,96 @@ func newKeyHandler(name string, cfg *viper.Viper, hd *HandlerData) (http.Handler
 		h = handler.StripPrefix(h, stripURL)
 		log.Info().Msgf("Strip prefix: %s", stripURL)
 	}
-	h = handler.LogDB(h, repo, cfg.GetBool(name+".syncLog"))
-	hKey := handler.KeyValid(h, repo)
+	h = handler.LogDB(h, repo, name, cfg.GetBool(name+".syncLog"))
+	if h, err = addEntitlements(name, cfg, h); err != nil {
+		return nil, errors.Wrap(err, "can't init entitlements")
+	}
+	hKey := handler.KeyValid(handler.ScopeValid(h, name), repo, hd.Guard, hd.KeyPrefixes)
 	h = handler.KeyExtract(hKey)
 
-	return h, nil
+	return addCORS(name, cfg, addPreflight(name, cfg, h, repo))
+}
+
+// addPreflight answers CORS preflights for publishable keys if <name>.publishable is set
+func addPreflight(name string, cfg *viper.Viper, h http.Handler, op handler.OriginProvider) http.Handler {
+	if !cfg.GetBool(name + ".publishable") {
+		return h
+	}
+	log.Info().Msgf("Preflight for publishable keys")
+	return handler.Preflight(h, op)
+}
+
+func hasCORS(name string, cfg *viper.Viper) bool {
+	return cfg.GetString(name+".cors.allowedOrigins") != ""
+}
+
+// addCORS answers preflights and adds CORS headers for the origins of <name>.cors.allowedOrigins
+func addCORS(name string, cfg *viper.Viper, h http.Handler) (http.Handler, error) {
+	if !hasCORS(name, cfg) {
+		return h, nil
+	}
+	pr := name + ".cors."
+	res, err := handler.CORS(h, handler.CORSSettings{
+		AllowedOrigins:   initList(cfg.GetString(pr + "allowedOrigins")),
+		AllowedMethods:   initList(cfg.GetString(pr + "allowedMethods")),
+		AllowedHeaders:   initList(cfg.GetString(pr + "allowedHeaders")),
+		ExposedHeaders:   initList(cfg.GetString(pr + "exposedHeaders")),
+		AllowCredentials: cfg.GetBool(pr + "allowCredentials"),
+		MaxAge:           cfg.GetDuration(pr + "maxAge"),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "wrong CORS settings")
+	}
+	log.Info().Msgf("CORS origins: %s", cfg.GetString(pr+"allowedOrigins"))
+	return res, nil
+}
+
+// addPricing calculates the quota by the <name>.quota.pricing.expression if it is set
+func addPricing(name string, cfg *viper.Viper, h http.Handler) (http.Handler, error) {
+	expr := strings.TrimSpace(cfg.GetString(name + ".quota.pricing.expression"))
+	if expr == "" {
+		return h, nil
+	}
+	rule, err := pricing.NewRule(expr, cfg.GetString(name+".quota.pricing.path"))
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("Pricing: %s", rule)
+	return handler.Pricing(h, rule), nil
+}
+
+// addEntitlements checks the JSON body by the key tags if <name>.entitlements is set,
+// the format is a list of '<tag>=<field>' or '<tag>=len(<field>)'
+func addEntitlements(name string, cfg *viper.Viper, h http.Handler) (http.Handler, error) {
+	str := cfg.GetString(name + ".entitlements")
+	if strings.TrimSpace(str) == "" {
+		return h, nil
+	}
+	rules, err := initEntitlements(str)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("Entitlements: %s", str)
+	return handler.Entitlements(h, rules)
+}
+
+func initEntitlements(str string) ([]handler.EntitlementRule, error) {
+	var res []handler.EntitlementRule
+	for _, s := range initList(str) {
+		t, f, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, errors.Errorf("wrong entitlement '%s', expected <tag>=<field>", s)
+		}
+		rule := handler.EntitlementRule{Tag: strings.TrimSpace(t), Field: strings.TrimSpace(f)}
+		if v, ok := strings.CutPrefix(rule.Field, "len("); ok {
+			if rule.Field, ok = strings.CutSuffix(v, ")"); !ok {
+				return nil, errors.Errorf("wrong entitlement '%s', expected len(<field>)", s)
+			}
+			rule.Length = true
+		}
+		res = append(res, rule)
+	}
+	return res, nil
 }
 
 func addCleanHeader(h http.Handler, headerPrefix string) (http.Handler, error) {
@@ -347,10 +477,18 @@ func addCleanHeader(h http.Handler, headerPrefix string) (http.Handler, error) {
 
 func initMethods(str string) map[string]bool {
 	res := make(map[string]bool)
+	for _, s := range initList(str) {
+		res[s] = true
+	}
+	return res
+}
+
+func initList(str string) []string {
+	var res []string
 	for _, s := range strings.Split(str, ",") {
 		s = strings.TrimSpace(s)
 		if s != "" {
-			res[s] = true
+			res = append(res, s)
 		}
 	}
 	return res
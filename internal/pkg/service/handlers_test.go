@@ -45,6 +45,60 @@ func TestDefaultProvider_Fail(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestDefaultProvider_CORS(t *testing.T) {
+	h, err := NewHandler("default", newTestC(t, "default:\n  backend: http://olia.lt\n  cors:\n    allowedOrigins: '*'"), nil)
+	assert.Nil(t, err)
+	req := httptest.NewRequest("OPTIONS", "/any", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp := httptest.NewRecorder()
+	h.Handler().ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "*", resp.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestKeyHandler_CORS(t *testing.T) {
+	h, err := NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: key
+  db: test
+  prefixURL: /start
+  method: POST
+  cors:
+    allowedOrigins: https://example.com, https://*.example.com
+    allowedMethods: POST
+    maxAge: 10m
+`), newTestProvider(t))
+	assert.Nil(t, err)
+	hq := h.(*prefixHandler)
+	assert.True(t, hq.Valid(httptest.NewRequest("OPTIONS", "/start", nil)))
+	assert.Contains(t, h.Info(), "CORS([https://example.com https://*.example.com], [POST], false)")
+	assert.NotContains(t, h.Info(), "Preflight")
+
+	req := httptest.NewRequest("OPTIONS", "/start", nil)
+	req.Header.Set("Origin", "https://a.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp := httptest.NewRecorder()
+	h.Handler().ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "600", resp.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestKeyHandler_FailCORS(t *testing.T) {
+	h, err := NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: key
+  db: test
+  prefixURL: /start
+  cors:
+    allowedOrigins: example.com
+`), newTestProvider(t))
+	assert.Nil(t, h)
+	assert.NotNil(t, err)
+}
+
 func TestNewHandler_Fail(t *testing.T) {
 	h, err := NewHandler("default1", newTestC(t, "default1:\n  type: olia"), nil)
 	assert.Nil(t, h)
@@ -87,7 +141,7 @@ func TestQuotaHandle(t *testing.T) {
 	assert.Contains(t, h.Info(), "FillOutHeader")
 	assert.Contains(t, h.Info(), "FillKeyHeader")
 	assert.Contains(t, h.Info(), "FillRequestIDHeader(db:test)")
-	assert.Contains(t, h.Info(), "RateLimitValidate(1002, RedisRateLimiter(redis:6379, 180))")
+	assert.Contains(t, h.Info(), "RateLimitValidate(1002, 100, RedisRateLimiter(redis:6379, 180))")
 	assert.Contains(t, h.Info(), "CleanHeader ([TTS-ONE TTS-TWO])")
 	assert.Contains(t, h.Info(), "SkipFirstQuota(rID)")
 }
@@ -347,6 +401,144 @@ tts:
 	assert.Contains(t, h.Info(), "FillKeyHeader")
 	assert.Contains(t, h.Info(), "FillRequestIDHeader(db:test)")
 	assert.Contains(t, h.Info(), "CleanHeader ([TTS-ONE])")
+	assert.False(t, hq.Valid(httptest.NewRequest("OPTIONS", "/start", nil)))
+	assert.NotContains(t, h.Info(), "Preflight")
+}
+
+func TestKeyHandler_Publishable(t *testing.T) {
+	h, err := NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: key
+  db: test
+  prefixURL: /start
+  method: POST
+  publishable: true
+`), newTestProvider(t))
+	assert.Nil(t, err)
+	hq := h.(*prefixHandler)
+	assert.True(t, hq.Valid(httptest.NewRequest("OPTIONS", "/start", nil)))
+	assert.False(t, hq.Valid(httptest.NewRequest("GET", "/start", nil)))
+	assert.Contains(t, h.Info(), "Preflight")
+}
+
+func TestQuotaHandle_JSONPath(t *testing.T) {
+	h, err := NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: quota
+  db: test
+  quota:
+    type: json
+    field: $.segments[*].text
+    fieldMode: sum
+  prefixURL: /start
+  method: POST
+`), newTestProvider(t))
+	assert.Nil(t, err)
+	assert.Contains(t, h.Info(), "JSONField($.segments[*].text, sum)")
+	assert.Contains(t, h.Info(), "JSONAsQuota")
+
+	h, err = NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: quota
+  db: test
+  quota:
+    type: json
+    field: segments
+    fieldMode: count
+  prefixURL: /start
+  method: POST
+`), newTestProvider(t))
+	assert.Nil(t, err)
+	assert.Contains(t, h.Info(), "JSONField(segments, count)")
+	assert.NotContains(t, h.Info(), "JSONAsQuota")
+}
+
+func TestQuotaHandle_Pricing(t *testing.T) {
+	h, err := NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: quota
+  db: test
+  quota:
+    type: json
+    field: text
+    pricing:
+      expression: math.greatest(quota, 10.0)
+      path: /start/{voice}
+  prefixURL: /start
+  method: POST
+`), newTestProvider(t))
+	assert.Nil(t, err)
+	assert.Contains(t, h.Info(), "Pricing(math.greatest(quota, 10.0), /start/{voice})")
+}
+
+func TestQuotaHandle_FailPricing(t *testing.T) {
+	h, err := NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: quota
+  db: test
+  quota:
+    type: json
+    field: text
+    pricing:
+      expression: quota +
+  prefixURL: /start
+  method: POST
+`), newTestProvider(t))
+	assert.Nil(t, h)
+	assert.NotNil(t, err)
+}
+
+func TestQuotaHandle_FailJSONPath(t *testing.T) {
+	for _, v := range []string{"field: segments[*].text", "field: a[\n    fieldMode: sum", "field: text\n    fieldMode: olia"} {
+		h, err := NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: quota
+  db: test
+  quota:
+    type: json
+    `+v+`
+  prefixURL: /start
+  method: POST
+`), newTestProvider(t))
+		assert.Nil(t, h, v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestKeyHandler_Entitlements(t *testing.T) {
+	h, err := NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: key
+  db: test
+  prefixURL: /start
+  method: POST
+  entitlements: voices=voice, maxChars=len(text)
+`), newTestProvider(t))
+	assert.Nil(t, err)
+	assert.Contains(t, h.Info(), "Entitlements(voices=voice, maxchars=len(text))")
+}
+
+func TestKeyHandler_FailEntitlements(t *testing.T) {
+	for _, v := range []string{"voices", "voices=", "maxChars=len(text"} {
+		h, err := NewHandler("tts", newTestC(t, `
+tts:
+  backend: http://olia.lt
+  type: key
+  db: test
+  prefixURL: /start
+  method: POST
+  entitlements: `+v+`
+`), newTestProvider(t))
+		assert.Nil(t, h, v)
+		assert.NotNil(t, err, v)
+	}
 }
 
 func TestKeyHandler_FailNoDB(t *testing.T) {
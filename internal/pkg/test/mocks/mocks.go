@@ -10,9 +10,15 @@ import (
 )
 
 //go:generate pegomock generate --package=mocks --output=oneKeyRetriever.go github.com/airenas/api-doorman/internal/pkg/admin OneKeyRetriever
+//go:generate pegomock generate --package=mocks --output=keyRetriever.go github.com/airenas/api-doorman/internal/pkg/admin KeyRetriever
 //go:generate pegomock generate --package=mocks --output=logProvider.go github.com/airenas/api-doorman/internal/pkg/admin LogProvider
 //go:generate pegomock generate --package=mocks --output=prValidator.go github.com/airenas/api-doorman/internal/pkg/admin PrValidator
 //go:generate pegomock generate --package=mocks --output=usageRestorer.go github.com/airenas/api-doorman/internal/pkg/admin UsageRestorer
+//go:generate pegomock generate --package=mocks --output=adminManager.go github.com/airenas/api-doorman/internal/pkg/admin AdminManager
+//go:generate pegomock generate --package=mocks --output=keyPurger.go github.com/airenas/api-doorman/internal/pkg/admin KeyPurger
+//go:generate pegomock generate --package=mocks --output=hashReporter.go github.com/airenas/api-doorman/internal/pkg/admin HashReporter
+//go:generate pegomock generate --package=mocks --output=blockManager.go github.com/airenas/api-doorman/internal/pkg/admin BlockManager
+//go:generate pegomock generate --package=mocks --output=failureGuard.go github.com/airenas/api-doorman/internal/pkg/handler FailureGuard
 
 //go:generate pegomock generate --package=mocks --output=keyValidator.go github.com/airenas/api-doorman/internal/pkg/handler KeyValidator
 //go:generate pegomock generate --package=mocks --output=quotaValidator.go github.com/airenas/api-doorman/internal/pkg/handler QuotaValidator
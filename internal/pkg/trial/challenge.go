@@ -0,0 +1,132 @@
+package trial
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	adminapi "github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+)
+
+const (
+	// Algorithm of the proof-of-work hash
+	Algorithm = "sha256"
+
+	_minSecretLen  = 16
+	_maxDifficulty = 32
+	_maxNonceLen   = 64
+)
+
+// Challenger issues and verifies HMAC signed proof-of-work challenges,
+// so no challenge state is kept until the challenge is solved
+type Challenger struct {
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+// challenge is the verified content of the challenge token
+type challenge struct {
+	ID      string
+	Project string
+	Expires time.Time
+}
+
+// NewChallenger creates challenger, difficulty is the count of required leading zero bits
+func NewChallenger(secret string, difficulty int, ttl time.Duration) (*Challenger, error) {
+	if len(secret) < _minSecretLen {
+		return nil, fmt.Errorf("secret must be at least %d symbols", _minSecretLen)
+	}
+	if difficulty < 1 || difficulty > _maxDifficulty {
+		return nil, fmt.Errorf("wrong difficulty %d, expected [1, %d]", difficulty, _maxDifficulty)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("wrong challenge ttl %v", ttl)
+	}
+	return &Challenger{secret: []byte(secret), difficulty: difficulty, ttl: ttl, now: time.Now}, nil
+}
+
+// New issues a challenge for the project
+func (c *Challenger) New(project string) (*adminapi.TrialChallenge, error) {
+	rnd := make([]byte, 16)
+	if _, err := rand.Read(rnd); err != nil {
+		return nil, fmt.Errorf("generate challenge: %w", err)
+	}
+	expires := c.now().Add(c.ttl).Truncate(time.Second)
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%s|%d|%d|%s", hex.EncodeToString(rnd), expires.Unix(), c.difficulty, project)))
+	return &adminapi.TrialChallenge{
+		Challenge:  payload + "." + c.sign(payload),
+		Algorithm:  Algorithm,
+		Difficulty: c.difficulty,
+		Expires:    expires,
+	}, nil
+}
+
+// verify checks the signature, project, expiry and the solution of the challenge
+func (c *Challenger) verify(token, nonce, project string) (*challenge, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(c.sign(payload))) {
+		return nil, model.NewWrongFieldError("challenge", "invalid")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, model.NewWrongFieldError("challenge", "invalid")
+	}
+	parts := strings.SplitN(string(b), "|", 4)
+	if len(parts) != 4 {
+		return nil, model.NewWrongFieldError("challenge", "invalid")
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, model.NewWrongFieldError("challenge", "invalid")
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, model.NewWrongFieldError("challenge", "invalid")
+	}
+	res := &challenge{ID: parts[0], Expires: time.Unix(expires, 0), Project: parts[3]}
+	if res.Project != project {
+		return nil, model.NewWrongFieldError("challenge", "issued for other project")
+	}
+	if !c.now().Before(res.Expires) {
+		return nil, model.NewWrongFieldError("challenge", "expired")
+	}
+	if nonce == "" || len(nonce) > _maxNonceLen {
+		return nil, model.NewWrongFieldError("nonce", fmt.Sprintf("expected 1-%d symbols", _maxNonceLen))
+	}
+	if leadingZeros(sha256.Sum256([]byte(token+":"+nonce))) < difficulty {
+		return nil, model.NewWrongFieldError("nonce", "challenge is not solved")
+	}
+	return res, nil
+}
+
+func (c *Challenger) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Challenger) Info(pr string) string {
+	return pr + fmt.Sprintf("Challenger(%d, %v)", c.difficulty, c.ttl)
+}
+
+func leadingZeros(h [sha256.Size]byte) int {
+	res := 0
+	for _, b := range h {
+		if b != 0 {
+			return res + bits.LeadingZeros8(b)
+		}
+		res += 8
+	}
+	return res
+}
@@ -0,0 +1,108 @@
+package trial
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef"
+
+func solve(t *testing.T, challenge string, difficulty int) string {
+	t.Helper()
+	return findNonce(t, challenge, func(zeros int) bool { return zeros >= difficulty })
+}
+
+func findNonce(t *testing.T, challenge string, ok func(int) bool) string {
+	t.Helper()
+	for i := 0; i < 1<<20; i++ {
+		n := strconv.Itoa(i)
+		if ok(leadingZeros(sha256.Sum256([]byte(challenge + ":" + n)))) {
+			return n
+		}
+	}
+	t.Fatal("can't find nonce")
+	return ""
+}
+
+func TestNewChallenger(t *testing.T) {
+	_, err := NewChallenger("short", 10, time.Minute)
+	assert.Error(t, err)
+	_, err = NewChallenger(testSecret, 0, time.Minute)
+	assert.Error(t, err)
+	_, err = NewChallenger(testSecret, 33, time.Minute)
+	assert.Error(t, err)
+	_, err = NewChallenger(testSecret, 10, 0)
+	assert.Error(t, err)
+	_, err = NewChallenger(testSecret, 10, time.Minute)
+	assert.NoError(t, err)
+}
+
+func TestChallenger_Verify(t *testing.T) {
+	c, err := NewChallenger(testSecret, 8, time.Minute)
+	require.NoError(t, err)
+	ch, err := c.New("tts")
+	require.NoError(t, err)
+	assert.Equal(t, 8, ch.Difficulty)
+	assert.Equal(t, Algorithm, ch.Algorithm)
+	nonce := solve(t, ch.Challenge, ch.Difficulty)
+
+	res, err := c.verify(ch.Challenge, nonce, "tts")
+	require.NoError(t, err)
+	assert.Equal(t, "tts", res.Project)
+	assert.NotEmpty(t, res.ID)
+	assert.Equal(t, ch.Expires, res.Expires)
+}
+
+func TestChallenger_Verify_Fail(t *testing.T) {
+	c, err := NewChallenger(testSecret, 8, time.Minute)
+	require.NoError(t, err)
+	ch, err := c.New("tts")
+	require.NoError(t, err)
+	nonce := solve(t, ch.Challenge, ch.Difficulty)
+	wrongNonce := findNonce(t, ch.Challenge, func(zeros int) bool { return zeros < ch.Difficulty })
+	other, err := NewChallenger("fedcba9876543210", 8, time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		c         *Challenger
+		challenge string
+		nonce     string
+		project   string
+		field     string
+	}{
+		{name: "project", c: c, challenge: ch.Challenge, nonce: nonce, project: "asr", field: "challenge"},
+		{name: "signature", c: other, challenge: ch.Challenge, nonce: nonce, project: "tts", field: "challenge"},
+		{name: "tampered", c: c, challenge: "a" + ch.Challenge, nonce: nonce, project: "tts", field: "challenge"},
+		{name: "no signature", c: c, challenge: "abc", nonce: nonce, project: "tts", field: "challenge"},
+		{name: "no nonce", c: c, challenge: ch.Challenge, nonce: "", project: "tts", field: "nonce"},
+		{name: "unsolved", c: c, challenge: ch.Challenge, nonce: wrongNonce, project: "tts", field: "nonce"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.c.verify(tt.challenge, tt.nonce, tt.project)
+			var errF *model.WrongFieldError
+			require.ErrorAs(t, err, &errF)
+			assert.Equal(t, tt.field, errF.Field)
+		})
+	}
+}
+
+func TestChallenger_Verify_Expired(t *testing.T) {
+	c, err := NewChallenger(testSecret, 8, time.Minute)
+	require.NoError(t, err)
+	ch, err := c.New("tts")
+	require.NoError(t, err)
+	nonce := solve(t, ch.Challenge, ch.Difficulty)
+	c.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = c.verify(ch.Challenge, nonce, "tts")
+	var errF *model.WrongFieldError
+	require.ErrorAs(t, err, &errF)
+	assert.Equal(t, "challenge", errF.Field)
+}
@@ -0,0 +1,199 @@
+package trial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	adminapi "github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// Tag marks the keys issued by the trial service
+const Tag = "x-trial:true"
+
+const (
+	// trial caps are counted per network, so one host can't bypass them by rotating IPv6 addresses
+	_ipv4Bits = 32
+	_ipv6Bits = 64
+	// day counters live a bit longer than the day to survive clock differences of the instances
+	_dayCounterTTL = 25 * time.Hour
+)
+
+type (
+	// KeyCreator creates keys, it is the CMS key creation
+	KeyCreator interface {
+		Create(ctx context.Context, user *model.User, in *api.CreateInput) (*api.Key, bool /*created*/, error)
+	}
+
+	// UserLoader loads the administrator the trial keys are created by
+	UserLoader interface {
+		LoadUser(ctx context.Context, id string) (*model.User, error)
+	}
+
+	// Counter keeps expiring counters shared between service instances
+	Counter interface {
+		// Incr increments the counter, ttl is set for a new counter only
+		Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	}
+
+	// Plan of the trial keys
+	Plan struct {
+		Credits  float64
+		ValidFor time.Duration
+		// PerIP keys can be issued for an IP network during PerIPWindow
+		PerIP       int64
+		PerIPWindow time.Duration
+		// PerDay keys can be issued for a project during the UTC day, zero means no limit
+		PerDay int64
+	}
+
+	// Data is trial handlers' data keeper
+	Data struct {
+		Challenger *Challenger
+		Creator    KeyCreator
+		Users      UserLoader
+		Counter    Counter
+		// AdminID is the administrator owning the trial keys, its projects, budgets and allowed tags apply
+		AdminID  string
+		Projects []string
+		Plan     Plan
+	}
+)
+
+// Validate checks the trial configuration
+func (d *Data) Validate() error {
+	if d.Challenger == nil {
+		return errors.New("no challenger")
+	}
+	if d.Creator == nil {
+		return errors.New("no key creator")
+	}
+	if d.Users == nil {
+		return errors.New("no user loader")
+	}
+	if d.Counter == nil {
+		return errors.New("no counter")
+	}
+	if d.AdminID == "" {
+		return errors.New("no admin ID")
+	}
+	if len(d.Projects) == 0 {
+		return errors.New("no projects")
+	}
+	if d.Plan.Credits <= 0 || d.Plan.ValidFor <= 0 {
+		return fmt.Errorf("wrong plan: credits %v, validFor %v", d.Plan.Credits, d.Plan.ValidFor)
+	}
+	if d.Plan.PerIP <= 0 || d.Plan.PerIPWindow <= 0 {
+		return fmt.Errorf("wrong plan: perIP %d, perIPWindow %v", d.Plan.PerIP, d.Plan.PerIPWindow)
+	}
+	if d.Plan.PerDay < 0 {
+		return fmt.Errorf("wrong plan: perDay %d", d.Plan.PerDay)
+	}
+	return nil
+}
+
+// InitRoutes registers public http routes for the trial keys
+func InitRoutes(e *echo.Echo, data *Data) {
+	e.GET("/trial/:project/challenge", challengeGet(data))
+	e.POST("/trial/:project/key", keyCreate(data))
+}
+
+func challengeGet(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		project := c.Param("project")
+		if !slices.Contains(data.Projects, project) {
+			return echo.NewHTTPError(http.StatusNotFound, "no trial for project")
+		}
+		res, err := data.Challenger.New(project)
+		if err != nil {
+			return utils.ProcessError(err)
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+func keyCreate(data *Data) func(echo.Context) error {
+	return func(c echo.Context) error {
+		project := c.Param("project")
+		if !slices.Contains(data.Projects, project) {
+			return echo.NewHTTPError(http.StatusNotFound, "no trial for project")
+		}
+		var input adminapi.TrialKeyInput
+		if err := utils.TakeJSONInput(c, &input); err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		ch, err := data.Challenger.verify(input.Challenge, input.Nonce, project)
+		if err != nil {
+			return utils.ProcessError(err)
+		}
+		used, err := data.Counter.Incr(ctx, "trial:used:"+ch.ID, time.Until(ch.Expires)+time.Second)
+		if err != nil {
+			return utils.ProcessError(fmt.Errorf("mark challenge: %w", err))
+		}
+		if used > 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "challenge already used")
+		}
+
+		ip := utils.ExtractIP(c.Request())
+		ipKey := utils.IPKey(ip, _ipv4Bits, _ipv6Bits)
+		if err := checkCaps(ctx, data, project, ipKey); err != nil {
+			return err
+		}
+
+		user, err := data.Users.LoadUser(ctx, data.AdminID)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("admin", data.AdminID).Msg("can't load trial administrator")
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "trial is not available")
+		}
+		user.CurrentIP = ip
+		validTo := time.Now().Add(data.Plan.ValidFor)
+		res, _, err := data.Creator.Create(ctx, user, &api.CreateInput{
+			Service:     project,
+			Credits:     data.Plan.Credits,
+			ValidTo:     &validTo,
+			Description: "trial key for " + ipKey,
+			Tags:        []string{Tag},
+			// a scoped administrator can't issue unrestricted keys
+			Scopes: user.AllowedScopes,
+		})
+		if err != nil {
+			return utils.ProcessError(err)
+		}
+		log.Ctx(ctx).Info().Str("project", project).Str("ip", ipKey).Str("id", res.ID).Msg("Issued trial key")
+		return c.JSON(http.StatusCreated, res)
+	}
+}
+
+// checkCaps counts the issuance, requests over the caps are counted too, so a greedy IP does not get keys until its window ends
+func checkCaps(ctx context.Context, data *Data, project, ipKey string) error {
+	count, err := data.Counter.Incr(ctx, fmt.Sprintf("trial:ip:%s:%s", project, ipKey), data.Plan.PerIPWindow)
+	if err != nil {
+		return utils.ProcessError(fmt.Errorf("count ip: %w", err))
+	}
+	if count > data.Plan.PerIP {
+		log.Ctx(ctx).Warn().Str("project", project).Str("ip", ipKey).Int64("count", count).Msg("Trial IP cap reached")
+		return echo.NewHTTPError(http.StatusTooManyRequests, "trial key limit for IP reached")
+	}
+	if data.Plan.PerDay == 0 {
+		return nil
+	}
+	day := time.Now().UTC().Format(time.DateOnly)
+	count, err = data.Counter.Incr(ctx, fmt.Sprintf("trial:day:%s:%s", project, day), _dayCounterTTL)
+	if err != nil {
+		return utils.ProcessError(fmt.Errorf("count day: %w", err))
+	}
+	if count > data.Plan.PerDay {
+		log.Ctx(ctx).Warn().Str("project", project).Int64("count", count).Msg("Trial daily cap reached")
+		return echo.NewHTTPError(http.StatusTooManyRequests, "daily trial key limit reached")
+	}
+	return nil
+}
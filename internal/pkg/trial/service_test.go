@@ -0,0 +1,180 @@
+package trial
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	adminapi "github.com/airenas/api-doorman/internal/pkg/admin/api"
+	"github.com/airenas/api-doorman/internal/pkg/bruteforce"
+	"github.com/airenas/api-doorman/internal/pkg/integration/cms/api"
+	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCreator struct {
+	user  *model.User
+	input *api.CreateInput
+	err   error
+}
+
+func (c *testCreator) Create(_ context.Context, user *model.User, in *api.CreateInput) (*api.Key, bool, error) {
+	c.user, c.input = user, in
+	if c.err != nil {
+		return nil, false, c.err
+	}
+	return &api.Key{ID: "id1", Key: "key1", Service: in.Service}, true, nil
+}
+
+type testUsers struct {
+	scopes []string
+	err    error
+}
+
+func (u *testUsers) LoadUser(_ context.Context, id string) (*model.User, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	return &model.User{ID: id, AllowedScopes: u.scopes}, nil
+}
+
+func newTestData(t *testing.T) (*Data, *testCreator, *testUsers) {
+	t.Helper()
+	c, err := NewChallenger(testSecret, 8, time.Minute)
+	require.NoError(t, err)
+	creator, users := &testCreator{}, &testUsers{}
+	res := &Data{Challenger: c, Creator: creator, Users: users, Counter: bruteforce.NewMemoryStore(),
+		AdminID: "trial", Projects: []string{"tts"},
+		Plan: Plan{Credits: 100, ValidFor: time.Hour, PerIP: 1, PerIPWindow: time.Hour, PerDay: 2}}
+	require.NoError(t, res.Validate())
+	return res, creator, users
+}
+
+func invoke(t *testing.T, data *Data, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	InitRoutes(e, data)
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, req)
+	return resp
+}
+
+func newKeyRequest(t *testing.T, data *Data, project, ip string) *http.Request {
+	t.Helper()
+	resp := invoke(t, data, httptest.NewRequest(http.MethodGet, "/trial/"+project+"/challenge", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var ch adminapi.TrialChallenge
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &ch))
+	return newSolvedRequest(t, project, ip, &adminapi.TrialKeyInput{Challenge: ch.Challenge, Nonce: solve(t, ch.Challenge, ch.Difficulty)})
+}
+
+func newSolvedRequest(t *testing.T, project, ip string, in *adminapi.TrialKeyInput) *http.Request {
+	t.Helper()
+	b, err := json.Marshal(in)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/trial/"+project+"/key", strings.NewReader(string(b)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.RemoteAddr = ip + ":1000"
+	return req
+}
+
+func TestData_Validate(t *testing.T) {
+	d, _, _ := newTestData(t)
+	d.AdminID = ""
+	assert.Error(t, d.Validate())
+	d, _, _ = newTestData(t)
+	d.Plan.Credits = 0
+	assert.Error(t, d.Validate())
+	d, _, _ = newTestData(t)
+	d.Plan.PerIP = 0
+	assert.Error(t, d.Validate())
+	d, _, _ = newTestData(t)
+	d.Projects = nil
+	assert.Error(t, d.Validate())
+}
+
+func TestChallenge(t *testing.T) {
+	d, _, _ := newTestData(t)
+	resp := invoke(t, d, httptest.NewRequest(http.MethodGet, "/trial/tts/challenge", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = invoke(t, d, httptest.NewRequest(http.MethodGet, "/trial/asr/challenge", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestKeyCreate(t *testing.T) {
+	d, creator, _ := newTestData(t)
+	resp := invoke(t, d, newKeyRequest(t, d, "tts", "1.1.1.1"))
+	require.Equal(t, http.StatusCreated, resp.Code)
+	var key api.Key
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &key))
+	assert.Equal(t, "key1", key.Key)
+
+	assert.Equal(t, "trial", creator.user.ID)
+	assert.Equal(t, "1.1.1.1", creator.user.CurrentIP)
+	assert.Equal(t, "tts", creator.input.Service)
+	assert.Equal(t, 100.0, creator.input.Credits)
+	assert.Equal(t, []string{Tag}, creator.input.Tags)
+	require.NotNil(t, creator.input.ValidTo)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *creator.input.ValidTo, time.Minute)
+}
+
+func TestKeyCreate_Scopes(t *testing.T) {
+	d, creator, users := newTestData(t)
+	users.scopes = []string{"POST tts"}
+	resp := invoke(t, d, newKeyRequest(t, d, "tts", "1.1.1.1"))
+	require.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, []string{"POST tts"}, creator.input.Scopes)
+}
+
+func TestKeyCreate_Replay(t *testing.T) {
+	d, _, _ := newTestData(t)
+	d.Plan.PerIP = 10
+	req := newKeyRequest(t, d, "tts", "1.1.1.1")
+	var in adminapi.TrialKeyInput
+	require.NoError(t, json.NewDecoder(req.Body).Decode(&in))
+
+	resp := invoke(t, d, newSolvedRequest(t, "tts", "1.1.1.1", &in))
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	resp = invoke(t, d, newSolvedRequest(t, "tts", "1.1.1.2", &in))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestKeyCreate_Caps(t *testing.T) {
+	d, _, _ := newTestData(t)
+	assert.Equal(t, http.StatusCreated, invoke(t, d, newKeyRequest(t, d, "tts", "1.1.1.1")).Code)
+	assert.Equal(t, http.StatusTooManyRequests, invoke(t, d, newKeyRequest(t, d, "tts", "1.1.1.1")).Code)
+	// same IPv6 /64 network
+	assert.Equal(t, http.StatusCreated, invoke(t, d, newKeyRequest(t, d, "tts", "[2001:db8::1]")).Code)
+	assert.Equal(t, http.StatusTooManyRequests, invoke(t, d, newKeyRequest(t, d, "tts", "[2001:db8::2]")).Code)
+	// daily cap
+	assert.Equal(t, http.StatusTooManyRequests, invoke(t, d, newKeyRequest(t, d, "tts", "1.1.1.3")).Code)
+}
+
+func TestKeyCreate_Fail(t *testing.T) {
+	d, _, _ := newTestData(t)
+	req := newSolvedRequest(t, "tts", "1.1.1.1", &adminapi.TrialKeyInput{Challenge: "a.b", Nonce: "1"})
+	assert.Equal(t, http.StatusBadRequest, invoke(t, d, req).Code)
+	req = newSolvedRequest(t, "asr", "1.1.1.1", &adminapi.TrialKeyInput{Challenge: "a.b", Nonce: "1"})
+	assert.Equal(t, http.StatusNotFound, invoke(t, d, req).Code)
+	req = newKeyRequest(t, d, "tts", "1.1.1.1")
+	req.Header.Set(echo.HeaderContentType, "text/plain")
+	assert.Equal(t, http.StatusBadRequest, invoke(t, d, req).Code)
+}
+
+func TestKeyCreate_FailCreate(t *testing.T) {
+	d, creator, users := newTestData(t)
+	d.Plan.PerIP, d.Plan.PerDay = 10, 0
+	creator.err = model.NewWrongFieldError("credits", "budget exceeded")
+	assert.Equal(t, http.StatusBadRequest, invoke(t, d, newKeyRequest(t, d, "tts", "1.1.1.1")).Code)
+	creator.err = errors.New("olia")
+	assert.Equal(t, http.StatusInternalServerError, invoke(t, d, newKeyRequest(t, d, "tts", "1.1.1.1")).Code)
+	users.err = model.ErrUnauthorized
+	assert.Equal(t, http.StatusServiceUnavailable, invoke(t, d, newKeyRequest(t, d, "tts", "1.1.1.1")).Code)
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 // func HashKey(k string) string {
@@ -19,17 +21,93 @@ func HashKeyWithHMAC(key, secret string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// HashSecret is a HMAC secret with its version, the version is saved alongside the hash
+type HashSecret struct {
+	Version int
+	Secret  string
+}
+
+// Hasher hashes keys with the current secret, legacy secrets are kept for validation of old hashes
 type Hasher struct {
-	secret string
+	// secrets, the first one is current
+	secrets []HashSecret
 }
 
+// NewHasher creates hasher with one secret of version 1
 func NewHasher(secret string) (*Hasher, error) {
-	if len(secret) < 30 {
-		return nil, fmt.Errorf("secret is too short")
+	return NewVersionedHasher([]HashSecret{{Version: 1, Secret: secret}})
+}
+
+// NewVersionedHasher creates hasher, the first secret is current, others are legacy
+func NewVersionedHasher(secrets []HashSecret) (*Hasher, error) {
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no secrets")
+	}
+	versions := make(map[int]bool, len(secrets))
+	for _, s := range secrets {
+		if len(s.Secret) < 30 {
+			return nil, fmt.Errorf("secret is too short")
+		}
+		if s.Version < 1 {
+			return nil, fmt.Errorf("wrong secret version %d", s.Version)
+		}
+		if versions[s.Version] {
+			return nil, fmt.Errorf("duplicate secret version %d", s.Version)
+		}
+		versions[s.Version] = true
 	}
-	return &Hasher{secret: secret}, nil
+	return &Hasher{secrets: secrets}, nil
 }
 
+// ParseHashSecrets parses the list '<version>:<secret>,...', the first one is current
+func ParseHashSecrets(s string) ([]HashSecret, error) {
+	var res []HashSecret
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		vStr, secret, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("wrong secret format, expected <version>:<secret>")
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(vStr))
+		if err != nil {
+			return nil, fmt.Errorf("wrong secret version '%s'", vStr)
+		}
+		res = append(res, HashSecret{Version: v, Secret: strings.TrimSpace(secret)})
+	}
+	return res, nil
+}
+
+// HashKey hashes with the current secret
 func (h *Hasher) HashKey(key string) string {
-	return HashKeyWithHMAC(key, h.secret)
+	return HashKeyWithHMAC(key, h.secrets[0].Secret)
+}
+
+// Version returns the version of the current secret
+func (h *Hasher) Version() int {
+	return h.secrets[0].Version
+}
+
+// HashKeys returns hashes by all secrets, the current one is first
+func (h *Hasher) HashKeys(key string) []string {
+	res := make([]string, 0, len(h.secrets))
+	for _, s := range h.secrets {
+		res = append(res, HashKeyWithHMAC(key, s.Secret))
+	}
+	return res
+}
+
+// NewConfigHasher creates hasher from the secrets list, see ParseHashSecrets,
+// if the list is empty the legacy single salt is used as version 1
+func NewConfigHasher(secrets, salt string) (*Hasher, error) {
+	if strings.TrimSpace(secrets) == "" {
+		return NewHasher(salt)
+	}
+	hs, err := ParseHashSecrets(secrets)
+	if err != nil {
+		return nil, err
+	}
+	return NewVersionedHasher(hs)
 }
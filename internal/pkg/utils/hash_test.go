@@ -3,6 +3,8 @@ package utils
 import (
 	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // func TestHashKey(t *testing.T) {
@@ -52,3 +54,51 @@ func TestHashWithHmac(t *testing.T) {
 	}
 
 }
+
+func TestVersionedHasher(t *testing.T) {
+	s1, s2 := strings.Repeat("a", 30), strings.Repeat("b", 30)
+	h, err := NewVersionedHasher([]HashSecret{{Version: 2, Secret: s2}, {Version: 1, Secret: s1}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, h.Version())
+	assert.Equal(t, HashKeyWithHMAC("olia", s2), h.HashKey("olia"))
+	assert.Equal(t, []string{HashKeyWithHMAC("olia", s2), HashKeyWithHMAC("olia", s1)}, h.HashKeys("olia"))
+
+	h, err = NewHasher(s1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, h.Version())
+	assert.Equal(t, HashKeyWithHMAC("olia", s1), h.HashKey("olia"))
+}
+
+func TestNewVersionedHasher_Fail(t *testing.T) {
+	s := strings.Repeat("a", 30)
+	tests := []struct {
+		name    string
+		secrets []HashSecret
+	}{
+		{name: "Empty", secrets: nil},
+		{name: "Short", secrets: []HashSecret{{Version: 1, Secret: "olia"}}},
+		{name: "Version", secrets: []HashSecret{{Version: 0, Secret: s}}},
+		{name: "Duplicate", secrets: []HashSecret{{Version: 1, Secret: s}, {Version: 1, Secret: s + "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewVersionedHasher(tt.secrets)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseHashSecrets(t *testing.T) {
+	got, err := ParseHashSecrets(" 2:secret2, 1:secret1 ,")
+	assert.NoError(t, err)
+	assert.Equal(t, []HashSecret{{Version: 2, Secret: "secret2"}, {Version: 1, Secret: "secret1"}}, got)
+
+	got, err = ParseHashSecrets("")
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = ParseHashSecrets("secret")
+	assert.Error(t, err)
+	_, err = ParseHashSecrets("v2:secret")
+	assert.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/airenas/api-doorman/internal/pkg/model"
+	"github.com/airenas/api-doorman/internal/pkg/model/permission"
 	"github.com/airenas/go-app/pkg/goapp"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
@@ -45,6 +46,16 @@ func RunWithUser(c echo.Context, execFunc func(echo.Context, *model.User) error)
 	return execFunc(c, user)
 }
 
+// RunWithPermission runs execFunc if the user has the permission, returns 403 otherwise
+func RunWithPermission(c echo.Context, perm permission.Enum, execFunc func(echo.Context, *model.User) error) error {
+	return RunWithUser(c, func(c echo.Context, u *model.User) error {
+		if !u.HasPermission(perm) {
+			return echo.NewHTTPError(http.StatusForbidden)
+		}
+		return execFunc(c, u)
+	})
+}
+
 func getUser(c echo.Context) (*model.User, error) {
 	r := c.Request()
 	user, ok := r.Context().Value(model.CtxUser).(*model.User)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -25,8 +26,9 @@ func ExtractIP(r *http.Request) string {
 	return DefaultIPExtractor.Get(r)
 }
 
-// NewIPExtractor creates new extractor based on type
-func NewIPExtractor(ipType string) (IPExtractor, error) {
+// NewIPExtractor creates new extractor based on type,
+// trustedProxies is a comma separated CIDR list used by the trustedProxy type
+func NewIPExtractor(ipType string, trustedProxies string) (IPExtractor, error) {
 	if ipType == "" {
 		return nil, errors.New("No ip extractor type ")
 	}
@@ -36,6 +38,9 @@ func NewIPExtractor(ipType string) (IPExtractor, error) {
 	if ipType == "firstForwardFor" {
 		return &firstForwardFor{}, nil
 	}
+	if ipType == "trustedProxy" {
+		return newTrustedProxy(trustedProxies)
+	}
 	return nil, errors.Errorf("Unknown ip extractor type '%s'", ipType)
 }
 
@@ -69,7 +74,33 @@ func getIP(r *http.Request, f func(string) string) string {
 }
 
 func trimPort(s string) string {
-	return strings.TrimSpace(strings.Split(s, ":")[0])
+	if ip, ok := ParseHostIP(s); ok {
+		return ip.String()
+	}
+	return strings.TrimSpace(s)
+}
+
+// ParseHostIP parses IP from the forms: IPv4, IPv4:port, IPv6, [IPv6], [IPv6]:port, quoted values are accepted.
+// IPv4-mapped IPv6 addresses are returned as IPv4 and zones are dropped, so the same client gets the same IP
+func ParseHostIP(s string) (netip.Addr, bool) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if s == "" {
+		return netip.Addr{}, false
+	}
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return netip.Addr{}, false
+		}
+		s = s[1:end]
+	} else if strings.Count(s, ":") == 1 {
+		s = s[:strings.Index(s, ":")]
+	}
+	res, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return res.Unmap().WithZone(""), true
 }
 
 func getFirst(s string) string {
@@ -100,10 +131,11 @@ func ValidateIPInWhiteList(ips, ip string) (bool, error) {
 	if strings.TrimSpace(ips) == "" {
 		return true, nil
 	}
-	ipParsed := net.ParseIP(ip)
-	if ipParsed == nil {
+	addr, ok := ParseHostIP(ip)
+	if !ok {
 		return false, fmt.Errorf("wrong IP: %s", ip)
 	}
+	ipParsed := net.IP(addr.AsSlice())
 	for _, s := range strings.Split(ips, ",") {
 		s = strings.TrimSpace(s)
 		if s != "" {
@@ -118,3 +150,35 @@ func ValidateIPInWhiteList(ips, ip string) (bool, error) {
 	}
 	return false, nil
 }
+
+// IPKey returns the anonymous quota key of the IP: the IP itself, or its network
+// if the prefix length for the IP version is shorter than the address. Zero length means the full address
+func IPKey(ip string, v4Bits, v6Bits int) string {
+	addr, ok := ParseHostIP(ip)
+	if !ok {
+		return ip
+	}
+	bits := v6Bits
+	if addr.Is4() {
+		bits = v4Bits
+	}
+	if bits <= 0 || bits >= addr.BitLen() {
+		return addr.String()
+	}
+	p, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return p.String()
+}
+
+// ValidateIPKeyPrefixes checks the prefix lengths for IPKey
+func ValidateIPKeyPrefixes(v4Bits, v6Bits int) error {
+	if v4Bits < 0 || v4Bits > 32 {
+		return errors.Errorf("wrong IPv4 prefix length %d", v4Bits)
+	}
+	if v6Bits < 0 || v6Bits > 128 {
+		return errors.Errorf("wrong IPv6 prefix length %d", v6Bits)
+	}
+	return nil
+}
@@ -34,20 +34,95 @@ func TestIP_NoPort(t *testing.T) {
 }
 
 func TestNewExtractor(t *testing.T) {
-	e, err := NewIPExtractor("lastForwardFor")
+	e, err := NewIPExtractor("lastForwardFor", "")
 	assert.NotNil(t, e)
 	assert.Nil(t, err)
-	e, err = NewIPExtractor("firstForwardFor")
+	e, err = NewIPExtractor("firstForwardFor", "")
 	assert.NotNil(t, e)
 	assert.Nil(t, err)
 }
 
+func TestIP_IPv6(t *testing.T) {
+	DefaultIPExtractor = &firstForwardFor{}
+	req := httptest.NewRequest("GET", "/olia", nil)
+	req.RemoteAddr = "[2001:db8::1]:8000"
+	assert.Equal(t, "2001:db8::1", ExtractIP(req))
+	req.Header.Add("X-FORWARDED-FOR", "2001:DB8:0::2, 92.1.1.3")
+	assert.Equal(t, "2001:db8::2", ExtractIP(req))
+}
+
+func TestParseHostIP(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{in: "1.1.1.1", want: "1.1.1.1", ok: true},
+		{in: " 1.1.1.1:80 ", want: "1.1.1.1", ok: true},
+		{in: "2001:db8::1", want: "2001:db8::1", ok: true},
+		{in: "[2001:db8::1]", want: "2001:db8::1", ok: true},
+		{in: `"[2001:db8::1]:4711"`, want: "2001:db8::1", ok: true},
+		{in: "::ffff:1.2.3.4", want: "1.2.3.4", ok: true},
+		{in: "fe80::1%eth0", want: "fe80::1", ok: true},
+		{in: "unknown", ok: false},
+		{in: "_hidden", ok: false},
+		{in: "[2001:db8::1", ok: false},
+		{in: "", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := ParseHostIP(tt.in)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.want, got.String())
+			}
+		})
+	}
+}
+
+func TestTrustedProxy(t *testing.T) {
+	e, err := NewIPExtractor("trustedProxy", "10.0.0.0/8, ::1/128")
+	assert.Nil(t, err)
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{name: "no headers", remote: "10.0.0.1:80", want: "10.0.0.1"},
+		{name: "untrusted remote", remote: "1.1.1.1:80", headers: map[string]string{"X-Forwarded-For": "2.2.2.2"}, want: "1.1.1.1"},
+		{name: "xff", remote: "10.0.0.1:80", headers: map[string]string{"X-Forwarded-For": "3.3.3.3, 2.2.2.2, 10.0.0.2"}, want: "2.2.2.2"},
+		{name: "xff all trusted", remote: "10.0.0.1:80", headers: map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "ipv6 remote", remote: "[::1]:80", headers: map[string]string{"X-Forwarded-For": "2001:db8::5"}, want: "2001:db8::5"},
+		{name: "forwarded", remote: "10.0.0.1:80", headers: map[string]string{
+			"Forwarded":       `for=3.3.3.3, for="[2001:db8:cafe::17]:4711";proto=https, For=10.0.0.5;by=10.0.0.1`,
+			"X-Forwarded-For": "4.4.4.4"}, want: "2001:db8:cafe::17"},
+		{name: "forwarded unknown", remote: "10.0.0.1:80", headers: map[string]string{"Forwarded": "for=3.3.3.3, for=unknown"}, want: "10.0.0.1"},
+		{name: "real ip", remote: "10.0.0.1:80", headers: map[string]string{"X-Real-IP": "5.5.5.5"}, want: "5.5.5.5"},
+		{name: "real ip untrusted", remote: "1.1.1.1:80", headers: map[string]string{"X-Real-IP": "5.5.5.5"}, want: "1.1.1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/olia", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, e.Get(req))
+		})
+	}
+}
+
 func TestNewExtractor_Fail(t *testing.T) {
-	e, err := NewIPExtractor("")
+	e, err := NewIPExtractor("", "")
 	assert.Nil(t, e)
 	assert.NotNil(t, err)
 
-	e, err = NewIPExtractor("olia")
+	e, err = NewIPExtractor("olia", "")
+	assert.Nil(t, e)
+	assert.NotNil(t, err)
+
+	e, err = NewIPExtractor("trustedProxy", "10.0.0.1")
 	assert.Nil(t, e)
 	assert.NotNil(t, err)
 }
@@ -110,6 +185,12 @@ func TestValidateIPInWhiteList_Valid(t *testing.T) {
 	assert.True(t, v)
 	v, _ = ValidateIPInWhiteList("1.1.1.1/32,1.1.1.1/16,255.1.1.1/8", "255.254.55.222")
 	assert.True(t, v)
+	v, _ = ValidateIPInWhiteList("1.1.1.1/32", "::ffff:1.1.1.1")
+	assert.True(t, v)
+	v, _ = ValidateIPInWhiteList("2001:db8::/32", "[2001:db8::1]")
+	assert.True(t, v)
+	v, _ = ValidateIPInWhiteList("2001:db8::/32", "2001:db9::1")
+	assert.False(t, v)
 }
 
 func TestValidateIPInWhiteList_Errors(t *testing.T) {
@@ -125,3 +206,21 @@ func TestValidateIPInWhiteList_Errors(t *testing.T) {
 	_, err = ValidateIPInWhiteList("1.1.1.1/32,11.1.1.1//", "1.1.1.2")
 	assert.NotNil(t, err)
 }
+
+func TestIPKey(t *testing.T) {
+	assert.Equal(t, "1.2.3.4", IPKey("1.2.3.4", 0, 0))
+	assert.Equal(t, "1.2.3.4", IPKey("1.2.3.4", 32, 128))
+	assert.Equal(t, "1.2.3.0/24", IPKey("1.2.3.4", 24, 64))
+	assert.Equal(t, "1.2.0.0/16", IPKey("::ffff:1.2.3.4", 16, 64))
+	assert.Equal(t, "2001:db8:1:2::/64", IPKey("2001:db8:1:2:3:4:5:6", 24, 64))
+	assert.Equal(t, "2001:db8::1", IPKey("2001:db8::1", 24, 0))
+	assert.Equal(t, "olia", IPKey("olia", 24, 64))
+}
+
+func TestValidateIPKeyPrefixes(t *testing.T) {
+	assert.Nil(t, ValidateIPKeyPrefixes(0, 0))
+	assert.Nil(t, ValidateIPKeyPrefixes(24, 64))
+	assert.NotNil(t, ValidateIPKeyPrefixes(33, 64))
+	assert.NotNil(t, ValidateIPKeyPrefixes(-1, 64))
+	assert.NotNil(t, ValidateIPKeyPrefixes(24, 129))
+}
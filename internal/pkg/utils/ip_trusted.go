@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+const (
+	forwardedHeader = "Forwarded"
+	realIPHeader    = "X-Real-IP"
+)
+
+// trustedProxy takes the client IP from the forwarding chain walking it from the right
+// and skipping the trusted proxies. Headers are ignored if the request does not come from a trusted proxy
+type trustedProxy struct {
+	trusted []netip.Prefix
+}
+
+func newTrustedProxy(cidrs string) (*trustedProxy, error) {
+	res := &trustedProxy{}
+	for _, s := range strings.Split(cidrs, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("wrong trusted proxy CIDR %s: %w", s, err)
+		}
+		res.trusted = append(res.trusted, p.Masked())
+	}
+	return res, nil
+}
+
+func (e *trustedProxy) Get(r *http.Request) string {
+	remote, ok := ParseHostIP(r.RemoteAddr)
+	if !ok {
+		return trimPort(r.RemoteAddr)
+	}
+	res := remote
+	chain := forwardChain(r)
+	slices.Reverse(chain)
+	for _, hop := range chain {
+		if !e.isTrusted(res) {
+			break
+		}
+		ip, ok := ParseHostIP(hop)
+		if !ok { // unknown or obfuscated node, nothing behind it can be trusted
+			break
+		}
+		res = ip
+	}
+	return res.String()
+}
+
+func (e *trustedProxy) isTrusted(ip netip.Addr) bool {
+	for _, p := range e.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardChain returns the client addresses from the left to the right, the Forwarded header is preferred
+func forwardChain(r *http.Request) []string {
+	if values := r.Header.Values(forwardedHeader); len(values) > 0 {
+		return parseForwarded(values)
+	}
+	if values := r.Header.Values(ipHeader); len(values) > 0 {
+		var res []string
+		for _, v := range values {
+			res = append(res, strings.Split(v, ",")...)
+		}
+		return res
+	}
+	if v := r.Header.Get(realIPHeader); v != "" {
+		return []string{v}
+	}
+	return nil
+}
+
+// parseForwarded extracts the for= values of RFC 7239 elements, an element without for= gives an empty value
+func parseForwarded(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, el := range strings.Split(v, ",") {
+			value := ""
+			for _, pair := range strings.Split(el, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(k), "for") {
+					value = val
+				}
+			}
+			res = append(res, value)
+		}
+	}
+	return res
+}
@@ -0,0 +1,159 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path selects values of decoded JSON (map[string]interface{}, []interface{}).
+// Syntax: [$]<step>..., a step is '.name', "['name']", '[index]' or '[*]' for all array items,
+// the leading '.' of the first name may be omitted, e.g. 'text', '$.input.text', 'segments[*].text'
+type Path struct {
+	str      string
+	steps    []step
+	wildcard bool
+}
+
+type step struct {
+	name  string
+	index int
+	kind  stepKind
+}
+
+type stepKind int
+
+const (
+	stepName stepKind = iota
+	stepIndex
+	stepAll
+)
+
+// Parse parses the path
+func Parse(s string) (*Path, error) {
+	res := &Path{str: s}
+	rest := strings.TrimSpace(s)
+	rest = strings.TrimPrefix(rest, "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+	for rest != "" {
+		var st step
+		var err error
+		switch rest[0] {
+		case '.':
+			st, rest, err = parseName(rest[1:])
+		case '[':
+			st, rest, err = parseBracket(rest[1:])
+		default:
+			err = fmt.Errorf("unexpected '%c'", rest[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("wrong path '%s': %w", s, err)
+		}
+		res.wildcard = res.wildcard || st.kind == stepAll
+		res.steps = append(res.steps, st)
+	}
+	if len(res.steps) == 0 {
+		return nil, fmt.Errorf("wrong path '%s': no field", s)
+	}
+	return res, nil
+}
+
+func parseName(s string) (step, string, error) {
+	i := strings.IndexAny(s, ".[")
+	if i < 0 {
+		i = len(s)
+	}
+	name := s[:i]
+	if name == "" {
+		return step{}, "", fmt.Errorf("empty name")
+	}
+	if name == "*" {
+		return step{kind: stepAll}, s[i:], nil
+	}
+	return step{name: name}, s[i:], nil
+}
+
+func parseBracket(s string) (step, string, error) {
+	if s != "" && (s[0] == '\'' || s[0] == '"') {
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 || len(s) < end+3 || s[end+2] != ']' {
+			return step{}, "", fmt.Errorf("no closing quote")
+		}
+		return step{name: s[1 : end+1]}, s[end+3:], nil
+	}
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return step{}, "", fmt.Errorf("no ']'")
+	}
+	v := strings.TrimSpace(s[:end])
+	if v == "*" {
+		return step{kind: stepAll}, s[end+1:], nil
+	}
+	index, err := strconv.Atoi(v)
+	if err != nil || index < 0 {
+		return step{}, "", fmt.Errorf("wrong index '%s'", v)
+	}
+	return step{index: index, kind: stepIndex}, s[end+1:], nil
+}
+
+// Find returns the selected values, every step must exist in the data, an empty array selects nothing
+func (p *Path) Find(data interface{}) ([]interface{}, error) {
+	current := []interface{}{data}
+	at := "$"
+	for _, st := range p.steps {
+		var next []interface{}
+		for _, v := range current {
+			switch st.kind {
+			case stepName:
+				m, ok := v.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s is not an object", at)
+				}
+				f, ok := m[st.name]
+				if !ok || f == nil {
+					return nil, fmt.Errorf("no field %s.%s", at, st.name)
+				}
+				next = append(next, f)
+			case stepIndex:
+				a, ok := v.([]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s is not an array", at)
+				}
+				if st.index >= len(a) {
+					return nil, fmt.Errorf("no item %s[%d]", at, st.index)
+				}
+				next = append(next, a[st.index])
+			case stepAll:
+				a, ok := v.([]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s is not an array", at)
+				}
+				next = append(next, a...)
+			}
+		}
+		at += st.String()
+		current = next
+	}
+	return current, nil
+}
+
+// Wildcard returns true if the path may select several values
+func (p *Path) Wildcard() bool {
+	return p.wildcard
+}
+
+func (p *Path) String() string {
+	return p.str
+}
+
+func (s step) String() string {
+	switch s.kind {
+	case stepIndex:
+		return "[" + strconv.Itoa(s.index) + "]"
+	case stepAll:
+		return "[*]"
+	}
+	return "." + s.name
+}
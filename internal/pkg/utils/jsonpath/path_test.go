@@ -0,0 +1,93 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		wantWildcard bool
+		wantErr      bool
+	}{
+		{name: "field", path: "text"},
+		{name: "root", path: "$.text"},
+		{name: "nested", path: "input.text"},
+		{name: "index", path: "items[0].text"},
+		{name: "all", path: "items[*].text", wantWildcard: true},
+		{name: "all dot", path: "items.*.text", wantWildcard: true},
+		{name: "quoted", path: "['a.b'][\"c\"]"},
+		{name: "root array", path: "$[*]", wantWildcard: true},
+		{name: "empty", path: "", wantErr: true},
+		{name: "only root", path: "$", wantErr: true},
+		{name: "empty name", path: "a..b", wantErr: true},
+		{name: "trailing dot", path: "a.", wantErr: true},
+		{name: "no bracket", path: "a[0", wantErr: true},
+		{name: "wrong index", path: "a[x]", wantErr: true},
+		{name: "negative index", path: "a[-1]", wantErr: true},
+		{name: "no quote", path: "['a]", wantErr: true},
+		{name: "no quoted bracket", path: "['a'", wantErr: true},
+		{name: "after bracket", path: "a[0]b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.path)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, tt.wantWildcard, got.Wildcard())
+			assert.Equal(t, tt.path, got.String())
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	const data = `{"text":"a","input":{"text":"b"},"items":[{"text":"c"},{"text":"d","n":1}],"empty":[],
+		"a.b":{"c":"e"},"nested":[[1,2],[3]]}`
+	tests := []struct {
+		name    string
+		path    string
+		want    []interface{}
+		wantErr string
+	}{
+		{name: "field", path: "text", want: []interface{}{"a"}},
+		{name: "root", path: "$.text", want: []interface{}{"a"}},
+		{name: "nested", path: "input.text", want: []interface{}{"b"}},
+		{name: "index", path: "items[1].text", want: []interface{}{"d"}},
+		{name: "all", path: "items[*].text", want: []interface{}{"c", "d"}},
+		{name: "all dot", path: "items.*.text", want: []interface{}{"c", "d"}},
+		{name: "array", path: "nested", want: []interface{}{[]interface{}{[]interface{}{1.0, 2.0}, []interface{}{3.0}}}},
+		{name: "all nested", path: "nested[*][*]", want: []interface{}{1.0, 2.0, 3.0}},
+		{name: "empty", path: "empty[*].text", want: nil},
+		{name: "quoted", path: "['a.b'].c", want: []interface{}{"e"}},
+		{name: "missing", path: "input.txt", wantErr: "no field $.input.txt"},
+		{name: "missing in item", path: "items[*].n", wantErr: "no field $.items[*].n"},
+		{name: "not object", path: "text.a", wantErr: "$.text is not an object"},
+		{name: "not array", path: "input[0]", wantErr: "$.input is not an array"},
+		{name: "not array all", path: "input[*]", wantErr: "$.input is not an array"},
+		{name: "no item", path: "items[2]", wantErr: "no item $.items[2]"},
+	}
+	var d interface{}
+	require.Nil(t, json.Unmarshal([]byte(data), &d))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.path)
+			require.Nil(t, err)
+			got, err := p.Find(d)
+			if tt.wantErr != "" {
+				require.NotNil(t, err)
+				assert.Equal(t, tt.wantErr, err.Error())
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type origin struct {
+	scheme, host, port string
+}
+
+// ValidateOriginPatterns checks the allowed origin patterns of the form <scheme>://<host>[:<port>],
+// the host may start with '*.' to allow subdomains, the port may be '*' to allow any port
+func ValidateOriginPatterns(patterns []string) error {
+	for _, p := range patterns {
+		o, ok := parseOrigin(p)
+		if !ok {
+			return errors.Errorf("wrong origin pattern '%s'", p)
+		}
+		host := strings.TrimPrefix(o.host, "*.")
+		if host == "" || strings.Contains(host, "*") {
+			return errors.Errorf("wrong origin pattern '%s', only a '*.' host prefix is allowed", p)
+		}
+		if strings.Contains(o.scheme, "*") || (strings.Contains(o.port, "*") && o.port != "*") {
+			return errors.Errorf("wrong origin pattern '%s'", p)
+		}
+	}
+	return nil
+}
+
+// MatchOrigin returns true if the origin matches any of the patterns
+func MatchOrigin(patterns []string, originStr string) bool {
+	o, ok := parseOrigin(originStr)
+	if !ok {
+		return false
+	}
+	for _, s := range patterns {
+		if p, ok := parseOrigin(s); ok && p.match(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestOrigin returns the Origin header, or the origin of the Referer if there is no Origin
+func RequestOrigin(r *http.Request) string {
+	if res := strings.TrimSpace(r.Header.Get("Origin")); res != "" && res != "null" {
+		return res
+	}
+	ref, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || ref.Scheme == "" || ref.Host == "" {
+		return ""
+	}
+	return ref.Scheme + "://" + ref.Host
+}
+
+func (p *origin) match(o *origin) bool {
+	if p.scheme != o.scheme || (p.port != "*" && p.port != o.port) {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(p.host, "*"); ok {
+		return len(o.host) > len(suffix) && strings.HasSuffix(o.host, suffix)
+	}
+	return p.host == o.host
+}
+
+func parseOrigin(s string) (*origin, bool) {
+	scheme, rest, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "://")
+	if !ok || scheme == "" || rest == "" || strings.ContainsAny(rest, "/?#@ ") {
+		return nil, false
+	}
+	res := &origin{scheme: scheme, host: rest}
+	if i := strings.LastIndexByte(rest, ':'); i > strings.LastIndexByte(rest, ']') {
+		res.host, res.port = rest[:i], rest[i+1:]
+		if res.port == "" {
+			return nil, false
+		}
+	}
+	if (scheme == "https" && res.port == "443") || (scheme == "http" && res.port == "80") {
+		res.port = ""
+	}
+	return res, res.host != ""
+}
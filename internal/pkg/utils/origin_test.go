@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOriginPatterns(t *testing.T) {
+	tests := []struct {
+		in      []string
+		wantErr bool
+	}{
+		{in: nil, wantErr: false},
+		{in: []string{"https://example.com", "https://*.example.com", "http://localhost:*", "http://[::1]:3000"}, wantErr: false},
+		{in: []string{"*"}, wantErr: true},
+		{in: []string{"https://*"}, wantErr: true},
+		{in: []string{"https://a.*.com"}, wantErr: true},
+		{in: []string{"example.com"}, wantErr: true},
+		{in: []string{"https://example.com/path"}, wantErr: true},
+		{in: []string{"https://example.com:"}, wantErr: true},
+		{in: []string{"https://example.com:8*"}, wantErr: true},
+		{in: []string{"*://example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			err := ValidateOriginPatterns(tt.in)
+			assert.Equal(t, tt.wantErr, err != nil, tt.in)
+		})
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	patterns := []string{"https://example.com", "https://*.app.com", "http://localhost:*"}
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: "https://example.com", want: true},
+		{in: "HTTPS://Example.com", want: true},
+		{in: "https://example.com:443", want: true},
+		{in: "https://example.com:8443", want: false},
+		{in: "http://example.com", want: false},
+		{in: "https://sub.example.com", want: false},
+		{in: "https://a.app.com", want: true},
+		{in: "https://a.b.app.com", want: true},
+		{in: "https://app.com", want: false},
+		{in: "https://evilapp.com", want: false},
+		{in: "http://localhost:3000", want: true},
+		{in: "http://localhost", want: true},
+		{in: "null", want: false},
+		{in: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.want, MatchOrigin(patterns, tt.in))
+		})
+	}
+}
+
+func TestRequestOrigin(t *testing.T) {
+	req := httptest.NewRequest("GET", "/olia", nil)
+	assert.Equal(t, "", RequestOrigin(req))
+	req.Header.Set("Referer", "https://example.com:8080/page?x=1")
+	assert.Equal(t, "https://example.com:8080", RequestOrigin(req))
+	req.Header.Set("Origin", "null")
+	assert.Equal(t, "https://example.com:8080", RequestOrigin(req))
+	req.Header.Set("Origin", "https://other.com")
+	assert.Equal(t, "https://other.com", RequestOrigin(req))
+}
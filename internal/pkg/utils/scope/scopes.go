@@ -0,0 +1,104 @@
+package scope
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Scope restricts a key to a route or a path and optionally to HTTP methods.
+// Format: [<METHOD>[,<METHOD>] ]<target>, the target is a route name or a path pattern starting with '/'.
+// A path pattern uses path.Match syntax, a pattern ending with '/**' matches the path and everything below it
+type Scope struct {
+	Methods []string
+	Route   string
+	Path    string
+}
+
+// Parse parses the scope
+func Parse(s string) (*Scope, error) {
+	fields := strings.Fields(s)
+	res := &Scope{}
+	switch len(fields) {
+	case 1:
+	case 2:
+		for _, m := range strings.Split(fields[0], ",") {
+			m = strings.ToUpper(strings.TrimSpace(m))
+			if !validMethod(m) {
+				return nil, fmt.Errorf("wrong method '%s' in scope '%s'", m, s)
+			}
+			res.Methods = append(res.Methods, m)
+		}
+	default:
+		return nil, fmt.Errorf("wrong scope '%s', expected '[METHODS ]<route or /path>'", s)
+	}
+	target := fields[len(fields)-1]
+	if !strings.HasPrefix(target, "/") {
+		res.Route = strings.ToLower(target)
+		return res, nil
+	}
+	if _, err := path.Match(strings.TrimSuffix(target, "/**"), ""); err != nil {
+		return nil, fmt.Errorf("wrong path pattern in scope '%s': %w", s, err)
+	}
+	res.Path = target
+	return res, nil
+}
+
+// Validate checks the scopes
+func Validate(scopes []string) error {
+	for _, s := range scopes {
+		if _, err := Parse(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Allowed returns true if there are no scopes or any of them matches the request
+func Allowed(scopes []string, route, method, urlPath string) (bool, error) {
+	if len(scopes) == 0 {
+		return true, nil
+	}
+	for _, s := range scopes {
+		sc, err := Parse(s)
+		if err != nil {
+			return false, err
+		}
+		if sc.Match(route, method, urlPath) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Match returns true if the scope allows the request
+func (s *Scope) Match(route, method, urlPath string) bool {
+	if len(s.Methods) > 0 && !slices.Contains(s.Methods, strings.ToUpper(method)) {
+		return false
+	}
+	if s.Route != "" {
+		return s.Route == strings.ToLower(route)
+	}
+	if prefix, ok := strings.CutSuffix(s.Path, "/**"); ok {
+		// match the prefix with the same count of the path segments
+		n := strings.Count(prefix, "/")
+		parts := strings.SplitN(urlPath, "/", n+2)
+		if len(parts) < n+1 {
+			return false
+		}
+		ok, _ := path.Match(prefix, strings.Join(parts[:n+1], "/"))
+		return ok
+	}
+	ok, _ := path.Match(s.Path, urlPath)
+	return ok
+}
+
+func validMethod(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
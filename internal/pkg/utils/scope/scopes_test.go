@@ -0,0 +1,64 @@
+package scope
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    *Scope
+		wantErr bool
+	}{
+		{name: "route", in: "TTS", want: &Scope{Route: "tts"}},
+		{name: "path", in: "/tts/*", want: &Scope{Path: "/tts/*"}},
+		{name: "methods", in: "get,post /tts/**", want: &Scope{Methods: []string{"GET", "POST"}, Path: "/tts/**"}},
+		{name: "route methods", in: "POST tts", want: &Scope{Methods: []string{"POST"}, Route: "tts"}},
+		{name: "empty", in: "", wantErr: true},
+		{name: "too many", in: "POST tts olia", wantErr: true},
+		{name: "method", in: "OLIA tts", wantErr: true},
+		{name: "pattern", in: "/tts/[", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		route  string
+		method string
+		path   string
+		want   bool
+	}{
+		{name: "no scopes", scopes: nil, route: "tts", method: "POST", path: "/tts", want: true},
+		{name: "route", scopes: []string{"tts"}, route: "tts", method: "POST", path: "/any", want: true},
+		{name: "other route", scopes: []string{"tts"}, route: "clone", method: "POST", path: "/any", want: false},
+		{name: "method", scopes: []string{"GET tts"}, route: "tts", method: "POST", path: "/any", want: false},
+		{name: "one of", scopes: []string{"GET tts", "POST /clone"}, route: "clone", method: "post", path: "/clone", want: true},
+		{name: "path", scopes: []string{"/tts/*"}, route: "tts", method: "POST", path: "/tts/synth", want: true},
+		{name: "path deeper", scopes: []string{"/tts/*"}, route: "tts", method: "POST", path: "/tts/synth/a", want: false},
+		{name: "path below", scopes: []string{"/tts/**"}, route: "tts", method: "POST", path: "/tts/synth/a", want: true},
+		{name: "path self", scopes: []string{"/tts/**"}, route: "tts", method: "POST", path: "/tts", want: true},
+		{name: "path other", scopes: []string{"/tts/**"}, route: "tts", method: "POST", path: "/ttsx/a", want: false},
+		{name: "path wildcard below", scopes: []string{"/*/synth/**"}, route: "tts", method: "POST", path: "/v1/synth/a/b", want: true},
+		{name: "path wildcard other", scopes: []string{"/*/synth/**"}, route: "tts", method: "POST", path: "/v1/clone/a", want: false},
+		{name: "all", scopes: []string{"GET /**"}, route: "tts", method: "GET", path: "/a/b", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Allowed(tt.scopes, tt.route, tt.method, tt.path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,503 @@
+package tag
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Condition validates a tag value.
+//
+// Grammar of the condition, keywords are case insensitive:
+//
+//	condition = and { "or" and }
+//	and       = unary { "and" unary }
+//	unary     = "not" unary | "each" unary | "(" condition ")" | check
+//	check     = "in[" list "]"           value is one of the list
+//	          | "prefix[" list "]"       value starts with any of the list
+//	          | "regex[" regexp "]"      whole value matches the RE2 expression
+//	          | "between[" num "," num "]" value is a number in the range, bounds included
+//	list      = item { "," item }        items are trimmed, they can't contain ','
+//
+// "each" splits a list valued tag by ',' and checks every item, e.g. "each in[mp3,wav]" allows "mp3,wav".
+// Brackets inside the check arguments must be balanced, a regex may escape them by '\'.
+// Examples: "in[a,b] or prefix[x-]", "not in[admin]", "between[0.5,2]", "each (in[a,b] or regex[c\d+])"
+type Condition interface {
+	Validate(value string) error
+	String() string
+}
+
+// ParseCondition parses the condition
+func ParseCondition(s string) (Condition, error) {
+	p := &condParser{in: s}
+	res, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("wrong condition '%s': %w", s, err)
+	}
+	if t := p.next(); t.kind != tokEnd {
+		return nil, fmt.Errorf("wrong condition '%s': unexpected '%s' at %d", s, t.text, t.pos)
+	}
+	return res, nil
+}
+
+// ValidateCondition checks the condition syntax, empty condition is valid
+func ValidateCondition(s string) error {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	_, err := ParseCondition(s)
+	return err
+}
+
+type tokenKind int
+
+const (
+	tokEnd tokenKind = iota
+	tokOpen
+	tokClose
+	tokWord
+	tokCheck
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	arg  string
+	pos  int
+}
+
+type condParser struct {
+	in     string
+	pos    int
+	peeked *token
+}
+
+func (p *condParser) peek() token {
+	if p.peeked == nil {
+		t := p.scan()
+		p.peeked = &t
+	}
+	return *p.peeked
+}
+
+func (p *condParser) next() token {
+	res := p.peek()
+	p.peeked = nil
+	return res
+}
+
+func (p *condParser) scan() token {
+	for p.pos < len(p.in) && (p.in[p.pos] == ' ' || p.in[p.pos] == '\t') {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.in) {
+		return token{kind: tokEnd, pos: start}
+	}
+	switch p.in[p.pos] {
+	case '(':
+		p.pos++
+		return token{kind: tokOpen, text: "(", pos: start}
+	case ')':
+		p.pos++
+		return token{kind: tokClose, text: ")", pos: start}
+	}
+	for p.pos < len(p.in) && isLetter(p.in[p.pos]) {
+		p.pos++
+	}
+	word := strings.ToLower(p.in[start:p.pos])
+	if word == "" {
+		p.pos++
+		return token{kind: tokWord, text: p.in[start:p.pos], pos: start}
+	}
+	if p.pos >= len(p.in) || p.in[p.pos] != '[' {
+		return token{kind: tokWord, text: word, pos: start}
+	}
+	depth := 0
+	for i := p.pos; i < len(p.in); i++ {
+		switch p.in[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				p.pos = i + 1
+				return token{kind: tokCheck, text: p.in[start:p.pos], arg: p.in[start+len(word)+1 : i], pos: start}
+			}
+		}
+	}
+	p.pos = len(p.in)
+	return token{kind: tokCheck, text: p.in[start:], pos: start}
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *condParser) parseOr() (Condition, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	res := &orCond{items: []Condition{first}}
+	for p.peek().kind == tokWord && p.peek().text == "or" {
+		p.next()
+		c, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		res.items = append(res.items, c)
+	}
+	if len(res.items) == 1 {
+		return first, nil
+	}
+	return res, nil
+}
+
+func (p *condParser) parseAnd() (Condition, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	res := &andCond{items: []Condition{first}}
+	for p.peek().kind == tokWord && p.peek().text == "and" {
+		p.next()
+		c, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		res.items = append(res.items, c)
+	}
+	if len(res.items) == 1 {
+		return first, nil
+	}
+	return res, nil
+}
+
+func (p *condParser) parseUnary() (Condition, error) {
+	t := p.next()
+	switch t.kind {
+	case tokEnd:
+		return nil, fmt.Errorf("unexpected end")
+	case tokOpen:
+		res, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokClose {
+			return nil, fmt.Errorf("no ')' at %d", c.pos)
+		}
+		return &groupCond{item: res}, nil
+	case tokWord:
+		switch t.text {
+		case "not":
+			res, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &notCond{item: res}, nil
+		case "each":
+			res, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &eachCond{item: res}, nil
+		}
+	case tokCheck:
+		return parseCheck(t)
+	}
+	return nil, fmt.Errorf("unexpected '%s' at %d", t.text, t.pos)
+}
+
+func parseCheck(t token) (Condition, error) {
+	if !strings.HasSuffix(t.text, "]") {
+		return nil, fmt.Errorf("no ']' for '%s'", t.text)
+	}
+	name := strings.ToLower(t.text[:strings.IndexByte(t.text, '[')])
+	switch name {
+	case "in", "prefix":
+		items, err := parseList(t.arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.text, err)
+		}
+		if name == "in" {
+			return &inCond{text: t.text, items: items}, nil
+		}
+		return &prefixCond{text: t.text, items: items}, nil
+	case "regex":
+		re, err := regexp.Compile("^(?:" + t.arg + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.text, err)
+		}
+		return &regexCond{text: t.text, re: re}, nil
+	case "between":
+		parts := strings.Split(t.arg, ",")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("wrong between condition: %s", t.arg)
+		}
+		from, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("wrong from value: %s: %w", parts[0], err)
+		}
+		to, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("wrong to value: %s: %w", parts[1], err)
+		}
+		if from > to {
+			return nil, fmt.Errorf("wrong range: %s", t.arg)
+		}
+		return &betweenCond{text: t.text, from: from, to: to}, nil
+	}
+	return nil, fmt.Errorf("unknown check '%s'", name)
+}
+
+func parseList(s string) ([]string, error) {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return nil, fmt.Errorf("empty item")
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+type inCond struct {
+	text  string
+	items []string
+}
+
+func (c *inCond) Validate(value string) error {
+	for _, v := range c.items {
+		if v == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("value '%s' not in [%s]", value, strings.Join(c.items, ","))
+}
+
+func (c *inCond) String() string { return c.text }
+
+type prefixCond struct {
+	text  string
+	items []string
+}
+
+func (c *prefixCond) Validate(value string) error {
+	for _, v := range c.items {
+		if strings.HasPrefix(value, v) {
+			return nil
+		}
+	}
+	return fmt.Errorf("value '%s' has no prefix [%s]", value, strings.Join(c.items, ","))
+}
+
+func (c *prefixCond) String() string { return c.text }
+
+type regexCond struct {
+	text string
+	re   *regexp.Regexp
+}
+
+func (c *regexCond) Validate(value string) error {
+	if !c.re.MatchString(value) {
+		return fmt.Errorf("value '%s' does not match %s", value, c.text)
+	}
+	return nil
+}
+
+func (c *regexCond) String() string { return c.text }
+
+type betweenCond struct {
+	text     string
+	from, to float64
+}
+
+func (c *betweenCond) Validate(value string) error {
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fmt.Errorf("wrong value: %s: %w", value, err)
+	}
+	if v < c.from || v > c.to {
+		return fmt.Errorf("value '%s' not in range [%s, %s]", value, formatFloat(c.from), formatFloat(c.to))
+	}
+	return nil
+}
+
+func (c *betweenCond) String() string { return c.text }
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+type notCond struct {
+	item Condition
+}
+
+func (c *notCond) Validate(value string) error {
+	if c.item.Validate(value) == nil {
+		return fmt.Errorf("value '%s' matches %s", value, c.item.String())
+	}
+	return nil
+}
+
+func (c *notCond) String() string { return "not " + c.item.String() }
+
+type eachCond struct {
+	item Condition
+}
+
+func (c *eachCond) Validate(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if err := c.item.Validate(strings.TrimSpace(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *eachCond) String() string { return "each " + c.item.String() }
+
+type groupCond struct {
+	item Condition
+}
+
+func (c *groupCond) Validate(value string) error { return c.item.Validate(value) }
+
+func (c *groupCond) String() string { return "(" + c.item.String() + ")" }
+
+type andCond struct {
+	items []Condition
+}
+
+func (c *andCond) Validate(value string) error {
+	for _, item := range c.items {
+		if err := item.Validate(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *andCond) String() string { return joinConditions(c.items, " and ") }
+
+type orCond struct {
+	items []Condition
+}
+
+func (c *orCond) Validate(value string) error {
+	for _, item := range c.items {
+		if item.Validate(value) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("value '%s' does not match %s", value, c.String())
+}
+
+func (c *orCond) String() string { return joinConditions(c.items, " or ") }
+
+func joinConditions(items []Condition, sep string) string {
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.String())
+	}
+	return strings.Join(res, sep)
+}
+
+// Narrows returns true if every value allowed by the condition is allowed by the parent condition,
+// an empty condition allows any value. Lists of values, ranges and prefixes inside the parent's ones
+// are recognized, other checks must be the same as the parent's, e.g. "in[a]" narrows "in[a,b] or prefix[x-]"
+func Narrows(condition, parent string) bool {
+	if strings.TrimSpace(parent) == "" {
+		return true
+	}
+	if strings.TrimSpace(condition) == "" {
+		return false
+	}
+	if strings.TrimSpace(condition) == strings.TrimSpace(parent) {
+		return true
+	}
+	c, err := ParseCondition(condition)
+	if err != nil {
+		return false
+	}
+	p, err := ParseCondition(parent)
+	if err != nil {
+		return false
+	}
+	return narrows(c, p)
+}
+
+func narrows(c, p Condition) bool {
+	c, p = ungroup(c), ungroup(p)
+	switch cv := c.(type) {
+	case *inCond:
+		for _, v := range cv.items {
+			if p.Validate(v) != nil {
+				return false
+			}
+		}
+		return true
+	case *orCond:
+		for _, item := range cv.items {
+			if !narrows(item, p) {
+				return false
+			}
+		}
+		return true
+	case *andCond:
+		for _, item := range cv.items {
+			if narrows(item, p) {
+				return true
+			}
+		}
+	}
+	switch pv := p.(type) {
+	case *orCond:
+		for _, item := range pv.items {
+			if narrows(c, item) {
+				return true
+			}
+		}
+		return false
+	case *andCond:
+		for _, item := range pv.items {
+			if !narrows(c, item) {
+				return false
+			}
+		}
+		return true
+	case *betweenCond:
+		if cv, ok := c.(*betweenCond); ok {
+			return cv.from >= pv.from && cv.to <= pv.to
+		}
+	case *prefixCond:
+		if cv, ok := c.(*prefixCond); ok {
+			for _, v := range cv.items {
+				if pv.Validate(v) != nil {
+					return false
+				}
+			}
+			return true
+		}
+	case *eachCond:
+		if cv, ok := c.(*eachCond); ok {
+			return narrows(cv.item, pv.item)
+		}
+	}
+	return c.String() == p.String()
+}
+
+func ungroup(c Condition) Condition {
+	for {
+		g, ok := c.(*groupCond)
+		if !ok {
+			return c
+		}
+		c = g.item
+	}
+}
@@ -0,0 +1,186 @@
+package tag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		cond    string
+		want    string
+		wantErr bool
+	}{
+		{name: "In", cond: "in[1,2,3]", want: "in[1,2,3]"},
+		{name: "In spaces", cond: "  in[1, 2 ,3]  ", want: "in[1, 2 ,3]"},
+		{name: "In upper", cond: "IN[a]", want: "IN[a]"},
+		{name: "Prefix", cond: "prefix[x-,y-]", want: "prefix[x-,y-]"},
+		{name: "Regex", cond: `regex[[a-z]+\d]`, want: `regex[[a-z]+\d]`},
+		{name: "Regex escaped", cond: `regex[a\]]`, want: `regex[a\]]`},
+		{name: "Between", cond: "between[1,10]", want: "between[1,10]"},
+		{name: "Between float", cond: "between[-0.5, 1e3]", want: "between[-0.5, 1e3]"},
+		{name: "Not", cond: "not in[a]", want: "not in[a]"},
+		{name: "Not not", cond: "not not in[a]", want: "not not in[a]"},
+		{name: "Each", cond: "each in[a]", want: "each in[a]"},
+		{name: "And", cond: "prefix[a] and not in[ab]", want: "prefix[a] and not in[ab]"},
+		{name: "Or", cond: "in[a] or in[b] or in[c]", want: "in[a] or in[b] or in[c]"},
+		{name: "Keywords upper", cond: "NOT in[a] AND in[b] OR in[c]", want: "not in[a] and in[b] or in[c]"},
+		{name: "Group", cond: "(in[a] or in[b]) and not in[c]", want: "(in[a] or in[b]) and not in[c]"},
+		{name: "Nested group", cond: "each ((in[a]))", want: "each ((in[a]))"},
+		{name: "Tabs", cond: "in[a]\tor\tin[b]", want: "in[a] or in[b]"},
+
+		{name: "Empty", cond: "", wantErr: true},
+		{name: "Plain", cond: "olia", wantErr: true},
+		{name: "Unknown", cond: "ops[1]", wantErr: true},
+		{name: "No bracket", cond: "in[1,2", wantErr: true},
+		{name: "Empty in", cond: "in[]", wantErr: true},
+		{name: "Empty item", cond: "in[a,,b]", wantErr: true},
+		{name: "Empty prefix", cond: "prefix[]", wantErr: true},
+		{name: "Wrong regex", cond: "regex[a(]", wantErr: true},
+		{name: "Between one", cond: "between[1]", wantErr: true},
+		{name: "Between three", cond: "between[1,2,3]", wantErr: true},
+		{name: "Between from", cond: "between[a,2]", wantErr: true},
+		{name: "Between to", cond: "between[1,b]", wantErr: true},
+		{name: "Between order", cond: "between[2,1]", wantErr: true},
+		{name: "Trailing", cond: "in[a] in[b]", wantErr: true},
+		{name: "Trailing and", cond: "in[a] and", wantErr: true},
+		{name: "Leading or", cond: "or in[a]", wantErr: true},
+		{name: "Not only", cond: "not", wantErr: true},
+		{name: "Each only", cond: "each", wantErr: true},
+		{name: "No close", cond: "(in[a]", wantErr: true},
+		{name: "No open", cond: "in[a])", wantErr: true},
+		{name: "Empty group", cond: "()", wantErr: true},
+		{name: "Symbol", cond: "!in[a]", wantErr: true},
+		{name: "Symbols", cond: "in[a] && in[b]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCondition(tt.cond)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestCondition_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cond    string
+		value   string
+		wantErr string
+	}{
+		{name: "In", cond: "in[a,b]", value: "b"},
+		{name: "In trimmed", cond: "in[ a , b ]", value: "b"},
+		{name: "In fail", cond: "in[a,b]", value: "c", wantErr: "value 'c' not in [a,b]"},
+		{name: "In case", cond: "in[a,b]", value: "A", wantErr: "not in"},
+		{name: "Prefix", cond: "prefix[x-,y-]", value: "y-1"},
+		{name: "Prefix same", cond: "prefix[x-]", value: "x-"},
+		{name: "Prefix fail", cond: "prefix[x-,y-]", value: "z-1", wantErr: "value 'z-1' has no prefix [x-,y-]"},
+		{name: "Regex", cond: `regex[v\d+]`, value: "v10"},
+		{name: "Regex whole", cond: `regex[v\d+]`, value: "av10", wantErr: `value 'av10' does not match regex[v\d+]`},
+		{name: "Regex whole end", cond: `regex[v\d+]`, value: "v10a", wantErr: "does not match"},
+		{name: "Regex alternative", cond: `regex[a|b]`, value: "b"},
+		{name: "Regex alternative whole", cond: `regex[a|b]`, value: "ab", wantErr: "does not match"},
+		{name: "Regex brackets", cond: `regex[[a-c]{2}]`, value: "ca"},
+		{name: "Regex escaped", cond: `regex[a\]]`, value: "a]"},
+		{name: "Between int", cond: "between[1,3]", value: "3"},
+		{name: "Between from", cond: "between[1,3]", value: "1"},
+		{name: "Between less", cond: "between[1,3]", value: "0", wantErr: "value '0' not in range [1, 3]"},
+		{name: "Between more", cond: "between[1,3]", value: "4", wantErr: "not in range"},
+		{name: "Between float", cond: "between[0.5,1.5]", value: "0.75"},
+		{name: "Between float value", cond: "between[1,3]", value: "2.5"},
+		{name: "Between float fail", cond: "between[0.5,1.5]", value: "1.6", wantErr: "value '1.6' not in range [0.5, 1.5]"},
+		{name: "Between negative", cond: "between[-2,-1]", value: "-1.5"},
+		{name: "Between not number", cond: "between[1,3]", value: "a", wantErr: "wrong value"},
+		{name: "Not", cond: "not in[a,b]", value: "c"},
+		{name: "Not fail", cond: "not in[a,b]", value: "a", wantErr: "value 'a' matches in[a,b]"},
+		{name: "Not not", cond: "not not in[a]", value: "a"},
+		{name: "Not prefix", cond: "not prefix[admin]", value: "administrator", wantErr: "matches prefix[admin]"},
+		{name: "And", cond: "prefix[a] and not in[ab]", value: "ac"},
+		{name: "And fail first", cond: "prefix[a] and not in[ab]", value: "b", wantErr: "has no prefix"},
+		{name: "And fail second", cond: "prefix[a] and not in[ab]", value: "ab", wantErr: "matches in[ab]"},
+		{name: "Or", cond: "in[a] or between[5,6]", value: "5.5"},
+		{name: "Or first", cond: "in[a] or between[5,6]", value: "a"},
+		{name: "Or fail", cond: "in[a] or between[5,6]", value: "7", wantErr: "value '7' does not match in[a] or between[5,6]"},
+		{name: "And before or", cond: "in[a] and in[b] or in[c]", value: "c"},
+		{name: "And before or fail", cond: "in[a] or in[b] and in[c]", value: "b", wantErr: "does not match"},
+		{name: "Group", cond: "(in[a] or in[b]) and not in[c]", value: "b"},
+		{name: "Group fail", cond: "(in[a] or in[b]) and in[a]", value: "b", wantErr: "not in [a]"},
+		{name: "Not group", cond: "not (in[a] or in[b])", value: "b", wantErr: "value 'b' matches (in[a] or in[b])"},
+		{name: "Each", cond: "each in[mp3,wav]", value: "mp3,wav"},
+		{name: "Each spaces", cond: "each in[mp3,wav]", value: "mp3, wav"},
+		{name: "Each one", cond: "each in[mp3,wav]", value: "wav"},
+		{name: "Each fail", cond: "each in[mp3,wav]", value: "mp3,flac", wantErr: "value 'flac' not in [mp3,wav]"},
+		{name: "Each between", cond: "each between[1,10]", value: "1,5,10"},
+		{name: "Each group", cond: "each (in[a] or prefix[x-])", value: "a,x-1,x-2"},
+		{name: "Each group fail", cond: "each (in[a] or prefix[x-])", value: "a,b", wantErr: "value 'b' does not match"},
+		{name: "Not each", cond: "not each in[a,b]", value: "a,c"},
+		{name: "Not each fail", cond: "not each in[a,b]", value: "a,b", wantErr: "matches each in[a,b]"},
+		{name: "No each list", cond: "in[a,b]", value: "a,b", wantErr: "not in"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCondition(tt.cond)
+			require.Nil(t, err)
+			err = c.Validate(tt.value)
+			if tt.wantErr == "" {
+				assert.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValidateCondition(t *testing.T) {
+	assert.Nil(t, ValidateCondition(""))
+	assert.Nil(t, ValidateCondition("  "))
+	assert.Nil(t, ValidateCondition("in[a] or regex[b+]"))
+	assert.NotNil(t, ValidateCondition("in[a] or"))
+	assert.NotNil(t, ValidateCondition("regex[(]"))
+}
+
+func TestNarrows(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		parent    string
+		want      bool
+	}{
+		{name: "same", condition: "in[a,b]", parent: "in[a,b]", want: true},
+		{name: "any parent", condition: "in[a]", parent: "", want: true},
+		{name: "any", condition: "", parent: "in[a]", want: false},
+		{name: "in subset", condition: "in[b]", parent: "in[a,b,c]", want: true},
+		{name: "in other", condition: "in[b,d]", parent: "in[a,b,c]", want: false},
+		{name: "in by prefix", condition: "in[x-a,b]", parent: "in[b] or prefix[x-]", want: true},
+		{name: "in by regex", condition: "in[v1]", parent: `regex[v\d+]`, want: true},
+		{name: "in by each", condition: "in[mp3]", parent: "each in[mp3,wav]", want: true},
+		{name: "between", condition: "between[2,5]", parent: "between[1,10]", want: true},
+		{name: "between wider", condition: "between[0,5]", parent: "between[1,10]", want: false},
+		{name: "prefix", condition: "prefix[x-a]", parent: "prefix[x-,y-]", want: true},
+		{name: "prefix wider", condition: "prefix[x]", parent: "prefix[x-]", want: false},
+		{name: "each", condition: "each in[mp3]", parent: "each (in[mp3,wav])", want: true},
+		{name: "each to in", condition: "each in[mp3]", parent: "in[mp3]", want: false},
+		{name: "or", condition: "in[a] or between[2,3]", parent: "in[a,b] or between[1,5]", want: true},
+		{name: "or wider", condition: "in[a] or between[2,6]", parent: "in[a,b] or between[1,5]", want: false},
+		{name: "and", condition: "in[a,z] and not in[z]", parent: "in[a,z]", want: true},
+		{name: "parent and", condition: "in[a]", parent: "regex[a+] and not in[b]", want: true},
+		{name: "regex other", condition: "regex[a]", parent: "regex[a+]", want: false},
+		{name: "not", condition: "not in[a]", parent: "not in[a]", want: true},
+		{name: "not wider", condition: "not in[a]", parent: "not in[a,b]", want: false},
+		{name: "wrong", condition: "in[a", parent: "in[a,b]", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Narrows(tt.condition, tt.parent))
+		})
+	}
+}
@@ -69,6 +69,14 @@ func TestValidateValue(t *testing.T) {
 		{name: "Between Fail Str val", args: args{valueCondition: "between[1,3]", value: "vv"}, wantErr: true},
 		{name: "Between Fail condition", args: args{valueCondition: "between[1]", value: "1"}, wantErr: true},
 
+		{name: "Between Float", args: args{valueCondition: "between[0.5,1.5]", value: "1.25"}, wantErr: false},
+		{name: "Between Float Fail", args: args{valueCondition: "between[0.5,1.5]", value: "1.51"}, wantErr: true},
+		{name: "Prefix", args: args{valueCondition: "prefix[x-,y-]", value: "y-olia"}, wantErr: false},
+		{name: "Regex", args: args{valueCondition: `regex[v\d+]`, value: "v12"}, wantErr: false},
+		{name: "Not In", args: args{valueCondition: "not in[1,2]", value: "2"}, wantErr: true},
+		{name: "Or", args: args{valueCondition: "in[1] or between[5,6]", value: "5"}, wantErr: false},
+		{name: "Each", args: args{valueCondition: "each in[mp3,wav]", value: "mp3, wav"}, wantErr: false},
+		{name: "Wrong condition", args: args{valueCondition: "in[1,2", value: "1"}, wantErr: true},
 		{name: "Other", args: args{valueCondition: "ops[1,10000]", value: "1"}, wantErr: true},
 	}
 	for _, tt := range tests {
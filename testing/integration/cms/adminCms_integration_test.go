@@ -2,6 +2,7 @@ package cms
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -148,7 +149,7 @@ func TestCreate_FailIPWhiteList(t *testing.T) {
 
 	key := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 		IPWhiteList: "1.1.1.1/32",
@@ -163,7 +164,7 @@ func TestCreate_OKIPWhiteList(t *testing.T) {
 
 	key := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 		IPWhiteList: "1.1.1.1/32,2.2.2.2/0",
@@ -173,12 +174,41 @@ func TestCreate_OKIPWhiteList(t *testing.T) {
 	checkCode(t, resp, http.StatusCreated)
 }
 
+func TestCreate_OKAllowedOrigins(t *testing.T) {
+	t.Parallel()
+
+	in := &api.CreateInput{ID: ulid.Make().String(), OperationID: ulid.Make().String(), Service: "test", Credits: 100,
+		AllowedOrigins: []string{"https://example.com", "https://*.example.com"}}
+	resp := invoke(t, newRequest(t, http.MethodPost, "/key", in))
+	checkCode(t, resp, http.StatusCreated)
+	var key api.Key
+	decode(t, resp, &key)
+	assert.True(t, key.Publishable)
+
+	res := getKeyInfo(t, key.ID)
+	assert.True(t, res.Publishable)
+	assert.Equal(t, []string{"https://example.com", "https://*.example.com"}, res.AllowedOrigins)
+
+	upd := update(t, key.ID, map[string]interface{}{"allowedOrigins": []string{}})
+	assert.False(t, upd.Publishable)
+	assert.Empty(t, upd.AllowedOrigins)
+}
+
+func TestCreate_FailAllowedOrigins(t *testing.T) {
+	t.Parallel()
+
+	in := &api.CreateInput{ID: ulid.Make().String(), OperationID: ulid.Make().String(), Service: "test", Credits: 100,
+		AllowedOrigins: []string{"*"}}
+	resp := invoke(t, newRequest(t, http.MethodPost, "/key", in))
+	checkCode(t, resp, http.StatusBadRequest)
+}
+
 func TestCreate_OKAllowedTags(t *testing.T) {
 	t.Parallel()
 
 	key := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 		AllowedTags: []string{"x-a:in[1]", "x-b:in[2]"},
@@ -197,7 +227,7 @@ func TestCreate_FailAllowedTags(t *testing.T) {
 
 	key := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 		AllowedTags: []string{"x-a:in[1]", "x-b:in[2]"},
@@ -207,12 +237,53 @@ func TestCreate_FailAllowedTags(t *testing.T) {
 	checkCode(t, resp, http.StatusForbidden)
 }
 
+func TestCreate_OKScopes(t *testing.T) {
+	t.Parallel()
+
+	key := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:      []string{"test"},
+		Permissions:   []string{permission.KeyManager},
+		MaxLimit:      1000,
+		MaxValidTo:    time.Now().AddDate(1, 0, 0),
+		AllowedScopes: []string{"GET tts", "/tts/**"},
+	})
+	in := &api.CreateInput{ID: ulid.Make().String(), OperationID: ulid.Make().String(), Service: "test", Credits: 100, Scopes: []string{"GET tts"}}
+	resp := invoke(t, newRequestWithAuth(t, http.MethodPost, "/key", in, key))
+	checkCode(t, resp, http.StatusCreated)
+	res := api.Key{}
+	decode(t, resp, &res)
+	assert.Equal(t, []string{"GET tts"}, res.Scopes)
+}
+
+func TestCreate_FailScopes(t *testing.T) {
+	t.Parallel()
+
+	key := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:      []string{"test"},
+		Permissions:   []string{permission.KeyManager},
+		MaxLimit:      1000,
+		MaxValidTo:    time.Now().AddDate(1, 0, 0),
+		AllowedScopes: []string{"GET tts"},
+	})
+	in := &api.CreateInput{ID: ulid.Make().String(), OperationID: ulid.Make().String(), Service: "test", Credits: 100, Scopes: []string{"POST tts"}}
+	resp := invoke(t, newRequestWithAuth(t, http.MethodPost, "/key", in, key))
+	checkCode(t, resp, http.StatusForbidden)
+
+	in = &api.CreateInput{ID: ulid.Make().String(), OperationID: ulid.Make().String(), Service: "test", Credits: 100}
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPost, "/key", in, key))
+	checkCode(t, resp, http.StatusForbidden)
+
+	in = &api.CreateInput{ID: ulid.Make().String(), OperationID: ulid.Make().String(), Service: "test", Credits: 100, Scopes: []string{"GOT tts"}}
+	resp = invoke(t, newRequest(t, http.MethodPost, "/key", in))
+	checkCode(t, resp, http.StatusBadRequest)
+}
+
 func TestCreate_FailTagValue(t *testing.T) {
 	t.Parallel()
 
 	key := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 		AllowedTags: []string{"x-a:in[1,aaa]", "x-b:in[2]"},
@@ -227,7 +298,7 @@ func TestCreate_FailWrongProject(t *testing.T) {
 
 	key := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"tts"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 	})
@@ -344,7 +415,7 @@ func TestAddCredits_FailOther(t *testing.T) {
 
 	lKey := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 	})
@@ -378,7 +449,7 @@ func TestGet_FailOther(t *testing.T) {
 
 	lKey := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 	})
@@ -576,7 +647,7 @@ func TestUpdate_FailOtherUser(t *testing.T) {
 
 	lKey := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 	})
@@ -591,7 +662,7 @@ func TestUpdate_OKAllowedTags(t *testing.T) {
 
 	lKey := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 		AllowedTags: []string{"x-a:in[1,b]", "x-b:in[2]"},
@@ -612,7 +683,7 @@ func TestUpdate_FailAllowedTags(t *testing.T) {
 
 	lKey := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 	})
@@ -633,7 +704,7 @@ func TestUpdate_FailTagValue(t *testing.T) {
 
 	lKey := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 		AllowedTags: []string{"x-a:in[1,b]", "x-b:between[1,1000]"},
@@ -710,6 +781,66 @@ func TestChangeKey_OK(t *testing.T) {
 	assert.Equal(t, key.Service, resKey.Service)
 }
 
+func TestChangeKey_OKGrace(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	old := key.Key
+	now := time.Now()
+
+	resp := invoke(t, newRequest(t, http.MethodPost, fmt.Sprintf("/key/%s/change?grace=24h", key.ID), nil))
+	checkCode(t, resp, http.StatusOK)
+	nKey := api.Key{}
+	decode(t, resp, &nKey)
+	assert.NotEqual(t, old, nKey.Key)
+	require.NotNil(t, nKey.OldKeyValidTo)
+
+	newCallService(t, old, 10, http.StatusOK)
+	newCallService(t, nKey.Key, 10, http.StatusOK)
+	info := getKeyInfo(t, key.ID)
+	assert.Equal(t, 20.0, info.UsedCredits)
+	require.NotNil(t, info.OldKeyValidTo)
+
+	resp = invoke(t, newRequest(t, http.MethodPost, "/keyID", api.Key{Key: old}))
+	checkCode(t, resp, http.StatusOK)
+	resKey := api.KeyID{}
+	decode(t, resp, &resKey)
+	assert.Equal(t, key.ID, resKey.ID)
+
+	resp = invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/key/%s/usage?from=%s&to=%s&full=1", key.ID,
+		test.TimeToQueryStr(now.Add(-time.Hour)), test.TimeToQueryStr(time.Now().Add(time.Second))), nil))
+	checkCode(t, resp, http.StatusOK)
+	usage := api.Usage{}
+	decode(t, resp, &usage)
+	require.Len(t, usage.Logs, 2)
+	assert.True(t, usage.Logs[0].OldKey)
+	assert.False(t, usage.Logs[1].OldKey)
+
+	resp = invoke(t, newRequest(t, http.MethodPost, fmt.Sprintf("/key/%s/change/end", key.ID), nil))
+	checkCode(t, resp, http.StatusOK)
+	eKey := api.Key{}
+	decode(t, resp, &eKey)
+	assert.Nil(t, eKey.OldKeyValidTo)
+
+	newCallService(t, old, 10, http.StatusUnauthorized)
+	newCallService(t, nKey.Key, 10, http.StatusOK)
+}
+
+func TestKeyFormat_OK(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	assert.True(t, strings.HasPrefix(key.Key, "dm_test_"), key.Key)
+	newCallService(t, key.Key, 10, http.StatusOK)
+
+	last := key.Key[len(key.Key)-1:]
+	wrong := "a"
+	if last == wrong {
+		wrong = "b"
+	}
+	newCallService(t, key.Key[:len(key.Key)-1]+wrong, 10, http.StatusUnauthorized)
+}
+
 func TestChangeKey_FailNonManual(t *testing.T) {
 	t.Parallel()
 
@@ -827,6 +958,50 @@ func TestUsage_OKNoLog(t *testing.T) {
 	assert.Len(t, res.Logs, 0)
 }
 
+func TestUsage_FailRange(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	now := time.Now()
+
+	resp := invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/key/%s/usage?from=%s&to=%s", key.ID,
+		test.TimeToQueryStr(now.AddDate(-2, 0, 0)), test.TimeToQueryStr(now)), nil))
+	checkCode(t, resp, http.StatusBadRequest)
+}
+
+func TestUsage_FailTooManyLogs(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		newCallService(t, key.Key, 10, http.StatusOK)
+	}
+
+	resp := invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/key/%s/usage?from=%s&to=%s&full=1&limit=2", key.ID,
+		test.TimeToQueryStr(now.Add(-time.Hour)), test.TimeToQueryStr(now.Add(time.Second))), nil))
+	checkCode(t, resp, http.StatusBadRequest)
+}
+
+func TestUsage_OKLongRange(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		newCallService(t, key.Key, 10, http.StatusOK)
+	}
+
+	resp := invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/key/%s/usage?from=%s&to=%s&full=1", key.ID,
+		test.TimeToQueryStr(now.AddDate(0, 0, -3).Add(-time.Hour)), test.TimeToQueryStr(now.AddDate(0, 0, 2))), nil))
+	checkCode(t, resp, http.StatusOK)
+	res := api.Usage{}
+	decode(t, resp, &res)
+	assert.Equal(t, 3, res.RequestCount)
+	assert.Equal(t, 30.0, res.UsedCredits)
+	assert.Len(t, res.Logs, 3)
+}
+
 func TestUsage_FailNoAuth(t *testing.T) {
 	t.Parallel()
 
@@ -940,6 +1115,80 @@ func TestStats_OKDate(t *testing.T) {
 	checkCode(t, resp, http.StatusOK)
 }
 
+func TestStats_OKHourly(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	addCredits(t, key, 1000)
+
+	for i := 0; i < 3; i++ {
+		newCallService(t, key.Key, 10, http.StatusOK)
+	}
+
+	resp := invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/key/%s/stats?type=hourly", key.ID), nil))
+	checkCode(t, resp, http.StatusOK)
+	res := []*api.Bucket{}
+	decode(t, resp, &res)
+	require.Len(t, res, 1)
+	assert.Equal(t, 3, res[0].RequestCount)
+	assert.Equal(t, 30.0, res[0].UsedQuota)
+	assert.Equal(t, time.Now().UTC().Truncate(time.Hour), res[0].At.UTC())
+}
+
+func TestStats_OKTimeZone(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	addCredits(t, key, 1000)
+	newCallService(t, key.Key, 10, http.StatusOK)
+
+	loc, err := time.LoadLocation("America/New_York")
+	require.Nil(t, err)
+	resp := invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/key/%s/stats?type=daily&tz=America/New_York", key.ID), nil))
+	checkCode(t, resp, http.StatusOK)
+	res := []*api.Bucket{}
+	decode(t, resp, &res)
+	require.Len(t, res, 1)
+	assert.Equal(t, 1, res[0].RequestCount)
+	y, m, d := time.Now().In(loc).Date()
+	assert.True(t, time.Date(y, m, d, 0, 0, 0, 0, loc).Equal(res[0].At))
+}
+
+func TestStats_OKGroupBy(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	addCredits(t, key, 400)
+
+	for i := 0; i < 2; i++ {
+		newCallService(t, key.Key, 50, http.StatusOK)
+	}
+	for i := 0; i < 3; i++ {
+		newCallService(t, key.Key, 10, http.StatusForbidden)
+	}
+
+	resp := invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/key/%s/stats?type=daily&groupBy=code,route", key.ID), nil))
+	checkCode(t, resp, http.StatusOK)
+	res := []*api.Bucket{}
+	decode(t, resp, &res)
+	require.Len(t, res, 2)
+	assert.Equal(t, "2xx", res[0].CodeClass)
+	assert.Equal(t, "test", res[0].Route)
+	assert.Equal(t, 2, res[0].RequestCount)
+	assert.Equal(t, "4xx", res[1].CodeClass)
+	assert.Equal(t, 3, res[1].RequestCount)
+	assert.Equal(t, 3, res[1].FailedRequests)
+}
+
+func TestStats_FailTimeZone(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+
+	resp := invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/key/%s/stats?type=daily&tz=Olia/Olia", key.ID), nil))
+	checkCode(t, resp, http.StatusBadRequest)
+}
+
 func TestStats_FailNoAuth(t *testing.T) {
 	t.Parallel()
 
@@ -955,7 +1204,7 @@ func TestStats_FailOtherUser(t *testing.T) {
 	key := newKey(t)
 	lKey := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 	})
@@ -969,7 +1218,7 @@ func TestStats_OKNonSuperUser(t *testing.T) {
 
 	lKey := newAdminKey(t, &integration.InsertAdminParams{
 		Projects:    []string{"test"},
-		Permissions: []string{},
+		Permissions: []string{permission.KeyManager},
 		MaxLimit:    1000,
 		MaxValidTo:  time.Now().AddDate(1, 0, 0),
 	})
@@ -980,6 +1229,501 @@ func TestStats_OKNonSuperUser(t *testing.T) {
 	checkCode(t, resp, http.StatusOK)
 }
 
+func newStatsAdmin(t *testing.T) (string, *api.Key, *api.Key) {
+	t.Helper()
+
+	lKey := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:    []string{"test"},
+		Permissions: []string{permission.KeyManager},
+		MaxLimit:    1000,
+		MaxValidTo:  time.Now().AddDate(1, 0, 0),
+	})
+	key1 := newKeyWithAuth(t, lKey)
+	key2 := newKeyWithAuth(t, lKey)
+	for i := 0; i < 2; i++ {
+		newCallService(t, key1.Key, 50, http.StatusOK)
+	}
+	newCallService(t, key2.Key, 10, http.StatusOK)
+	return lKey, key1, key2
+}
+
+func TestProjectStats_OK(t *testing.T) {
+	t.Parallel()
+
+	lKey, _, _ := newStatsAdmin(t)
+
+	resp := invoke(t, newRequestWithAuth(t, http.MethodGet, "/stats?type=daily&service=test", nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	res := []*api.Bucket{}
+	decode(t, resp, &res)
+	require.Len(t, res, 1)
+	assert.Equal(t, 3, res[0].RequestCount)
+	assert.Equal(t, 110.0, res[0].UsedQuota)
+
+	resp = invoke(t, newRequestWithAuth(t, http.MethodGet, "/stats?type=monthly", nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	res = []*api.Bucket{}
+	decode(t, resp, &res)
+	require.Len(t, res, 1)
+	assert.Equal(t, 3, res[0].RequestCount)
+}
+
+func TestProjectStats_FailOtherProject(t *testing.T) {
+	t.Parallel()
+
+	lKey, _, _ := newStatsAdmin(t)
+
+	resp := invoke(t, newRequestWithAuth(t, http.MethodGet, "/stats?type=daily&service=tts", nil, lKey))
+	checkCode(t, resp, http.StatusForbidden)
+}
+
+func TestTopKeys_OK(t *testing.T) {
+	t.Parallel()
+
+	lKey, key1, key2 := newStatsAdmin(t)
+
+	resp := invoke(t, newRequestWithAuth(t, http.MethodGet, "/stats/top?limit=5", nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	res := []*api.KeyStat{}
+	decode(t, resp, &res)
+	require.Len(t, res, 2)
+	assert.Equal(t, key1.ID, res[0].ID)
+	assert.Equal(t, 100.0, res[0].UsedQuota)
+	assert.Equal(t, key2.ID, res[1].ID)
+	assert.Equal(t, 10.0, res[1].UsedQuota)
+}
+
+func TestExhaustedKeys_OK(t *testing.T) {
+	t.Parallel()
+
+	lKey, key1, _ := newStatsAdmin(t)
+
+	resp := invoke(t, newRequestWithAuth(t, http.MethodGet, "/stats/exhausted", nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	res := []*api.Key{}
+	decode(t, resp, &res)
+	require.Len(t, res, 1)
+	assert.Equal(t, key1.ID, res[0].ID)
+	assert.Empty(t, res[0].Key)
+}
+
+func TestAdmins_OKCreateRotateDisable(t *testing.T) {
+	t.Parallel()
+
+	resp := invoke(t, newRequest(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "partner",
+		Projects: []string{"test"}, Permissions: []string{permission.KeyManager}, MaxLimit: 1000}))
+	checkCode(t, resp, http.StatusCreated)
+	adm := adminapi.Administrator{}
+	decode(t, resp, &adm)
+	require.NotEmpty(t, adm.Key)
+	newKeyWithAuth(t, adm.Key)
+
+	resp = invoke(t, newRequest(t, http.MethodGet, "/admins/"+adm.ID, nil))
+	checkCode(t, resp, http.StatusOK)
+	got := adminapi.Administrator{}
+	decode(t, resp, &got)
+	assert.Equal(t, "partner", got.Name)
+	assert.Empty(t, got.Key)
+
+	resp = invoke(t, newRequest(t, http.MethodPost, "/admins/"+adm.ID+"/rotate", nil))
+	checkCode(t, resp, http.StatusOK)
+	rotated := adminapi.Administrator{}
+	decode(t, resp, &rotated)
+	require.NotEmpty(t, rotated.Key)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodGet, "/stats/exhausted", nil, adm.Key))
+	checkCode(t, resp, http.StatusUnauthorized)
+	newKeyWithAuth(t, rotated.Key)
+
+	disabled := true
+	resp = invoke(t, newRequest(t, http.MethodPatch, "/admins/"+adm.ID, adminapi.AdministratorUpdate{Disabled: &disabled}))
+	checkCode(t, resp, http.StatusOK)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodGet, "/stats/exhausted", nil, rotated.Key))
+	checkCode(t, resp, http.StatusUnauthorized)
+}
+
+func TestAdmins_FailNoPermission(t *testing.T) {
+	t.Parallel()
+
+	lKey := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:    []string{"test"},
+		Permissions: []string{},
+		MaxLimit:    1000,
+		MaxValidTo:  time.Now().AddDate(1, 0, 0),
+	})
+	resp := invoke(t, newRequestWithAuth(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "partner",
+		Projects: []string{"test"}}, lKey))
+	checkCode(t, resp, http.StatusForbidden)
+}
+
+func TestAdmins_FailGrantMore(t *testing.T) {
+	t.Parallel()
+
+	lKey := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:    []string{"test"},
+		Permissions: []string{"AdminManage"},
+		MaxLimit:    1000,
+		MaxValidTo:  time.Now().AddDate(1, 0, 0),
+	})
+	resp := invoke(t, newRequestWithAuth(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "partner",
+		Projects: []string{"test"}, Permissions: []string{"Everything"}}, lKey))
+	checkCode(t, resp, http.StatusForbidden)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "partner",
+		Projects: []string{"tts"}}, lKey))
+	checkCode(t, resp, http.StatusForbidden)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "partner",
+		Projects: []string{"test"}, MaxLimit: 2000}, lKey))
+	checkCode(t, resp, http.StatusBadRequest)
+}
+
+func TestAdmins_FailAllowedTagCondition(t *testing.T) {
+	t.Parallel()
+
+	resp := invoke(t, newRequest(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "partner",
+		Projects: []string{"test"}, AllowedTags: []string{"x-a:in[1,2"}}))
+	checkCode(t, resp, http.StatusBadRequest)
+	resp = invoke(t, newRequest(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "partner",
+		Projects: []string{"test"}, AllowedTags: []string{"x-a:not in[1] and regex[\\d+]"}}))
+	checkCode(t, resp, http.StatusCreated)
+}
+
+func TestAdmins_OKParentSeesChildKeys(t *testing.T) {
+	t.Parallel()
+
+	lKey := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:    []string{"test"},
+		Permissions: []string{"AdminManage", permission.KeyManager},
+		MaxLimit:    1000,
+		MaxValidTo:  time.Now().AddDate(1, 0, 0),
+	})
+	resp := invoke(t, newRequestWithAuth(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "child",
+		Projects: []string{"test"}, Permissions: []string{permission.KeyManager}, MaxLimit: 500}, lKey))
+	checkCode(t, resp, http.StatusCreated)
+	child := adminapi.Administrator{}
+	decode(t, resp, &child)
+	key := newKeyWithAuth(t, child.Key)
+
+	resp = invoke(t, newRequestWithAuth(t, http.MethodGet, "/key/"+key.ID, nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodGet, "/admins", nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	var admins []*adminapi.Administrator
+	decode(t, resp, &admins)
+	require.Len(t, admins, 1)
+	assert.Equal(t, child.ID, admins[0].ID)
+
+	disabled := true
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPatch, "/admins/"+child.ID, adminapi.AdministratorUpdate{Disabled: &disabled}, child.Key))
+	checkCode(t, resp, http.StatusForbidden)
+}
+
+func TestAdmins_FailBudget(t *testing.T) {
+	t.Parallel()
+
+	resp := invoke(t, newRequest(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "partner",
+		Projects: []string{"test"}, Permissions: []string{"AdminManage", permission.KeyManager}, MaxLimit: 1000,
+		Budgets: []*adminapi.Budget{{Project: "test", Limit: 150, Period: "daily"}}}))
+	checkCode(t, resp, http.StatusCreated)
+	adm := adminapi.Administrator{}
+	decode(t, resp, &adm)
+
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "child",
+		Projects: []string{"test"}, MaxLimit: 1000,
+		Budgets: []*adminapi.Budget{{Project: "test", Limit: 200, Period: "daily"}}}, adm.Key))
+	checkCode(t, resp, http.StatusBadRequest)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPost, "/admins", adminapi.AdministratorInput{Name: "child",
+		Projects: []string{"test"}, MaxLimit: 1000,
+		Budgets: []*adminapi.Budget{{Project: "test", Limit: 120, Period: "daily"}}, Permissions: []string{permission.KeyManager}}, adm.Key))
+	checkCode(t, resp, http.StatusCreated)
+	child := adminapi.Administrator{}
+	decode(t, resp, &child)
+
+	newKeyWithAuth(t, child.Key)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPost, "/key", &api.CreateInput{ID: ulid.Make().String(),
+		OperationID: ulid.Make().String(), Service: "test", Credits: 100}, adm.Key))
+	checkCode(t, resp, http.StatusBadRequest)
+
+	resp = invoke(t, newRequest(t, http.MethodGet, "/admins/"+adm.ID, nil))
+	checkCode(t, resp, http.StatusOK)
+	got := adminapi.Administrator{}
+	decode(t, resp, &got)
+	require.Len(t, got.Budgets, 1)
+	assert.Equal(t, 100.0, got.Budgets[0].Used)
+}
+
+func TestPermissions_FailReadOnly(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	lKey := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:    []string{"test"},
+		Permissions: []string{permission.ReadOnly},
+		MaxLimit:    1000,
+		MaxValidTo:  time.Now().AddDate(1, 0, 0),
+	})
+	resp := invoke(t, newRequestWithAuth(t, http.MethodPost, "/key", &api.CreateInput{ID: ulid.Make().String(),
+		OperationID: ulid.Make().String(), Service: "test", Credits: 100}, lKey))
+	checkCode(t, resp, http.StatusForbidden)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPatch, fmt.Sprintf("/key/%s/credits", key.ID),
+		api.CreditsInput{OperationID: ulid.Make().String(), Credits: 10}, lKey))
+	checkCode(t, resp, http.StatusForbidden)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodGet, "/stats/exhausted", nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+}
+
+func TestKeys_OKList(t *testing.T) {
+	t.Parallel()
+
+	lKey := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:    []string{"test"},
+		Permissions: []string{permission.KeyManager},
+		MaxLimit:    1000,
+		MaxValidTo:  time.Now().AddDate(1, 0, 0),
+	})
+	desc := ulid.Make().String()
+	for i := 0; i < 3; i++ {
+		newKeyInputWithAuth(t, &api.CreateInput{ID: ulid.Make().String(), OperationID: ulid.Make().String(), Service: "test",
+			Credits: float64(10 * (i + 1)), Description: desc, Tags: []string{"plan:gold"}}, lKey)
+	}
+	newKeyWithAuth(t, lKey)
+
+	var all []*adminapi.Key
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		resp := invoke(t, newRequestWithAuth(t, http.MethodGet,
+			fmt.Sprintf("/test/key?q=%s&tag=plan&sort=-remaining&limit=2&cursor=%s", desc, cursor), nil, lKey))
+		checkCode(t, resp, http.StatusOK)
+		res := adminapi.KeyListResp{}
+		decode(t, resp, &res)
+		all = append(all, res.Keys...)
+		cursor = res.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+	require.Len(t, all, 3)
+	for i, k := range all {
+		assert.Empty(t, k.Key)
+		assert.Equal(t, desc, k.Description)
+		assert.Equal(t, float64(10*(3-i)), k.Limit)
+	}
+
+	resp := invoke(t, newRequestWithAuth(t, http.MethodGet, fmt.Sprintf("/test/key?q=%s&remainingMin=15", desc), nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	res := adminapi.KeyListResp{}
+	decode(t, resp, &res)
+	assert.Len(t, res.Keys, 2)
+}
+
+func TestArchive_OK(t *testing.T) {
+	t.Parallel()
+
+	lKey := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:    []string{"test"},
+		Permissions: []string{permission.KeyManager},
+		MaxLimit:    1000,
+		MaxValidTo:  time.Now().AddDate(1, 0, 0),
+	})
+	desc := ulid.Make().String()
+	key := newKeyInputWithAuth(t, &api.CreateInput{ID: ulid.Make().String(), OperationID: ulid.Make().String(), Service: "test",
+		Credits: 100, Description: desc}, lKey)
+	newCallService(t, key.Key, 10, http.StatusOK)
+
+	for i := 0; i < 2; i++ {
+		resp := invoke(t, newRequestWithAuth(t, http.MethodPost, fmt.Sprintf("/key/%s/archive", key.ID), nil, lKey))
+		checkCode(t, resp, http.StatusOK)
+		res := api.Key{}
+		decode(t, resp, &res)
+		assert.NotNil(t, res.Archived)
+	}
+	newCallService(t, key.Key, 10, http.StatusUnauthorized)
+
+	resp := invoke(t, newRequestWithAuth(t, http.MethodGet, fmt.Sprintf("/test/key?q=%s", desc), nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	list := adminapi.KeyListResp{}
+	decode(t, resp, &list)
+	assert.Empty(t, list.Keys)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodGet, fmt.Sprintf("/test/key?q=%s&archived=true", desc), nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	decode(t, resp, &list)
+	require.Len(t, list.Keys, 1)
+	assert.Equal(t, key.ID, list.Keys[0].ID)
+
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPatch, fmt.Sprintf("/key/%s", key.ID), api.UpdateInput{Description: &desc}, lKey))
+	checkCode(t, resp, http.StatusBadRequest)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodPatch, fmt.Sprintf("/key/%s/credits", key.ID),
+		api.CreditsInput{OperationID: ulid.Make().String(), Credits: 10}, lKey))
+	checkCode(t, resp, http.StatusBadRequest)
+
+	resp = invoke(t, newRequest(t, http.MethodPost, fmt.Sprintf("/test/purge?before=%s", test.TimeToQueryStr(time.Now())), nil))
+	checkCode(t, resp, http.StatusOK)
+	resp = invoke(t, newRequestWithAuth(t, http.MethodGet, fmt.Sprintf("/key/%s", key.ID), nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	info := api.Key{}
+	decode(t, resp, &info)
+	assert.Empty(t, info.LastIP)
+	assert.Equal(t, 10.0, info.UsedCredits)
+}
+
+func TestArchive_FailPurgeNoPermission(t *testing.T) {
+	t.Parallel()
+
+	lKey := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:    []string{"test"},
+		Permissions: []string{permission.KeyManager},
+		MaxLimit:    1000,
+		MaxValidTo:  time.Now().AddDate(1, 0, 0),
+	})
+	resp := invoke(t, newRequestWithAuth(t, http.MethodPost, fmt.Sprintf("/test/purge?before=%s", test.TimeToQueryStr(time.Now())), nil, lKey))
+	checkCode(t, resp, http.StatusForbidden)
+}
+
+func TestHashReport_OK(t *testing.T) {
+	t.Parallel()
+
+	newKey(t)
+	resp := invoke(t, newRequest(t, http.MethodGet, "/hash/report", nil))
+	checkCode(t, resp, http.StatusOK)
+	res := adminapi.HashReport{}
+	decode(t, resp, &res)
+	assert.Equal(t, 1, res.CurrentVersion)
+	require.NotEmpty(t, res.Keys)
+	assert.Equal(t, 1, res.Keys[0].Version)
+	assert.True(t, res.Keys[0].Count > 0)
+	assert.Equal(t, int64(0), res.Legacy)
+}
+
+func TestBulk_OKCreateDisable(t *testing.T) {
+	t.Parallel()
+
+	ops := []string{ulid.Make().String(), ulid.Make().String()}
+	csvIn := fmt.Sprintf("operationID,service,credits,tags\n%s,test,10,a:1\n%s,test,20,\n", ops[0], ops[1])
+	req := newRequestFull(t, http.MethodPost, cfg.url+"/keys/bulk/create?format=csv", nil)
+	req.Body = io.NopCloser(strings.NewReader(csvIn))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	resp := invoke(t, integration.AddAdmAuth(req))
+	checkCode(t, resp, http.StatusOK)
+	recs, err := csv.NewReader(resp.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, recs, 3)
+	var items []*api.BulkItem
+	for _, r := range recs[1:] {
+		assert.Equal(t, "ok", r[3])
+		require.NotEmpty(t, r[5])
+		newCallService(t, r[5], 5, http.StatusOK)
+		items = append(items, &api.BulkItem{ID: r[1], OperationID: ulid.Make().String()})
+	}
+
+	resp = invoke(t, newRequest(t, http.MethodPost, "/keys/bulk/disable", items))
+	checkCode(t, resp, http.StatusOK)
+	res := api.BulkResult{}
+	decode(t, resp, &res)
+	assert.Equal(t, 2, res.OK)
+	resp = invoke(t, newRequest(t, http.MethodPost, "/keys/bulk/disable", items))
+	checkCode(t, resp, http.StatusOK)
+	res = api.BulkResult{}
+	decode(t, resp, &res)
+	assert.Equal(t, api.BulkStatusExists, res.Items[0].Status)
+	assert.True(t, getKeyInfo(t, items[0].ID).Disabled)
+}
+
+func TestBulk_FailAtomic(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	items := []*api.BulkItem{{ID: key.ID, OperationID: ulid.Make().String(), Credits: 10},
+		{ID: ulid.Make().String(), OperationID: ulid.Make().String(), Credits: 10}}
+	resp := invoke(t, newRequest(t, http.MethodPost, "/keys/bulk/credits", items))
+	checkCode(t, resp, http.StatusBadRequest)
+	res := api.BulkResult{}
+	decode(t, resp, &res)
+	require.Len(t, res.Items, 2)
+	assert.Equal(t, api.BulkStatusRolledBack, res.Items[0].Status)
+	assert.Equal(t, api.BulkStatusFailed, res.Items[1].Status)
+
+	resp = invoke(t, newRequest(t, http.MethodPost, "/keys/bulk/credits?mode=partial", items))
+	checkCode(t, resp, http.StatusOK)
+	res = api.BulkResult{}
+	decode(t, resp, &res)
+	assert.Equal(t, 1, res.OK)
+	assert.Equal(t, 1, res.Failed)
+}
+
+func TestLogs_OKPaging(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	addCredits(t, key, 1000)
+	for i := 0; i < 5; i++ {
+		newCallService(t, key.Key, 10, http.StatusOK)
+	}
+
+	var all []*adminapi.Log
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		resp := invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/test/log?keyID=%s&limit=2&cursor=%s", key.ID, cursor), nil))
+		checkCode(t, resp, http.StatusOK)
+		res := adminapi.LogListResp{}
+		decode(t, resp, &res)
+		all = append(all, res.Logs...)
+		cursor = res.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+	require.Len(t, all, 5)
+	for i, l := range all {
+		assert.Equal(t, key.ID, l.KeyID)
+		assert.Equal(t, 10.0, l.QuotaValue)
+		if i > 0 {
+			assert.False(t, l.Date.Before(all[i-1].Date))
+		}
+	}
+}
+
+func TestLogs_OKStream(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	addCredits(t, key, 1000)
+	for i := 0; i < 3; i++ {
+		newCallService(t, key.Key, 10, http.StatusOK)
+	}
+
+	resp := invoke(t, newRequest(t, http.MethodGet, fmt.Sprintf("/test/log?keyID=%s&format=ndjson", key.ID), nil))
+	checkCode(t, resp, http.StatusOK)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 3)
+	for _, l := range lines {
+		res := adminapi.Log{}
+		require.NoError(t, json.Unmarshal([]byte(l), &res))
+		assert.Equal(t, key.ID, res.KeyID)
+	}
+}
+
+func TestLogs_OtherUserSeesNothing(t *testing.T) {
+	t.Parallel()
+
+	key := newKey(t)
+	newCallService(t, key.Key, 10, http.StatusOK)
+	lKey := newAdminKey(t, &integration.InsertAdminParams{
+		Projects:    []string{"test"},
+		Permissions: []string{permission.KeyManager},
+		MaxLimit:    1000,
+		MaxValidTo:  time.Now().AddDate(1, 0, 0),
+	})
+
+	resp := invoke(t, newRequestWithAuth(t, http.MethodGet, fmt.Sprintf("/test/log?keyID=%s", key.ID), nil, lKey))
+	checkCode(t, resp, http.StatusOK)
+	res := adminapi.LogListResp{}
+	decode(t, resp, &res)
+	assert.Len(t, res.Logs, 0)
+
+	resp = invoke(t, newRequestWithAuth(t, http.MethodGet, "/tts/log", nil, lKey))
+	checkCode(t, resp, http.StatusForbidden)
+}
+
 func TestHasTraceparent(t *testing.T) {
 	t.Parallel()
 
@@ -46,14 +46,15 @@ func InsertIPKey(t *testing.T, db *sqlx.DB, project string) string {
 }
 
 type InsertAdminParams struct {
-	Projects    []string
-	KeyHash     string
-	Permissions []string
-	MaxLimit    float64
-	MaxValidTo  time.Time
-	Disabled    bool
-	IPWhiteList string
-	AllowedTags []string
+	Projects      []string
+	KeyHash       string
+	Permissions   []string
+	MaxLimit      float64
+	MaxValidTo    time.Time
+	Disabled      bool
+	IPWhiteList   string
+	AllowedTags   []string
+	AllowedScopes []string
 }
 
 func InsertAdmin(t *testing.T, db *sqlx.DB, params *InsertAdminParams) {
@@ -62,11 +63,12 @@ func InsertAdmin(t *testing.T, db *sqlx.DB, params *InsertAdminParams) {
 	now := time.Now()
 	_, err := db.Exec(`
 		INSERT INTO administrators
-			(id, key_hash, projects, max_valid_to, max_limit, name, created, updated, permissions, ip_white_list, allowed_tags)
+			(id, key_hash, projects, max_valid_to, max_limit, name, created, updated, permissions, ip_white_list, allowed_tags,
+			allowed_scopes)
 		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $7, $8, $9, $10)
+			($1, $2, $3, $4, $5, $6, $7, $7, $8, $9, $10, $11)
 		`, ulid.Make().String(), params.KeyHash, pq.Array(params.Projects), params.MaxValidTo, params.MaxLimit, "test", now, pq.Array(params.Permissions), params.IPWhiteList,
-		pq.Array(params.AllowedTags))
+		pq.Array(params.AllowedTags), pq.Array(params.AllowedScopes))
 	require.NoError(t, err)
 }
 